@@ -25,6 +25,14 @@ type Controller struct {
 	name      string
 }
 
+// updateEvent is queued for updates so the handler gets both versions of the object
+// the other events are queued by key and the object is read from the indexer
+type updateEvent struct {
+	key    string
+	oldObj interface{}
+	newObj interface{}
+}
+
 // Run is the main path of execution for the controller loop
 func (c *Controller) Run(stopCh <-chan struct{}) {
 	// handle a panic with logging and exiting
@@ -70,7 +78,7 @@ func (c *Controller) runWorker() {
 
 // processNextItem retrieves each queued item and takes the
 // necessary handler action based off of if the item was
-// created or deleted
+// created, updated or deleted
 func (c *Controller) processNextItem() bool {
 	log.Infof("%sController.processNextItem: start", c.name)
 
@@ -88,6 +96,19 @@ func (c *Controller) processNextItem() bool {
 
 	defer c.queue.Done(key)
 
+	// updates carry the old and new object, the handler sends the changed fields
+	if update, ok := key.(updateEvent); ok {
+		// objects deleted since the update are left to the delete event
+		if _, exists, _ := c.informer.GetIndexer().GetByKey(update.key); exists {
+			c.logger.Infof("%sController.processNextItem: object updated detected: %s", c.name, update.key)
+			if err := c.handler.ObjectUpdated(update.oldObj, update.newObj); err != nil {
+				c.logger.Errorf("%sController.processNextItem: Failed updating %s: %v", c.name, update.key, err)
+			}
+		}
+		c.queue.Forget(key)
+		return true
+	}
+
 	// assert the string out of the key (format `namespace/name`)
 	keyRaw := key.(string)
 
@@ -116,23 +137,24 @@ func (c *Controller) processNextItem() bool {
 
 	// if the item doesn't exist then it was deleted and we need to fire off the handler's
 	// ObjectDeleted method. but if the object does exist that indicates that the object
-	// was created (or updated) so run the ObjectCreated method
+	// was created so run the ObjectCreated method
 	//
 	// after both instances, we want to forget the key from the queue, as this indicates
 	// a code path of successful queue key processing
 	if !exists {
 		c.logger.Infof("%sController.processNextItem: object deleted detected: %s", c.name, keyRaw)
-		c.handler.ObjectDeleted(item, keyRaw) // TODO: make this check for the error
-		c.queue.Forget(key)                   // TODO: forget if no error, otherwise put back in queue and try again
+		// requests which fail because the rest service is unavailable are kept in the outbound buffer
+		// errors are objects which can't be sent, retrying them wouldn't help
+		if err := c.handler.ObjectDeleted(item, keyRaw); err != nil {
+			c.logger.Errorf("%sController.processNextItem: Failed deleting %s: %v", c.name, keyRaw, err)
+		}
+		c.queue.Forget(key)
 	} else {
 		c.logger.Infof("%sController.processNextItem: object created detected: %s", c.name, keyRaw)
 		//c.logger.Infof("%sController.processNextItem: %s %s ", c.name, item, reflect.TypeOf(item))
-		if item == nil {
-			c.handler.ObjectUpdated(item, item)
-		} else {
-			c.handler.ObjectCreated(item)
+		if err := c.handler.ObjectCreated(item); err != nil {
+			c.logger.Errorf("%sController.processNextItem: Failed creating %s: %v", c.name, keyRaw, err)
 		}
-		// c.handler.ObjectCreated(item)
 		c.queue.Forget(key)
 	}
 
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/cache"
+)
+
+// OutboundBuffer keeps the objects which couldn't be sent until the rest service is available again
+// objects are sent without it if nil
+var OutboundBuffer *Buffer
+
+// compactRecords is the number of records the log grows to before it's rewritten with the pending entries only
+const compactRecords = 1000
+
+// BufferEntry is a request waiting to be sent to the rest service
+type BufferEntry struct {
+	Seq uint64 `json:"seq"`
+	// Key identifies the object, e.g. pod:default/pod01, a newer entry for the same object replaces the pending one
+	Key    string          `json:"key"`
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+// bufferRecord is a line of the log, an entry to send or the seq of a sent entry
+type bufferRecord struct {
+	Put *BufferEntry `json:"put,omitempty"`
+	Ack uint64       `json:"ack,omitempty"`
+}
+
+// Buffer is a write-ahead log of the creates and deletes which couldn't be sent to the rest service
+// the entries are kept in a file so that they survive restarts and are replayed in order by Run
+type Buffer struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	entries []*BufferEntry
+	seq     uint64
+	records int
+}
+
+// NewBuffer opens the log at path and loads the entries which weren't sent yet
+func NewBuffer(path string) (*Buffer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	b := &Buffer{path: path}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	b.file = file
+	if len(b.entries) > 0 {
+		log.Infof("%d pending requests loaded from %s", len(b.entries), path)
+	}
+	return b, nil
+}
+
+// load replays the records of the log
+func (b *Buffer) load() error {
+	file, err := os.Open(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		record := bufferRecord{}
+		// the last line is cut if the controller stopped while writing it
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Warnf("skipping invalid record in %s: %v", b.path, err)
+			continue
+		}
+		b.records++
+		if record.Put != nil {
+			b.put(record.Put)
+			if record.Put.Seq > b.seq {
+				b.seq = record.Put.Seq
+			}
+		} else {
+			b.ack(record.Ack)
+		}
+	}
+	return scanner.Err()
+}
+
+// Close closes the log, the entries are loaded again by NewBuffer
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.file.Close()
+}
+
+// Len returns the number of entries waiting to be sent
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+// Age returns how long the oldest entry has been waiting, 0 if there is none
+func (b *Buffer) Age() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) == 0 {
+		return 0
+	}
+	return time.Since(b.entries[0].Time)
+}
+
+// Metrics returns the depth and age of the buffer as prometheus gauges
+func (b *Buffer) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "katlas_collector_buffer_depth",
+			Help: "Number of requests waiting in the outbound buffer of the collector",
+		}, func() float64 { return float64(b.Len()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "katlas_collector_buffer_age_seconds",
+			Help: "Time the oldest request has been waiting in the outbound buffer of the collector",
+		}, func() float64 { return b.Age().Seconds() }),
+	}
+}
+
+// Send sends the request to the rest service, it's written to the log if the service is unavailable
+// requests are buffered while others are pending so that they are sent in order
+func (b *Buffer) Send(key string, method string, url string, obj interface{}) error {
+	var body []byte
+	if obj != nil {
+		var err error
+		if body, err = marshalObject(obj); err != nil {
+			return err
+		}
+	}
+	if b.Len() == 0 {
+		status, _ := sendRequest(method, url, body)
+		if !retryable(status) {
+			return statusError(method, url, status)
+		}
+	}
+	return b.Put(&BufferEntry{Key: key, Method: method, URL: url, Body: body, Time: time.Now()})
+}
+
+// Put writes the entry to the log, replacing the pending entry of the same object
+func (b *Buffer) Put(entry *BufferEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	entry.Seq = b.seq
+	if err := b.write(bufferRecord{Put: entry}); err != nil {
+		return err
+	}
+	b.put(entry)
+	return nil
+}
+
+// Replay sends the entries in order until the rest service fails, it returns the number of entries sent
+func (b *Buffer) Replay() int {
+	sent := 0
+	for {
+		b.mu.Lock()
+		if len(b.entries) == 0 {
+			b.mu.Unlock()
+			return sent
+		}
+		entry := b.entries[0]
+		b.mu.Unlock()
+
+		status, _ := sendRequest(entry.Method, entry.URL, entry.Body)
+		if retryable(status) {
+			return sent
+		}
+		if err := statusError(entry.Method, entry.URL, status); err != nil {
+			log.Errorf("dropping buffered request %s: %v", entry.Key, err)
+		}
+		b.mu.Lock()
+		// the entry may have been replaced by a newer one of the same object while it was sent
+		if err := b.write(bufferRecord{Ack: entry.Seq}); err != nil {
+			log.Errorf("failed to write %s: %v", b.path, err)
+		}
+		b.ack(entry.Seq)
+		b.compact()
+		b.mu.Unlock()
+		sent++
+	}
+}
+
+// Run replays the entries every period until stopCh is closed
+func (b *Buffer) Run(period time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if n := b.Replay(); n > 0 {
+				log.Infof("%d buffered requests sent, %d pending", n, b.Len())
+			}
+		}
+	}
+}
+
+// put adds the entry at the end, the pending entry of the same object is removed
+func (b *Buffer) put(entry *BufferEntry) {
+	for i, e := range b.entries {
+		if e.Key == entry.Key {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			break
+		}
+	}
+	b.entries = append(b.entries, entry)
+}
+
+// ack removes the entry with seq if it's still pending
+func (b *Buffer) ack(seq uint64) {
+	for i, e := range b.entries {
+		if e.Seq == seq {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// write appends the record to the log and syncs it to disk
+func (b *Buffer) write(record bufferRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := b.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	b.records++
+	return b.file.Sync()
+}
+
+// compact rewrites the log with the pending entries once it's mostly made of sent ones
+func (b *Buffer) compact() {
+	if len(b.entries) > 0 && (b.records < compactRecords || b.records < 2*len(b.entries)) {
+		return
+	}
+	tmp := b.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Errorf("failed to compact %s: %v", b.path, err)
+		return
+	}
+	w := bufio.NewWriter(file)
+	for _, entry := range b.entries {
+		data, _ := json.Marshal(bufferRecord{Put: entry})
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err := os.Rename(tmp, b.path); err != nil {
+		log.Errorf("failed to compact %s: %v", b.path, err)
+		return
+	}
+	b.file.Close()
+	if b.file, err = os.OpenFile(b.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		log.Errorf("failed to open %s: %v", b.path, err)
+		return
+	}
+	b.records = len(b.entries)
+}
+
+// retryable returns whether the request failed because the rest service is unavailable
+func retryable(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
+
+// statusError returns nil if the status is a success
+func statusError(method string, url string, status int) error {
+	if status >= http.StatusOK && status < http.StatusMultipleChoices {
+		return nil
+	}
+	return fmt.Errorf("%s %s failed with status %d", method, url, status)
+}
+
+// objectKey identifies an object of objType in the buffer
+func objectKey(objType string, obj interface{}) string {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		key = fmt.Sprint(obj)
+	}
+	return objType + ":" + key
+}
+
+// SendObject sends an object created or updated to the rest service, it's buffered if the service is unavailable
+func SendObject(objType string, obj interface{}, url string) error {
+	if OutboundBuffer == nil {
+		// without a buffer the object is lost once the retries fail
+		if _, err := SendJSONQueryWithRetries(obj, url); err != nil {
+			log.Errorf("dropping %s %s: %v", objType, objectKey(objType, obj), err)
+		}
+		return nil
+	}
+	return OutboundBuffer.Send(objectKey(objType, obj), "POST", url, obj)
+}
+
+// SendDelete sends the deletion of the object with key (namespace/name) to the rest service, it's buffered if the service is unavailable
+func SendDelete(objType string, key string, url string) error {
+	if OutboundBuffer == nil {
+		SendDeleteRequest(url)
+		return nil
+	}
+	return OutboundBuffer.Send(objType+":"+key, "DELETE", url, nil)
+}
@@ -83,21 +83,29 @@ func (t *DeploymentHandler) ObjectCreated(obj interface{}) error {
 		log.Error(err)
 	}
 	log.Debugf("    Deployment: %s, \n", j)
-	SendJSONQueryWithRetries(deployment, RestSvcEndpoint+"v1.1/entity?objtype=deployment")
-	return nil
+	return SendObject("deployment", deployment, RestSvcEndpoint+"v1.1/entity?objtype=deployment")
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *DeploymentHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("DeploymentHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/deployment/deployment:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return SendDelete("deployment", key, RestSvcEndpoint+"v1/entity/deployment/deployment:"+ClusterName+":"+strings.Replace(key, "/", ":", -1))
 }
 
+// deploymentTrackedFields are the fields deployment entities are mapped from, updates of other fields aren't sent
+var deploymentTrackedFields = []string{"metadata.labels", "spec.replicas", "spec.strategy", "status.availableReplicas"}
+
 // ObjectUpdated is called when an object is updated
 func (t *DeploymentHandler) ObjectUpdated(objOld, objNew interface{}) error {
 	log.Info("DeploymentHandler.ObjectUpdated")
-	return nil
+	deployment, ok := objNew.(*v1beta2.Deployment)
+	if !ok {
+		return errors.New("updated object is not a deployment")
+	}
+	if !ValidateDeployment(deployment) {
+		return errors.New("Could not validate deployment object " + deployment.ObjectMeta.Name)
+	}
+	return SendUpdate("deployment", objOld, objNew, deploymentTrackedFields)
 }
 
 // DeploymentSynchronize sync all Deployments periodically in case missing events
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DynamicResource is a resource watched with the dynamic client, any kind including CRDs
+// the objects are sent as they are and mapped by the rest service with the metadata named ObjType
+type DynamicResource struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+	ObjType  string `json:"objtype"`
+	// ClusterScoped resources are watched in all namespaces even if AppNamespace is set
+	ClusterScoped bool `json:"clusterScoped"`
+	// TrackedFields are the paths of the fields sent on updates, e.g. status.succeeded, defaultTrackedFields if empty
+	TrackedFields []string `json:"trackedFields"`
+}
+
+// defaultTrackedFields leave out the metadata which changes on every update
+var defaultTrackedFields = []string{"metadata.labels", "metadata.annotations", "metadata.ownerReferences", "spec", "status"}
+
+// DynamicConfig is the content of the resources config file, the resources to watch are listed under resources
+type DynamicConfig struct {
+	Resources []DynamicResource `json:"resources"`
+}
+
+// GroupVersionResource returns the resource the dynamic client is asked for
+func (r DynamicResource) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// Namespace returns the namespace the resource is watched in, all namespaces for cluster scoped resources
+func (r DynamicResource) Namespace() string {
+	if r.ClusterScoped {
+		return v1.NamespaceAll
+	}
+	return AppNamespace
+}
+
+// LoadDynamicResources reads the resources to watch from a yaml or json config file
+func LoadDynamicResources(path string) ([]DynamicResource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := DynamicConfig{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for _, r := range config.Resources {
+		if r.Version == "" || r.Resource == "" || r.ObjType == "" {
+			return nil, fmt.Errorf("resource %+v in %s needs version, resource and objtype", r, path)
+		}
+	}
+	return config.Resources, nil
+}
+
+// DynamicHandler sends unstructured objects of a dynamic resource to the rest service
+// updates are sent with the TrackedFields, defaultTrackedFields if empty
+type DynamicHandler struct {
+	ObjType       string
+	TrackedFields []string
+}
+
+// GetDynamicInformer get index Informer to watch a resource from a dynamic shared informer factory
+func GetDynamicInformer(factory dynamicinformer.DynamicSharedInformerFactory, resource DynamicResource) cache.SharedIndexInformer {
+	return factory.ForResource(resource.GroupVersionResource()).Informer()
+}
+
+// Init handles any handler initialization
+func (t *DynamicHandler) Init() error {
+	log.Infof("DynamicHandler.Init %s", t.ObjType)
+	return nil
+}
+
+// ValidateUnstructured verify that the object has at least these fields
+func ValidateUnstructured(obj *unstructured.Unstructured) bool {
+	return obj.GetName() != "" && obj.GetResourceVersion() != ""
+}
+
+// ObjectCreated is called when an object is created
+func (t *DynamicHandler) ObjectCreated(obj interface{}) error {
+	object, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("%s object %v is not unstructured", t.ObjType, obj)
+	}
+	if !ValidateUnstructured(object) {
+		return errors.New("Could not validate " + t.ObjType + " object " + object.GetName())
+	}
+	// the service maps the raw object with the jsonpath of the metadata fields
+	return SendObject(t.ObjType, object, RestSvcEndpoint+"v1.1/entity?objtype="+t.ObjType)
+}
+
+// ObjectDeleted is called when an object is deleted
+func (t *DynamicHandler) ObjectDeleted(obj interface{}, key string) error {
+	log.Infof("DynamicHandler.ObjectDeleted %s", t.ObjType)
+	return SendDelete(t.ObjType, key, RestSvcEndpoint+"v1/entity/"+t.ObjType+"/"+t.ObjType+":"+ClusterName+":"+strings.Replace(key, "/", ":", -1))
+}
+
+// ObjectUpdated is called when an object is updated
+// only the tracked fields which changed are sent to the rest service
+func (t *DynamicHandler) ObjectUpdated(objOld, objNew interface{}) error {
+	log.Infof("DynamicHandler.ObjectUpdated %s", t.ObjType)
+	object, ok := objNew.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("%s object %v is not unstructured", t.ObjType, objNew)
+	}
+	if !ValidateUnstructured(object) {
+		return errors.New("Could not validate " + t.ObjType + " object " + object.GetName())
+	}
+	tracked := t.TrackedFields
+	if len(tracked) == 0 {
+		tracked = defaultTrackedFields
+	}
+	return SendUpdate(t.ObjType, objOld, objNew, tracked)
+}
+
+// DynamicSynchronize sync all objects of a dynamic resource periodically in case missing events
+func DynamicSynchronize(client dynamic.Interface, resource DynamicResource) {
+	list, err := client.Resource(resource.GroupVersionResource()).Namespace(resource.Namespace()).List(v1.ListOptions{})
+	if err != nil {
+		log.Errorf("failed to list %s: %v", resource.Resource, err)
+		return
+	}
+	objects := make([]map[string]interface{}, 0, len(list.Items))
+	for _, item := range list.Items {
+		objects = append(objects, item.Object)
+	}
+	SendJSONQueryWithRetries(objects, RestSvcEndpoint+"v1/sync/"+resource.ObjType)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -60,21 +61,25 @@ func (t *IngressHandler) ObjectCreated(obj interface{}) error {
 	// assert the type to a Ingress object to pull out relevant data
 	ingress := obj.(*ext_v1beta1.Ingress)
 	log.Infof("    ingressmeta: %+v", ingress)
-	SendJSONQueryWithRetries(ingress, RestSvcEndpoint+"v1.1/entity?objtype=ingress")
-	return nil
+	return SendObject("ingress", ingress, RestSvcEndpoint+"v1.1/entity?objtype=ingress")
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *IngressHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("IngressHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/ingress/ingress:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return SendDelete("ingress", key, RestSvcEndpoint+"v1/entity/ingress/ingress:"+ClusterName+":"+strings.Replace(key, "/", ":", -1))
 }
 
+// ingressTrackedFields are the fields ingress entities are mapped from, updates of other fields aren't sent
+var ingressTrackedFields = []string{"metadata.labels", "spec"}
+
 // ObjectUpdated is called when an object is updated
 func (t *IngressHandler) ObjectUpdated(objOld, objNew interface{}) error {
 	log.Info("IngressHandler.ObjectUpdated")
-	return nil
+	if _, ok := objNew.(*ext_v1beta1.Ingress); !ok {
+		return errors.New("updated object is not an ingress")
+	}
+	return SendUpdate("ingress", objOld, objNew, ingressTrackedFields)
 }
 
 // IngressSynchronize sync all Ingresses periodically in case missing events
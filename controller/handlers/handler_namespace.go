@@ -73,21 +73,29 @@ func (t *NamespaceHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateNamespace(namespace) {
 		return errors.New("Could not validate namespace object " + namespace.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(namespace, RestSvcEndpoint+"v1.1/entity?objtype=namespace")
-	return nil
+	return SendObject("namespace", namespace, RestSvcEndpoint+"v1.1/entity?objtype=namespace")
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *NamespaceHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("NamespaceHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/namespace/namespace:" + ClusterName + ":" + key)
-	return nil
+	return SendDelete("namespace", key, RestSvcEndpoint+"v1/entity/namespace/namespace:"+ClusterName+":"+key)
 }
 
+// namespaceTrackedFields are the fields namespace entities are mapped from, updates of other fields aren't sent
+var namespaceTrackedFields = []string{"metadata.labels", "metadata.annotations"}
+
 // ObjectUpdated is called when an object is updated
 func (t *NamespaceHandler) ObjectUpdated(objOld, objNew interface{}) error {
 	log.Info("NamespaceHandler.ObjectUpdated")
-	return nil
+	namespace, ok := objNew.(*core_v1.Namespace)
+	if !ok {
+		return errors.New("updated object is not a namespace")
+	}
+	if !ValidateNamespace(namespace) {
+		return errors.New("Could not validate namespace object " + namespace.ObjectMeta.Name)
+	}
+	return SendUpdate("namespace", objOld, objNew, namespaceTrackedFields)
 }
 
 // NamespaceSynchronize sync all Namespaces periodically in case missing events
@@ -78,21 +78,29 @@ func (t *PodHandler) ObjectCreated(obj interface{}) error {
 		return errors.New("Could not validate pod object " + pod.ObjectMeta.Name)
 	}
 	// send the object to the rest service
-	SendJSONQueryWithRetries(pod, RestSvcEndpoint+"v1.1/entity?objtype=pod")
-	return nil
+	return SendObject("pod", pod, RestSvcEndpoint+"v1.1/entity?objtype=pod")
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *PodHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("PodHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/pod/pod:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return SendDelete("pod", key, RestSvcEndpoint+"v1/entity/pod/pod:"+ClusterName+":"+strings.Replace(key, "/", ":", -1))
 }
 
+// podTrackedFields are the fields pod entities are mapped from, updates of other fields aren't sent
+var podTrackedFields = []string{"metadata.labels", "metadata.ownerReferences", "spec.nodeName", "spec.containers", "spec.volumes", "status.phase", "status.podIP", "status.startTime"}
+
 // ObjectUpdated is called when an object is updated
 func (t *PodHandler) ObjectUpdated(objOld, objNew interface{}) error {
 	log.Info("PodHandler.ObjectUpdated")
-	return nil
+	pod, ok := objNew.(*core_v1.Pod)
+	if !ok {
+		return errors.New("updated object is not a pod")
+	}
+	if !ValidatePod(pod) {
+		return errors.New("Could not validate pod object " + pod.ObjectMeta.Name)
+	}
+	return SendUpdate("pod", objOld, objNew, podTrackedFields)
 }
 
 // PodSynchronize synchronize the objects in dgraph with the cluster to account for drift
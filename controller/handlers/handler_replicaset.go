@@ -77,21 +77,29 @@ func (t *ReplicaSetHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateReplicaSet(replicaset) {
 		return errors.New("Could not validate replicaset object " + replicaset.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(replicaset, RestSvcEndpoint+"v1.1/entity?objtype=replicaset")
-	return nil
+	return SendObject("replicaset", replicaset, RestSvcEndpoint+"v1.1/entity?objtype=replicaset")
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *ReplicaSetHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("ReplicaSetHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/replicaset/replicaset:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return SendDelete("replicaset", key, RestSvcEndpoint+"v1/entity/replicaset/replicaset:"+ClusterName+":"+strings.Replace(key, "/", ":", -1))
 }
 
+// replicasetTrackedFields are the fields replicaset entities are mapped from, updates of other fields aren't sent
+var replicasetTrackedFields = []string{"metadata.labels", "metadata.ownerReferences", "spec.replicas", "spec.template"}
+
 // ObjectUpdated is called when an object is updated
 func (t *ReplicaSetHandler) ObjectUpdated(objOld, objNew interface{}) error {
 	log.Info("ReplicaSetHandler.ObjectUpdated")
-	return nil
+	replicaset, ok := objNew.(*v1beta2.ReplicaSet)
+	if !ok {
+		return errors.New("updated object is not a replicaset")
+	}
+	if !ValidateReplicaSet(replicaset) {
+		return errors.New("Could not validate replicaset object " + replicaset.ObjectMeta.Name)
+	}
+	return SendUpdate("replicaset", objOld, objNew, replicasetTrackedFields)
 }
 
 // ReplicaSetSynchronize sync all ReplicaSets periodically in case missing events
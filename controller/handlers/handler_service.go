@@ -78,21 +78,29 @@ func (t *ServiceHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateService(service) {
 		return errors.New("Could not validate service object " + service.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(service, RestSvcEndpoint+"v1.1/entity?objtype=service")
-	return nil
+	return SendObject("service", service, RestSvcEndpoint+"v1.1/entity?objtype=service")
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *ServiceHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("ServiceHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/service/service:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return SendDelete("service", key, RestSvcEndpoint+"v1/entity/service/service:"+ClusterName+":"+strings.Replace(key, "/", ":", -1))
 }
 
+// serviceTrackedFields are the fields service entities are mapped from, updates of other fields aren't sent
+var serviceTrackedFields = []string{"metadata.labels", "spec.selector", "spec.clusterIP", "spec.type", "spec.ports"}
+
 // ObjectUpdated is called when an object is updated
 func (t *ServiceHandler) ObjectUpdated(objOld, objNew interface{}) error {
 	log.Info("ServiceHandler.ObjectUpdated")
-	return nil
+	service, ok := objNew.(*core_v1.Service)
+	if !ok {
+		return errors.New("updated object is not a service")
+	}
+	if !ValidateService(service) {
+		return errors.New("Could not validate service object " + service.ObjectMeta.Name)
+	}
+	return SendUpdate("service", objOld, objNew, serviceTrackedFields)
 }
 
 // ServiceSynchronize sync all Services periodically in case missing events
@@ -78,21 +78,29 @@ func (t *StatefulSetHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateStatefulSet(statefulset) {
 		return errors.New("Could not validate statefulset object " + statefulset.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(statefulset, RestSvcEndpoint+"v1.1/entity?objtype=statefulset")
-	return nil
+	return SendObject("statefulset", statefulset, RestSvcEndpoint+"v1.1/entity?objtype=statefulset")
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *StatefulSetHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("StatefulSetHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/statefulset/statefulset:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return SendDelete("statefulset", key, RestSvcEndpoint+"v1/entity/statefulset/statefulset:"+ClusterName+":"+strings.Replace(key, "/", ":", -1))
 }
 
+// statefulsetTrackedFields are the fields statefulset entities are mapped from, updates of other fields aren't sent
+var statefulsetTrackedFields = []string{"metadata.labels", "spec.replicas"}
+
 // ObjectUpdated is called when an object is updated
 func (t *StatefulSetHandler) ObjectUpdated(objOld, objNew interface{}) error {
 	log.Info("StatefulSetHandler.ObjectUpdated")
-	return nil
+	statefulset, ok := objNew.(*appsv1.StatefulSet)
+	if !ok {
+		return errors.New("updated object is not a statefulset")
+	}
+	if !ValidateStatefulSet(statefulset) {
+		return errors.New("Could not validate statefulset object " + statefulset.ObjectMeta.Name)
+	}
+	return SendUpdate("statefulset", objOld, objNew, statefulsetTrackedFields)
 }
 
 // StatefulSetSynchronize sync all StatefulSets periodically in case missing events
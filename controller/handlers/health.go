@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Health reports whether the replica is the leader and whether the informers of its controllers have synced
+type Health struct {
+	Elector Elector
+	mu      sync.RWMutex
+	synced  map[string]func() bool
+}
+
+// HealthStatus is returned by the /healthz and /readyz endpoints
+type HealthStatus struct {
+	Identity string          `json:"identity"`
+	Leader   bool            `json:"leader"`
+	Synced   map[string]bool `json:"synced"`
+}
+
+// NewHealth returns the health of the replica elected by elector
+func NewHealth(elector Elector) *Health {
+	return &Health{Elector: elector, synced: map[string]func() bool{}}
+}
+
+// SetSynced registers the HasSynced func of the informer of the controller name, nil removes the controller
+func (h *Health) SetSynced(name string, hasSynced func() bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hasSynced == nil {
+		delete(h.synced, name)
+		return
+	}
+	h.synced[name] = hasSynced
+}
+
+// Status returns the leader status and the sync state of the informers of the running controllers
+func (h *Health) Status() HealthStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status := HealthStatus{
+		Identity: h.Elector.Identity(),
+		Leader:   h.Elector.IsLeader(),
+		Synced:   map[string]bool{},
+	}
+	for name, hasSynced := range h.synced {
+		status.Synced[name] = hasSynced()
+	}
+	return status
+}
+
+// Ready returns true for standby replicas and for the leader once its controllers are running with synced informers
+func (s HealthStatus) Ready() bool {
+	if !s.Leader {
+		return true
+	}
+	if len(s.Synced) == 0 {
+		return false
+	}
+	for _, synced := range s.Synced {
+		if !synced {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthzHandler reports the status of the replica, it fails only if the process can't serve requests
+func (h *Health) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthStatus(w, http.StatusOK, h.Status())
+}
+
+// ReadyzHandler reports the status of the replica with 503 while the leader's informers are syncing
+func (h *Health) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	status := h.Status()
+	code := http.StatusOK
+	if !status.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealthStatus(w, code, status)
+}
+
+func writeHealthStatus(w http.ResponseWriter, code int, status HealthStatus) {
+	ret, _ := json.Marshal(status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(ret)
+}
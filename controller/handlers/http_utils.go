@@ -5,13 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"reflect"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
@@ -39,16 +43,66 @@ type Handler interface {
 // SendJSONQuery send requests to REST api
 func SendJSONQuery(obj interface{}, url string) (int, []byte) {
 	//url := "http://localhost:8011/create"
+	return sendJSONRequest("POST", obj, url)
+}
+
+// SendPatchQuery send partial objects to the REST api
+func SendPatchQuery(obj interface{}, url string) (int, []byte) {
+	return sendJSONRequest("PATCH", obj, url)
+}
 
-	s, err := json.Marshal(obj)
+// sendJSONRequest sends obj as json with the given http method
+func sendJSONRequest(method string, obj interface{}, url string) (int, []byte) {
+	s, err := marshalObject(obj)
 	if err != nil {
 		log.Error("failed to marshal object in SendJSONQuery")
 		log.Error(err)
 	}
-	log.Infof("sent to %s:\n    %s", url, string(s))
-	payload := bytes.NewBuffer(s)
+	return sendRequest(method, url, s)
+}
+
+// marshalObject returns the json of obj with the kind of typed kubernetes objects set,
+// objects from informers and lists don't have it but the rest service needs it to map them
+func marshalObject(obj interface{}) ([]byte, error) {
+	return json.Marshal(withKind(obj))
+}
+
+// withKind returns a copy of the typed kubernetes objects in obj, either one object or a slice, with their kind set
+// the informer cache is shared so objects are never changed in place, other objects are returned as they are
+func withKind(obj interface{}) interface{} {
+	if o, ok := obj.(runtime.Object); ok {
+		if !o.GetObjectKind().GroupVersionKind().Empty() {
+			return obj
+		}
+		gvks, _, err := scheme.Scheme.ObjectKinds(o)
+		if err != nil || len(gvks) == 0 {
+			return obj
+		}
+		o = o.DeepCopyObject()
+		o.GetObjectKind().SetGroupVersionKind(gvks[0])
+		return o
+	}
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Slice || v.IsNil() {
+		return obj
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		// items of lists are values, their pointers are the kubernetes objects
+		items[i] = withKind(v.Index(i).Addr().Interface())
+	}
+	return items
+}
+
+// sendRequest sends the json data with the given http method, 503 is returned if the rest service can't be reached
+func sendRequest(method string, url string, data []byte) (int, []byte) {
+	log.Infof("sent to %s:\n    %s", url, string(data))
+	var payload io.Reader
+	if data != nil {
+		payload = bytes.NewBuffer(data)
+	}
 
-	req, _ := http.NewRequest("POST", url, payload)
+	req, _ := http.NewRequest(method, url, payload)
 	req.Close = true
 	req.Header.Add("Cache-Control", "no-cache")
 	req.Header.Add("Content-Type", "application/json")
@@ -58,7 +112,7 @@ func SendJSONQuery(obj interface{}, url string) (int, []byte) {
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Error(err)
-		return 404, nil
+		return http.StatusServiceUnavailable, nil
 	}
 
 	defer res.Body.Close()
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Elector decides which replica of the controller is active, so that objects are sent once however many replicas run
+type Elector interface {
+	// Run calls run while the replica is the leader, the context given to run is cancelled when the leadership is lost
+	// it blocks until ctx is cancelled
+	Run(ctx context.Context, run func(ctx context.Context))
+	// IsLeader returns whether the replica is the leader now
+	IsLeader() bool
+	// Identity returns the name of the replica
+	Identity() string
+}
+
+// LocalElector is always the leader, it stands in for the lease with a single replica and in tests
+type LocalElector struct {
+	leader int32
+}
+
+// Run calls run until ctx is cancelled
+func (e *LocalElector) Run(ctx context.Context, run func(ctx context.Context)) {
+	atomic.StoreInt32(&e.leader, 1)
+	defer atomic.StoreInt32(&e.leader, 0)
+	run(ctx)
+}
+
+// IsLeader returns true while Run is running
+func (e *LocalElector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Identity of the local replica
+func (e *LocalElector) Identity() string {
+	return "local"
+}
+
+// LeaseElector elects the leader with a Kubernetes Lease, a standby replica takes over when the leader
+// doesn't renew the lease for LeaseDuration
+type LeaseElector struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+	ID        string
+	// LeaseDuration is how long standby replicas wait before taking over, it bounds the failover time
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader retries renewing the lease before it gives up the leadership
+	RenewDeadline time.Duration
+	// RetryPeriod is the time between tries to acquire or renew the lease
+	RetryPeriod time.Duration
+	leader      int32
+}
+
+// NewLeaseElector returns an elector with the lease name in namespace and durations for a fast failover
+func NewLeaseElector(client kubernetes.Interface, namespace string, name string, id string) *LeaseElector {
+	return &LeaseElector{
+		Client:        client,
+		Namespace:     namespace,
+		Name:          name,
+		ID:            id,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}
+}
+
+// Run campaigns for the lease until ctx is cancelled, the replica campaigns again after losing the leadership
+func (e *LeaseElector) Run(ctx context.Context, run func(ctx context.Context)) {
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, e.Namespace, e.Name,
+		e.Client.CoreV1(), e.Client.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: e.ID})
+	if err != nil {
+		log.Fatalf("failed to create lease lock: %v", err)
+	}
+	for ctx.Err() == nil {
+		// run is called in its own goroutine, it has to return before campaigning again
+		var mu sync.Mutex
+		var running sync.WaitGroup
+		stopped := false
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: e.LeaseDuration,
+			RenewDeadline: e.RenewDeadline,
+			RetryPeriod:   e.RetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					mu.Lock()
+					if stopped {
+						mu.Unlock()
+						return
+					}
+					running.Add(1)
+					mu.Unlock()
+					defer running.Done()
+					log.Infof("%s started leading %s/%s", e.ID, e.Namespace, e.Name)
+					atomic.StoreInt32(&e.leader, 1)
+					defer atomic.StoreInt32(&e.leader, 0)
+					run(ctx)
+				},
+				OnStoppedLeading: func() {
+					if e.IsLeader() {
+						log.Infof("%s stopped leading %s/%s", e.ID, e.Namespace, e.Name)
+					}
+				},
+				OnNewLeader: func(identity string) {
+					log.Infof("%s/%s leader is %s", e.Namespace, e.Name, identity)
+				},
+			},
+		})
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+		running.Wait()
+	}
+}
+
+// IsLeader returns whether the replica holds the lease
+func (e *LeaseElector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Identity of the replica in the lease
+func (e *LeaseElector) Identity() string {
+	return e.ID
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// metadataFields identify the object in partial updates, with its kind
+var metadataFields = []string{"name", "namespace", "resourceVersion"}
+
+// ChangedFields compares the tracked fields of two versions of an object, fields are paths like status.phase
+// it returns a partial object with the changed fields and the metadata identifying the object, nil if none of them changed
+func ChangedFields(objOld, objNew interface{}, tracked []string) (map[string]interface{}, error) {
+	oldMap, err := toMap(objOld)
+	if err != nil {
+		return nil, err
+	}
+	newMap, err := toMap(objNew)
+	if err != nil {
+		return nil, err
+	}
+	partial := map[string]interface{}{}
+	for _, field := range tracked {
+		path := strings.Split(field, ".")
+		newValue := getPath(newMap, path)
+		if reflect.DeepEqual(getPath(oldMap, path), newValue) {
+			continue
+		}
+		// removed fields are sent as null
+		setPath(partial, path, newValue)
+	}
+	if len(partial) == 0 {
+		return nil, nil
+	}
+	for _, field := range metadataFields {
+		if value := getPath(newMap, []string{"metadata", field}); value != nil {
+			setPath(partial, []string{"metadata", field}, value)
+		}
+	}
+	// the kind is needed by the rest service to map the object
+	if kind, ok := newMap["kind"]; ok {
+		partial["kind"] = kind
+	}
+	return partial, nil
+}
+
+// SendUpdate sends the tracked fields which changed between objOld and objNew to the rest service
+// updates of other fields, like the status churn of pods, are skipped
+// the whole object is sent if the service doesn't know it yet, e.g. if its create event was missed,
+// or if it's unavailable, to be buffered
+func SendUpdate(objType string, objOld, objNew interface{}, tracked []string) error {
+	changed, err := ChangedFields(objOld, objNew, tracked)
+	if err != nil {
+		return err
+	}
+	if changed == nil {
+		log.Debugf("%s update skipped, no tracked field changed", objType)
+		return nil
+	}
+	url := RestSvcEndpoint + "v1.1/entity?objtype=" + objType
+	// the whole object is sent after the pending requests of the buffer, it replaces the ones of the same object
+	if OutboundBuffer != nil && OutboundBuffer.Len() > 0 {
+		return SendObject(objType, objNew, url)
+	}
+	status, _ := SendPatchQuery(changed, url)
+	for cur := 0; OutboundBuffer == nil && retryable(status) && cur < 5; cur++ {
+		time.Sleep(2000 * time.Millisecond)
+		status, _ = SendPatchQuery(changed, url)
+	}
+	if status == http.StatusNotFound || retryable(status) {
+		return SendObject(objType, objNew, url)
+	}
+	return statusError("PATCH", url, status)
+}
+
+// toMap returns the json representation of an object
+func toMap(obj interface{}) (map[string]interface{}, error) {
+	data, err := marshalObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// getPath returns the value at path in m, nil if there is none
+func getPath(m map[string]interface{}, path []string) interface{} {
+	var value interface{} = m
+	for _, key := range path {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[key]
+	}
+	return value
+}
+
+// setPath sets the value at path in m, creating the maps on the way
+func setPath(m map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[key] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -8,6 +10,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	handlers "github.com/intuit/katlas/controller/handlers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	cache "k8s.io/client-go/tools/cache"
@@ -15,8 +21,8 @@ import (
 	"k8s.io/client-go/util/workqueue"
 )
 
-// GetKubernetesClient retrieve the Kubernetes cluster client from outside of the cluster
-func GetKubernetesClient() kubernetes.Interface {
+// GetKubernetesConfig retrieve the Kubernetes cluster config from outside of the cluster or the incluster config
+func GetKubernetesConfig() *rest.Config {
 	// construct the path to resolve to `~/.kube/config`
 	kubeConfigPath := os.Getenv("HOME") + "/.kube/config"
 	// kubeConfigPath := os.Getenv("HOME") + "/Downloads/admins\\@dev-devx-cmdb-api-usw2-ppd-qal"
@@ -33,9 +39,13 @@ func GetKubernetesClient() kubernetes.Interface {
 			panic(err.Error())
 		}
 	}
+	return config
+}
 
+// GetKubernetesClient retrieve the Kubernetes cluster client from outside of the cluster
+func GetKubernetesClient() kubernetes.Interface {
 	// generate the client based off of the config
-	client, err := kubernetes.NewForConfig(config)
+	client, err := kubernetes.NewForConfig(GetKubernetesConfig())
 	if err != nil {
 		log.Fatalf("getClusterConfig: %v", err)
 	}
@@ -93,6 +103,28 @@ func CreateController(objType string) *Controller {
 		handlerc = &handlers.StatefulSetHandler{}
 	}
 
+	return newController(objType, client, informer, handlerc, queue)
+}
+
+// GetDynamicClient retrieve the dynamic client used to watch the resources of the config file
+func GetDynamicClient() dynamic.Interface {
+	client, err := dynamic.NewForConfig(GetKubernetesConfig())
+	if err != nil {
+		log.Fatalf("getClusterConfig: %v", err)
+	}
+	return client
+}
+
+// CreateDynamicController to build a controller watching unstructured objects of any resource
+// the informer is shared through the factory, which is filtered by namespace unless the resource is cluster scoped
+func CreateDynamicController(factory dynamicinformer.DynamicSharedInformerFactory, resource handlers.DynamicResource) *Controller {
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	informer := handlers.GetDynamicInformer(factory, resource)
+	return newController(resource.ObjType, GetKubernetesClient(), informer, &handlers.DynamicHandler{ObjType: resource.ObjType, TrackedFields: resource.TrackedFields}, queue)
+}
+
+// newController adds the event handlers queueing the keys of changed objects to the informer
+func newController(objType string, client kubernetes.Interface, informer cache.SharedIndexInformer, handlerc handlers.Handler, queue workqueue.RateLimitingInterface) *Controller {
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			// convert the resource object into a key (in this case
@@ -108,7 +140,8 @@ func CreateController(objType string) *Controller {
 			key, err := cache.MetaNamespaceKeyFunc(newObj)
 			log.Infof("Update %s: %s", objType, key)
 			if err == nil {
-				queue.Add(key)
+				// both versions are queued so the handler can send only the changed fields
+				queue.Add(updateEvent{key: key, oldObj: oldObj, newObj: newObj})
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
@@ -140,11 +173,16 @@ func CreateController(objType string) *Controller {
 	return &controller
 }
 
-// Synchronizer periodically sync resources with database
-func Synchronizer() {
+// Synchronizer periodically sync resources with database until stopCh is closed
+func Synchronizer(resources []handlers.DynamicResource, stopCh <-chan struct{}) {
 	client := GetKubernetesClient()
+	dynamicClient := GetDynamicClient()
 	for {
-		time.Sleep(time.Hour)
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(time.Hour):
+		}
 		handlers.NamespaceSynchronize(client)
 		handlers.StatefulSetSynchronize(client)
 		handlers.DeploymentSynchronize(client)
@@ -152,37 +190,129 @@ func Synchronizer() {
 		handlers.PodSynchronize(client)
 		handlers.ServiceSynchronize(client)
 		handlers.IngressSynchronize(client)
+		for _, resource := range resources {
+			handlers.DynamicSynchronize(dynamicClient, resource)
+		}
 	}
 }
 
+// GetElector returns the lease elector when LEADER_ELECTION_NAMESPACE is set, so that only one replica sends objects
+// otherwise the replica is always the leader
+func GetElector() handlers.Elector {
+	namespace := os.Getenv("LEADER_ELECTION_NAMESPACE")
+	if namespace == "" {
+		log.Info("Leader election disabled, running as the only replica")
+		return &handlers.LocalElector{}
+	}
+	// the pod name identifies the replica in the lease
+	id := os.Getenv("POD_NAME")
+	if id == "" {
+		id, _ = os.Hostname()
+	}
+	return handlers.NewLeaseElector(GetKubernetesClient(), namespace, "katlas-controller", id)
+}
+
+// runControllers watches the objects and sends them to the rest service until ctx is cancelled
+// the controllers are created for each leadership since informers and queues can't be restarted
+func runControllers(ctx context.Context, resources []handlers.DynamicResource, health *handlers.Health) {
+	controllers := []*Controller{
+		CreateController("Pod"),
+		CreateController("Service"),
+		CreateController("Namespace"),
+		CreateController("Deployment"),
+		CreateController("ReplicaSet"),
+		CreateController("Ingress"),
+		CreateController("StatefulSet"),
+	}
+
+	// any other resource, CRDs included, is watched with the dynamic client when listed in the config file
+	dynamicClient := GetDynamicClient()
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0, handlers.AppNamespace, nil)
+	clusterFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+	for _, resource := range resources {
+		log.Infof("Watching %s as %s", resource.GroupVersionResource(), resource.ObjType)
+		if resource.ClusterScoped {
+			controllers = append(controllers, CreateDynamicController(clusterFactory, resource))
+		} else {
+			controllers = append(controllers, CreateDynamicController(factory, resource))
+		}
+	}
+
+	// start sync task
+	go Synchronizer(resources, ctx.Done())
+	// run the controller loop to process items
+	for _, c := range controllers {
+		health.SetSynced(c.name, c.HasSynced)
+		go c.Run(ctx.Done())
+	}
+	<-ctx.Done()
+	for _, c := range controllers {
+		health.SetSynced(c.name, nil)
+	}
+}
+
+// serveHealth serves /healthz, /readyz and the prometheus /metrics on HEALTH_ADDR, :8080 by default
+func serveHealth(health *handlers.Health) {
+	addr := os.Getenv("HEALTH_ADDR")
+	if addr == "" {
+		addr = ":8080"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.HealthzHandler)
+	mux.HandleFunc("/readyz", health.ReadyzHandler)
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
 // main code path
 func main() {
 
 	log.Info("Current namespace: ", os.Getenv("AppNamespace"))
-	podcontroller := CreateController("Pod")
-	svccontroller := CreateController("Service")
-	nscontroller := CreateController("Namespace")
-	depcontroller := CreateController("Deployment")
-	rscontroller := CreateController("ReplicaSet")
-	ingcontroller := CreateController("Ingress")
-	sscontroller := CreateController("StatefulSet")
-
-	// use a channel to synchronize the finalization for a graceful shutdown
-	stopCh := make(chan struct{})
-	defer close(stopCh)
+
+	var resources []handlers.DynamicResource
+	if path := os.Getenv("RESOURCES_CONFIG"); path != "" {
+		var err error
+		resources, err = handlers.LoadDynamicResources(path)
+		if err != nil {
+			log.Fatalf("Resources config error: %v", err)
+		}
+	}
 
 	// log.SetLevel(log.DebugLevel)
 
-	// start sync task
-	go Synchronizer()
-	// run the controller loop to process items
-	go podcontroller.Run(stopCh)
-	go svccontroller.Run(stopCh)
-	go nscontroller.Run(stopCh)
-	go depcontroller.Run(stopCh)
-	go rscontroller.Run(stopCh)
-	go ingcontroller.Run(stopCh)
-	go sscontroller.Run(stopCh)
+	// keep the requests which fail while the rest service is unavailable on disk and replay them once it's back
+	if path := os.Getenv("BUFFER_PATH"); path != "" {
+		buffer, err := handlers.NewBuffer(path)
+		if err != nil {
+			log.Fatalf("Outbound buffer error: %v", err)
+		}
+		defer buffer.Close()
+		prometheus.MustRegister(buffer.Metrics()...)
+		handlers.OutboundBuffer = buffer
+	}
+
+	// only the leader runs the controllers, the other replicas stand by to take over
+	elector := GetElector()
+	health := handlers.NewHealth(elector)
+	go serveHealth(health)
+
+	// use a context to synchronize the finalization for a graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go elector.Run(ctx, func(ctx context.Context) {
+		// buffered requests are replayed by the leader only, a replica which lost the lease
+		// would overwrite the newer state sent by the new leader
+		if buffer := handlers.OutboundBuffer; buffer != nil {
+			replayed := make(chan struct{})
+			defer func() { <-replayed }()
+			go func() {
+				defer close(replayed)
+				buffer.Run(5*time.Second, ctx.Done())
+			}()
+		}
+		runControllers(ctx, resources, health)
+	})
+
 	// use a channel to handle OS signals to terminate and gracefully shut
 	// down processing
 	sigTerm := make(chan os.Signal, 1)
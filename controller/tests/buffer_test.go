@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testBufferServer records the requests it receives and fails them with status while it isn't 200
+type testBufferServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []string
+}
+
+func newTestBufferServer() *testBufferServer {
+	s := &testBufferServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		obj := map[string]interface{}{}
+		json.Unmarshal(body, &obj)
+		request := r.Method + " " + r.URL.Path
+		if name, ok := obj["name"]; ok {
+			request += " " + name.(string)
+		}
+		s.requests = append(s.requests, request)
+	}))
+	return s
+}
+
+func (s *testBufferServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *testBufferServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func testBuffer(t *testing.T) (*handlers.Buffer, string) {
+	dir, err := ioutil.TempDir("", "katlas-buffer")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	path := filepath.Join(dir, "outbound.wal")
+	buffer, err := handlers.NewBuffer(path)
+	if err != nil {
+		t.Fatalf("error opening buffer: %v", err)
+	}
+	return buffer, path
+}
+
+func testBufferEntry(key string, method string, url string, name string) *handlers.BufferEntry {
+	body, _ := json.Marshal(map[string]string{"name": name})
+	return &handlers.BufferEntry{Key: key, Method: method, URL: url, Body: body, Time: time.Now()}
+}
+
+func TestBufferCoalesce(t *testing.T) {
+	server := newTestBufferServer()
+	defer server.Close()
+	buffer, path := testBuffer(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	if buffer.Len() != 0 || buffer.Age() != 0 {
+		t.Errorf("expected empty buffer, got %d entries of %v", buffer.Len(), buffer.Age())
+	}
+	first := testBufferEntry("pod:default/pod01", "POST", server.URL+"/v1.1/entity", "pod01")
+	first.Time = time.Now().Add(-time.Minute)
+	buffer.Put(first)
+	buffer.Put(testBufferEntry("pod:default/pod02", "POST", server.URL+"/v1.1/entity", "pod02"))
+	// the delete replaces the pending create of the same pod
+	buffer.Put(testBufferEntry("pod:default/pod01", "DELETE", server.URL+"/v1/entity/pod/pod01", "pod01"))
+	if buffer.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", buffer.Len())
+	}
+	if age := buffer.Age(); age > time.Minute-time.Second {
+		t.Errorf("expected the age of pod02, got %v", age)
+	}
+
+	// the entries survive a restart
+	buffer.Close()
+	buffer, err := handlers.NewBuffer(path)
+	if err != nil {
+		t.Fatalf("error opening buffer: %v", err)
+	}
+	defer buffer.Close()
+	if buffer.Len() != 2 {
+		t.Errorf("expected 2 entries after reopening, got %d", buffer.Len())
+	}
+	if n := buffer.Replay(); n != 2 {
+		t.Errorf("expected 2 entries sent, got %d", n)
+	}
+	expected := []string{"POST /v1.1/entity pod02", "DELETE /v1/entity/pod/pod01 pod01"}
+	if requests := server.received(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %v, got %v", expected, requests)
+	}
+}
+
+func TestBufferReplay(t *testing.T) {
+	server := newTestBufferServer()
+	defer server.Close()
+	buffer, path := testBuffer(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer buffer.Close()
+
+	// requests are sent directly while the service is available
+	if err := buffer.Send("pod:default/pod01", "POST", server.URL+"/v1.1/entity", map[string]string{"name": "pod01"}); err != nil {
+		t.Errorf("error sending pod01: %v", err)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected empty buffer, got %d entries", buffer.Len())
+	}
+
+	server.setStatus(http.StatusServiceUnavailable)
+	buffer.Send("pod:default/pod02", "POST", server.URL+"/v1.1/entity", map[string]string{"name": "pod02"})
+	buffer.Send("pod:default/pod03", "POST", server.URL+"/v1.1/entity", map[string]string{"name": "pod03"})
+	buffer.Send("pod:default/pod02", "POST", server.URL+"/v1.1/entity", map[string]string{"name": "pod02v2"})
+	if buffer.Len() != 2 {
+		t.Errorf("expected 2 buffered entries, got %d", buffer.Len())
+	}
+	if n := buffer.Replay(); n != 0 {
+		t.Errorf("expected replay to stop while the service is unavailable, got %d sent", n)
+	}
+
+	// once the service is back, pending entries are sent in order before the new ones
+	server.setStatus(http.StatusOK)
+	buffer.Send("pod:default/pod04", "DELETE", server.URL+"/v1/entity/pod/pod04", nil)
+	if n := buffer.Replay(); n != 3 {
+		t.Errorf("expected 3 entries sent, got %d", n)
+	}
+	expected := []string{
+		"POST /v1.1/entity pod01",
+		"POST /v1.1/entity pod03",
+		"POST /v1.1/entity pod02v2",
+		"DELETE /v1/entity/pod/pod04",
+	}
+	if requests := server.received(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %v, got %v", expected, requests)
+	}
+	if buffer.Len() != 0 || buffer.Age() != 0 {
+		t.Errorf("expected empty buffer, got %d entries of %v", buffer.Len(), buffer.Age())
+	}
+
+	// the log is compacted once the entries are sent
+	buffer.Close()
+	buffer, err := handlers.NewBuffer(path)
+	if err != nil {
+		t.Fatalf("error opening buffer: %v", err)
+	}
+	defer buffer.Close()
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 || buffer.Len() != 0 {
+		t.Errorf("expected empty log, got %v %v", info, err)
+	}
+
+	// requests rejected by the service aren't buffered
+	server.setStatus(http.StatusBadRequest)
+	if err := buffer.Send("pod:default/pod05", "POST", server.URL+"/v1.1/entity", map[string]string{"name": "pod05"}); err == nil {
+		t.Error("expected error for rejected request")
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected empty buffer, got %d entries", buffer.Len())
+	}
+}
+
+func TestBufferHandlers(t *testing.T) {
+	server := newTestBufferServer()
+	defer server.Close()
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = server.URL + "/"
+	defer func() { handlers.RestSvcEndpoint = endpoint }()
+	buffer, path := testBuffer(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer buffer.Close()
+	handlers.OutboundBuffer = buffer
+	defer func() { handlers.OutboundBuffer = nil }()
+
+	server.setStatus(http.StatusServiceUnavailable)
+	podhandler := handlers.PodHandler{}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-namespace", ResourceVersion: "1"}}
+	if err := podhandler.ObjectCreated(pod); err != nil {
+		t.Errorf("error creating pod: %v", err)
+	}
+	if err := podhandler.ObjectDeleted(pod, "test-namespace/test-pod"); err != nil {
+		t.Errorf("error deleting pod: %v", err)
+	}
+	if buffer.Len() != 1 {
+		t.Errorf("expected the delete to replace the create, got %d entries", buffer.Len())
+	}
+
+	server.setStatus(http.StatusOK)
+	buffer.Replay()
+	expected := []string{"DELETE /v1/entity/pod/pod:" + handlers.ClusterName + ":test-namespace:test-pod"}
+	if requests := server.received(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %v, got %v", expected, requests)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+var dynamicconfig = `
+resources:
+- group: batch
+  version: v1
+  resource: jobs
+  objtype: job
+- group: example.com
+  version: v1alpha1
+  resource: widgets
+  objtype: widget
+  clusterScoped: true
+`
+
+func TestLoadDynamicResources(t *testing.T) {
+	file, err := ioutil.TempFile("", "resources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(dynamicconfig)
+	file.Close()
+
+	resources, err := handlers.LoadDynamicResources(file.Name())
+	if err != nil {
+		t.Fatalf("error loading resources: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	if gvr := resources[0].GroupVersionResource(); gvr.Group != "batch" || gvr.Version != "v1" || gvr.Resource != "jobs" {
+		t.Errorf("unexpected resource %v", gvr)
+	}
+	if resources[0].ObjType != "job" || resources[0].ClusterScoped || !resources[1].ClusterScoped {
+		t.Errorf("unexpected resources %+v", resources)
+	}
+
+	// objtype is required to map the objects
+	ioutil.WriteFile(file.Name(), []byte("resources:\n- version: v1\n  resource: configmaps\n"), 0644)
+	if _, err := handlers.LoadDynamicResources(file.Name()); err == nil {
+		t.Error("expected error for resource without objtype")
+	}
+}
+
+func TestDynamic(t *testing.T) {
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":            "test-job",
+			"namespace":       "test-namespace",
+			"resourceVersion": "1",
+		},
+		"spec": map[string]interface{}{"completions": int64(1)},
+	}}
+	resource := handlers.DynamicResource{Group: "batch", Version: "v1", Resource: "jobs", ObjType: "job"}
+
+	// Create the fake client.
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), job)
+	jobhandler := handlers.DynamicHandler{ObjType: resource.ObjType}
+	jobhandler.Init()
+
+	if err := jobhandler.ObjectCreated(job); err != nil {
+		t.Errorf("error creating job : %v", err)
+	}
+	if err := jobhandler.ObjectCreated(&unstructured.Unstructured{Object: map[string]interface{}{}}); err == nil {
+		t.Error("expected error for job without name")
+	}
+	if err := jobhandler.ObjectUpdated(job, job); err != nil {
+		t.Errorf("error updating job : %v", err)
+	}
+
+	handlers.DynamicSynchronize(client, resource)
+	t.Log("Jobs synced")
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	if informer := handlers.GetDynamicInformer(factory, resource); informer == nil {
+		t.Error("error creating job informer")
+	}
+}
@@ -77,12 +77,12 @@ func TestPod(t *testing.T) {
 	for i, test := range podtests {
 		_ = i
 		testpod := test.in
-		a, err := client.Core().Pods("test-namespace").Create(testpod)
+		a, err := client.CoreV1().Pods("test-namespace").Create(testpod)
 		if err != nil {
 			t.Errorf("error injecting pod add: %v", err)
 		}
 
-		listpods, err := client.Core().Pods("test-namespace").List(metav1.ListOptions{})
+		listpods, err := client.CoreV1().Pods("test-namespace").List(metav1.ListOptions{})
 		t.Logf("Pods: %s\n", listpods.String())
 
 		err = podhandler.ObjectCreated(a)
@@ -61,12 +61,12 @@ func TestService(t *testing.T) {
 	for i, test := range servicetests {
 		_ = i
 		testservice := test.in
-		a, err := client.Core().Services("test-namespace").Create(testservice)
+		a, err := client.CoreV1().Services("test-namespace").Create(testservice)
 		if err != nil {
 			t.Errorf("error injecting service add: %v", err)
 		}
 
-		listservices, err := client.Core().Services("test-namespace").List(metav1.ListOptions{})
+		listservices, err := client.CoreV1().Services("test-namespace").List(metav1.ListOptions{})
 		t.Logf("Services: %s\n", listservices.String())
 
 		err = servicehandler.ObjectCreated(a)
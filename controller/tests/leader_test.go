@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// waitFor polls cond until it is true or the timeout is reached
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func testLeaseElector(client *fake.Clientset, id string) *handlers.LeaseElector {
+	elector := handlers.NewLeaseElector(client, "test-namespace", "katlas-controller", id)
+	elector.LeaseDuration = time.Second
+	elector.RenewDeadline = 500 * time.Millisecond
+	elector.RetryPeriod = 100 * time.Millisecond
+	return elector
+}
+
+func TestLocalElector(t *testing.T) {
+	elector := &handlers.LocalElector{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		elector.Run(ctx, func(ctx context.Context) {
+			<-ctx.Done()
+		})
+		close(done)
+	}()
+	if !waitFor(time.Second, elector.IsLeader) {
+		t.Error("expected local elector to be the leader")
+	}
+	cancel()
+	<-done
+	if elector.IsLeader() {
+		t.Error("expected local elector to stop leading")
+	}
+}
+
+func TestLeaseElector(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	first := testLeaseElector(client, "first")
+	second := testLeaseElector(client, "second")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	firstCtx, firstCancel := context.WithCancel(ctx)
+	firstRuns := make(chan struct{}, 1)
+	go first.Run(firstCtx, func(ctx context.Context) {
+		firstRuns <- struct{}{}
+		<-ctx.Done()
+	})
+	if !waitFor(5*time.Second, first.IsLeader) {
+		t.Fatal("expected first replica to be the leader")
+	}
+	<-firstRuns
+
+	go second.Run(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	time.Sleep(500 * time.Millisecond)
+	if second.IsLeader() {
+		t.Error("expected a single leader")
+	}
+
+	// the standby replica takes over once the lease of the first one expires
+	firstCancel()
+	if !waitFor(5*time.Second, second.IsLeader) {
+		t.Error("expected second replica to take over")
+	}
+	if first.IsLeader() {
+		t.Error("expected first replica to stop leading")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	elector := &handlers.LocalElector{}
+	health := handlers.NewHealth(elector)
+	check := func(handler http.HandlerFunc, code int) handlers.HealthStatus {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != code {
+			t.Errorf("expected %d, got %d %s", code, w.Code, w.Body.String())
+		}
+		status := handlers.HealthStatus{}
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Errorf("error decoding status: %v", err)
+		}
+		return status
+	}
+
+	// standby replicas are ready
+	if status := check(health.ReadyzHandler, http.StatusOK); status.Leader || status.Identity != "local" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	synced := false
+	go elector.Run(ctx, func(ctx context.Context) {
+		health.SetSynced("Pod", func() bool { return synced })
+		<-ctx.Done()
+	})
+	waitFor(time.Second, elector.IsLeader)
+	waitFor(time.Second, func() bool { return len(health.Status().Synced) == 1 })
+
+	// the leader isn't ready until its informers have synced
+	if status := check(health.ReadyzHandler, http.StatusServiceUnavailable); !status.Leader || status.Synced["Pod"] {
+		t.Errorf("unexpected status %+v", status)
+	}
+	check(health.HealthzHandler, http.StatusOK)
+	synced = true
+	if status := check(health.ReadyzHandler, http.StatusOK); !status.Leader || !status.Synced["Pod"] {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	health.SetSynced("Pod", nil)
+	if status := health.Status(); len(status.Synced) != 0 {
+		t.Errorf("expected no controllers, got %+v", status)
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testUpdatePod(version string, phase v1.PodPhase, ready v1.ConditionStatus) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-pod",
+			Namespace:       "test-namespace",
+			ResourceVersion: version,
+			Labels:          map[string]string{"app": "test"},
+		},
+		Spec: v1.PodSpec{NodeName: "node1"},
+		Status: v1.PodStatus{
+			Phase:      phase,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: ready}},
+		},
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	tracked := []string{"metadata.labels", "spec.nodeName", "status.phase"}
+	oldPod := testUpdatePod("1", v1.PodPending, v1.ConditionFalse)
+
+	// status churn of untracked fields is skipped
+	changed, err := handlers.ChangedFields(oldPod, testUpdatePod("2", v1.PodPending, v1.ConditionTrue), tracked)
+	if err != nil || changed != nil {
+		t.Errorf("expected no changes, got %v %v", changed, err)
+	}
+
+	newPod := testUpdatePod("3", v1.PodRunning, v1.ConditionTrue)
+	newPod.Labels = nil
+	changed, err = handlers.ChangedFields(oldPod, newPod, tracked)
+	if err != nil {
+		t.Fatalf("error comparing pods: %v", err)
+	}
+	expected := map[string]interface{}{
+		"kind": "Pod",
+		"metadata": map[string]interface{}{
+			"name":            "test-pod",
+			"namespace":       "test-namespace",
+			"resourceVersion": "3",
+			"labels":          nil,
+		},
+		"status": map[string]interface{}{"phase": "Running"},
+	}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("unexpected changes %v, expected %v", changed, expected)
+	}
+	// the kind is set on a copy, objects of the informer cache are left as they are
+	if newPod.Kind != "" {
+		t.Errorf("expected pod to be unchanged, got kind %s", newPod.Kind)
+	}
+}
+
+func TestSendUpdate(t *testing.T) {
+	methods := []string{}
+	bodies := []map[string]interface{}{}
+	found := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		obj := map[string]interface{}{}
+		json.Unmarshal(body, &obj)
+		methods = append(methods, r.Method)
+		bodies = append(bodies, obj)
+		if r.Method == "PATCH" && !found {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = server.URL + "/"
+	defer func() { handlers.RestSvcEndpoint = endpoint }()
+
+	podhandler := handlers.PodHandler{}
+	oldPod := testUpdatePod("1", v1.PodPending, v1.ConditionFalse)
+	if err := podhandler.ObjectUpdated(oldPod, testUpdatePod("2", v1.PodPending, v1.ConditionTrue)); err != nil {
+		t.Errorf("error updating pod : %v", err)
+	}
+	if len(methods) != 0 {
+		t.Errorf("expected untracked changes to be skipped, got %v", methods)
+	}
+
+	if err := podhandler.ObjectUpdated(oldPod, testUpdatePod("3", v1.PodRunning, v1.ConditionTrue)); err != nil {
+		t.Errorf("error updating pod : %v", err)
+	}
+	if !reflect.DeepEqual(methods, []string{"PATCH"}) || bodies[0]["spec"] != nil {
+		t.Errorf("expected a patch of the changed fields, got %v %v", methods, bodies)
+	}
+
+	// the whole object is created if the service doesn't know it
+	found = false
+	if err := podhandler.ObjectUpdated(oldPod, testUpdatePod("4", v1.PodFailed, v1.ConditionFalse)); err != nil {
+		t.Errorf("error updating pod : %v", err)
+	}
+	if !reflect.DeepEqual(methods, []string{"PATCH", "PATCH", "POST"}) || bodies[2]["spec"] == nil || bodies[2]["kind"] != "Pod" {
+		t.Errorf("expected the pod to be created, got %v %v", methods, bodies)
+	}
+
+	if err := podhandler.ObjectUpdated(oldPod, "test-pod"); err == nil {
+		t.Error("expected error for object which isn't a pod")
+	}
+}
@@ -2,6 +2,8 @@ package apis
 
 import (
 	//"fmt"
+	"flag"
+	"os"
 	"testing"
 
 	log "github.com/Sirupsen/logrus"
@@ -12,18 +14,21 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func init() {
-	dc := db.NewDGClient("127.0.0.1:9080")
+// TestMain parses the flags before the schema is created so that the storage selected with -storage is used
+func TestMain(m *testing.M) {
+	flag.Parse()
+	dc := newTestClient()
 	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
 	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
 	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	os.Exit(m.Run())
 }
 
 func TestMetricsDgraphNumKeywordQueries(t *testing.T) {
 
 	prevCounter := util.ReadCounter(metrics.DgraphNumKeywordQueries)
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	var err error
 	db.LruCache, err = lru.New(5)
@@ -46,7 +51,7 @@ func TestMetricsDgraphNumKeyValueQueries(t *testing.T) {
 
 	prevCounter := util.ReadCounter(metrics.DgraphNumKeyValueQueries)
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewQueryService(dc)
 	//Create query map
@@ -64,7 +69,7 @@ func TestMetricsDgraphNumQSL(t *testing.T) {
 
 	prevCounter := util.ReadCounter(metrics.DgraphNumQSL)
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	qslSvc := NewQSLService(dc)
 	q := `
@@ -81,7 +86,7 @@ func TestMetricsDgraphCreateEntity(t *testing.T) {
 
 	prevCounter := util.ReadCounter(metrics.DgraphNumCreateEntity)
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	node := map[string]interface{}{
@@ -99,7 +104,7 @@ func TestMetricsDgraphGetEntity(t *testing.T) {
 
 	prevCounter := util.ReadCounter(metrics.DgraphNumGetEntity)
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	node := map[string]interface{}{
@@ -119,7 +124,7 @@ func TestMetricsDgraphUpdateEntity(t *testing.T) {
 
 	prevCounter := util.ReadCounter(metrics.DgraphNumUpdateEntity)
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	node := map[string]interface{}{
@@ -140,7 +145,7 @@ func TestMetricsDgraphDeleteEntity(t *testing.T) {
 
 	var prevCounter, nextCounter, expectedDgraphNumDeleteEntity float64
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 
@@ -175,7 +180,7 @@ func TestMetricsDgraphUpdateEdge(t *testing.T) {
 
 	prevCounter := util.ReadCounter(metrics.DgraphNumUpdateEdge)
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	var pid, nid string
@@ -0,0 +1,51 @@
+package apis
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/intuit/katlas/service/util"
+)
+
+// Cursor marks where a page of results ended, clients pass it back as an opaque token to get the next page
+// Key is the value of the first order field of the last object, Skip the number of objects at the end
+// of the page sharing that value, which the next page skips
+type Cursor struct {
+	UID  string      `json:"uid"`
+	Key  interface{} `json:"key,omitempty"`
+	Skip int         `json:"skip,omitempty"`
+}
+
+// Encode returns the cursor as a url safe token
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a token created by Cursor.Encode
+func DecodeCursor(token string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %s", token)
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(b, c); err != nil || !uidRegex.MatchString(c.UID) || c.Skip < 0 {
+		return nil, fmt.Errorf("invalid cursor %s", token)
+	}
+	return c, nil
+}
+
+// lastCursor returns the cursor following the last of the objects, nil when fewer than limit objects
+// were returned as there is no next page
+func lastCursor(objects []interface{}, limit int) *Cursor {
+	if len(objects) == 0 || len(objects) < limit {
+		return nil
+	}
+	last, ok := objects[len(objects)-1].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	uid, _ := last[util.UID].(string)
+	return &Cursor{UID: uid}
+}
@@ -2,12 +2,15 @@ package apis
 
 import (
 	"encoding/json"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/cenkalti/backoff"
+	"github.com/intuit/katlas/service/cfg"
 	"github.com/intuit/katlas/service/db"
 	"github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
@@ -21,7 +24,7 @@ var mutex = util.NewKeyMutex(time.Minute, 1000)
 // IEntityService define interfaces to manipulate data
 type IEntityService interface {
 	// get entity return the object with specified ID
-	GetEntity(uid string) (map[string]interface{}, error)
+	GetEntity(uid string, option ...util.OptionContext) (map[string]interface{}, error)
 	// remove object with given ID
 	DeleteEntity(uid string) error
 	// remove object with given ID
@@ -34,6 +37,8 @@ type IEntityService interface {
 	CreateOrDeleteEdge(fromUID string, toUID string, rel string, op db.Action) error
 	// sync data between source and underlying database
 	SyncEntities(meta string, data map[string]interface{}) error
+	// apply a list of creates, updates and deletes with one result per operation
+	BulkEntities(ops []BulkOperation) []BulkResult
 }
 
 // EntityService provides service for controller and frontend by implement IEntityService interface
@@ -47,15 +52,85 @@ func NewEntityService(dc db.IDGClient) *EntityService {
 }
 
 // GetEntity get entity return the object with specified ID
-func (s EntityService) GetEntity(uuid string) (map[string]interface{}, error) {
+// soft deleted entities aren't found unless the option includes them, like in queries
+func (s EntityService) GetEntity(uuid string, option ...util.OptionContext) (map[string]interface{}, error) {
 	metrics.DgraphNumGetEntity.Inc()
-	return s.dbclient.GetEntity(uuid)
+	ret, err := s.dbclient.GetEntity(uuid)
+	if err != nil || (len(option) > 0 && option[0].IncludeDeleted) {
+		return ret, err
+	}
+	if objs, _ := ret[util.Objects].([]interface{}); len(objs) > 0 {
+		if _, deleted := objs[0].(map[string]interface{})[util.DeletedAt]; deleted {
+			return map[string]interface{}{}, nil
+		}
+	}
+	return ret, nil
 }
 
 // DeleteEntity remove object with given ID
 func (s EntityService) DeleteEntity(uuid string) error {
 	metrics.DgraphNumDeleteEntity.Inc()
-	return s.dbclient.DeleteEntity(uuid)
+	return s.deleteEntity(uuid)
+}
+
+// deleteEntity removes an object and notifies watchers with the object as it was before
+// with soft delete the object is only marked with deletedat and removed by the reaper later
+func (s EntityService) deleteEntity(uuid string) error {
+	obj := s.getObject(uuid)
+	if cfg.ServerCfg.SoftDelete {
+		return s.softDeleteEntity(uuid, obj)
+	}
+	err := s.dbclient.DeleteEntity(uuid)
+	if err != nil {
+		return err
+	}
+	if obj != nil {
+		s.changed(WatchDeleted, uuid, "", obj, nil, nil)
+	}
+	return nil
+}
+
+// softDeleteEntity marks an object as deleted, deleting a tombstone again does nothing
+func (s EntityService) softDeleteEntity(uuid string, obj map[string]interface{}) error {
+	mutation := deleteMutation(uuid, obj)
+	if mutation == nil {
+		return nil
+	}
+	err := s.dbclient.UpdateEntity(uuid, mutation.Data, util.OptionContext{ReplaceListOrEdge: false})
+	if err != nil {
+		return err
+	}
+	s.changed(WatchDeleted, uuid, "", obj, nil, nil)
+	return nil
+}
+
+// changed records the change of an entity in its history and notifies watchers
+func (s EntityService) changed(change string, uid string, meta string, oldValue, newValue map[string]interface{}, cluster interface{}) {
+	obj := newValue
+	if change == WatchDeleted {
+		obj = oldValue
+	}
+	e := publishEntityEvent(change, uid, meta, obj, cluster)
+	if change != WatchDeleted {
+		// the event has the uid assigned to a new object
+		newValue = e.Object
+	}
+	recordChange(s.dbclient, change, uid, e.ObjType, oldValue, newValue, e.Cluster)
+}
+
+// getObject returns the object with the given uid, nil if not found
+func (s EntityService) getObject(uuid string) map[string]interface{} {
+	ret, err := s.dbclient.GetEntity(uuid)
+	if err != nil {
+		log.Debug(err)
+		return nil
+	}
+	objs, _ := ret[util.Objects].([]interface{})
+	if len(objs) == 0 {
+		return nil
+	}
+	obj, _ := objs[0].(map[string]interface{})
+	return obj
 }
 
 // DeleteEntityByResourceID remove object by given resourceid
@@ -71,7 +146,7 @@ func (s EntityService) DeleteEntityByResourceID(meta string, rid string) error {
 	if len(node[util.Objects].([]interface{})) > 0 {
 		// got existing object id
 		for _, obj := range node[util.Objects].([]interface{}) {
-			err = s.dbclient.DeleteEntity(obj.(map[string]interface{})[util.UID].(string))
+			err = s.deleteEntity(obj.(map[string]interface{})[util.UID].(string))
 			if err != nil {
 				return err
 			}
@@ -84,17 +159,68 @@ func (s EntityService) DeleteEntityByResourceID(meta string, rid string) error {
 // CreateEntity save new entity to the storage
 func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (string, error) {
 	metrics.DgraphNumCreateEntity.Inc()
+	cluster := data[util.Cluster]
+	if err := s.prepareEntity(meta, data); err != nil {
+		return "", err
+	}
+	if _, ok := data[util.UID]; !ok {
+		data[util.UID] = "_:A"
+	}
+	if mutex.TryLock(data[util.ResourceID]) {
+		defer mutex.Unlock(data[util.ResourceID])
+		current, err := s.getCurrent(data[util.ResourceID])
+		if err != nil {
+			return "", err
+		}
+		var uuid string
+		operation := func() error {
+			uuid, err = s.dbclient.CreateEntity(meta, data)
+			return err
+		}
+		err = backoff.Retry(operation, backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount))
+		if err != nil {
+			return "", err
+		}
+		s.created(uuid, meta, current, data, cluster)
+		return uuid, nil
+	}
+	return "", fmt.Errorf("can't get resource lock, ignore after timeout reached")
+}
+
+// created notifies the upsert of an entity, current is the object before or nil if it didn't exist
+func (s EntityService) created(uuid string, meta string, current, data map[string]interface{}, cluster interface{}) {
+	_, deleted := current[util.DeletedAt]
+	if current == nil {
+		s.changed(WatchAdded, uuid, meta, nil, data, cluster)
+	} else if newer(data[util.ResourceVersion], current[util.ResourceVersion]) {
+		// the object is left unchanged when the given version isn't newer
+		if deleted {
+			// a soft deleted object was created again
+			s.changed(WatchAdded, uuid, meta, nil, data, cluster)
+		} else {
+			s.changed(WatchModified, uuid, meta, current, data, cluster)
+		}
+	}
+}
+
+// prepareEntity sets the resourceid of an entity and converts its fields as defined by the metadata
+// json fields are stored as strings and relationships are replaced with the uid of the objects they point to
+func (s EntityService) prepareEntity(meta string, data map[string]interface{}) error {
 	cluster := data[util.Cluster]
 	ns := data[util.Namespace]
 	if _, ok := data[util.ResourceID]; !ok {
-		data[util.ResourceID] = getResourceID(meta, data)
+		rid, err := getResourceID(meta, data)
+		if err != nil {
+			return err
+		}
+		data[util.ResourceID] = rid
 	}
 
 	m := NewMetaService(s.dbclient)
 	fs, err := m.GetMetadataFields(meta)
 	if err != nil {
 		log.Debug(err)
-		return "", err
+		return err
 	}
 	delMap := make(map[string]interface{})
 	if len(fs) > 0 {
@@ -120,11 +246,14 @@ func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (s
 				if strings.EqualFold(field.Cardinality, util.Many) {
 					uidMaps := []map[string]interface{}{}
 					for _, rel := range data[field.FieldName].([]interface{}) {
-						dataMap := buildDataMap(data[util.K8sObj], rel, field.RefDataType, cluster, ns)
+						dataMap, err := buildDataMap(data[util.K8sObj], rel, field.RefDataType, cluster, ns)
+						if err != nil {
+							return err
+						}
 						uid, err := s.getUIDFromRelData(dataMap, field.RefDataType)
 						if err != nil {
 							log.Error(err)
-							return "", err
+							return err
 						}
 						uidMaps = append(uidMaps, map[string]interface{}{util.UID: *uid})
 					}
@@ -133,14 +262,19 @@ func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (s
 					uidMap := map[string]interface{}{}
 					// pod can be owned by multi-objs like replicaset, daemonset
 					// FIX-later: hack to set refDataType to dynamic value from owner reference
-					if strings.EqualFold(meta, util.Pod) && strings.EqualFold(field.FieldName, util.Owner) {
-						field.RefDataType = data[util.OwnerType].(string)
+					if ownerType, ok := data[util.OwnerType].(string); ok && strings.EqualFold(meta, util.Pod) && strings.EqualFold(field.FieldName, util.Owner) {
+						// owner references carry the kind, e.g. ReplicaSet
+						field.RefDataType = strings.ToLower(ownerType)
+						data[util.OwnerType] = field.RefDataType
+					}
+					dataMap, err := buildDataMap(data[util.K8sObj], data[field.FieldName], field.RefDataType, cluster, ns)
+					if err != nil {
+						return err
 					}
-					dataMap := buildDataMap(data[util.K8sObj], data[field.FieldName], field.RefDataType, cluster, ns)
 					uid, err := s.getUIDFromRelData(dataMap, field.RefDataType)
 					if err != nil {
 						log.Error(err)
-						return "", err
+						return err
 					}
 					uidMap[util.UID] = *uid
 					data[field.FieldName] = uidMap
@@ -148,23 +282,7 @@ func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (s
 			}
 		}
 	}
-	if _, ok := data[util.UID]; !ok {
-		data[util.UID] = "_:A"
-	}
-	if mutex.TryLock(data[util.ResourceID]) {
-		defer mutex.Unlock(data[util.ResourceID])
-		var uuid string
-		operation := func() error {
-			uuid, err = s.dbclient.CreateEntity(meta, data)
-			return err
-		}
-		err := backoff.Retry(operation, backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount))
-		if err != nil {
-			return "", err
-		}
-		return uuid, nil
-	}
-	return "", fmt.Errorf("can't get resource lock, ignore after timeout reached")
+	return nil
 }
 
 // SyncEntities ...
@@ -193,7 +311,7 @@ func (s EntityService) SyncEntities(meta string, data []map[string]interface{})
 					}
 				}
 				if !found {
-					s.dbclient.DeleteEntity(uid)
+					s.deleteEntity(uid)
 					log.Debugf("entity %s deleted by sync", rid)
 				}
 			}
@@ -222,6 +340,7 @@ func (s EntityService) CreateOrDeleteEdge(fromType string, fromUID string, toTyp
 func (s EntityService) UpdateEntity(uuid string, data map[string]interface{}, option ...util.OptionContext) error {
 	if mutex.TryLock(uuid) {
 		defer mutex.Unlock(uuid)
+		old := s.getObject(uuid)
 		operation := func() error {
 			return s.dbclient.UpdateEntity(uuid, data, option...)
 		}
@@ -230,33 +349,128 @@ func (s EntityService) UpdateEntity(uuid string, data map[string]interface{}, op
 			return err
 		}
 		metrics.DgraphNumUpdateEntity.Inc()
+		if obj := s.getObject(uuid); obj != nil {
+			s.changed(WatchModified, uuid, "", old, obj, nil)
+		}
 		return nil
 	}
 	return fmt.Errorf("can't get resource lock to update %s, ignore after timeout reached", uuid)
 }
 
+// PatchEntity updates the entity with the resourceid of data with the fields given in data, other fields are left as they are
+// fields set to nil are removed from the entity
+// an empty uid is returned if there is no such entity, versions which aren't newer than the current one are ignored
+func (s EntityService) PatchEntity(meta string, data map[string]interface{}) (string, error) {
+	if _, ok := data[util.ResourceID]; !ok {
+		rid, err := getResourceID(meta, data)
+		if err != nil {
+			return "", err
+		}
+		data[util.ResourceID] = rid
+	}
+	current, err := s.getCurrent(data[util.ResourceID])
+	if err != nil {
+		return "", err
+	}
+	if _, deleted := current[util.DeletedAt]; current == nil || deleted {
+		return "", nil
+	}
+	uid := current[util.UID].(string)
+	if _, ok := data[util.ResourceVersion]; ok && !newer(data[util.ResourceVersion], current[util.ResourceVersion]) {
+		log.Debugf("%s %s version %v isn't newer than %v, ignore patch", meta, uid, data[util.ResourceVersion], current[util.ResourceVersion])
+		return uid, nil
+	}
+	// removed fields are null, they are kept for the update to delete them
+	removed := []string{}
+	for k, v := range data {
+		if v == nil {
+			removed = append(removed, k)
+		}
+	}
+	if err := s.prepareEntity(meta, data); err != nil {
+		return "", err
+	}
+	for _, k := range removed {
+		data[k] = nil
+	}
+	delete(data, util.UID)
+	return uid, s.UpdateEntity(uid, data)
+}
+
+// getCurrent returns the object with the given resourceid, nil if there is none
+func (s EntityService) getCurrent(rid interface{}) (map[string]interface{}, error) {
+	q := fmt.Sprintf(`{
+		objects(func: eq(%s, %s)) {
+			uid
+		}
+	}`, util.ResourceID, dgraphString(fmt.Sprint(rid)))
+	ret, err := s.dbclient.ExecuteDgraphQuery(q)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	objs, _ := ret[util.Objects].([]interface{})
+	if len(objs) == 0 {
+		return nil, nil
+	}
+	uid, _ := objs[0].(map[string]interface{})[util.UID].(string)
+	if obj := s.getObject(uid); obj != nil {
+		return obj, nil
+	}
+	return map[string]interface{}{util.UID: uid}, nil
+}
+
+// newer returns whether the resourceversion written by an upsert is newer than the current one
+func newer(version interface{}, current interface{}) bool {
+	v, err := strconv.ParseInt(fmt.Sprint(version), 10, 64)
+	if err != nil {
+		return false
+	}
+	c, _ := strconv.ParseInt(fmt.Sprint(current), 10, 64)
+	return v > c
+}
+
+// EntityError is returned when an entity can't be stored because of its content, e.g. it has no name
+type EntityError struct {
+	Message string
+}
+
+func (e *EntityError) Error() string {
+	return e.Message
+}
+
 // build resourceid
-func getResourceID(meta string, data map[string]interface{}) string {
+func getResourceID(meta string, data map[string]interface{}) (string, error) {
 	ridPrefix := meta + ":"
 	if _, ok := data[util.K8sObj]; ok {
-		if _, ok := data[util.Cluster]; ok {
-			ridPrefix += data[util.Cluster].(string) + ":"
-		}
-		if _, ok := data[util.Namespace]; ok {
-			ridPrefix += data[util.Namespace].(string) + ":"
+		for _, field := range []string{util.Cluster, util.Namespace} {
+			if _, ok := data[field]; !ok {
+				continue
+			}
+			value, ok := data[field].(string)
+			if !ok {
+				return "", &EntityError{Message: fmt.Sprintf("%s of %s must be a string", field, meta)}
+			}
+			ridPrefix += value + ":"
 		}
 	}
-	return ridPrefix + data[util.Name].(string)
+	name, ok := data[util.Name].(string)
+	if !ok || name == "" {
+		return "", &EntityError{Message: fmt.Sprintf("%s has no name to build its resourceid", meta)}
+	}
+	return ridPrefix + name, nil
 }
 
 // build data
-func buildDataMap(k8sObj interface{}, relData interface{}, relType string, cluster interface{}, ns interface{}) map[string]interface{} {
+func buildDataMap(k8sObj interface{}, relData interface{}, relType string, cluster interface{}, ns interface{}) (map[string]interface{}, error) {
 	var dataMap map[string]interface{}
-	if reflect.TypeOf(relData).Kind() == reflect.String {
-		dataMap = make(map[string]interface{})
-		dataMap[util.Name] = relData.(string)
-	} else if reflect.TypeOf(relData).Kind() == reflect.Map {
-		dataMap = relData.(map[string]interface{})
+	switch rel := relData.(type) {
+	case string:
+		dataMap = map[string]interface{}{util.Name: rel}
+	case map[string]interface{}:
+		dataMap = rel
+	default:
+		return nil, &EntityError{Message: fmt.Sprintf("invalid %s relationship %v", relType, relData)}
 	}
 	dataMap[util.ObjType] = relType
 	if k8sObj != nil {
@@ -265,16 +479,24 @@ func buildDataMap(k8sObj interface{}, relData interface{}, relType string, clust
 	_, hasRID := dataMap[util.ResourceID]
 	_, hasUID := dataMap[util.UID]
 	if hasRID || hasUID {
-		return dataMap
+		return dataMap, nil
+	}
+	name, ok := dataMap[util.Name].(string)
+	if !ok {
+		return nil, &EntityError{Message: fmt.Sprintf("%s relationship has no name", relType)}
 	}
 	// compose resource id
 	if strings.EqualFold(relType, util.Cluster) {
-		dataMap[util.ResourceID] = relType + ":" + dataMap[util.Name].(string)
+		dataMap[util.ResourceID] = relType + ":" + name
 	} else if strings.EqualFold(relType, util.Namespace) || strings.EqualFold(relType, util.Node) {
+		c, ok := cluster.(string)
+		if !ok {
+			return nil, &EntityError{Message: fmt.Sprintf("%s relationship %s has no cluster", relType, name)}
+		}
 		dataMap[util.Cluster] = cluster
-		dataMap[util.ResourceID] = relType + ":" + cluster.(string) + ":" + dataMap[util.Name].(string)
+		dataMap[util.ResourceID] = relType + ":" + c + ":" + name
 	} else if strings.EqualFold(relType, util.Application) || strings.EqualFold(relType, util.Asset) {
-		dataMap[util.ResourceID] = relType + ":" + dataMap[util.Name].(string)
+		dataMap[util.ResourceID] = relType + ":" + name
 	} else {
 		if cluster != nil {
 			dataMap[util.Cluster] = cluster
@@ -282,36 +504,206 @@ func buildDataMap(k8sObj interface{}, relData interface{}, relType string, clust
 		if ns != nil {
 			dataMap[util.Namespace] = ns
 		}
-		dataMap[util.ResourceID] = getResourceID(relType, dataMap)
+		rid, err := getResourceID(relType, dataMap)
+		if err != nil {
+			return nil, err
+		}
+		dataMap[util.ResourceID] = rid
 	}
-	return dataMap
+	return dataMap, nil
 }
 
 // get uid from relationship object, if object not present, create it
+// relationships don't point to soft deleted objects, a tombstone found by resourceid is brought back by the create
 func (s EntityService) getUIDFromRelData(data map[string]interface{}, objType string) (*string, error) {
 	if _, ok := data[util.UID]; ok {
 		id := data[util.UID].(string)
+		if _, deleted := s.getObject(id)[util.DeletedAt]; deleted {
+			return nil, &EntityError{Message: fmt.Sprintf("%s relationship %s is deleted", objType, id)}
+		}
 		return &id, nil
 	}
 	// query by ResourceID to get uid
-	qm := map[string][]string{util.ResourceID: {data[util.ResourceID].(string)}, util.ObjType: {objType}, util.Print: {util.ResourceID}}
-	queryService := NewQueryService(s.dbclient)
-	node, err := queryService.GetQueryResult(qm)
+	current, err := s.getCurrent(data[util.ResourceID])
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
-	var uid string
-	if len(node[util.Objects].([]interface{})) > 0 {
+	if _, deleted := current[util.DeletedAt]; current != nil && !deleted {
 		// got existing object id
-		uid = node[util.Objects].([]interface{})[0].(map[string]interface{})[util.UID].(string)
-	} else {
-		// create new object
-		uid, err = s.CreateEntity(objType, data)
-		if err != nil {
-			log.Error(err)
-			return nil, err
-		}
+		uid := current[util.UID].(string)
+		return &uid, nil
+	}
+	// create new object
+	uid, err := s.CreateEntity(objType, data)
+	if err != nil {
+		log.Error(err)
+		return nil, err
 	}
 	return &uid, nil
 }
+
+// operations of a bulk request
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// MaximumBulkOperations is the largest number of operations accepted in a bulk request
+const MaximumBulkOperations = 1000
+
+// BulkOperation is a single change of a bulk request
+// creates need the objtype and the object, updates the uid and the fields to change,
+// deletes the uid or the objtype and resourceid
+type BulkOperation struct {
+	Op         string
+	ObjType    string
+	UID        string
+	ResourceID string
+	Object     map[string]interface{}
+}
+
+// BulkResult is the outcome of a bulk operation, UID is the entity created or changed
+type BulkResult struct {
+	UID     string
+	ObjType string
+	Err     error
+}
+
+// bulkChange keeps what is needed to notify the change made by a bulk operation
+type bulkChange struct {
+	index   int
+	current map[string]interface{}
+	cluster interface{}
+}
+
+// BulkEntities applies a list of creates, updates and deletes with one result per operation
+// the entities are written in batched transactions, an operation failing doesn't stop the others
+// like single creates and updates the resourceids and uids changed are locked while they are written
+func (s EntityService) BulkEntities(ops []BulkOperation) []BulkResult {
+	results := make([]BulkResult, len(ops))
+	clusters := make([]interface{}, len(ops))
+	// creates are prepared before any lock is taken as their relationships may create other entities
+	for i, op := range ops {
+		results[i] = BulkResult{UID: op.UID, ObjType: op.ObjType}
+		if op.Op == BulkCreate {
+			clusters[i] = op.Object[util.Cluster]
+			results[i].Err = s.prepareEntity(op.ObjType, op.Object)
+		}
+	}
+	keys := []string{}
+	for i, op := range ops {
+		if op.Op == BulkCreate && results[i].Err == nil {
+			keys = append(keys, fmt.Sprint(op.Object[util.ResourceID]))
+		} else if op.Op == BulkUpdate {
+			keys = append(keys, op.UID)
+		}
+	}
+	// keys are locked in order so concurrent bulk requests can't wait for each other
+	sort.Strings(keys)
+	locked := map[string]bool{}
+	for _, key := range keys {
+		if _, ok := locked[key]; !ok {
+			locked[key] = mutex.TryLock(key)
+		}
+	}
+	defer func() {
+		for key, ok := range locked {
+			if ok {
+				mutex.Unlock(key)
+			}
+		}
+	}()
+	mutations := []db.Mutation{}
+	changes := []bulkChange{}
+	for i, op := range ops {
+		change := bulkChange{index: i, cluster: clusters[i]}
+		var mutation *db.Mutation
+		switch op.Op {
+		case BulkCreate:
+			metrics.DgraphNumCreateEntity.Inc()
+			if results[i].Err != nil {
+				continue
+			}
+			if !locked[fmt.Sprint(op.Object[util.ResourceID])] {
+				results[i].Err = fmt.Errorf("can't get resource lock, ignore after timeout reached")
+				continue
+			}
+			current, err := s.getCurrent(op.Object[util.ResourceID])
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			change.current = current
+			mutation = &db.Mutation{Action: db.Create, Meta: op.ObjType, Data: op.Object}
+		case BulkUpdate:
+			metrics.DgraphNumUpdateEntity.Inc()
+			if !locked[op.UID] {
+				results[i].Err = fmt.Errorf("can't get resource lock to update %s, ignore after timeout reached", op.UID)
+				continue
+			}
+			change.current = s.getObject(op.UID)
+			mutation = &db.Mutation{Action: db.Update, UID: op.UID, Data: op.Object}
+		case BulkDelete:
+			metrics.DgraphNumDeleteEntity.Inc()
+			if op.UID == "" {
+				current, err := s.getCurrent(op.ResourceID)
+				if err != nil {
+					results[i].Err = err
+					continue
+				}
+				if current == nil {
+					// nothing to delete, same as DeleteEntityByResourceID
+					continue
+				}
+				results[i].UID, _ = current[util.UID].(string)
+			}
+			change.current = s.getObject(results[i].UID)
+			if mutation = deleteMutation(results[i].UID, change.current); mutation == nil {
+				continue
+			}
+		default:
+			results[i].Err = fmt.Errorf("unknown operation %s, expected create, update or delete", op.Op)
+			continue
+		}
+		mutations = append(mutations, *mutation)
+		changes = append(changes, change)
+	}
+	for n, res := range s.dbclient.BulkMutate(mutations) {
+		i, m := changes[n].index, mutations[n]
+		if p, ok := res.Err.(*backoff.PermanentError); ok {
+			res.Err = p.Err
+		}
+		if res.Err != nil {
+			results[i].Err = res.Err
+			continue
+		}
+		results[i].UID = res.UID
+		switch ops[i].Op {
+		case BulkCreate:
+			s.created(res.UID, ops[i].ObjType, changes[n].current, m.Data, changes[n].cluster)
+		case BulkUpdate:
+			if obj := s.getObject(res.UID); obj != nil {
+				s.changed(WatchModified, res.UID, "", changes[n].current, obj, nil)
+			}
+		case BulkDelete:
+			if changes[n].current != nil {
+				s.changed(WatchDeleted, res.UID, "", changes[n].current, nil, nil)
+			}
+		}
+	}
+	return results
+}
+
+// deleteMutation returns the mutation deleting an entity, with soft delete it marks the entity with deletedat
+// nil is returned when a soft deleted entity doesn't exist or is already deleted
+func deleteMutation(uuid string, obj map[string]interface{}) *db.Mutation {
+	if !cfg.ServerCfg.SoftDelete {
+		return &db.Mutation{Action: db.Delete, UID: uuid}
+	}
+	if _, ok := obj[util.DeletedAt]; obj == nil || ok {
+		return nil
+	}
+	return &db.Mutation{Action: db.Update, UID: uuid, Data: map[string]interface{}{util.DeletedAt: time.Now().UTC().Format(time.RFC3339)}}
+}
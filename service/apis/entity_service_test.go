@@ -6,13 +6,14 @@ import (
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/intuit/katlas/service/db"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCreateEntity(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	// create node
@@ -37,7 +38,7 @@ func TestCreateEntity(t *testing.T) {
 }
 
 func TestDeleteEntityByRid(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	s := NewEntityService(dc)
 	// create node
 	node := map[string]interface{}{
@@ -53,7 +54,7 @@ func TestDeleteEntityByRid(t *testing.T) {
 }
 
 func TestCreateEntityWithMeta(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	q := NewQueryService(dc)
@@ -204,7 +205,7 @@ func TestCreateEntityWithMeta(t *testing.T) {
 }
 
 func TestSyncEntities(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	ms := NewMetaService(dc)
 	s := NewEntityService(dc)
@@ -421,7 +422,7 @@ func TestSyncEntities(t *testing.T) {
 }
 
 func TestMultiCreateEntity(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	q := NewQueryService(dc)
 	defer dc.Close()
 	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
@@ -475,7 +476,7 @@ func TestMultiCreateEntity(t *testing.T) {
 }
 
 func TestCreateRelByUid(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	q := NewQueryService(dc)
@@ -628,7 +629,7 @@ func TestCreateRelByUid(t *testing.T) {
 }
 
 func TestEntityUpdate(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	s := NewEntityService(dc)
 	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
@@ -674,3 +675,115 @@ func TestEntityUpdate(t *testing.T) {
 	defer s.DeleteEntity(nid)
 	defer s.DeleteEntity(nid2)
 }
+
+func TestBulkEntities(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	pid, _ := s.CreateEntity("bulkpod", map[string]interface{}{"objtype": "bulkpod", "name": "bulkpod01", "resourceversion": "1"})
+	ret := s.BulkEntities([]BulkOperation{
+		{Op: BulkCreate, ObjType: "bulkpod", Object: map[string]interface{}{"objtype": "bulkpod", "name": "bulkpod02", "resourceversion": "1"}},
+		{Op: BulkUpdate, UID: pid, Object: map[string]interface{}{"name": "bulkpod01", "phase": "Running", "resourceversion": "2"}},
+		{Op: BulkUpdate, UID: "0xfffffff", Object: map[string]interface{}{"phase": "Running"}},
+		{Op: "patch", UID: pid},
+		{Op: BulkCreate, ObjType: "bulkpod", Object: map[string]interface{}{"objtype": "bulkpod", "name": "bulkpod03", "resourceversion": "1"}},
+	})
+	assert.Equal(t, 5, len(ret))
+	assert.Nil(t, ret[0].Err)
+	assert.NotEmpty(t, ret[0].UID)
+	assert.Equal(t, "bulkpod", ret[0].ObjType)
+	assert.Nil(t, ret[1].Err)
+	assert.Equal(t, pid, ret[1].UID)
+	assert.Equal(t, "Running", s.getObject(pid)["phase"])
+	// failed operations don't stop the others
+	assert.NotNil(t, ret[2].Err)
+	assert.NotNil(t, ret[3].Err)
+	assert.Nil(t, ret[4].Err)
+	assert.NotEqual(t, ret[0].UID, ret[4].UID)
+
+	ret = s.BulkEntities([]BulkOperation{
+		{Op: BulkDelete, UID: pid},
+		{Op: BulkDelete, ObjType: "bulkpod", ResourceID: s.getObject(ret[0].UID)["resourceid"].(string)},
+		{Op: BulkDelete, ObjType: "bulkpod", ResourceID: "bulkpod:none"},
+		{Op: BulkDelete, UID: ret[4].UID},
+	})
+	for _, r := range ret {
+		assert.Nil(t, r.Err)
+	}
+	assert.Nil(t, s.getObject(pid))
+	assert.Nil(t, s.getObject(ret[1].UID))
+	assert.Nil(t, s.getObject(ret[3].UID))
+}
+
+func TestBulkUpdateMissingEntity(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	pid, _ := s.CreateEntity("bulkpod", map[string]interface{}{"objtype": "bulkpod", "name": "bulkpod04", "resourceversion": "1"})
+	// the target of an edge exists as a uid only, it isn't an entity
+	assert.Nil(t, dc.CreateOrDeleteEdge("bulkpod", pid, "bulknode", "0xffffff0", "runson", db.Create))
+	ret := s.BulkEntities([]BulkOperation{
+		{Op: BulkUpdate, UID: "0xffffff0", Object: map[string]interface{}{"phase": "Running"}},
+		{Op: BulkUpdate, UID: "0xffffff1", Object: map[string]interface{}{"phase": "Running"}},
+	})
+	for _, r := range ret {
+		assert.IsType(t, &db.NotFoundError{}, r.Err)
+	}
+	assert.Nil(t, s.getObject("0xffffff0"))
+	assert.Nil(t, s.getObject("0xffffff1"))
+}
+
+func TestBulkEntitiesLock(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	rid := "bulkpod:bulkpod05"
+	assert.True(t, mutex.TryLock(rid))
+	done := make(chan []BulkResult)
+	go func() {
+		// the same resourceid twice in a request doesn't wait for itself
+		done <- s.BulkEntities([]BulkOperation{
+			{Op: BulkCreate, ObjType: "bulkpod", Object: map[string]interface{}{"objtype": "bulkpod", "name": "bulkpod05", "resourceid": rid, "resourceversion": "1"}},
+			{Op: BulkCreate, ObjType: "bulkpod", Object: map[string]interface{}{"objtype": "bulkpod", "name": "bulkpod05", "resourceid": rid, "resourceversion": "2"}},
+		})
+	}()
+	select {
+	case <-done:
+		t.Fatal("bulk create written while its resourceid is locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+	mutex.Unlock(rid)
+	ret := <-done
+	assert.Nil(t, ret[0].Err)
+	assert.Nil(t, ret[1].Err)
+	assert.Equal(t, ret[0].UID, ret[1].UID)
+	assert.Equal(t, "2", s.getObject(ret[0].UID)["resourceversion"])
+	// the lock is released once the request is done
+	assert.True(t, mutex.TryLock(rid))
+	mutex.Unlock(rid)
+}
+
+func TestPatchEntity(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	pid, _ := s.CreateEntity("patchpod", map[string]interface{}{"objtype": "patchpod", "name": "patchpod01", "phase": "Pending", "ip": "10.0.0.1", "resourceversion": "1"})
+
+	uid, err := s.PatchEntity("patchpod", map[string]interface{}{"name": "patchpod01", "phase": "Running", "resourceversion": "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, pid, uid)
+	obj := s.getObject(pid)
+	assert.Equal(t, "Running", obj["phase"])
+	// fields which aren't given are left as they are
+	assert.Equal(t, "10.0.0.1", obj["ip"])
+
+	// older versions are ignored
+	uid, err = s.PatchEntity("patchpod", map[string]interface{}{"name": "patchpod01", "phase": "Failed", "resourceversion": "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, pid, uid)
+	assert.Equal(t, "Running", s.getObject(pid)["phase"])
+
+	uid, err = s.PatchEntity("patchpod", map[string]interface{}{"name": "patchpod02", "phase": "Running", "resourceversion": "2"})
+	assert.Nil(t, err)
+	assert.Empty(t, uid)
+}
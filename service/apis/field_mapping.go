@@ -0,0 +1,255 @@
+package apis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/intuit/katlas/service/util"
+)
+
+// defaultPaths are the paths of the fields every kubernetes object has, used when a metadata field has no jsonpath
+var defaultPaths = map[string]string{
+	util.Name:            ".metadata.name",
+	util.Namespace:       ".metadata.namespace",
+	util.ResourceVersion: ".metadata.resourceVersion",
+	util.CreationTime:    ".metadata.creationTimestamp",
+	util.Labels:          ".metadata.labels",
+}
+
+// builtinKinds are the types the collector always sent as raw kubernetes objects,
+// typed objects from informers have no kind so their metadata is enough to recognize them
+var builtinKinds = map[string]bool{
+	util.Namespace:   true,
+	util.Deployment:  true,
+	util.Ingress:     true,
+	util.Pod:         true,
+	util.ReplicaSet:  true,
+	util.Service:     true,
+	util.StatefulSet: true,
+}
+
+// IsK8sObject returns true if the object of type meta is a raw kubernetes object rather than a normalized entity
+// objects need a kind and metadata, the kind is optional for the built in types
+func IsK8sObject(meta string, obj map[string]interface{}) bool {
+	if _, ok := obj[util.Metadata].(map[string]interface{}); !ok {
+		return false
+	}
+	_, hasKind := obj["kind"]
+	return hasKind || builtinKinds[meta]
+}
+
+// MapK8sObject builds an entity from a raw kubernetes object with the jsonpath of the metadata fields
+// e.g. {"fieldname": "numreplicas", "jsonpath": ".spec.replicas"}, well known fields like name, namespace
+// and labels are read from the object metadata without a jsonpath, fields not found in the object are left out
+// fields whose path runs into an explicit null are set to nil, partial objects of updates send removed fields as null
+func MapK8sObject(clusterName string, meta string, obj map[string]interface{}, fields []MetadataField) (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		util.ObjType: meta,
+		util.K8sObj:  util.K8sObj,
+	}
+	for _, f := range fields {
+		path := f.JSONPath
+		if path == "" {
+			if f.FieldName == util.Cluster {
+				if clusterName != "" {
+					data[util.Cluster] = clusterName
+				}
+				continue
+			}
+			path = defaultPaths[f.FieldName]
+		}
+		if path == "" {
+			continue
+		}
+		val, err := EvalJSONPath(obj, path)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %v", f.FieldName, meta, err)
+		}
+		if val != nil {
+			data[f.FieldName] = val
+		} else if removedPath(obj, path) {
+			data[f.FieldName] = nil
+		}
+	}
+	name, _ := EvalJSONPath(obj, defaultPaths[util.Name])
+	if _, ok := name.(string); !ok {
+		return nil, fmt.Errorf("%s object has no name", meta)
+	}
+	data[util.Name] = name
+	return data, nil
+}
+
+// EvalJSONPath returns the value at path in obj, nil if the path doesn't exist
+// paths are a subset of kubernetes jsonpath: keys separated by dots, list indexes, quoted keys, unions and wildcards
+// e.g. .spec.replicas, .metadata.ownerReferences[0].name, .metadata.labels['app.kubernetes.io/name'],
+// .metadata.labels['app','k8s-app'] or .spec.containers[*].image
+// paths with a union or a wildcard return the list of values found
+func EvalJSONPath(obj interface{}, path string) (interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := []interface{}{obj}
+	multi := false
+	for _, step := range steps {
+		next := []interface{}{}
+		for _, v := range cur {
+			next = append(next, step.apply(v)...)
+		}
+		cur = next
+		multi = multi || step.wildcard || len(step.keys) > 1
+	}
+	if len(cur) == 0 {
+		return nil, nil
+	}
+	if multi {
+		return cur, nil
+	}
+	return cur[0], nil
+}
+
+// removedPath returns whether path runs into an explicit null in obj, or past the end of a list present in obj
+// keys which aren't in obj aren't removed, partial objects leave out the fields which didn't change
+func removedPath(obj interface{}, path string) bool {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return false
+	}
+	cur := obj
+	for _, step := range steps {
+		if cur == nil {
+			return true
+		}
+		if step.wildcard || len(step.keys) > 1 {
+			return false
+		}
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			if len(step.keys) != 1 {
+				return false
+			}
+			val, ok := v[step.keys[0]]
+			if !ok {
+				return false
+			}
+			cur = val
+		case []interface{}:
+			if step.index < 0 {
+				return false
+			}
+			if step.index >= len(v) {
+				return true
+			}
+			cur = v[step.index]
+		default:
+			return false
+		}
+	}
+	return cur == nil
+}
+
+// jsonPathStep selects keys of a map, an index of a list when index isn't negative, or everything with a wildcard
+type jsonPathStep struct {
+	keys     []string
+	index    int
+	wildcard bool
+}
+
+// apply returns the values the step selects in v, missing and null values are left out
+func (step jsonPathStep) apply(v interface{}) []interface{} {
+	vals := []interface{}{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := step.keys
+		if step.wildcard {
+			keys = make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+		}
+		for _, k := range keys {
+			if val, ok := v[k]; ok && val != nil {
+				vals = append(vals, val)
+			}
+		}
+	case []interface{}:
+		if step.wildcard {
+			for _, val := range v {
+				if val != nil {
+					vals = append(vals, val)
+				}
+			}
+		} else if step.index >= 0 && step.index < len(v) && v[step.index] != nil {
+			vals = append(vals, v[step.index])
+		}
+	}
+	return vals
+}
+
+// parseJSONPath splits a path like .a.b[0]['c.d'] into its steps
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	p := strings.TrimSpace(path)
+	// kubectl style {.spec.replicas} is accepted as well
+	if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+		p = p[1 : len(p)-1]
+	}
+	if !strings.HasPrefix(p, ".") && !strings.HasPrefix(p, "[") {
+		return nil, fmt.Errorf("invalid jsonpath %s, expected a path starting with .", path)
+	}
+	steps := []jsonPathStep{}
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			j := i + 1
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("invalid jsonpath %s, empty key at %d", path, i)
+			}
+			key := p[i+1 : j]
+			steps = append(steps, jsonPathStep{keys: []string{key}, index: -1, wildcard: key == "*"})
+			i = j
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jsonpath %s, missing ]", path)
+			}
+			step, err := parseJSONPathBracket(p[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonpath %s, %v", path, err)
+			}
+			steps = append(steps, step)
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("invalid jsonpath %s, unexpected %c at %d", path, p[i], i)
+		}
+	}
+	return steps, nil
+}
+
+// parseJSONPathBracket parses the inside of brackets, an index, a wildcard or a list of quoted keys
+func parseJSONPathBracket(inner string) (jsonPathStep, error) {
+	if inner == "*" {
+		return jsonPathStep{index: -1, wildcard: true}, nil
+	}
+	if len(inner) > 0 && (inner[0] == '\'' || inner[0] == '"') {
+		step := jsonPathStep{index: -1}
+		for _, k := range strings.Split(inner, ",") {
+			k = strings.TrimSpace(k)
+			if len(k) < 2 || (k[0] != '\'' && k[0] != '"') || k[len(k)-1] != k[0] {
+				return step, fmt.Errorf("bad key %s", k)
+			}
+			step.keys = append(step.keys, k[1:len(k)-1])
+		}
+		return step, nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil || n < 0 {
+		return jsonPathStep{}, fmt.Errorf("bad index %s", inner)
+	}
+	return jsonPathStep{index: n}, nil
+}
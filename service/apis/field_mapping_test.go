@@ -0,0 +1,214 @@
+package apis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/intuit/katlas/service/db"
+	"github.com/stretchr/testify/assert"
+)
+
+const testJob = `{
+	"apiVersion": "batch/v1",
+	"kind": "Job",
+	"metadata": {
+		"name": "pi",
+		"namespace": "default",
+		"resourceVersion": "42",
+		"creationTimestamp": "2018-11-01T10:00:00Z",
+		"labels": {"app.kubernetes.io/name": "pi"},
+		"ownerReferences": [{"kind": "CronJob", "name": "pi-cron"}]
+	},
+	"spec": {"completions": 3},
+	"status": {"succeeded": 1}
+}`
+
+func TestEvalJSONPath(t *testing.T) {
+	obj := map[string]interface{}{}
+	json.Unmarshal([]byte(testJob), &obj)
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{".metadata.name", "pi"},
+		{"{.spec.completions}", float64(3)},
+		{".metadata.ownerReferences[0].name", "pi-cron"},
+		{".metadata.labels['app.kubernetes.io/name']", "pi"},
+		{`.metadata.labels["app.kubernetes.io/name"]`, "pi"},
+		{".metadata.ownerReferences[1].name", nil},
+		{".spec.parallelism", nil},
+		{".metadata.name.first", nil},
+		{".metadata[0]", nil},
+		{".metadata.labels['app.kubernetes.io/name','app']", []interface{}{"pi"}},
+		{".metadata.labels['app']", nil},
+		{".metadata.ownerReferences[*].kind", []interface{}{"CronJob"}},
+		{".metadata.ownerReferences[*].uid", nil},
+		{".spec.*", []interface{}{float64(3)}},
+	}
+	for _, test := range tests {
+		val, err := EvalJSONPath(obj, test.path)
+		assert.Nil(t, err, test.path)
+		assert.Equal(t, test.want, val, test.path)
+	}
+	for _, path := range []string{"metadata.name", ".metadata..name", ".metadata.labels[a", ".containers[-1]", ".items[x]", ".metadata.labels['a',b]"} {
+		_, err := EvalJSONPath(obj, path)
+		assert.NotNil(t, err, path)
+	}
+}
+
+func TestMapK8sObject(t *testing.T) {
+	obj := map[string]interface{}{}
+	json.Unmarshal([]byte(testJob), &obj)
+	assert.True(t, IsK8sObject("job", obj))
+	assert.False(t, IsK8sObject("job", map[string]interface{}{"metadata": map[string]interface{}{"name": "pi"}}))
+	assert.False(t, IsK8sObject("job", map[string]interface{}{"name": "pi", "metadata": "job"}))
+	// built in types are recognized from their metadata, typed objects of informers have no kind
+	assert.True(t, IsK8sObject("pod", map[string]interface{}{"metadata": map[string]interface{}{"name": "pod01"}}))
+	fields := []MetadataField{
+		{FieldName: "name"}, {FieldName: "namespace"}, {FieldName: "cluster"}, {FieldName: "labels"},
+		{FieldName: "resourceversion"}, {FieldName: "creationtime"},
+		{FieldName: "owner", JSONPath: ".metadata.ownerReferences[0].name"},
+		{FieldName: "completions", JSONPath: ".spec.completions"},
+		{FieldName: "parallelism", JSONPath: ".spec.parallelism"},
+	}
+	data, err := MapK8sObject("cluster01", "job", obj, fields)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"objtype":         "job",
+		"k8sobj":          "k8sobj",
+		"name":            "pi",
+		"namespace":       "default",
+		"cluster":         "cluster01",
+		"labels":          map[string]interface{}{"app.kubernetes.io/name": "pi"},
+		"resourceversion": "42",
+		"creationtime":    "2018-11-01T10:00:00Z",
+		"owner":           "pi-cron",
+		"completions":     float64(3),
+	}, data)
+	rid, _ := getResourceID("job", data)
+	assert.Equal(t, "job:cluster01:default:pi", rid)
+
+	// cluster scoped objects have no namespace in the resourceid
+	data, _ = MapK8sObject("", "clusterrole", map[string]interface{}{"kind": "ClusterRole", "metadata": map[string]interface{}{"name": "view"}}, fields)
+	rid, _ = getResourceID("clusterrole", data)
+	assert.Equal(t, "clusterrole:view", rid)
+	_, err = getResourceID("job", map[string]interface{}{"k8sobj": "k8sobj", "namespace": "default"})
+	assert.IsType(t, &EntityError{}, err)
+
+	_, err = MapK8sObject("cluster01", "job", map[string]interface{}{"kind": "Job", "metadata": map[string]interface{}{}}, fields)
+	assert.NotNil(t, err)
+	_, err = MapK8sObject("cluster01", "job", obj, []MetadataField{{FieldName: "owner", JSONPath: "owner"}})
+	assert.NotNil(t, err)
+}
+
+func TestMapBuiltinKinds(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	metaSvc := loadTestMetadata(t, dc)
+	mapObject := func(objtype string, raw string) map[string]interface{} {
+		obj := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(raw), &obj))
+		fields, err := metaSvc.GetMetadataFields(objtype)
+		assert.Nil(t, err)
+		data, err := MapK8sObject("cluster01", objtype, obj, fields)
+		assert.Nil(t, err)
+		return data
+	}
+
+	pod := mapObject("pod", `{"metadata": {"name": "pod01", "namespace": "default", "resourceVersion": "7",
+		"ownerReferences": [{"kind": "ReplicaSet", "name": "rs01"}]},
+		"spec": {"nodeName": "node01", "containers": [{"name": "app", "image": "nginx"}]},
+		"status": {"phase": "Running", "podIP": "10.0.0.1", "startTime": "2018-11-01T10:00:00Z"}}`)
+	assert.Equal(t, "pod01", pod["name"])
+	assert.Equal(t, "default", pod["namespace"])
+	assert.Equal(t, "cluster01", pod["cluster"])
+	assert.Equal(t, "Running", pod["phase"])
+	assert.Equal(t, "node01", pod["nodename"])
+	assert.Equal(t, "10.0.0.1", pod["ip"])
+	assert.Equal(t, "rs01", pod["owner"])
+	assert.Equal(t, "ReplicaSet", pod["ownertype"])
+	assert.Equal(t, "2018-11-01T10:00:00Z", pod["starttime"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "app", "image": "nginx"}}, pod["containers"])
+	rid, _ := getResourceID("pod", pod)
+	assert.Equal(t, "pod:cluster01:default:pod01", rid)
+	_, ok := pod["volumes"]
+	assert.False(t, ok)
+
+	deployment := mapObject("deployment", `{"metadata": {"name": "dep01", "namespace": "default", "resourceVersion": "3",
+		"labels": {"app": "web", "k8s-app": "web-ui"}},
+		"spec": {"replicas": 2, "strategy": {"type": "RollingUpdate"}}, "status": {"availableReplicas": 1}}`)
+	assert.Equal(t, float64(2), deployment["numreplicas"])
+	assert.Equal(t, float64(1), deployment["availablereplicas"])
+	assert.Equal(t, "RollingUpdate", deployment["strategy"])
+	assert.Equal(t, []interface{}{"web", "web-ui"}, deployment["application"])
+
+	ns := mapObject("namespace", `{"metadata": {"name": "default", "resourceVersion": "1",
+		"annotations": {"iks.intuit.com/service-asset-id": "1234"}}}`)
+	assert.Equal(t, "1234", ns["asset"])
+	rid, _ = getResourceID("namespace", ns)
+	assert.Equal(t, "namespace:cluster01:default", rid)
+
+	// the owner of a pod is linked with the type of its owner reference
+	s := NewEntityService(dc)
+	uid, err := s.CreateEntity("pod", pod)
+	assert.Nil(t, err)
+	obj := s.getObject(uid)
+	assert.Equal(t, "replicaset", obj["ownertype"])
+	owner := obj["owner"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "replicaset", s.getObject(owner["uid"].(string))["objtype"])
+}
+
+func TestPatchRemovedFields(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	metaSvc := loadTestMetadata(t, dc)
+	fields, err := metaSvc.GetMetadataFields("pod")
+	assert.Nil(t, err)
+	mapObject := func(raw string) map[string]interface{} {
+		obj := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(raw), &obj))
+		data, err := MapK8sObject("cluster01", "pod", obj, fields)
+		assert.Nil(t, err)
+		return data
+	}
+	s := NewEntityService(dc)
+	uid, err := s.CreateEntity("pod", mapObject(`{"metadata": {"name": "pod02", "namespace": "default", "resourceVersion": "7",
+		"labels": {"app": "web"}, "ownerReferences": [{"kind": "ReplicaSet", "name": "rs02"}]},
+		"spec": {"nodeName": "node02"}, "status": {"phase": "Running"}}`))
+	assert.Nil(t, err)
+	obj := s.getObject(uid)
+	assert.NotNil(t, obj["nodename"])
+	assert.NotNil(t, obj["owner"])
+
+	// the collector sends the tracked fields which were removed as null
+	partial := mapObject(`{"metadata": {"name": "pod02", "namespace": "default", "resourceVersion": "8",
+		"labels": null, "ownerReferences": null}, "spec": {"nodeName": null}}`)
+	assert.Contains(t, partial, "nodename")
+	assert.Nil(t, partial["nodename"])
+	_, ok := partial["phase"]
+	assert.False(t, ok, "fields left out of the partial object are kept")
+	patched, err := s.PatchEntity("pod", partial)
+	assert.Nil(t, err)
+	assert.Equal(t, uid, patched)
+	obj = s.getObject(uid)
+	for _, field := range []string{"nodename", "owner", "ownertype", "labels"} {
+		_, ok := obj[field]
+		assert.False(t, ok, "%s should be removed", field)
+	}
+	assert.Equal(t, "Running", obj["phase"])
+	assert.Equal(t, "8", obj["resourceversion"])
+}
+
+// loadTestMetadata creates the metadata of data/meta.json
+func loadTestMetadata(t *testing.T, dc db.IDGClient) *MetaService {
+	metaSvc := NewMetaService(dc)
+	meta, err := ioutil.ReadFile("../data/meta.json")
+	assert.Nil(t, err)
+	var jsonData []map[string]interface{}
+	json.Unmarshal(meta, &jsonData)
+	for _, data := range jsonData {
+		metaSvc.CreateMetadata(data)
+	}
+	return metaSvc
+}
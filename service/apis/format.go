@@ -0,0 +1,276 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/intuit/katlas/service/util"
+)
+
+// Content types of the alternative formats of query results
+const (
+	FormatCSV   = "text/csv"
+	FormatYAML  = "application/yaml"
+	FormatTable = "text/plain"
+)
+
+// NegotiateFormat returns the first alternative format accepted by the Accept header,
+// empty when json should be returned
+func NegotiateFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		switch mediaType {
+		case FormatCSV, FormatTable:
+			return mediaType
+		case FormatYAML, "application/x-yaml", "text/yaml":
+			return FormatYAML
+		case "application/json", "*/*":
+			return ""
+		}
+	}
+	return ""
+}
+
+// EncodeResponse converts a query response to the given format
+// csv and table contain the objects only, yaml the whole response
+func EncodeResponse(format string, response map[string]interface{}) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		buf := &bytes.Buffer{}
+		writeYAML(buf, response, 0)
+		return buf.Bytes(), nil
+	case FormatCSV:
+		header, rows := FlattenObjects(response[util.Objects])
+		buf := &bytes.Buffer{}
+		w := csv.NewWriter(buf)
+		w.Write(header)
+		w.WriteAll(rows)
+		return buf.Bytes(), w.Error()
+	case FormatTable:
+		header, rows := FlattenObjects(response[util.Objects])
+		buf := &bytes.Buffer{}
+		w := tabwriter.NewWriter(buf, 0, 8, 3, ' ', 0)
+		for i := range header {
+			header[i] = strings.ToUpper(header[i])
+		}
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported format %s", format)
+}
+
+// FlattenObjects turns the objects of a query result into rows of columns
+// the fields of nested blocks become columns prefixed with the relation, e.g. ~runsOn.name,
+// and an object is repeated for every nested object
+func FlattenObjects(data interface{}) ([]string, [][]string) {
+	objects, _ := data.([]interface{})
+	records := []map[string]string{}
+	columns := map[string]bool{}
+	for _, o := range objects {
+		if obj, ok := o.(map[string]interface{}); ok {
+			records = append(records, flattenObject("", obj)...)
+		}
+	}
+	for _, rec := range records {
+		for k := range rec {
+			columns[k] = true
+		}
+	}
+	header := []string{}
+	for k := range columns {
+		header = append(header, k)
+	}
+	sort.Slice(header, func(i, j int) bool {
+		// fields of an object come before the fields of its nested blocks
+		di, dj := strings.Count(header[i], "."), strings.Count(header[j], ".")
+		if di != dj {
+			return di < dj
+		}
+		return header[i] < header[j]
+	})
+	rows := [][]string{}
+	for _, rec := range records {
+		row := make([]string, len(header))
+		for i, k := range header {
+			row[i] = rec[k]
+		}
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+// flattenObject returns the records of an object, one per combination of its nested objects
+func flattenObject(prefix string, obj map[string]interface{}) []map[string]string {
+	records := []map[string]string{{}}
+	keys := []string{}
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		nested, ok := nestedObjects(obj[k])
+		if !ok {
+			for _, rec := range records {
+				rec[prefix+k] = formatValue(obj[k])
+			}
+			continue
+		}
+		children := []map[string]string{}
+		for _, n := range nested {
+			children = append(children, flattenObject(prefix+k+".", n)...)
+		}
+		if len(children) == 0 {
+			continue
+		}
+		expanded := []map[string]string{}
+		for _, rec := range records {
+			for _, child := range children {
+				r := map[string]string{}
+				for ck, cv := range rec {
+					r[ck] = cv
+				}
+				for ck, cv := range child {
+					r[ck] = cv
+				}
+				expanded = append(expanded, r)
+			}
+		}
+		records = expanded
+	}
+	return records
+}
+
+// nestedObjects returns the objects of a nested block, false for any other value
+func nestedObjects(v interface{}) ([]map[string]interface{}, bool) {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+	objs := []map[string]interface{}{}
+	for _, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		objs = append(objs, obj)
+	}
+	return objs, true
+}
+
+// formatValue returns a scalar as plain text and anything else as json
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// writeYAML writes a json value as block style yaml with sorted keys
+func writeYAML(buf *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			buf.WriteString(pad + "{}\n")
+			return
+		}
+		keys := []string{}
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString(pad + yamlScalar(k) + ":")
+			writeYAMLValue(buf, val[k], indent+1)
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			buf.WriteString(pad + "[]\n")
+			return
+		}
+		for _, item := range val {
+			buf.WriteString(pad + "-")
+			writeYAMLValue(buf, item, indent+1)
+		}
+	default:
+		buf.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLValue writes the value following a key or list marker, nested on the next lines if not empty
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+	default:
+		buf.WriteString(" " + yamlScalar(v) + "\n")
+		return
+	}
+	buf.WriteString("\n")
+	writeYAML(buf, v, indent)
+}
+
+// yamlScalar returns a scalar as yaml, strings are quoted when they could be read as another type
+func yamlScalar(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if needsQuotes(val) {
+			b, _ := json.Marshal(val)
+			return string(b)
+		}
+		return val
+	}
+	return formatValue(v)
+}
+
+// needsQuotes reports whether a plain string would not be read back as the same string
+func needsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	// uids such as 0x41 are hex numbers in yaml
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	return strings.ContainsAny(s, "\n\t\\\"") || strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":")
+}
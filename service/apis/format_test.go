@@ -0,0 +1,93 @@
+package apis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"status": float64(200),
+		"count":  float64(2),
+		"objects": []interface{}{
+			map[string]interface{}{
+				"uid":  "0x41",
+				"name": "pod01",
+				"runsOn": []interface{}{
+					map[string]interface{}{"name": "node01"},
+				},
+				"~owns": []interface{}{
+					map[string]interface{}{"name": "rs01"},
+					map[string]interface{}{"name": "rs02"},
+				},
+			},
+			map[string]interface{}{
+				"uid":    "0x42",
+				"name":   "pod02",
+				"labels": map[string]interface{}{"app": "web"},
+			},
+		},
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	assert.Equal(t, FormatCSV, NegotiateFormat("text/csv"))
+	assert.Equal(t, FormatYAML, NegotiateFormat("application/x-yaml;q=0.9, application/json"))
+	assert.Equal(t, FormatTable, NegotiateFormat("text/plain"))
+	assert.Equal(t, "", NegotiateFormat("application/json, text/csv"))
+	assert.Equal(t, "", NegotiateFormat(""))
+}
+
+func TestFlattenObjects(t *testing.T) {
+	header, rows := FlattenObjects(testResponse()["objects"])
+	assert.Equal(t, []string{"labels", "name", "uid", "runsOn.name", "~owns.name"}, header)
+	// nested objects repeat their parent
+	assert.Equal(t, [][]string{
+		{"", "pod01", "0x41", "node01", "rs01"},
+		{"", "pod01", "0x41", "node01", "rs02"},
+		{`{"app":"web"}`, "pod02", "0x42", "", ""},
+	}, rows)
+}
+
+func TestEncodeResponse(t *testing.T) {
+	csv, err := EncodeResponse(FormatCSV, testResponse())
+	assert.Nil(t, err)
+	assert.Equal(t, "labels,name,uid,runsOn.name,~owns.name\n"+
+		",pod01,0x41,node01,rs01\n"+
+		",pod01,0x41,node01,rs02\n"+
+		"\"{\"\"app\"\":\"\"web\"\"}\",pod02,0x42,,\n", string(csv))
+
+	table, err := EncodeResponse(FormatTable, testResponse())
+	assert.Nil(t, err)
+	assert.Equal(t, "LABELS          NAME    UID    RUNSON.NAME   ~OWNS.NAME\n"+
+		"                pod01   0x41   node01        rs01\n"+
+		"                pod01   0x41   node01        rs02\n"+
+		"{\"app\":\"web\"}   pod02   0x42                 \n", string(table))
+
+	yaml, err := EncodeResponse(FormatYAML, testResponse())
+	assert.Nil(t, err)
+	assert.Equal(t, `count: 2
+objects:
+  -
+    name: pod01
+    runsOn:
+      -
+        name: node01
+    uid: "0x41"
+    ~owns:
+      -
+        name: rs01
+      -
+        name: rs02
+  -
+    labels:
+      app: web
+    name: pod02
+    uid: "0x42"
+status: 200
+`, string(yaml))
+
+	_, err = EncodeResponse("text/html", testResponse())
+	assert.NotNil(t, err)
+}
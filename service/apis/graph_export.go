@@ -0,0 +1,264 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
+)
+
+// Graph export formats, passed with ?export= or the matching Accept header
+const (
+	ExportDOT       = "dot"
+	ExportGraphML   = "graphml"
+	ExportCytoscape = "cytoscape"
+)
+
+// exportContentTypes maps export formats to the content type of the response
+var exportContentTypes = map[string]string{
+	ExportDOT:       "text/vnd.graphviz",
+	ExportGraphML:   "application/graphml+xml",
+	ExportCytoscape: "application/vnd.cytoscape+json",
+}
+
+// ExportContentType returns the content type of an export format
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+// NegotiateExport returns the export format asked for with the export query param or the Accept header,
+// empty when the result shouldn't be exported as a graph
+func NegotiateExport(export string, accept string) (string, error) {
+	if export != "" {
+		if _, ok := exportContentTypes[export]; !ok {
+			return "", fmt.Errorf("export must be one of %s, %s or %s", ExportDOT, ExportGraphML, ExportCytoscape)
+		}
+		return export, nil
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		for format, contentType := range exportContentTypes {
+			if mediaType == contentType {
+				return format, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// GraphNode is an entity of an exported graph
+type GraphNode struct {
+	ID      string
+	ObjType string
+	Name    string
+}
+
+// Label returns the text drawn for the node, objtype and name
+func (n GraphNode) Label() string {
+	if n.Name == "" {
+		return n.ObjType
+	}
+	return n.ObjType + "/" + n.Name
+}
+
+// GraphEdge is a relationship between two nodes, from the entity holding the relationship field
+type GraphEdge struct {
+	Source   string
+	Target   string
+	Relation string
+}
+
+// Graph is the node/edge form of a nested query result
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// GraphService converts query results to graphs of entities and relationships
+type GraphService struct {
+	dbclient db.IDGClient
+}
+
+// NewGraphService creates a new GraphService with the given dgraph client.
+func NewGraphService(dc db.IDGClient) *GraphService {
+	return &GraphService{dc}
+}
+
+// Export converts the objects of a query result to a graph and serializes it in the given format
+func (s GraphService) Export(format string, data map[string]interface{}) ([]byte, error) {
+	relations, err := s.getRelations()
+	if err != nil {
+		return nil, err
+	}
+	g := BuildGraph(data[util.Objects], relations)
+	switch format {
+	case ExportDOT:
+		return g.DOT(), nil
+	case ExportGraphML:
+		return g.GraphML(), nil
+	case ExportCytoscape:
+		return g.Cytoscape()
+	}
+	return nil, fmt.Errorf("unsupported export format %s", format)
+}
+
+// getRelations returns the names of the relationship fields in metadata
+func (s GraphService) getRelations() (map[string]bool, error) {
+	m := NewMetaService(s.dbclient)
+	metas, err := m.GetAllMetadata()
+	if err != nil {
+		log.Error(err)
+		return nil, fmt.Errorf("Failed to connect to dgraph to get metadata")
+	}
+	relations := map[string]bool{}
+	for _, meta := range metas {
+		for _, item := range meta.Fields {
+			if item.FieldType == util.Relationship {
+				relations[strings.ToLower(item.FieldName)] = true
+			}
+		}
+	}
+	return relations, nil
+}
+
+// BuildGraph walks nested objects and returns every object with a uid as a node
+// nested objects under a relationship field become edges, under ~field the edge points back to the parent
+func BuildGraph(objects interface{}, relations map[string]bool) *Graph {
+	g := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	nodes := map[string]int{}
+	edges := map[GraphEdge]bool{}
+	var walk func(obj map[string]interface{}) string
+	walk = func(obj map[string]interface{}) string {
+		uid, _ := obj[util.UID].(string)
+		if uid == "" {
+			return ""
+		}
+		objtype, _ := obj[util.ObjType].(string)
+		name, _ := obj[util.Name].(string)
+		if i, ok := nodes[uid]; !ok {
+			nodes[uid] = len(g.Nodes)
+			g.Nodes = append(g.Nodes, GraphNode{ID: uid, ObjType: objtype, Name: name})
+		} else if g.Nodes[i].ObjType == "" && g.Nodes[i].Name == "" {
+			// the same entity may be returned with more fields elsewhere in the result
+			g.Nodes[i].ObjType, g.Nodes[i].Name = objtype, name
+		}
+		keys := []string{}
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			rel := strings.TrimPrefix(k, "~")
+			if !relations[strings.ToLower(rel)] {
+				continue
+			}
+			for _, child := range childObjects(obj[k]) {
+				cuid := walk(child)
+				if cuid == "" {
+					continue
+				}
+				edge := GraphEdge{Source: uid, Target: cuid, Relation: rel}
+				if strings.HasPrefix(k, "~") {
+					edge = GraphEdge{Source: cuid, Target: uid, Relation: rel}
+				}
+				if !edges[edge] {
+					edges[edge] = true
+					g.Edges = append(g.Edges, edge)
+				}
+			}
+		}
+		return uid
+	}
+	for _, o := range childObjects(objects) {
+		walk(o)
+	}
+	return g
+}
+
+// childObjects returns the objects of a nested block, which dgraph returns as a list or a single object
+func childObjects(v interface{}) []map[string]interface{} {
+	objs := []map[string]interface{}{}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		objs = append(objs, val)
+	case []interface{}:
+		for _, item := range val {
+			if obj, ok := item.(map[string]interface{}); ok {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	return objs
+}
+
+// DOT serializes the graph for graphviz
+func (g Graph) DOT() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("digraph katlas {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(buf, "\t%s [label=%s];\n", dotQuote(n.ID), dotQuote(n.Label()))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(buf, "\t%s -> %s [label=%s];\n", dotQuote(e.Source), dotQuote(e.Target), dotQuote(e.Relation))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// GraphML serializes the graph as graphml with objtype, name and label node attributes
+func (g Graph) GraphML() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	buf.WriteString("\t" + `<key id="objtype" for="node" attr.name="objtype" attr.type="string"/>` + "\n")
+	buf.WriteString("\t" + `<key id="name" for="node" attr.name="name" attr.type="string"/>` + "\n")
+	buf.WriteString("\t" + `<key id="label" for="all" attr.name="label" attr.type="string"/>` + "\n")
+	buf.WriteString("\t" + `<graph id="katlas" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(buf, "\t\t<node id=\"%s\">\n", xmlEscape(n.ID))
+		fmt.Fprintf(buf, "\t\t\t<data key=\"objtype\">%s</data>\n", xmlEscape(n.ObjType))
+		fmt.Fprintf(buf, "\t\t\t<data key=\"name\">%s</data>\n", xmlEscape(n.Name))
+		fmt.Fprintf(buf, "\t\t\t<data key=\"label\">%s</data>\n", xmlEscape(n.Label()))
+		buf.WriteString("\t\t</node>\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(buf, "\t\t<edge source=\"%s\" target=\"%s\">\n", xmlEscape(e.Source), xmlEscape(e.Target))
+		fmt.Fprintf(buf, "\t\t\t<data key=\"label\">%s</data>\n", xmlEscape(e.Relation))
+		buf.WriteString("\t\t</edge>\n")
+	}
+	buf.WriteString("\t</graph>\n</graphml>\n")
+	return buf.Bytes()
+}
+
+func xmlEscape(s string) string {
+	buf := &bytes.Buffer{}
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
+
+// Cytoscape serializes the graph as cytoscape.js elements
+func (g Graph) Cytoscape() ([]byte, error) {
+	nodes := []interface{}{}
+	for _, n := range g.Nodes {
+		nodes = append(nodes, map[string]interface{}{"data": map[string]interface{}{
+			"id": n.ID, "objtype": n.ObjType, "name": n.Name, "label": n.Label(),
+		}})
+	}
+	edges := []interface{}{}
+	for _, e := range g.Edges {
+		edges = append(edges, map[string]interface{}{"data": map[string]interface{}{
+			"id": e.Source + "-" + e.Relation + "-" + e.Target, "source": e.Source, "target": e.Target, "label": e.Relation,
+		}})
+	}
+	return json.Marshal(map[string]interface{}{"elements": map[string]interface{}{"nodes": nodes, "edges": edges}})
+}
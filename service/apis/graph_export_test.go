@@ -0,0 +1,93 @@
+package apis
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGraphObjects() interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"uid":     "0x1",
+			"objtype": "pod",
+			"name":    "pod01",
+			"nodename": []interface{}{
+				map[string]interface{}{"uid": "0x2", "objtype": "node", "name": "node01"},
+			},
+			"~owner": []interface{}{
+				map[string]interface{}{"uid": "0x3", "objtype": "service", "name": "svc \"web\""},
+			},
+			"labels": []interface{}{"app"},
+		},
+		map[string]interface{}{
+			"uid":     "0x4",
+			"objtype": "pod",
+			"name":    "pod02",
+			"nodename": []interface{}{
+				map[string]interface{}{"uid": "0x2"},
+			},
+		},
+	}
+}
+
+func TestBuildGraph(t *testing.T) {
+	g := BuildGraph(testGraphObjects(), map[string]bool{"nodename": true, "owner": true})
+	assert.Equal(t, []GraphNode{
+		{ID: "0x1", ObjType: "pod", Name: "pod01"},
+		{ID: "0x2", ObjType: "node", Name: "node01"},
+		{ID: "0x3", ObjType: "service", Name: "svc \"web\""},
+		{ID: "0x4", ObjType: "pod", Name: "pod02"},
+	}, g.Nodes)
+	// ~owner points from the nested object back to its parent
+	assert.Equal(t, []GraphEdge{
+		{Source: "0x1", Target: "0x2", Relation: "nodename"},
+		{Source: "0x3", Target: "0x1", Relation: "owner"},
+		{Source: "0x4", Target: "0x2", Relation: "nodename"},
+	}, g.Edges)
+
+	// nested objects of fields not defined as relationship are left out
+	g = BuildGraph(testGraphObjects(), map[string]bool{"owner": true})
+	assert.Equal(t, 3, len(g.Nodes))
+	assert.Equal(t, 1, len(g.Edges))
+}
+
+func TestGraphFormats(t *testing.T) {
+	g := &Graph{
+		Nodes: []GraphNode{{ID: "0x1", ObjType: "pod", Name: "pod01"}, {ID: "0x2", ObjType: "node", Name: "a<b>"}},
+		Edges: []GraphEdge{{Source: "0x1", Target: "0x2", Relation: "nodename"}},
+	}
+	assert.Equal(t, "digraph katlas {\n"+
+		"\t\"0x1\" [label=\"pod/pod01\"];\n"+
+		"\t\"0x2\" [label=\"node/a<b>\"];\n"+
+		"\t\"0x1\" -> \"0x2\" [label=\"nodename\"];\n"+
+		"}\n", string(g.DOT()))
+
+	graphml := string(g.GraphML())
+	assert.Contains(t, graphml, "<node id=\"0x2\">\n\t\t\t<data key=\"objtype\">node</data>\n\t\t\t<data key=\"name\">a&lt;b&gt;</data>")
+	assert.Contains(t, graphml, "<edge source=\"0x1\" target=\"0x2\">\n\t\t\t<data key=\"label\">nodename</data>")
+
+	b, err := g.Cytoscape()
+	assert.Nil(t, err)
+	var cy map[string]interface{}
+	assert.Nil(t, json.Unmarshal(b, &cy))
+	elements := cy["elements"].(map[string]interface{})
+	assert.Equal(t, 2, len(elements["nodes"].([]interface{})))
+	edge := elements["edges"].([]interface{})[0].(map[string]interface{})["data"]
+	assert.Equal(t, map[string]interface{}{"id": "0x1-nodename-0x2", "source": "0x1", "target": "0x2", "label": "nodename"}, edge)
+}
+
+func TestNegotiateExport(t *testing.T) {
+	format, err := NegotiateExport("graphml", "")
+	assert.Nil(t, err)
+	assert.Equal(t, ExportGraphML, format)
+	format, err = NegotiateExport("", "text/vnd.graphviz")
+	assert.Nil(t, err)
+	assert.Equal(t, ExportDOT, format)
+	format, err = NegotiateExport("", "application/json")
+	assert.Nil(t, err)
+	assert.Equal(t, "", format)
+	_, err = NegotiateExport("png", "")
+	assert.Equal(t, "export must be one of dot, graphml or cytoscape", err.Error())
+}
@@ -0,0 +1,638 @@
+package apis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// GraphQLError is an error of a GraphQL request, with the location in the query when known
+type GraphQLError struct {
+	Message   string               `json:"message"`
+	Locations []GraphQLErrLocation `json:"locations,omitempty"`
+}
+
+// GraphQLErrLocation is a position in a GraphQL query
+type GraphQLErrLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *GraphQLError) Error() string {
+	if len(e.Locations) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s at line %d column %d", e.Message, e.Locations[0].Line, e.Locations[0].Column)
+}
+
+func newGraphQLError(pos GraphQLErrLocation, format string, args ...interface{}) *GraphQLError {
+	return &GraphQLError{Message: fmt.Sprintf(format, args...), Locations: []GraphQLErrLocation{pos}}
+}
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind gqlTokenKind
+	text string
+	pos  GraphQLErrLocation
+}
+
+// lexGraphQL splits a GraphQL document into tokens, commas and comments are ignored
+func lexGraphQL(query string) ([]gqlToken, error) {
+	tokens := []gqlToken{}
+	line, lineStart := 1, 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		pos := GraphQLErrLocation{Line: line, Column: i - lineStart + 1}
+		switch {
+		case c == '\n':
+			i++
+			line, lineStart = line+1, i
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "..."):
+			tokens = append(tokens, gqlToken{gqlPunct, "...", pos})
+			i += 3
+		case strings.ContainsRune("!$():=@[]{}|", rune(c)):
+			tokens = append(tokens, gqlToken{gqlPunct, string(c), pos})
+			i++
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			j := i + 1
+			for j < len(query) && (query[j] == '_' || query[j] >= 'A' && query[j] <= 'Z' || query[j] >= 'a' && query[j] <= 'z' || query[j] >= '0' && query[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, gqlToken{gqlName, query[i:j], pos})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			kind := gqlInt
+			for j < len(query) && strings.ContainsRune("0123456789.eE+-", rune(query[j])) {
+				if strings.ContainsRune(".eE", rune(query[j])) {
+					kind = gqlFloat
+				}
+				j++
+			}
+			text := query[i:j]
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, newGraphQLError(pos, "invalid number %s", text)
+			}
+			tokens = append(tokens, gqlToken{kind, text, pos})
+			i = j
+		case c == '"':
+			if strings.HasPrefix(query[i:], `"""`) {
+				return nil, newGraphQLError(pos, "block strings are not supported")
+			}
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(query) && query[j] != '"' && query[j] != '\n'; j++ {
+				if query[j] != '\\' {
+					sb.WriteByte(query[j])
+					continue
+				}
+				if j+1 >= len(query) {
+					break
+				}
+				j++
+				switch query[j] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				case 'r':
+					sb.WriteByte('\r')
+				case 'b':
+					sb.WriteByte('\b')
+				case 'f':
+					sb.WriteByte('\f')
+				case 'u':
+					if j+4 >= len(query) {
+						return nil, newGraphQLError(pos, "invalid unicode escape")
+					}
+					r, err := strconv.ParseUint(query[j+1:j+5], 16, 32)
+					if err != nil {
+						return nil, newGraphQLError(pos, "invalid unicode escape")
+					}
+					sb.WriteRune(rune(r))
+					j += 4
+				default:
+					sb.WriteByte(query[j])
+				}
+			}
+			if j >= len(query) || query[j] != '"' {
+				return nil, newGraphQLError(pos, "unterminated string")
+			}
+			tokens = append(tokens, gqlToken{gqlString, sb.String(), pos})
+			i = j + 1
+		default:
+			r, _ := utf8.DecodeRuneInString(query[i:])
+			return nil, newGraphQLError(pos, "unexpected character %q", r)
+		}
+	}
+	return append(tokens, gqlToken{gqlEOF, "", GraphQLErrLocation{Line: line, Column: len(query) - lineStart + 1}}), nil
+}
+
+// gqlDocument is a parsed GraphQL request
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	kind       string
+	name       string
+	vars       []*gqlVarDef
+	selections []*gqlSelection
+	pos        GraphQLErrLocation
+}
+
+type gqlVarDef struct {
+	name     string
+	typ      string
+	nonNull  bool
+	defValue *gqlValue
+	pos      GraphQLErrLocation
+}
+
+type gqlFragment struct {
+	name       string
+	typeCond   string
+	selections []*gqlSelection
+	pos        GraphQLErrLocation
+}
+
+// gqlSelection is a field, a fragment spread or an inline fragment
+type gqlSelection struct {
+	alias      string
+	name       string
+	args       []*gqlArg
+	directives []*gqlDirective
+	selections []*gqlSelection
+	// spread is the name of a fragment spread
+	spread string
+	// inline is true for inline fragments, typeCond is empty if there is no type condition
+	inline   bool
+	typeCond string
+	pos      GraphQLErrLocation
+}
+
+func (s *gqlSelection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type gqlArg struct {
+	name  string
+	value *gqlValue
+	pos   GraphQLErrLocation
+}
+
+type gqlDirective struct {
+	name string
+	args []*gqlArg
+	pos  GraphQLErrLocation
+}
+
+type gqlValueKind int
+
+const (
+	gqlVariable gqlValueKind = iota
+	gqlIntValue
+	gqlFloatValue
+	gqlStringValue
+	gqlBoolValue
+	gqlNullValue
+	gqlEnumValue
+	gqlListValue
+	gqlObjectValue
+)
+
+type gqlValue struct {
+	kind   gqlValueKind
+	text   string
+	list   []*gqlValue
+	fields map[string]*gqlValue
+	pos    GraphQLErrLocation
+}
+
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+}
+
+// parseGraphQL parses a GraphQL request document of operations and fragments
+func parseGraphQL(query string) (*gqlDocument, error) {
+	tokens, err := lexGraphQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens}
+	doc := &gqlDocument{fragments: map[string]*gqlFragment{}}
+	for p.peek().kind != gqlEOF {
+		t := p.peek()
+		switch {
+		case t.kind == gqlPunct && t.text == "{":
+			sels, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: sels, pos: t.pos})
+		case t.kind == gqlName && (t.text == "query" || t.text == "mutation" || t.text == "subscription"):
+			op, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case t.kind == gqlName && t.text == "fragment":
+			f, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if doc.fragments[f.name] != nil {
+				return nil, newGraphQLError(f.pos, "fragment %s is defined more than once", f.name)
+			}
+			doc.fragments[f.name] = f
+		default:
+			return nil, p.unexpected(t, "query, fragment or {")
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &GraphQLError{Message: "document has no operation"}
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != gqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == gqlPunct && t.text == text
+}
+
+func (p *gqlParser) unexpected(t gqlToken, expected string) error {
+	if t.kind == gqlEOF {
+		return newGraphQLError(t.pos, "unexpected end of query, expected %s", expected)
+	}
+	return newGraphQLError(t.pos, "unexpected %q, expected %s", t.text, expected)
+}
+
+func (p *gqlParser) expectPunct(text string) (gqlToken, error) {
+	if !p.isPunct(text) {
+		return p.peek(), p.unexpected(p.peek(), text)
+	}
+	return p.next(), nil
+}
+
+func (p *gqlParser) expectName() (gqlToken, error) {
+	if p.peek().kind != gqlName {
+		return p.peek(), p.unexpected(p.peek(), "name")
+	}
+	return p.next(), nil
+}
+
+func (p *gqlParser) parseOperation() (*gqlOperation, error) {
+	t := p.next()
+	op := &gqlOperation{kind: t.text, pos: t.pos}
+	if p.peek().kind == gqlName {
+		op.name = p.next().text
+	}
+	if p.isPunct("(") {
+		p.next()
+		for !p.isPunct(")") {
+			v, err := p.parseVarDef()
+			if err != nil {
+				return nil, err
+			}
+			op.vars = append(op.vars, v)
+		}
+		p.next()
+	}
+	if _, err := p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = sels
+	return op, nil
+}
+
+func (p *gqlParser) parseVarDef() (*gqlVarDef, error) {
+	t, err := p.expectPunct("$")
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	v := &gqlVarDef{name: name.text, pos: t.pos}
+	if _, err := p.expectPunct(":"); err != nil {
+		return nil, err
+	}
+	// list types are only checked to be well formed, their items are passed as given
+	depth := 0
+	for p.isPunct("[") {
+		p.next()
+		depth++
+	}
+	typ, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	v.typ = typ.text
+	for ; depth > 0; depth-- {
+		if p.isPunct("!") {
+			p.next()
+		}
+		if _, err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+		v.typ = "[" + v.typ + "]"
+	}
+	if p.isPunct("!") {
+		p.next()
+		v.nonNull = true
+	}
+	if p.isPunct("=") {
+		p.next()
+		if v.defValue, err = p.parseValue(true); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (p *gqlParser) parseFragment() (*gqlFragment, error) {
+	t := p.next()
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if name.text == "on" {
+		return nil, p.unexpected(name, "fragment name")
+	}
+	if on, err := p.expectName(); err != nil || on.text != "on" {
+		return nil, p.unexpected(on, "on")
+	}
+	cond, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &gqlFragment{name: name.text, typeCond: cond.text, selections: sels, pos: t.pos}, nil
+}
+
+func (p *gqlParser) parseSelectionSet() ([]*gqlSelection, error) {
+	if _, err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	sels := []*gqlSelection{}
+	for !p.isPunct("}") {
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, p.unexpected(p.peek(), "field")
+	}
+	p.next()
+	return sels, nil
+}
+
+func (p *gqlParser) parseSelection() (*gqlSelection, error) {
+	t := p.peek()
+	sel := &gqlSelection{pos: t.pos}
+	var err error
+	if p.isPunct("...") {
+		p.next()
+		if p.peek().kind == gqlName && p.peek().text != "on" {
+			sel.spread = p.next().text
+			sel.directives, err = p.parseDirectives()
+			return sel, err
+		}
+		sel.inline = true
+		if p.peek().kind == gqlName {
+			p.next()
+			cond, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			sel.typeCond = cond.text
+		}
+		if sel.directives, err = p.parseDirectives(); err != nil {
+			return nil, err
+		}
+		sel.selections, err = p.parseSelectionSet()
+		return sel, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return nil, p.unexpected(t, "field")
+	}
+	sel.name = name.text
+	if p.isPunct(":") {
+		p.next()
+		if name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+		sel.alias, sel.name = sel.name, name.text
+	}
+	if sel.args, err = p.parseArgs(); err != nil {
+		return nil, err
+	}
+	if sel.directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		if sel.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *gqlParser) parseArgs() ([]*gqlArg, error) {
+	args := []*gqlArg{}
+	if !p.isPunct("(") {
+		return args, nil
+	}
+	p.next()
+	for !p.isPunct(")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range args {
+			if a.name == name.text {
+				return nil, newGraphQLError(name.pos, "argument %s is given more than once", name.text)
+			}
+		}
+		args = append(args, &gqlArg{name: name.text, value: v, pos: name.pos})
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *gqlParser) parseDirectives() ([]*gqlDirective, error) {
+	directives := []*gqlDirective{}
+	for p.isPunct("@") {
+		t := p.next()
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, &gqlDirective{name: name.text, args: args, pos: t.pos})
+	}
+	return directives, nil
+}
+
+// parseValue parses an argument value, variables aren't allowed in default values
+func (p *gqlParser) parseValue(constant bool) (*gqlValue, error) {
+	t := p.next()
+	v := &gqlValue{text: t.text, pos: t.pos}
+	switch t.kind {
+	case gqlInt:
+		v.kind = gqlIntValue
+	case gqlFloat:
+		v.kind = gqlFloatValue
+	case gqlString:
+		v.kind = gqlStringValue
+	case gqlName:
+		switch t.text {
+		case "true", "false":
+			v.kind = gqlBoolValue
+		case "null":
+			v.kind = gqlNullValue
+		default:
+			v.kind = gqlEnumValue
+		}
+	case gqlPunct:
+		switch t.text {
+		case "$":
+			if constant {
+				return nil, newGraphQLError(t.pos, "variables can't be used in default values")
+			}
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			v.kind, v.text = gqlVariable, name.text
+		case "[":
+			v.kind = gqlListValue
+			for !p.isPunct("]") {
+				item, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.list = append(v.list, item)
+			}
+			p.next()
+		case "{":
+			v.kind = gqlObjectValue
+			v.fields = map[string]*gqlValue{}
+			for !p.isPunct("}") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if _, err := p.expectPunct(":"); err != nil {
+					return nil, err
+				}
+				if v.fields[name.text], err = p.parseValue(constant); err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+		default:
+			return nil, p.unexpected(t, "value")
+		}
+	default:
+		return nil, p.unexpected(t, "value")
+	}
+	return v, nil
+}
+
+// resolve returns the go value of a GraphQL value, numbers are float64 like decoded json
+func (v *gqlValue) resolve(vars map[string]interface{}) (interface{}, error) {
+	switch v.kind {
+	case gqlVariable:
+		val, ok := vars[v.text]
+		if !ok {
+			return nil, newGraphQLError(v.pos, "variable $%s is not defined", v.text)
+		}
+		return val, nil
+	case gqlIntValue, gqlFloatValue:
+		return strconv.ParseFloat(v.text, 64)
+	case gqlStringValue, gqlEnumValue:
+		return v.text, nil
+	case gqlBoolValue:
+		return v.text == "true", nil
+	case gqlListValue:
+		list := []interface{}{}
+		for _, item := range v.list {
+			val, err := item.resolve(vars)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, val)
+		}
+		return list, nil
+	case gqlObjectValue:
+		obj := map[string]interface{}{}
+		for k, item := range v.fields {
+			val, err := item.resolve(vars)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = val
+		}
+		return obj, nil
+	}
+	return nil, nil
+}
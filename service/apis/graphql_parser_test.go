@@ -0,0 +1,84 @@
+package apis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	doc, err := parseGraphQL(`
+	# pods and their node
+	query Pods($ns: String = "default", $first: Int!) {
+		pods: pod(namespace: $ns, first: $first) @include(if: true) {
+			uid
+			name
+			... on Pod { phase }
+			...nodeFields
+		}
+	}
+	fragment nodeFields on Pod { nodename { name } }`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, len(doc.operations))
+	assert.Equal(t, 1, len(doc.fragments))
+	op := doc.operations[0]
+	assert.Equal(t, "query", op.kind)
+	assert.Equal(t, "Pods", op.name)
+	if assert.Equal(t, 2, len(op.vars)) {
+		assert.Equal(t, "ns", op.vars[0].name)
+		assert.Equal(t, "String", op.vars[0].typ)
+		assert.False(t, op.vars[0].nonNull)
+		assert.Equal(t, "default", op.vars[0].defValue.text)
+		assert.True(t, op.vars[1].nonNull)
+	}
+	pods := op.selections[0]
+	assert.Equal(t, "pods", pods.key())
+	assert.Equal(t, "pod", pods.name)
+	assert.Equal(t, 2, len(pods.args))
+	assert.Equal(t, "include", pods.directives[0].name)
+	if assert.Equal(t, 4, len(pods.selections)) {
+		assert.True(t, pods.selections[2].inline)
+		assert.Equal(t, "Pod", pods.selections[2].typeCond)
+		assert.Equal(t, "nodeFields", pods.selections[3].spread)
+	}
+	assert.Equal(t, "Pod", doc.fragments["nodeFields"].typeCond)
+
+	// shorthand query
+	doc, err = parseGraphQL(`{ pod { name } }`)
+	assert.Nil(t, err)
+	assert.Equal(t, "query", doc.operations[0].kind)
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	tests := map[string]string{
+		`{ pod { name }`:               `unexpected end of query, expected field at line 1 column 15`,
+		"{\n  pod(name: ) { name } }":  `unexpected ")", expected value at line 2 column 13`,
+		`{ pod(name: "abc) { name } }`: `unterminated string at line 1 column 13`,
+	}
+	for query, expected := range tests {
+		_, err := parseGraphQL(query)
+		if assert.NotNil(t, err, query) {
+			assert.Equal(t, expected, err.Error(), query)
+			_, ok := err.(*GraphQLError)
+			assert.True(t, ok)
+		}
+	}
+}
+
+func TestGraphQLValueResolve(t *testing.T) {
+	doc, err := parseGraphQL(`{ pod(a: [1, 2.5, "x", true, null, ENUM, $v], b: {c: $v}) { name } }`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	args := doc.operations[0].selections[0].args
+	v, err := args[0].value.resolve(map[string]interface{}{"v": "var"})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{float64(1), 2.5, "x", true, nil, "ENUM", "var"}, v)
+	v, err = args[1].value.resolve(map[string]interface{}{"v": "var"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"c": "var"}, v)
+	_, err = args[1].value.resolve(nil)
+	assert.Equal(t, "variable $v is not defined at line 1 column 54", err.Error())
+}
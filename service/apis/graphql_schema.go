@@ -0,0 +1,254 @@
+package apis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/service/util"
+)
+
+// GraphQL scalar types of metadata fields
+const (
+	GraphQLID      = "ID"
+	GraphQLString  = "String"
+	GraphQLInt     = "Int"
+	GraphQLFloat   = "Float"
+	GraphQLBoolean = "Boolean"
+	GraphQLJSON    = "JSON"
+)
+
+// scalarTypes maps metadata field types to GraphQL scalars, any other type is a String
+var scalarTypes = map[string]string{
+	"int":     GraphQLInt,
+	"long":    GraphQLInt,
+	"double":  GraphQLFloat,
+	"float":   GraphQLFloat,
+	"bool":    GraphQLBoolean,
+	util.JSON: GraphQLJSON,
+}
+
+var graphQLNameRegex = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// GraphQLField is a field of a generated GraphQL type
+type GraphQLField struct {
+	Name string
+	// Predicate is the dgraph predicate of the field, ~field for reverse relationships
+	Predicate string
+	// Type is a scalar, an object type or a union of object types
+	Type string
+	List bool
+	// ObjType filters the objects of a reverse relationship, which can point to any type
+	ObjType string
+}
+
+// IsScalar returns true if the field has no sub selections
+func (f GraphQLField) IsScalar() bool {
+	switch f.Type {
+	case GraphQLID, GraphQLString, GraphQLInt, GraphQLFloat, GraphQLBoolean, GraphQLJSON:
+		return true
+	}
+	return false
+}
+
+// typeRef returns the type of the field as written in the schema
+func (f GraphQLField) typeRef() string {
+	if f.List {
+		return "[" + f.Type + "!]"
+	}
+	if f.Type == GraphQLID {
+		return f.Type + "!"
+	}
+	return f.Type
+}
+
+// GraphQLType is an object type generated from the metadata of an objtype
+type GraphQLType struct {
+	Name    string
+	ObjType string
+	Fields  []*GraphQLField
+}
+
+// Field returns the field with the given name, nil if the type has no such field
+func (t *GraphQLType) Field(name string) *GraphQLField {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// GraphQLSchema is the GraphQL schema generated from metadata
+// the query type has one field per type, named after the objtype, returning the objects of that type
+type GraphQLSchema struct {
+	Types  map[string]*GraphQLType
+	Unions map[string][]string
+	// Roots maps query fields to type names
+	Roots map[string]string
+}
+
+// BuildGraphQLSchema generates a GraphQL schema from metadata
+// each metadata becomes a type, relationship fields become object or list fields and every relationship
+// adds a reverse list field named <objtype>By<Field> to the types it points to
+func BuildGraphQLSchema(metas []Metadata) *GraphQLSchema {
+	s := &GraphQLSchema{Types: map[string]*GraphQLType{}, Unions: map[string][]string{}, Roots: map[string]string{}}
+	byObjType := map[string]*GraphQLType{}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Name < metas[j].Name })
+	for _, meta := range metas {
+		name := graphQLTypeName(meta.Name)
+		if !graphQLNameRegex.MatchString(meta.Name) || s.Types[name] != nil || isBuiltinGraphQLType(name) {
+			log.Warnf("metadata %s can't be used as a GraphQL type", meta.Name)
+			continue
+		}
+		t := &GraphQLType{Name: name, ObjType: meta.Name, Fields: []*GraphQLField{{Name: util.UID, Predicate: util.UID, Type: GraphQLID}}}
+		s.Types[name] = t
+		s.Roots[meta.Name] = name
+		byObjType[strings.ToLower(meta.Name)] = t
+	}
+	// scalar fields first so reverse fields can't take their names
+	for _, meta := range metas {
+		t := byObjType[strings.ToLower(meta.Name)]
+		if t == nil || t.ObjType != meta.Name {
+			continue
+		}
+		for _, f := range meta.Fields {
+			if f.FieldType == util.Relationship || !graphQLNameRegex.MatchString(f.FieldName) || t.Field(f.FieldName) != nil {
+				continue
+			}
+			typ, ok := scalarTypes[f.FieldType]
+			if !ok {
+				typ = GraphQLString
+			}
+			t.Fields = append(t.Fields, &GraphQLField{Name: f.FieldName, Predicate: f.FieldName, Type: typ})
+		}
+	}
+	reverse := []*GraphQLField{}
+	owners := []*GraphQLType{}
+	for _, meta := range metas {
+		t := byObjType[strings.ToLower(meta.Name)]
+		if t == nil || t.ObjType != meta.Name {
+			continue
+		}
+		for _, f := range meta.Fields {
+			if f.FieldType != util.Relationship || !graphQLNameRegex.MatchString(f.FieldName) || t.Field(f.FieldName) != nil {
+				continue
+			}
+			targets := []string{}
+			for _, ref := range strings.Split(f.RefDataType, ",") {
+				if target := byObjType[strings.ToLower(strings.TrimSpace(ref))]; target != nil {
+					targets = append(targets, target.Name)
+				}
+			}
+			if len(targets) == 0 {
+				log.Warnf("relationship %s of %s refers to unknown metadata %s", f.FieldName, meta.Name, f.RefDataType)
+				continue
+			}
+			typ := targets[0]
+			if len(targets) > 1 {
+				typ = t.Name + graphQLTypeName(f.FieldName)
+				s.Unions[typ] = targets
+			}
+			t.Fields = append(t.Fields, &GraphQLField{Name: f.FieldName, Predicate: f.FieldName, Type: typ, List: strings.EqualFold(f.Cardinality, util.Many)})
+			for _, target := range targets {
+				reverse = append(reverse, &GraphQLField{
+					Name:      meta.Name + "By" + graphQLTypeName(f.FieldName),
+					Predicate: "~" + f.FieldName,
+					Type:      t.Name,
+					List:      true,
+					ObjType:   meta.Name,
+				})
+				owners = append(owners, s.Types[target])
+			}
+		}
+	}
+	for i, f := range reverse {
+		if owners[i].Field(f.Name) != nil {
+			log.Warnf("reverse relationship %s of %s conflicts with an existing field", f.Name, owners[i].Name)
+			continue
+		}
+		owners[i].Fields = append(owners[i].Fields, f)
+	}
+	return s
+}
+
+// graphQLTypeName capitalizes a name to be used as a type name
+func graphQLTypeName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func isBuiltinGraphQLType(name string) bool {
+	switch name {
+	case GraphQLID, GraphQLString, GraphQLInt, GraphQLFloat, GraphQLBoolean, GraphQLJSON, "Query":
+		return true
+	}
+	return strings.HasPrefix(name, "__")
+}
+
+// possibleTypes returns the object types a field type can resolve to
+func (s *GraphQLSchema) possibleTypes(typ string) []string {
+	if types, ok := s.Unions[typ]; ok {
+		return types
+	}
+	return []string{typ}
+}
+
+// rootArgs returns the arguments of list fields: uid, pagination and an equality filter per scalar field
+func rootArgs(t *GraphQLType) []string {
+	args := []string{}
+	for _, f := range t.Fields {
+		if f.IsScalar() && f.Type != GraphQLJSON {
+			args = append(args, f.Name+": "+f.Type)
+		}
+	}
+	return append(args, util.First+": Int", util.Offset+": Int")
+}
+
+// SDL returns the schema in the GraphQL schema definition language
+func (s *GraphQLSchema) SDL() string {
+	var sb strings.Builder
+	sb.WriteString("scalar JSON\n\ntype Query {\n")
+	roots := []string{}
+	for name := range s.Roots {
+		roots = append(roots, name)
+	}
+	sort.Strings(roots)
+	for _, name := range roots {
+		t := s.Types[s.Roots[name]]
+		fmt.Fprintf(&sb, "\t%s(%s): [%s!]!\n", name, strings.Join(rootArgs(t), ", "), t.Name)
+	}
+	sb.WriteString("}\n")
+	names := []string{}
+	for name := range s.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := s.Types[name]
+		fmt.Fprintf(&sb, "\ntype %s {\n", t.Name)
+		for _, f := range t.Fields {
+			args := ""
+			if f.List {
+				if target, ok := s.Types[f.Type]; ok {
+					args = "(" + strings.Join(rootArgs(target), ", ") + ")"
+				}
+			}
+			fmt.Fprintf(&sb, "\t%s%s: %s\n", f.Name, args, f.typeRef())
+		}
+		sb.WriteString("}\n")
+	}
+	unions := []string{}
+	for name := range s.Unions {
+		unions = append(unions, name)
+	}
+	sort.Strings(unions)
+	for _, name := range unions {
+		fmt.Fprintf(&sb, "\nunion %s = %s\n", name, strings.Join(s.Unions[name], " | "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,647 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
+)
+
+// objtype of every object block, used to resolve unions and __typename
+const gqlObjTypeAlias = "gqlobjtype"
+
+// IGraphQLService define interfaces to query entities with GraphQL
+type IGraphQLService interface {
+	// regenerate the schema from metadata
+	Refresh() error
+	// get the current schema
+	Schema() (*GraphQLSchema, error)
+	// run a GraphQL query
+	Execute(req GraphQLRequest) (*GraphQLObject, error)
+}
+
+// GraphQLService implements IGraphQLService, queries are translated to a single dgraph query
+type GraphQLService struct {
+	dbclient db.IDGClient
+	mu       sync.RWMutex
+	schema   *GraphQLSchema
+}
+
+// GraphQLRequest is the body of a GraphQL request
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// NewGraphQLService creates a new GraphQLService with the given dgraph client.
+func NewGraphQLService(dc db.IDGClient) *GraphQLService {
+	return &GraphQLService{dbclient: dc}
+}
+
+// Refresh regenerates the schema from metadata, called at startup and whenever metadata changes
+func (s *GraphQLService) Refresh() error {
+	metas, err := NewMetaService(s.dbclient).GetAllMetadata()
+	if err != nil {
+		log.Error(err)
+		return fmt.Errorf("Failed to connect to dgraph to get metadata")
+	}
+	schema := BuildGraphQLSchema(metas)
+	s.mu.Lock()
+	s.schema = schema
+	s.mu.Unlock()
+	log.Infof("GraphQL schema generated with %d types", len(schema.Types))
+	return nil
+}
+
+// Schema returns the current schema, generating it if it wasn't yet
+func (s *GraphQLService) Schema() (*GraphQLSchema, error) {
+	s.mu.RLock()
+	schema := s.schema
+	s.mu.RUnlock()
+	if schema != nil {
+		return schema, nil
+	}
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.schema, nil
+}
+
+// Execute runs a GraphQL query, errors in the request are returned as *GraphQLError
+func (s *GraphQLService) Execute(req GraphQLRequest) (*GraphQLObject, error) {
+	schema, err := s.Schema()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := op.variables(req.Variables)
+	if err != nil {
+		return nil, err
+	}
+	pl := &gqlPlanner{schema: schema, doc: doc, vars: vars, visiting: map[string]bool{}}
+	roots, err := pl.planRoot(op.selections)
+	if err != nil {
+		return nil, err
+	}
+	q := dgraphGraphQLQuery(roots)
+	log.Debugf("dgraph query for GraphQL %#v:\n %s", req.Query, q)
+	data := NewGraphQLObject()
+	if q != "" {
+		ret, err := s.dbclient.ExecuteDgraphQuery(q)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range ret {
+			if r, ok := rootAliasIndex(k); ok && r < len(roots) {
+				roots[r].raw = v
+			}
+		}
+	}
+	for _, r := range roots {
+		data.Set(r.key, r.result())
+	}
+	return data, nil
+}
+
+// GraphQLObject is a result object keeping its fields in the order they were selected
+type GraphQLObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewGraphQLObject creates an empty GraphQLObject
+func NewGraphQLObject() *GraphQLObject {
+	return &GraphQLObject{values: map[string]interface{}{}}
+}
+
+// Set adds or replaces a field
+func (o *GraphQLObject) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Get returns the value of a field
+func (o *GraphQLObject) Get(key string) interface{} {
+	return o.values[key]
+}
+
+// MarshalJSON writes the fields in order
+func (o *GraphQLObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("{")
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteString(":")
+		v, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// operation returns the operation to run, by name if the document has several
+func (doc *gqlDocument) operation(name string) (*gqlOperation, error) {
+	var op *gqlOperation
+	for _, o := range doc.operations {
+		if name == "" && len(doc.operations) > 1 {
+			return nil, &GraphQLError{Message: "operationName is required when the document has several operations"}
+		}
+		if name == "" || o.name == name {
+			op = o
+			break
+		}
+	}
+	if op == nil {
+		return nil, &GraphQLError{Message: fmt.Sprintf("operation %s not found", name)}
+	}
+	if op.kind != "query" {
+		return nil, newGraphQLError(op.pos, "only queries are supported, not %s", op.kind)
+	}
+	return op, nil
+}
+
+// variables returns the values of the variables of an operation, falling back to their defaults
+func (op *gqlOperation) variables(given map[string]interface{}) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, v := range op.vars {
+		if val, ok := given[v.name]; ok && val != nil {
+			vars[v.name] = val
+			continue
+		}
+		if v.defValue != nil {
+			val, err := v.defValue.resolve(nil)
+			if err != nil {
+				return nil, err
+			}
+			vars[v.name] = val
+			continue
+		}
+		if v.nonNull {
+			return nil, newGraphQLError(v.pos, "variable $%s of type %s! is required", v.name, v.typ)
+		}
+		vars[v.name] = nil
+	}
+	return vars, nil
+}
+
+// gqlPlan is the selection of an object position, by concrete type when the position is a union
+type gqlPlan struct {
+	types  []string
+	fields map[string][]*gqlFieldPlan
+}
+
+// gqlFieldPlan is a selected field with its alias in the dgraph query
+type gqlFieldPlan struct {
+	key   string
+	alias string
+	// field is nil for __typename
+	field    *GraphQLField
+	typeName string
+	filters  []string
+	rootFunc string
+	first    *int
+	offset   *int
+	child    *gqlPlan
+	// raw is the dgraph result of a root field
+	raw interface{}
+}
+
+type gqlPlanner struct {
+	schema   *GraphQLSchema
+	doc      *gqlDocument
+	vars     map[string]interface{}
+	visiting map[string]bool
+	aliases  int
+}
+
+// gqlCollected is a response key with all the selections merged into it
+type gqlCollected struct {
+	key  string
+	sel  *gqlSelection
+	subs []*gqlSelection
+}
+
+// planRoot plans the fields of the query type, each one is a root block of the dgraph query
+func (pl *gqlPlanner) planRoot(sels []*gqlSelection) ([]*gqlFieldPlan, error) {
+	collected := []*gqlCollected{}
+	if err := pl.collect(sels, "Query", "Query", &collected); err != nil {
+		return nil, err
+	}
+	roots := []*gqlFieldPlan{}
+	for _, c := range collected {
+		if c.sel.name == "__typename" {
+			roots = append(roots, &gqlFieldPlan{key: c.key, typeName: "Query"})
+			continue
+		}
+		if c.sel.name == "__schema" || c.sel.name == "__type" {
+			return nil, newGraphQLError(c.sel.pos, "introspection is not supported, the schema is returned by /v1.1/graphql/schema")
+		}
+		typeName, ok := pl.schema.Roots[c.sel.name]
+		if !ok {
+			return nil, newGraphQLError(c.sel.pos, "Cannot query field %q on type \"Query\"", c.sel.name)
+		}
+		f := &GraphQLField{Name: c.sel.name, Type: typeName, List: true, ObjType: pl.schema.Types[typeName].ObjType}
+		fp, err := pl.planField(c, f, "Query")
+		if err != nil {
+			return nil, err
+		}
+		fp.alias = "q" + strconv.Itoa(len(roots))
+		roots = append(roots, fp)
+	}
+	return roots, nil
+}
+
+// rootAliasIndex returns the index of the root field of a dgraph result key
+func rootAliasIndex(key string) (int, bool) {
+	if !strings.HasPrefix(key, "q") {
+		return 0, false
+	}
+	i, err := strconv.Atoi(key[1:])
+	return i, err == nil
+}
+
+// plan plans a selection set at a position of the given type
+func (pl *gqlPlanner) plan(sels []*gqlSelection, typeName string) (*gqlPlan, error) {
+	p := &gqlPlan{types: pl.schema.possibleTypes(typeName), fields: map[string][]*gqlFieldPlan{}}
+	for _, concrete := range p.types {
+		collected := []*gqlCollected{}
+		if err := pl.collect(sels, concrete, typeName, &collected); err != nil {
+			return nil, err
+		}
+		fields := []*gqlFieldPlan{}
+		for _, c := range collected {
+			if c.sel.name == "__typename" {
+				fields = append(fields, &gqlFieldPlan{key: c.key, typeName: concrete})
+				continue
+			}
+			f := pl.schema.Types[concrete].Field(c.sel.name)
+			if f == nil {
+				return nil, newGraphQLError(c.sel.pos, "Cannot query field %q on type %q", c.sel.name, typeName)
+			}
+			fp, err := pl.planField(c, f, concrete)
+			if err != nil {
+				return nil, err
+			}
+			pl.aliases++
+			fp.alias = "f" + strconv.Itoa(pl.aliases)
+			fields = append(fields, fp)
+		}
+		p.fields[concrete] = fields
+	}
+	return p, nil
+}
+
+// collect merges the fields of a selection set that apply to the concrete type into response keys
+func (pl *gqlPlanner) collect(sels []*gqlSelection, concrete string, abstract string, collected *[]*gqlCollected) error {
+	for _, sel := range sels {
+		include, err := pl.included(sel)
+		if err != nil {
+			return err
+		}
+		if !include {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			frag := pl.doc.fragments[sel.spread]
+			if frag == nil {
+				return newGraphQLError(sel.pos, "unknown fragment %s", sel.spread)
+			}
+			if pl.visiting[frag.name] {
+				return newGraphQLError(sel.pos, "fragment %s spreads itself", frag.name)
+			}
+			apply, err := pl.applies(frag.typeCond, concrete, abstract, frag.pos)
+			if err != nil || !apply {
+				return err
+			}
+			pl.visiting[frag.name] = true
+			err = pl.collect(frag.selections, concrete, abstract, collected)
+			delete(pl.visiting, frag.name)
+			if err != nil {
+				return err
+			}
+		case sel.inline:
+			apply, err := pl.applies(sel.typeCond, concrete, abstract, sel.pos)
+			if err != nil {
+				return err
+			}
+			if apply {
+				if err := pl.collect(sel.selections, concrete, abstract, collected); err != nil {
+					return err
+				}
+			}
+		default:
+			merged := false
+			for _, c := range *collected {
+				if c.key != sel.key() {
+					continue
+				}
+				if c.sel.name != sel.name {
+					return newGraphQLError(sel.pos, "fields %s and %s conflict as both are returned as %s", c.sel.name, sel.name, sel.key())
+				}
+				c.subs = append(c.subs, sel.selections...)
+				merged = true
+			}
+			if !merged {
+				*collected = append(*collected, &gqlCollected{key: sel.key(), sel: sel, subs: sel.selections})
+			}
+		}
+	}
+	return nil
+}
+
+// applies returns whether a fragment with the type condition applies to the concrete type
+func (pl *gqlPlanner) applies(typeCond string, concrete string, abstract string, pos GraphQLErrLocation) (bool, error) {
+	if typeCond == "" || typeCond == concrete || typeCond == abstract {
+		return true, nil
+	}
+	if _, ok := pl.schema.Types[typeCond]; !ok {
+		if _, ok := pl.schema.Unions[typeCond]; !ok {
+			return false, newGraphQLError(pos, "unknown type %s", typeCond)
+		}
+	}
+	return false, nil
+}
+
+// included evaluates the @skip and @include directives of a selection
+func (pl *gqlPlanner) included(sel *gqlSelection) (bool, error) {
+	include := true
+	for _, d := range sel.directives {
+		if d.name != "skip" && d.name != "include" {
+			return false, newGraphQLError(d.pos, "unknown directive @%s", d.name)
+		}
+		if len(d.args) != 1 || d.args[0].name != "if" {
+			return false, newGraphQLError(d.pos, "@%s requires the if argument", d.name)
+		}
+		v, err := d.args[0].value.resolve(pl.vars)
+		if err != nil {
+			return false, err
+		}
+		cond, ok := v.(bool)
+		if !ok {
+			return false, newGraphQLError(d.pos, "if of @%s must be a Boolean", d.name)
+		}
+		if d.name == "skip" && cond || d.name == "include" && !cond {
+			include = false
+		}
+	}
+	return include, nil
+}
+
+// planField checks the arguments and sub selections of a field
+func (pl *gqlPlanner) planField(c *gqlCollected, f *GraphQLField, parent string) (*gqlFieldPlan, error) {
+	fp := &gqlFieldPlan{key: c.key, field: f, typeName: parent}
+	if f.IsScalar() {
+		if len(c.subs) > 0 {
+			return nil, newGraphQLError(c.sel.pos, "field %s of type %s can't have a selection of subfields", f.Name, f.Type)
+		}
+		if len(c.sel.args) > 0 {
+			return nil, newGraphQLError(c.sel.args[0].pos, "unknown argument %s of field %s", c.sel.args[0].name, f.Name)
+		}
+		return fp, nil
+	}
+	if len(c.subs) == 0 {
+		return nil, newGraphQLError(c.sel.pos, "field %s of type %s must have a selection of subfields", f.Name, f.Type)
+	}
+	target := pl.schema.Types[f.Type]
+	for _, arg := range c.sel.args {
+		if !f.List || target == nil {
+			return nil, newGraphQLError(arg.pos, "unknown argument %s of field %s", arg.name, f.Name)
+		}
+		v, err := arg.value.resolve(pl.vars)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		if err := fp.addArg(arg, v, target); err != nil {
+			return nil, err
+		}
+	}
+	child, err := pl.plan(c.subs, f.Type)
+	if err != nil {
+		return nil, err
+	}
+	fp.child = child
+	return fp, nil
+}
+
+// addArg adds a pagination argument or an equality filter on a scalar field of the target type
+func (fp *gqlFieldPlan) addArg(arg *gqlArg, v interface{}, target *GraphQLType) error {
+	if arg.name == util.First || arg.name == util.Offset {
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != math.Trunc(n) || n > MaximumLimit {
+			return newGraphQLError(arg.pos, "%s must be an integer between 0 and %d", arg.name, MaximumLimit)
+		}
+		i := int(n)
+		if arg.name == util.First {
+			fp.first = &i
+		} else {
+			fp.offset = &i
+		}
+		return nil
+	}
+	f := target.Field(arg.name)
+	if f == nil || !f.IsScalar() || f.Type == GraphQLJSON {
+		return newGraphQLError(arg.pos, "unknown argument %s of field %s", arg.name, fp.field.Name)
+	}
+	invalid := newGraphQLError(arg.pos, "argument %s must be of type %s", arg.name, f.Type)
+	switch f.Type {
+	case GraphQLID:
+		uid, ok := v.(string)
+		if !ok || !uidRegex.MatchString(uid) {
+			return invalid
+		}
+		if fp.typeName == "Query" && fp.rootFunc == "" {
+			fp.rootFunc = "uid(" + uid + ")"
+		} else {
+			fp.filters = append(fp.filters, "uid("+uid+")")
+		}
+	case GraphQLString:
+		s, ok := v.(string)
+		if !ok {
+			return invalid
+		}
+		fp.filters = append(fp.filters, "eq("+f.Predicate+","+dgraphString(s)+")")
+	case GraphQLInt, GraphQLFloat:
+		n, ok := v.(float64)
+		if !ok || f.Type == GraphQLInt && n != math.Trunc(n) {
+			return invalid
+		}
+		fp.filters = append(fp.filters, "eq("+f.Predicate+","+strconv.FormatFloat(n, 'f', -1, 64)+")")
+	case GraphQLBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return invalid
+		}
+		fp.filters = append(fp.filters, "eq("+f.Predicate+","+strconv.FormatBool(b)+")")
+	}
+	return nil
+}
+
+// dgraphGraphQLQuery generates the dgraph query of the root fields
+func dgraphGraphQLQuery(roots []*gqlFieldPlan) string {
+	var sb strings.Builder
+	for _, r := range roots {
+		if r.field == nil {
+			continue
+		}
+		root := r.rootFunc
+		filters := r.filters
+		objtype := "eq(" + util.ObjType + "," + dgraphString(r.field.ObjType) + ")"
+		if root == "" {
+			root = objtype
+		} else {
+			filters = append([]string{objtype}, filters...)
+		}
+		if notDeleted := dgraphNotDeleted(false); notDeleted != "" {
+			filters = append(filters, strings.TrimSpace(notDeleted))
+		}
+		fmt.Fprintf(&sb, "\t%s(func: %s%s)%s {\n", r.alias, root, r.pagination(), dgraphGraphQLFilter(filters))
+		r.child.writeDgraph(&sb, 2)
+		sb.WriteString("\t}\n")
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "{\n" + sb.String() + "}"
+}
+
+func dgraphGraphQLFilter(filters []string) string {
+	if len(filters) == 0 {
+		return ""
+	}
+	return " @filter(" + strings.Join(filters, " and ") + ")"
+}
+
+func (fp *gqlFieldPlan) pagination() string {
+	p := ""
+	if fp.first != nil {
+		p += ", " + util.First + ": " + strconv.Itoa(*fp.first)
+	}
+	if fp.offset != nil {
+		p += ", " + util.Offset + ": " + strconv.Itoa(*fp.offset)
+	}
+	return p
+}
+
+// writeDgraph writes the predicates of all the concrete types of the plan
+func (p *gqlPlan) writeDgraph(sb *strings.Builder, depth int) {
+	indent := strings.Repeat("\t", depth)
+	sb.WriteString(indent + gqlObjTypeAlias + " : " + util.ObjType + "\n")
+	for _, t := range p.types {
+		for _, fp := range p.fields[t] {
+			if fp.field == nil {
+				continue
+			}
+			if fp.child == nil {
+				sb.WriteString(indent + fp.alias + " : " + fp.field.Predicate + "\n")
+				continue
+			}
+			filters := fp.filters
+			if fp.field.ObjType != "" {
+				filters = append([]string{"eq(" + util.ObjType + "," + dgraphString(fp.field.ObjType) + ")"}, filters...)
+			}
+			args := strings.TrimPrefix(fp.pagination(), ", ")
+			if args != "" {
+				args = " (" + args + ")"
+			}
+			sb.WriteString(indent + fp.alias + " : " + fp.field.Predicate + args + dgraphGraphQLFilter(filters) + " {\n")
+			fp.child.writeDgraph(sb, depth+1)
+			sb.WriteString(indent + "}\n")
+		}
+	}
+}
+
+// result returns the value of a root field
+func (fp *gqlFieldPlan) result() interface{} {
+	if fp.field == nil {
+		return fp.typeName
+	}
+	list := []interface{}{}
+	for _, obj := range childObjects(fp.raw) {
+		if o := fp.child.shape(obj); o != nil {
+			list = append(list, o)
+		}
+	}
+	return list
+}
+
+// shape builds the result object of a dgraph object, nil if it isn't one of the possible types
+func (p *gqlPlan) shape(raw map[string]interface{}) *GraphQLObject {
+	concrete := p.types[0]
+	if len(p.types) > 1 {
+		objtype, _ := raw[gqlObjTypeAlias].(string)
+		concrete = ""
+		for _, t := range p.types {
+			if p.fields[t] != nil && strings.EqualFold(objtype, t) {
+				concrete = t
+			}
+		}
+		if concrete == "" {
+			return nil
+		}
+	}
+	obj := NewGraphQLObject()
+	for _, fp := range p.fields[concrete] {
+		obj.Set(fp.key, fp.value(raw))
+	}
+	return obj
+}
+
+// value returns the value of a field of a dgraph object
+func (fp *gqlFieldPlan) value(raw map[string]interface{}) interface{} {
+	if fp.field == nil {
+		return fp.typeName
+	}
+	v := raw[fp.alias]
+	if fp.child == nil {
+		if s, ok := v.(string); ok && fp.field.Type == GraphQLJSON {
+			var j interface{}
+			if err := json.Unmarshal([]byte(s), &j); err == nil {
+				return j
+			}
+		}
+		return v
+	}
+	objs := []interface{}{}
+	for _, obj := range childObjects(v) {
+		if o := fp.child.shape(obj); o != nil {
+			objs = append(objs, o)
+		}
+	}
+	if fp.field.List {
+		return objs
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+	return objs[0]
+}
@@ -0,0 +1,127 @@
+package apis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildGraphQLSchema(t *testing.T) {
+	metas := []Metadata{
+		{Name: "pod", Fields: []MetadataField{
+			{FieldName: "name", FieldType: "string"},
+			{FieldName: "numcontainers", FieldType: "int"},
+			{FieldName: "labels", FieldType: "json"},
+			{FieldName: "nodename", FieldType: "relationship", RefDataType: "node", Cardinality: "one"},
+			{FieldName: "owner", FieldType: "relationship", RefDataType: "replicaset,statefulset", Cardinality: "one"},
+		}},
+		{Name: "node", Fields: []MetadataField{{FieldName: "name", FieldType: "string"}}},
+		{Name: "replicaset", Fields: []MetadataField{{FieldName: "name", FieldType: "string"}}},
+		{Name: "statefulset", Fields: []MetadataField{{FieldName: "name", FieldType: "string"}}},
+		// not a valid GraphQL name
+		{Name: "k8s-pod"},
+	}
+	s := BuildGraphQLSchema(metas)
+	assert.Equal(t, 4, len(s.Types))
+	assert.Equal(t, map[string][]string{"PodOwner": {"Replicaset", "Statefulset"}}, s.Unions)
+	node := s.Types["Node"]
+	if assert.NotNil(t, node) {
+		f := node.Field("podByNodename")
+		if assert.NotNil(t, f) {
+			assert.Equal(t, "~nodename", f.Predicate)
+			assert.Equal(t, "pod", f.ObjType)
+			assert.True(t, f.List)
+		}
+	}
+	sdl := s.SDL()
+	for _, expected := range []string{
+		"\tpod(uid: ID, name: String, numcontainers: Int, first: Int, offset: Int): [Pod!]!\n",
+		"type Pod {\n\tuid: ID!\n\tname: String\n\tnumcontainers: Int\n\tlabels: JSON\n\tnodename: Node\n\towner: PodOwner\n}\n",
+		"\tpodByOwner(uid: ID, name: String, numcontainers: Int, first: Int, offset: Int): [Pod!]\n",
+		"union PodOwner = Replicaset | Statefulset\n",
+	} {
+		assert.True(t, strings.Contains(sdl, expected), "missing %q in\n%s", expected, sdl)
+	}
+}
+
+func TestGraphQLExecute(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	metaSvc := NewMetaService(dc)
+	meta, err := ioutil.ReadFile("../data/meta.json")
+	if err != nil {
+		log.Fatalf("Metadata file error: %v\n", err)
+	}
+	var jsonData []map[string]interface{}
+	json.Unmarshal(meta, &jsonData)
+	for _, data := range jsonData {
+		metaSvc.CreateMetadata(data)
+	}
+	nid, _ := dc.CreateEntity("node", map[string]interface{}{"objtype": "node", "name": "gqlnode01", "resourceid": "gqlnode01"})
+	defer dc.DeleteEntity(nid)
+	rid, _ := dc.CreateEntity("replicaset", map[string]interface{}{"objtype": "replicaset", "name": "gqlrs01", "resourceid": "gqlrs01"})
+	defer dc.DeleteEntity(rid)
+	for _, p := range [][]string{{"gqlpod01", "Running"}, {"gqlpod02", "Pending"}} {
+		pid, _ := dc.CreateEntity("pod", map[string]interface{}{
+			"objtype": "pod", "name": p[0], "resourceid": p[0], "phase": p[1],
+			"nodename": map[string]interface{}{"uid": nid},
+			"owner":    map[string]interface{}{"uid": rid},
+		})
+		defer dc.DeleteEntity(pid)
+	}
+
+	s := NewGraphQLService(dc)
+	tests := []struct {
+		req      GraphQLRequest
+		expected string
+	}{
+		{
+			GraphQLRequest{Query: `query Pods($phase: String = "Running") {
+				pods: pod(name: "gqlpod01", phase: $phase) {
+					name
+					host: nodename { name }
+					owner { __typename ... on Replicaset { name } }
+				}
+			}`},
+			`{"pods":[{"name":"gqlpod01","host":{"name":"gqlnode01"},"owner":{"__typename":"Replicaset","name":"gqlrs01"}}]}`,
+		},
+		{
+			GraphQLRequest{
+				Query:     `query($name: String!) { node(name: $name) { ...nodeFields } } fragment nodeFields on Node { name pods: podByNodename(phase: "Pending") { name } }`,
+				Variables: map[string]interface{}{"name": "gqlnode01"},
+			},
+			`{"node":[{"name":"gqlnode01","pods":[{"name":"gqlpod02"}]}]}`,
+		},
+		{
+			GraphQLRequest{Query: `{ pod(name: "gqlpod02") { name phase @skip(if: true) } node(name: "none") { name } }`},
+			`{"pod":[{"name":"gqlpod02"}],"node":[]}`,
+		},
+	}
+	for _, test := range tests {
+		data, err := s.Execute(test.req)
+		if !assert.Nil(t, err, test.req.Query) {
+			continue
+		}
+		ret, _ := json.Marshal(data)
+		assert.Equal(t, test.expected, string(ret), test.req.Query)
+	}
+
+	errs := map[string]string{
+		`{ pod { nope } }`:                              `Cannot query field "nope" on type "Pod" at line 1 column 9`,
+		`{ pod { nodename } }`:                          `field nodename of type Node must have a selection of subfields at line 1 column 9`,
+		`{ pod(first: -1) { name } }`:                   `first must be an integer between 0 and 10000 at line 1 column 7`,
+		`query($n: String!) { pod(name: $n) { name } }`: `variable $n of type String! is required at line 1 column 7`,
+		`{ __schema { types { name } } }`:               `introspection is not supported, the schema is returned by /v1.1/graphql/schema at line 1 column 3`,
+		`mutation { pod { name } }`:                     `only queries are supported, not mutation at line 1 column 1`,
+	}
+	for query, expected := range errs {
+		_, err := s.Execute(GraphQLRequest{Query: query})
+		if assert.NotNil(t, err, query) {
+			assert.Equal(t, expected, err.Error(), query)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
+)
+
+// IHistoryService define interfaces to read the changes of entities
+type IHistoryService interface {
+	// get the changes of an entity, oldest first
+	GetHistory(uid string) ([]HistoryEntry, error)
+	// get an entity as it was at the given time, nil if it didn't exist
+	GetEntityAsOf(uid string, asof time.Time) (map[string]interface{}, error)
+}
+
+// HistoryEntry is a change of an entity, stored as a changelog object
+type HistoryEntry struct {
+	UID             string                 `json:"uid"`
+	EntityUID       string                 `json:"entityuid"`
+	EntityType      string                 `json:"entitytype"`
+	Change          string                 `json:"change"`
+	OldValue        map[string]interface{} `json:"oldvalue,omitempty"`
+	NewValue        map[string]interface{} `json:"newvalue,omitempty"`
+	ResourceVersion string                 `json:"resourceversion,omitempty"`
+	Timestamp       time.Time              `json:"timestamp"`
+	Cluster         string                 `json:"cluster,omitempty"`
+}
+
+// HistoryService implements IHistoryService
+type HistoryService struct {
+	dbclient db.IDGClient
+}
+
+// NewHistoryService creates a new HistoryService with the given dgraph client.
+func NewHistoryService(dc db.IDGClient) *HistoryService {
+	return &HistoryService{dc}
+}
+
+// ParseAsOf parses the time of a point in time query
+func ParseAsOf(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return t, fmt.Errorf("asof must be a RFC3339 timestamp e.g. 2019-01-02T15:04:05Z")
+	}
+	return t, nil
+}
+
+// recordChange stores a change of an entity, old or new is nil when the entity is created or deleted
+func recordChange(dc db.IDGClient, change string, uid string, objtype string, oldValue, newValue map[string]interface{}, cluster string) {
+	now := time.Now().UTC()
+	record := map[string]interface{}{
+		util.ObjType:    util.ChangeLog,
+		util.ResourceID: util.ChangeLog + ":" + uid + ":" + strconv.FormatInt(now.UnixNano(), 10),
+		util.EntityUID:  uid,
+		util.EntityType: strings.ToLower(objtype),
+		util.Change:     change,
+		util.Timestamp:  now.Format(time.RFC3339Nano),
+	}
+	for k, v := range map[string]map[string]interface{}{util.OldValue: oldValue, util.NewValue: newValue} {
+		if v == nil {
+			continue
+		}
+		bytes, _ := json.Marshal(historyValue(v))
+		record[k] = string(bytes)
+	}
+	value := newValue
+	if value == nil {
+		value = oldValue
+	}
+	if v, ok := value[util.ResourceVersion]; ok && v != nil {
+		record[util.ResourceVersion] = fmt.Sprint(v)
+	}
+	if cluster != "" {
+		record[util.SourceCluster] = cluster
+	}
+	if _, err := dc.CreateEntity(util.ChangeLog, record); err != nil {
+		log.Errorf("failed to record %s of %s: %v", change, uid, err)
+	}
+}
+
+// historyValue copies an object keeping only the uid, name and objtype of the objects it refers to
+func historyValue(obj map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range obj {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			ret[k] = historyRef(val)
+		case []interface{}:
+			list := make([]interface{}, len(val))
+			for i, item := range val {
+				if m, ok := item.(map[string]interface{}); ok {
+					list[i] = historyRef(m)
+				} else {
+					list[i] = item
+				}
+			}
+			ret[k] = list
+		case []map[string]interface{}:
+			list := make([]interface{}, len(val))
+			for i, item := range val {
+				list[i] = historyRef(item)
+			}
+			ret[k] = list
+		default:
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+func historyRef(obj map[string]interface{}) map[string]interface{} {
+	ref := map[string]interface{}{}
+	for _, k := range []string{util.UID, util.Name, util.ObjType} {
+		if v, ok := obj[k]; ok {
+			ref[k] = v
+		}
+	}
+	return ref
+}
+
+// GetHistory returns the changes of an entity, oldest first
+func (s HistoryService) GetHistory(uid string) ([]HistoryEntry, error) {
+	return s.getEntries(util.EntityUID, uid)
+}
+
+// GetEntityAsOf returns an entity as it was at the given time, nil if it didn't exist then
+func (s HistoryService) GetEntityAsOf(uid string, asof time.Time) (map[string]interface{}, error) {
+	entries, err := s.GetHistory(uid)
+	if err != nil {
+		return nil, err
+	}
+	states := stateAsOf(entries, asof)
+	if len(states) == 0 {
+		return nil, nil
+	}
+	return states[0], nil
+}
+
+// getEntries returns the changelog objects with the given value of entityuid or entitytype, oldest first
+func (s HistoryService) getEntries(field string, value string) ([]HistoryEntry, error) {
+	q := fmt.Sprintf(`{
+		objects(func: eq(%s, %s)) @filter(eq(%s, %s)) {
+			uid
+			%s
+		}
+	}`, field, dgraphString(value), util.ObjType, dgraphString(util.ChangeLog), strings.Join([]string{
+		util.EntityUID, util.EntityType, util.Change, util.OldValue, util.NewValue, util.ResourceVersion, util.Timestamp, util.SourceCluster,
+	}, "\n\t\t\t"))
+	ret, err := s.dbclient.ExecuteDgraphQuery(q)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	entries := []HistoryEntry{}
+	objs, _ := ret[util.Objects].([]interface{})
+	for _, o := range objs {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		e := HistoryEntry{}
+		e.UID, _ = obj[util.UID].(string)
+		e.EntityUID, _ = obj[util.EntityUID].(string)
+		e.EntityType, _ = obj[util.EntityType].(string)
+		e.Change, _ = obj[util.Change].(string)
+		e.ResourceVersion, _ = obj[util.ResourceVersion].(string)
+		e.Cluster, _ = obj[util.SourceCluster].(string)
+		if ts, ok := obj[util.Timestamp].(string); ok {
+			e.Timestamp, _ = time.Parse(time.RFC3339Nano, ts)
+		}
+		if v, ok := obj[util.OldValue].(string); ok {
+			json.Unmarshal([]byte(v), &e.OldValue)
+		}
+		if v, ok := obj[util.NewValue].(string); ok {
+			json.Unmarshal([]byte(v), &e.NewValue)
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
+	return entries, nil
+}
+
+// stateAsOf returns the state of every entity of the entries at the given time, ordered by uid
+// the entries must be ordered by time, entities created later or deleted by then are left out
+func stateAsOf(entries []HistoryEntry, asof time.Time) []map[string]interface{} {
+	last := map[string]*HistoryEntry{}
+	for i, e := range entries {
+		if e.Timestamp.After(asof) {
+			continue
+		}
+		last[e.EntityUID] = &entries[i]
+	}
+	uids := []string{}
+	for uid, e := range last {
+		if e.Change != WatchDeleted && e.NewValue != nil {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uidLess(uids[i], uids[j]) })
+	states := make([]map[string]interface{}, len(uids))
+	for i, uid := range uids {
+		states[i] = last[uid].NewValue
+	}
+	return states
+}
+
+// uidLess compares dgraph uids by their numeric value
+func uidLess(a, b string) bool {
+	x, errA := strconv.ParseUint(strings.TrimPrefix(a, "0x"), 16, 64)
+	y, errB := strconv.ParseUint(strings.TrimPrefix(b, "0x"), 16, 64)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return x < y
+}
+
+// IsAsOfQuery returns true if the first block of a QSL query is read from the history with $$asof
+func IsAsOfQuery(query string) bool {
+	qsl, err := ParseQSL(query)
+	return err == nil && qsl.Blocks[0].Page.AsOf != nil
+}
+
+// QueryAsOf runs a query of a single block with $$asof against the history of its object type
+func (qa *QSLService) QueryAsOf(query string) (map[string]interface{}, error) {
+	qsl, err := ParseQSL(query)
+	if err != nil {
+		return nil, err
+	}
+	return qa.queryAsOf(qsl, 1000)
+}
+
+// queryAsOf returns the objects of a query from the history, limit applies when the block has none, -1 for all objects
+func (qa *QSLService) queryAsOf(qsl *QSLQuery, limit int) (map[string]interface{}, error) {
+	block := qsl.Blocks[0]
+	if len(qsl.Blocks) > 1 {
+		return nil, &QSLError{Message: "asof is only supported in queries of a single block", Column: qsl.Blocks[1].Column, Token: qsl.Blocks[1].ObjType}
+	}
+	if block.Fields.IsAggregate() || len(block.Fields.Computed) > 0 {
+		return nil, &QSLError{Message: "asof queries only support * or fields", Column: block.Column, Token: block.ObjType}
+	}
+	entries, err := NewHistoryService(qa.DBclient).getEntries(util.EntityType, block.ObjType)
+	if err != nil {
+		return nil, err
+	}
+	objects := []map[string]interface{}{}
+	for _, state := range stateAsOf(entries, *block.Page.AsOf) {
+		if block.Filter == nil || matchQSLFilter(block.Filter, state) {
+			objects = append(objects, state)
+		}
+	}
+	for i := len(block.Page.Order) - 1; i >= 0; i-- {
+		o := block.Page.Order[i]
+		sort.SliceStable(objects, func(a, b int) bool {
+			x, y := fmt.Sprint(objects[a][o.Field]), fmt.Sprint(objects[b][o.Field])
+			if o.Desc {
+				return compareWatchValue(x, ">", y)
+			}
+			return compareWatchValue(x, "<", y)
+		})
+	}
+	total := len(objects)
+	offset := 0
+	if block.Page.Offset != nil {
+		offset = *block.Page.Offset
+	}
+	if block.Page.Limit != nil {
+		limit = *block.Page.Limit
+	}
+	if offset > len(objects) {
+		offset = len(objects)
+	}
+	objects = objects[offset:]
+	if limit >= 0 && limit < len(objects) {
+		objects = objects[:limit]
+	}
+	ret := []interface{}{}
+	for _, obj := range objects {
+		ret = append(ret, projectAsOf(block.Fields, obj))
+	}
+	return map[string]interface{}{util.Objects: ret, util.Count: float64(total)}, nil
+}
+
+// projectAsOf selects the fields of a projection from the state of an object
+func projectAsOf(proj QSLProjection, obj map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	switch {
+	case proj.Levels > 1:
+		return obj
+	case proj.Levels == 1:
+		for k, v := range obj {
+			switch val := v.(type) {
+			case map[string]interface{}:
+				continue
+			case []interface{}:
+				if len(val) > 0 {
+					if _, ok := val[0].(map[string]interface{}); ok {
+						continue
+					}
+				}
+			}
+			ret[k] = v
+		}
+	case len(proj.Names) > 0:
+		for i, name := range proj.Names {
+			key := name
+			if len(proj.Aliases) > 0 && proj.Aliases[i] != "" {
+				key = proj.Aliases[i]
+			}
+			if v, ok := obj[name]; ok {
+				ret[key] = v
+			}
+		}
+		if _, ok := ret[util.ObjType]; !ok {
+			ret[util.ObjType] = obj[util.ObjType]
+		}
+	}
+	ret[util.UID] = obj[util.UID]
+	return ret
+}
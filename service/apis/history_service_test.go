@@ -0,0 +1,63 @@
+package apis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntityHistory(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	h := NewHistoryService(dc)
+
+	uid, err := s.CreateEntity("histpod", map[string]interface{}{"objtype": "histpod", "name": "histpod01", "phase": "Pending", "resourceversion": "1"})
+	assert.Nil(t, err)
+	other, _ := s.CreateEntity("histpod", map[string]interface{}{"objtype": "histpod", "name": "histpod02", "phase": "Pending", "resourceversion": "1"})
+	time.Sleep(10 * time.Millisecond)
+	created := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	s.UpdateEntity(uid, map[string]interface{}{"phase": "Running"})
+	time.Sleep(10 * time.Millisecond)
+	updated := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	s.DeleteEntity(uid)
+	defer s.DeleteEntity(other)
+
+	entries, err := h.GetHistory(uid)
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(entries)) {
+		assert.Equal(t, WatchAdded, entries[0].Change)
+		assert.Nil(t, entries[0].OldValue)
+		assert.Equal(t, WatchModified, entries[1].Change)
+		assert.Equal(t, "Pending", entries[1].OldValue["phase"])
+		assert.Equal(t, "Running", entries[1].NewValue["phase"])
+		assert.Equal(t, WatchDeleted, entries[2].Change)
+		assert.Nil(t, entries[2].NewValue)
+		assert.Equal(t, "histpod", entries[2].EntityType)
+	}
+
+	obj, err := h.GetEntityAsOf(uid, created)
+	assert.Nil(t, err)
+	assert.Equal(t, "Pending", obj["phase"])
+	obj, _ = h.GetEntityAsOf(uid, updated)
+	assert.Equal(t, "Running", obj["phase"])
+	obj, _ = h.GetEntityAsOf(uid, time.Now())
+	assert.Nil(t, obj)
+	obj, _ = h.GetEntityAsOf(uid, created.Add(-time.Hour))
+	assert.Nil(t, obj)
+
+	qa := NewQSLService(dc)
+	ret, err := qa.QueryAsOf(`histpod[@phase="Running"$$asof=` + updated.UTC().Format(time.RFC3339Nano) + `]{@name}`)
+	if assert.Nil(t, err) {
+		assert.Equal(t, float64(1), ret["count"])
+		assert.Equal(t, "histpod01", ret["objects"].([]interface{})[0].(map[string]interface{})["name"])
+	}
+	ret, _ = qa.QueryAsOf(`histpod[$$asof=` + time.Now().UTC().Format(time.RFC3339Nano) + `]{*}`)
+	assert.Equal(t, float64(1), ret["count"])
+
+	_, err = qa.QueryAsOf(`histpod[$$asof=` + updated.UTC().Format(time.RFC3339Nano) + `]{*}.node{*}`)
+	assert.NotNil(t, err)
+}
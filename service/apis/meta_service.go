@@ -23,6 +23,8 @@ type IMetaService interface {
 	UpdateMetadata(name string, data map[string]interface{}) error
 	// Get all metadata fields
 	GetMetadataFields(name string) ([]MetadataField, error)
+	// Get metadata of all object types
+	GetAllMetadata() ([]Metadata, error)
 	// Create schema
 	CreateSchema(sm db.Schema) error
 	// Drop a schema
@@ -59,6 +61,8 @@ type MetadataField struct {
 	RefDataType string `json:"refdatatype,omitempty"`
 	// One or Many
 	Cardinality string `json:"cardinality,omitempty"`
+	// Path of the field value in raw kubernetes objects, e.g. .spec.replicas
+	JSONPath string `json:"jsonpath,omitempty"`
 }
 
 // GetMetadata get entity return the object with specified ID
@@ -88,6 +92,25 @@ func NewMetaService(dc db.IDGClient) *MetaService {
 	return &MetaService{dc}
 }
 
+// GetAllMetadata returns the metadata of every object type
+func (s MetaService) GetAllMetadata() ([]Metadata, error) {
+	qm := map[string][]string{util.ObjType: {util.Metadata}}
+	queryService := NewQueryService(s.dbclient)
+	metas, err := queryService.GetQueryResult(qm)
+	if err != nil {
+		return nil, err
+	}
+	list := []Metadata{}
+	for _, m := range metas[util.Objects].([]interface{}) {
+		var metadata Metadata
+		if err := mapstructure.Decode(m, &metadata); err != nil {
+			return nil, err
+		}
+		list = append(list, metadata)
+	}
+	return list, nil
+}
+
 // GetMetadataFields EntityService will call this method to get all fields to verify and create edge accordingly
 func (s MetaService) GetMetadataFields(name string) ([]MetadataField, error) {
 	qm := map[string][]string{util.Name: {name}, util.ObjType: {util.Metadata}}
@@ -155,6 +178,11 @@ func (s MetaService) CreateMetadata(data map[string]interface{}) (string, error)
 			if err != nil {
 				return "", err
 			}
+			if path, ok := fMap[i].(map[string]interface{})[util.JSONPath].(string); ok {
+				if _, err = parseJSONPath(path); err != nil {
+					return "", err
+				}
+			}
 			dkMap := map[string]interface{}{
 				util.Cardinality: util.One,
 				util.Mandatory:   false,
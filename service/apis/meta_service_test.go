@@ -10,7 +10,7 @@ import (
 )
 
 func TestMetaService(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	q := NewQueryService(dc)
 	m := NewMetaService(dc)
@@ -72,7 +72,7 @@ func TestMetaService(t *testing.T) {
 }
 
 func TestDeleteMetadata(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	m := NewMetaService(dc)
 	q := NewQueryService(dc)
@@ -145,7 +145,7 @@ func TestDeleteMetadata(t *testing.T) {
 }
 
 func TestMetadataUpdate(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	m := NewMetaService(dc)
 	q := NewQueryService(dc)
@@ -0,0 +1,155 @@
+package apis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
+)
+
+// DefaultPathDepth is the maximum number of relations in a path when no depth is given
+const DefaultPathDepth = 5
+
+// MaximumPathDepth caps the depth of path queries
+const MaximumPathDepth = 10
+
+// MaximumNumPaths caps the number of paths returned by a path query
+const MaximumNumPaths = 10
+
+var uidRegex = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+
+// IPathService define interfaces to find how entities are connected
+type IPathService interface {
+	// get the shortest paths between two entities
+	GetPaths(from string, to string, maxDepth int, numPaths int) ([]EntityPath, error)
+}
+
+// PathService implements IPathService with dgraph shortest path queries
+type PathService struct {
+	dbclient db.IDGClient
+}
+
+// EntityPath is a chain of entities, Relations[i] connects Objects[i] to Objects[i+1]
+// a relation prefixed with ~ is followed from the object it points to
+type EntityPath struct {
+	Objects   []map[string]interface{} `json:"objects"`
+	Relations []string                 `json:"relations"`
+}
+
+// NewPathService creates a new PathService with the given dgraph client.
+func NewPathService(dc db.IDGClient) *PathService {
+	return &PathService{dc}
+}
+
+// GetPaths returns up to numPaths shortest paths of at most maxDepth relations between two entities
+// every relationship field of the metadata can be followed in both directions
+func (s PathService) GetPaths(from string, to string, maxDepth int, numPaths int) ([]EntityPath, error) {
+	if err := ValidatePathQuery(from, to, maxDepth, numPaths); err != nil {
+		return nil, err
+	}
+	relations, err := s.getRelations()
+	if err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf("{\n\tpath as shortest(from: %s, to: %s, numpaths: %d, depth: %d) {\n\t\t%s\n\t}\n\tobjects(func: uid(path)) {\n\t\tuid\n\t\tname\n\t\tobjtype\n\t}\n}",
+		from, to, numPaths, maxDepth, strings.Join(relations, "\n\t\t"))
+	log.Debugf("dgraph query for path from %s to %s:\n %s", from, to, q)
+	ret, err := s.dbclient.ExecuteDgraphQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return parsePaths(ret), nil
+}
+
+// ValidatePathQuery checks the arguments of a path query before it is sent to dgraph
+func ValidatePathQuery(from string, to string, maxDepth int, numPaths int) error {
+	if !uidRegex.MatchString(from) || !uidRegex.MatchString(to) {
+		return fmt.Errorf("from and to must be entity uids")
+	}
+	if maxDepth < 1 || maxDepth > MaximumPathDepth {
+		return fmt.Errorf("maxdepth must be between 1 and %d", MaximumPathDepth)
+	}
+	if numPaths < 1 || numPaths > MaximumNumPaths {
+		return fmt.Errorf("numpaths must be between 1 and %d", MaximumNumPaths)
+	}
+	return nil
+}
+
+// getRelations returns the relationship fields of all metadata and their reverse
+func (s PathService) getRelations() ([]string, error) {
+	m := NewMetaService(s.dbclient)
+	metas, err := m.GetAllMetadata()
+	if err != nil {
+		log.Error(err)
+		return nil, fmt.Errorf("Failed to connect to dgraph to get metadata")
+	}
+	seen := map[string]bool{}
+	relations := []string{}
+	for _, meta := range metas {
+		for _, item := range meta.Fields {
+			name := strings.ToLower(item.FieldName)
+			if item.FieldType != util.Relationship || seen[name] {
+				continue
+			}
+			seen[name] = true
+			relations = append(relations, name, "~"+name)
+		}
+	}
+	sort.Strings(relations)
+	return relations, nil
+}
+
+// parsePaths converts the nested _path_ result of a shortest query to a list of EntityPath
+// e.g. {"uid": "0x1", "~owner": [{"uid": "0x2"}]} -> objects [0x1, 0x2], relations [~owner]
+func parsePaths(ret map[string]interface{}) []EntityPath {
+	details := map[string]map[string]interface{}{}
+	if objs, ok := ret[util.Objects].([]interface{}); ok {
+		for _, o := range objs {
+			if obj, ok := o.(map[string]interface{}); ok {
+				if uid, ok := obj[util.UID].(string); ok {
+					details[uid] = obj
+				}
+			}
+		}
+	}
+	paths := []EntityPath{}
+	list, _ := ret["_path_"].([]interface{})
+	for _, p := range list {
+		path := EntityPath{Objects: []map[string]interface{}{}, Relations: []string{}}
+		node, _ := p.(map[string]interface{})
+		for node != nil {
+			uid, _ := node[util.UID].(string)
+			obj, ok := details[uid]
+			if !ok {
+				obj = map[string]interface{}{util.UID: uid}
+			}
+			path.Objects = append(path.Objects, obj)
+			var next map[string]interface{}
+			for k, v := range node {
+				// skip uid and dgraph internal keys such as _weight_
+				if k == util.UID || strings.HasPrefix(k, "_") {
+					continue
+				}
+				switch child := v.(type) {
+				case map[string]interface{}:
+					next = child
+				case []interface{}:
+					if len(child) > 0 {
+						next, _ = child[0].(map[string]interface{})
+					}
+				}
+				if next != nil {
+					path.Relations = append(path.Relations, k)
+					break
+				}
+			}
+			node = next
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -0,0 +1,67 @@
+package apis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPaths(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	metaSvc := NewMetaService(dc)
+	pathSvc := NewPathService(dc)
+
+	meta, err := ioutil.ReadFile("../data/meta.json")
+	assert.Nil(t, err)
+	var jsonData []map[string]interface{}
+	json.Unmarshal(meta, &jsonData)
+	for _, data := range jsonData {
+		metaSvc.CreateMetadata(data)
+	}
+
+	// deployment <- replicaset <- pod through the owner relationship
+	did, err := dc.CreateEntity("deployment", map[string]interface{}{"objtype": "deployment", "name": "path-deploy", "resourceid": "deployment:path:path-deploy"})
+	assert.Nil(t, err)
+	defer dc.DeleteEntity(did)
+	rid, err := dc.CreateEntity("replicaset", map[string]interface{}{"objtype": "replicaset", "name": "path-rs", "resourceid": "replicaset:path:path-rs",
+		"owner": map[string]interface{}{"uid": did}})
+	assert.Nil(t, err)
+	defer dc.DeleteEntity(rid)
+	pid, err := dc.CreateEntity("pod", map[string]interface{}{"objtype": "pod", "name": "path-pod", "resourceid": "pod:path:path-pod",
+		"owner": map[string]interface{}{"uid": rid}})
+	assert.Nil(t, err)
+	defer dc.DeleteEntity(pid)
+
+	paths, err := pathSvc.GetPaths(pid, did, DefaultPathDepth, 1)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(paths)) {
+		assert.Equal(t, []string{"owner", "owner"}, paths[0].Relations)
+		assert.Equal(t, 3, len(paths[0].Objects))
+		assert.Equal(t, "path-pod", paths[0].Objects[0]["name"])
+		assert.Equal(t, "path-rs", paths[0].Objects[1]["name"])
+		assert.Equal(t, "replicaset", paths[0].Objects[1]["objtype"])
+		assert.Equal(t, "path-deploy", paths[0].Objects[2]["name"])
+	}
+
+	// the reverse direction follows ~owner
+	paths, err = pathSvc.GetPaths(did, pid, DefaultPathDepth, 2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(paths)) {
+		assert.Equal(t, []string{"~owner", "~owner"}, paths[0].Relations)
+	}
+
+	// no path within the given depth
+	paths, err = pathSvc.GetPaths(pid, did, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(paths))
+
+	_, err = pathSvc.GetPaths("pod01", did, DefaultPathDepth, 1)
+	assert.Equal(t, "from and to must be entity uids", err.Error())
+	_, err = pathSvc.GetPaths(pid, did, MaximumPathDepth+1, 1)
+	assert.Equal(t, "maxdepth must be between 1 and 10", err.Error())
+	_, err = pathSvc.GetPaths(pid, did, DefaultPathDepth, 0)
+	assert.Equal(t, "numpaths must be between 1 and 10", err.Error())
+}
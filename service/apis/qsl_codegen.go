@@ -0,0 +1,494 @@
+package apis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/intuit/katlas/service/cfg"
+	"github.com/intuit/katlas/service/util"
+)
+
+// operatorMap maps QSL comparison operators to dgraph functions
+var operatorMap = map[string]string{
+	">":  "gt",
+	">=": "ge",
+	"<=": "le",
+	"<":  "lt",
+	"=":  "eq",
+	"!=": "not eq",
+	"~=": "regexp",
+}
+
+// dgraphFilter generates the body of a dgraph @filter from a QSL filter expression
+// e.g. @name="a"&&@k8sobj="b"||@name="c" -> ` eq(name,"a") and eq(k8sobj,"b") or eq(name,"c") `
+// dgraph gives and precedence over or, so parentheses are only added where an or is nested in an and
+func dgraphFilter(expr QSLExpr) string {
+	switch e := expr.(type) {
+	case *QSLCondition:
+		return " " + dgraphCondition(e) + " "
+	case *QSLNot:
+		if c, ok := e.Operand.(*QSLCondition); ok {
+			return " not " + dgraphCondition(c) + " "
+		}
+		return " not (" + dgraphFilter(e.Operand) + ") "
+	case *QSLLogical:
+		parts := make([]string, len(e.Operands))
+		for i, operand := range e.Operands {
+			if e.Operator == "and" {
+				parts[i] = dgraphGroup(operand)
+			} else {
+				parts[i] = dgraphFilter(operand)
+			}
+		}
+		return strings.Join(parts, e.Operator)
+	}
+	return ""
+}
+
+// dgraphGroup generates a filter that can be joined with "and" without changing its meaning
+func dgraphGroup(expr QSLExpr) string {
+	if l, ok := expr.(*QSLLogical); ok && l.Operator == "or" {
+		return " (" + dgraphFilter(expr) + ") "
+	}
+	return dgraphFilter(expr)
+}
+
+// dgraphNotDeleted generates the filter leaving out the tombstones of soft deleted objects
+// it is empty when soft delete is disabled or the tombstones are included
+func dgraphNotDeleted(includeDeleted bool) string {
+	if !cfg.ServerCfg.SoftDelete || includeDeleted {
+		return ""
+	}
+	return " not has(" + util.DeletedAt + ") "
+}
+
+// dgraphCondition generates a single dgraph function call from a QSL condition
+func dgraphCondition(c *QSLCondition) string {
+	field := c.Field
+	operator := c.Operator
+	value := c.Value.Text
+	switch {
+	case c.JSONKey != "":
+		// json field query, use regex search to match json key and value
+		if operator == "=" {
+			value = regexp.QuoteMeta(value)
+		}
+		if c.Value.Quoted {
+			value = `"` + value + `"`
+		}
+		value = dgraphRegex(`"` + c.JSONKey + `" *: *` + value)
+		operator = "~="
+	case operator == "~=":
+		value = dgraphRegex(value)
+	case c.Value.Quoted:
+		value = dgraphString(value)
+	}
+	// count filter refers to the var defined by getCntFilter
+	if c.Count {
+		field = "val(cnt_" + field + ")"
+	}
+	return operatorMap[operator] + "(" + field + "," + value + ")"
+}
+
+// dgraphString quotes a string value for dgraph
+func dgraphString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// dgraphRegex wraps a regular expression in slashes for dgraph
+func dgraphRegex(s string) string {
+	return "/" + strings.Replace(s, "/", `\/`, -1) + "/"
+}
+
+// dgraphPagination generates the pagination arguments of a block e.g. ,first: 2,offset: 2
+func dgraphPagination(page QSLPage) string {
+	paginate := ""
+	if page.Limit != nil {
+		paginate += "," + util.First + ": " + strconv.Itoa(*page.Limit)
+	}
+	if page.Offset != nil {
+		paginate += "," + util.Offset + ": " + strconv.Itoa(*page.Offset)
+	}
+	return paginate
+}
+
+// dgraphCursor generates the pagination arguments and filter continuing from the cursor of a block
+// without ordering dgraph pages by uid with after, ordered blocks start from the key of the cursor
+// and skip the objects with that key already returned
+func dgraphCursor(page QSLPage) (string, string) {
+	c := page.After
+	if c == nil {
+		return "", ""
+	}
+	if len(page.Order) == 0 {
+		return "," + util.After + ": " + c.UID, ""
+	}
+	args := ""
+	if c.Skip > 0 {
+		args = "," + util.Offset + ": " + strconv.Itoa(c.Skip)
+	}
+	fn := "ge"
+	if page.Order[0].Desc {
+		fn = "le"
+	}
+	key := fmt.Sprint(c.Key)
+	if s, ok := c.Key.(string); ok {
+		key = dgraphString(s)
+	}
+	return args, " @filter(" + fn + "(" + page.Order[0].Field + ", " + key + "))"
+}
+
+// dgraphOrder generates the ordering arguments of a block e.g. ,orderasc: name,orderdesc: starttime
+func dgraphOrder(page QSLPage) string {
+	order := ""
+	for _, o := range page.Order {
+		if o.Desc {
+			order += "," + util.OrderDesc + ": " + o.Field
+		} else {
+			order += "," + util.OrderAsc + ": " + o.Field
+		}
+	}
+	return order
+}
+
+// validateOrder checks the block is only ordered by scalar fields defined in its metadata
+func validateOrder(block *QSLBlock, metafieldslist []MetadataField) error {
+	for _, o := range block.Page.Order {
+		found := false
+		for _, item := range metafieldslist {
+			if item.FieldName != o.Field {
+				continue
+			}
+			found = true
+			if item.FieldType == "json" || item.FieldType == "relationship" {
+				return &QSLError{Message: fmt.Sprintf("can't order %s by %s field", block.ObjType, item.FieldType), Column: o.Column, Token: o.Field}
+			}
+		}
+		if !found {
+			return &QSLError{Message: fmt.Sprintf("can't order %s by unknown field", block.ObjType), Column: o.Column, Token: o.Field, Expected: metadataFieldNames(metafieldslist)}
+		}
+	}
+	return nil
+}
+
+// metadataFieldNames returns the sorted names of the fields of an object type
+func metadataFieldNames(metafieldslist []MetadataField) []string {
+	names := []string{}
+	for _, item := range metafieldslist {
+		names = append(names, item.FieldName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateBlock checks the filters and fields of a block against its metadata and returns
+// an error for every unknown field and every comparison the field type doesn't support
+// object types without metadata can't be checked and are left to dgraph
+func validateBlock(block *QSLBlock, metafieldslist []MetadataField) []*QSLError {
+	errs := []*QSLError{}
+	if len(metafieldslist) == 0 {
+		return errs
+	}
+	fieldType := map[string]string{util.UID: "string"}
+	for _, item := range metafieldslist {
+		fieldType[item.FieldName] = item.FieldType
+	}
+	for _, c := range filterConditions(block.Filter) {
+		if c.Count {
+			continue
+		}
+		ftype, ok := fieldType[c.Field]
+		newErr := func(format string, args ...interface{}) {
+			errs = append(errs, &QSLError{Message: fmt.Sprintf(format, args...), Column: c.Column, Token: c.Field})
+		}
+		switch {
+		case !ok:
+			errs = append(errs, &QSLError{Message: fmt.Sprintf("can't filter %s by unknown field", block.ObjType), Column: c.Column, Token: c.Field, Expected: metadataFieldNames(metafieldslist)})
+		case c.JSONKey != "" && ftype != "json":
+			newErr("can't filter %s field by json key", ftype)
+		case c.JSONKey != "":
+		case c.Operator == "~=" && (ftype == "int" || ftype == "relationship"):
+			newErr("can't use regexp on %s field", ftype)
+		case c.Operator != "=" && c.Operator != "!=" && c.Operator != "~=" && ftype != "int":
+			newErr("can't compare %s field with %s", ftype, c.Operator)
+		case ftype == "int" && c.Operator != "~=":
+			if _, err := strconv.ParseFloat(c.Value.Text, 64); err != nil {
+				newErr("can't compare int field with %s", strconv.Quote(c.Value.Text))
+			}
+		}
+	}
+	for i, name := range block.Fields.Names {
+		if _, ok := fieldType[name]; !ok {
+			errs = append(errs, &QSLError{Message: fmt.Sprintf("can't return unknown field of %s", block.ObjType), Column: block.Fields.Columns[i], Token: name, Expected: metadataFieldNames(metafieldslist)})
+		}
+	}
+	for _, c := range block.Fields.Computed {
+		if c.Len != "" {
+			ftype, ok := fieldType[c.Len]
+			switch {
+			case !ok:
+				errs = append(errs, &QSLError{Message: fmt.Sprintf("can't return unknown field of %s", block.ObjType), Column: c.Column, Token: c.Len, Expected: metadataFieldNames(metafieldslist)})
+			case ftype != "json":
+				errs = append(errs, &QSLError{Message: fmt.Sprintf("can't use len on %s field", ftype), Column: c.Column, Token: c.Len})
+			}
+			continue
+		}
+		for _, f := range c.Arith.Fields() {
+			ftype, ok := fieldType[f.Field]
+			switch {
+			case !ok:
+				errs = append(errs, &QSLError{Message: fmt.Sprintf("can't compute unknown field of %s", block.ObjType), Column: f.Column, Token: f.Field, Expected: metadataFieldNames(metafieldslist)})
+			case ftype != "int":
+				errs = append(errs, &QSLError{Message: fmt.Sprintf("can't use %s field in arithmetic", ftype), Column: f.Column, Token: f.Field})
+			}
+		}
+	}
+	return errs
+}
+
+// dgraphFields generates the list of predicates to return for a block, one per line
+// * shows all non relationship fields from metadata, n stars show the direct relationships n levels deep
+func dgraphFields(proj QSLProjection, metafieldslist []MetadataField, tabs int) []string {
+	returnlist := []string{}
+	switch {
+	case proj.Levels == 1:
+		// use list of metadatafields from metadata api to get names of all the fields
+		// for this object type
+		for _, item := range metafieldslist {
+			if item.FieldType != "relationship" {
+				returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+item.FieldName)
+			}
+		}
+	case proj.Levels > 1:
+		for i := 0; i < proj.Levels; i++ {
+			returnlist = append([]string{strings.Repeat("\t", proj.Levels-i+tabs) + "expand(_all_){"}, returnlist...)
+			returnlist = append(returnlist, strings.Repeat("\t", proj.Levels-i+tabs)+"}")
+		}
+		return returnlist
+	case len(proj.Names) == 0 && len(proj.Computed) == 0:
+		// default case for empty fields is to display nothing
+		return returnlist
+	default:
+		hasObjType := false
+		for i, name := range proj.Names {
+			line := name
+			if len(proj.Aliases) > 0 && proj.Aliases[i] != "" {
+				line = proj.Aliases[i] + " : " + name
+			}
+			returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+line)
+			hasObjType = hasObjType || (name == util.ObjType && line == name)
+		}
+		for _, c := range proj.Computed {
+			// len is counted after the query, dgraph returns the json field as a string
+			line := c.Alias + " : " + c.Len
+			if c.Arith != nil {
+				line = c.Alias + " : math(" + dgraphArith(c.Arith) + ")"
+			}
+			returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+line)
+		}
+		if !hasObjType {
+			returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+util.ObjType)
+		}
+	}
+	return append(returnlist, strings.Repeat("\t", tabs+1)+util.UID)
+}
+
+// dgraphValVarName names the value var holding a field used in computed fields
+func dgraphValVarName(field string) string {
+	return "val_" + field
+}
+
+// dgraphArith generates the math() expression of a computed field, nested operations are parenthesised
+func dgraphArith(e *QSLArith) string {
+	switch {
+	case e.Field != "":
+		return dgraphValVarName(e.Field)
+	case e.Operator == "":
+		return e.Number
+	}
+	operand := func(o *QSLArith) string {
+		if o.Operator != "" {
+			return "(" + dgraphArith(o) + ")"
+		}
+		return dgraphArith(o)
+	}
+	return operand(e.Left) + " " + e.Operator + " " + operand(e.Right)
+}
+
+// dgraphValVars defines a value var for each field used in computed fields of the blocks
+// the vars cover every object with the field so blocks of any object type can share them
+func dgraphValVars(blocks []*QSLBlock) []string {
+	fields := []string{}
+	seen := map[string]bool{}
+	for _, block := range blocks {
+		for _, c := range block.Fields.Computed {
+			if c.Arith == nil {
+				continue
+			}
+			for _, f := range c.Arith.Fields() {
+				if !seen[f.Field] {
+					seen[f.Field] = true
+					fields = append(fields, f.Field)
+				}
+			}
+		}
+	}
+	sort.Strings(fields)
+	vars := []string{}
+	for _, f := range fields {
+		vars = append(vars, fmt.Sprintf("{ var(func: has(%s)) { %s as %s } }", f, dgraphValVarName(f), f))
+	}
+	return vars
+}
+
+// dgraphHops generates the edges to the intermediate object types of a path, the last hop is the block itself
+// intermediate objects only return their objtype and uid
+func dgraphHops(path []QSLHop, cntOnly bool) []string {
+	ret := []string{}
+	for _, hop := range path[:len(path)-1] {
+		ret = append(ret, "\t"+hop.Relation+" @filter(eq(objtype, "+hop.ObjType+")){")
+		if cntOnly {
+			ret = append(ret, "\tcount(uid)")
+		} else {
+			ret = append(ret, "\t\t"+util.ObjType, "\t\t"+util.UID)
+		}
+	}
+	return ret
+}
+
+// countFilterTargets returns the object types used in count() conditions of a filter
+func countFilterTargets(expr QSLExpr) []string {
+	targets := []string{}
+	switch e := expr.(type) {
+	case *QSLCondition:
+		if e.Count {
+			targets = append(targets, e.Field)
+		}
+	case *QSLNot:
+		return countFilterTargets(e.Operand)
+	case *QSLLogical:
+		seen := map[string]bool{}
+		for _, operand := range e.Operands {
+			for _, t := range countFilterTargets(operand) {
+				if !seen[t] {
+					seen[t] = true
+					targets = append(targets, t)
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// filterConditions returns the conditions of a filter expression from left to right
+func filterConditions(expr QSLExpr) []*QSLCondition {
+	switch e := expr.(type) {
+	case *QSLCondition:
+		return []*QSLCondition{e}
+	case *QSLNot:
+		return filterConditions(e.Operand)
+	case *QSLLogical:
+		conditions := []*QSLCondition{}
+		for _, operand := range e.Operands {
+			conditions = append(conditions, filterConditions(operand)...)
+		}
+		return conditions
+	}
+	return nil
+}
+
+// cntVarTemplate defines cnt_<objtype> as the number of related objects of that type
+const cntVarTemplate = `{ var (func: eq(objtype, %s)) { %s @filter (eq (objtype, %s)) { cnt%s as count(name) } cnt_%s as sum(val(cnt%s)) }}`
+
+func dgraphCntVar(objType, relation, relType, seq string) string {
+	return fmt.Sprintf(cntVarTemplate, objType, relation, relType, seq, relType, seq)
+}
+
+// validateAggregates checks a block only groups and aggregates fields defined in its metadata
+// groupby works on scalar and relationship fields, min and max on scalar fields and sum and avg on numbers
+func validateAggregates(block *QSLBlock, metafieldslist []MetadataField) error {
+	fieldType := func(name string) (string, bool) {
+		for _, item := range metafieldslist {
+			if item.FieldName == name {
+				return item.FieldType, true
+			}
+		}
+		return "", false
+	}
+	for _, g := range block.Fields.GroupBy {
+		ftype, ok := fieldType(g.Field)
+		if !ok {
+			return &QSLError{Message: fmt.Sprintf("can't group %s by unknown field", block.ObjType), Column: g.Column, Token: g.Field, Expected: metadataFieldNames(metafieldslist)}
+		}
+		if ftype == "json" {
+			return &QSLError{Message: fmt.Sprintf("can't group %s by json field", block.ObjType), Column: g.Column, Token: g.Field}
+		}
+	}
+	for _, a := range block.Fields.Aggregates {
+		if a.Field == "" {
+			continue
+		}
+		ftype, ok := fieldType(a.Field)
+		switch {
+		case !ok:
+			return &QSLError{Message: fmt.Sprintf("can't %s unknown field of %s", a.Func, block.ObjType), Column: a.Column, Token: a.Field, Expected: metadataFieldNames(metafieldslist)}
+		case ftype == "json" || ftype == "relationship":
+			return &QSLError{Message: fmt.Sprintf("can't %s %s field", a.Func, ftype), Column: a.Column, Token: a.Field}
+		case (a.Func == util.Sum || a.Func == util.Avg) && ftype != "int":
+			return &QSLError{Message: fmt.Sprintf("can't %s non numeric field", a.Func), Column: a.Column, Token: a.Field}
+		}
+	}
+	return nil
+}
+
+// dgraphGroupBy generates the @groupby directive of an aggregated block
+// without groupby fields every object falls in a single group, its objtype
+func dgraphGroupBy(proj QSLProjection) string {
+	if len(proj.GroupBy) == 0 {
+		return " @groupby(" + util.ObjType + ")"
+	}
+	fields := make([]string, len(proj.GroupBy))
+	for i, g := range proj.GroupBy {
+		fields[i] = g.Field
+	}
+	return " @groupby(" + strings.Join(fields, ", ") + ")"
+}
+
+// dgraphAggVarName names the value var holding an aggregated field, only the last block may aggregate
+func dgraphAggVarName(field string) string {
+	return "agg_" + field
+}
+
+// dgraphAggregates generates the aggregations inside a @groupby block, one per line
+// dgraph only aggregates value vars in groups so fields are read through the vars of dgraphAggVars
+func dgraphAggregates(proj QSLProjection, tabs int) []string {
+	returnlist := []string{}
+	for _, a := range proj.Aggregates {
+		line := "count(uid)"
+		if a.Field != "" {
+			line = a.Key() + " : " + a.Func + "(val(" + dgraphAggVarName(a.Field) + "))"
+		}
+		returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+line)
+	}
+	return returnlist
+}
+
+// dgraphAggVars defines a value var for each field aggregated in the block
+func dgraphAggVars(block *QSLBlock) string {
+	vars := []string{}
+	seen := map[string]bool{}
+	for _, a := range block.Fields.Aggregates {
+		if a.Field == "" || seen[a.Field] {
+			continue
+		}
+		seen[a.Field] = true
+		vars = append(vars, dgraphAggVarName(a.Field)+" as "+a.Field)
+	}
+	if len(vars) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("{ var(func: eq(objtype, %s)) { %s } }", block.ObjType, strings.Join(vars, " "))
+}
@@ -0,0 +1,106 @@
+package apis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QSLExplain describes how a QSL query is translated to dgraph without running it
+type QSLExplain struct {
+	Query      string             `json:"query"`
+	Blocks     []*QSLExplainBlock `json:"blocks"`
+	CountQuery string             `json:"countquery"`
+	PageQuery  string             `json:"pagequery"`
+	Warnings   []string           `json:"warnings"`
+}
+
+// QSLExplainBlock is a parsed block with the relation used to reach it from the previous block
+type QSLExplainBlock struct {
+	*QSLBlock
+	// Relation is the dgraph edge from the previous block, prefixed with ~ when the reverse edge is used
+	Relation string `json:"relation,omitempty"`
+	Reverse  bool   `json:"reverse"`
+	// Path lists the intermediate object types of a block joined with .. followed by the block itself
+	Path []QSLHop `json:"path,omitempty"`
+	// Metadata is false when no metadata was found for the object type
+	Metadata bool `json:"metadata"`
+}
+
+// ExplainQuery parses the query and generates its count and paginated dgraph queries
+// warnings point out parts of the query that are likely to match nothing, the queries are
+// only generated when the query passes validation
+func (qa *QSLService) ExplainQuery(query string) (*QSLExplain, error) {
+	qsl, err := ParseQSL(query)
+	if err != nil {
+		return nil, err
+	}
+	explain := &QSLExplain{Query: query, Blocks: []*QSLExplainBlock{}, Warnings: []string{}}
+	valid := true
+	parent := ""
+	for _, block := range qsl.Blocks {
+		eb := &QSLExplainBlock{QSLBlock: block}
+		metafieldslist, err := qa.GetMetadata(block.ObjType)
+		if err != nil {
+			return nil, err
+		}
+		eb.Metadata = len(metafieldslist) > 0
+		if parent != "" {
+			path, err := qa.getRelationPath(block, parent)
+			if err != nil {
+				return nil, err
+			}
+			eb.Relation = path[len(path)-1].Relation
+			eb.Reverse = strings.HasPrefix(eb.Relation, "~")
+			if block.Indirect {
+				eb.Path = path
+			}
+		}
+		explain.Warnings = append(explain.Warnings, lintBlock(block, metafieldslist)...)
+		for _, e := range validateBlock(block, metafieldslist) {
+			explain.Warnings = append(explain.Warnings, e.Error())
+			valid = false
+		}
+		explain.Blocks = append(explain.Blocks, eb)
+		parent = block.ObjType
+	}
+	if !valid {
+		return explain, nil
+	}
+	if explain.CountQuery, err = qa.CreateDgraphQuery(query, true); err == nil {
+		explain.PageQuery, err = qa.CreateDgraphQuery(query, false)
+	}
+	if qerr, ok := err.(*QSLError); ok {
+		// ordering and aggregations are validated while generating the query
+		explain.CountQuery = ""
+		explain.Warnings = append(explain.Warnings, qerr.Error())
+		return explain, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return explain, nil
+}
+
+// lintBlock looks for filters that are valid but unlikely to do what was meant
+func lintBlock(block *QSLBlock, metafieldslist []MetadataField) []string {
+	warnings := []string{}
+	if len(metafieldslist) == 0 {
+		return append(warnings, fmt.Sprintf("no metadata found for %s, fields and relations can't be checked", block.ObjType))
+	}
+	fieldType := map[string]string{}
+	for _, item := range metafieldslist {
+		fieldType[item.FieldName] = item.FieldType
+	}
+	for _, c := range filterConditions(block.Filter) {
+		if c.Count || c.JSONKey != "" {
+			continue
+		}
+		switch fieldType[c.Field] {
+		case "json":
+			warnings = append(warnings, (&QSLError{Message: fmt.Sprintf("filter on json field %s compares the whole json value, use @%s.$key", c.Field, c.Field), Column: c.Column, Token: c.Field}).Error())
+		case "relationship":
+			warnings = append(warnings, (&QSLError{Message: fmt.Sprintf("filter on relationship field %s compares uids, filter the related block instead", c.Field), Column: c.Column, Token: c.Field}).Error())
+		}
+	}
+	return warnings
+}
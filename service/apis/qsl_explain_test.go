@@ -0,0 +1,76 @@
+package apis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainQuery(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	metaSvc := NewMetaService(dc)
+	qslSvc := NewQSLService(dc)
+
+	meta, err := ioutil.ReadFile("../data/meta.json")
+	assert.Nil(t, err)
+	var jsonData []map[string]interface{}
+	json.Unmarshal(meta, &jsonData)
+	for _, data := range jsonData {
+		metaSvc.CreateMetadata(data)
+	}
+
+	explain, err := qslSvc.ExplainQuery(`namespace[@name="default"]{@name}.pod[@labels="x"||@phase="Running"]{@name}`)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(explain.Blocks))
+	assert.Equal(t, "namespace", explain.Blocks[0].ObjType)
+	assert.Equal(t, "", explain.Blocks[0].Relation)
+	assert.True(t, explain.Blocks[0].Metadata)
+	// pod refers to namespace so the reverse edge is used
+	assert.Equal(t, "~namespace", explain.Blocks[1].Relation)
+	assert.True(t, explain.Blocks[1].Reverse)
+	assert.True(t, strings.Contains(explain.CountQuery, "\tcount(uid)"))
+	assert.False(t, strings.Contains(explain.CountQuery, "first:"))
+	assert.True(t, strings.Contains(explain.PageQuery, "{ objects(func: uid(A),first:1000,offset:0) {"))
+	assert.Equal(t, []string{
+		`filter on json field labels compares the whole json value, use @labels.$key at column 39 near "labels"`,
+	}, explain.Warnings)
+
+	// the blocks are serialized with the relation next to the parsed fields
+	b, _ := json.Marshal(explain.Blocks[1])
+	assert.True(t, strings.Contains(string(b), `"objtype":"pod"`))
+	assert.True(t, strings.Contains(string(b), `"relation":"~namespace"`))
+
+	// blocks joined with .. show the intermediate object types
+	explain, err = qslSvc.ExplainQuery(`deployment{@name}..pod{@name}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "~owner", explain.Blocks[1].Relation)
+	assert.Equal(t, []QSLHop{{ObjType: "replicaset", Relation: "~owner"}, {ObjType: "pod", Relation: "~owner"}}, explain.Blocks[1].Path)
+
+	// invalid queries list every problem instead of generating queries
+	explain, err = qslSvc.ExplainQuery(`pod[@phsae="Running"||@name.$app="a"]{@name,@bar}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "", explain.PageQuery)
+	if assert.Equal(t, 3, len(explain.Warnings)) {
+		assert.True(t, strings.HasPrefix(explain.Warnings[0], `can't filter pod by unknown field at column 5 near "phsae", expected one of `))
+		assert.Equal(t, `can't filter string field by json key at column 23 near "name"`, explain.Warnings[1])
+		assert.True(t, strings.HasPrefix(explain.Warnings[2], `can't return unknown field of pod at column 45 near "bar"`))
+	}
+
+	explain, err = qslSvc.ExplainQuery(`pod[$$orderasc=labels]{*}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "", explain.CountQuery)
+	assert.Equal(t, []string{`can't order pod by json field at column 16 near "labels"`}, explain.Warnings)
+
+	// object types without metadata can't be checked
+	explain, err = qslSvc.ExplainQuery(`unknownobj{@name}`)
+	assert.Nil(t, err)
+	assert.False(t, explain.Blocks[0].Metadata)
+	assert.Equal(t, []string{"no metadata found for unknownobj, fields and relations can't be checked"}, explain.Warnings)
+
+	_, err = qslSvc.ExplainQuery(`pod[@name="x"}{*}`)
+	assert.NotNil(t, err)
+}
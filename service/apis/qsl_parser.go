@@ -0,0 +1,914 @@
+package apis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/intuit/katlas/service/util"
+)
+
+// QSL grammar
+// query      = block { ( "." | ".." ) block }
+// block      = objtype [ "[" [ filter ] [ "$$" pagination ] "]" ] "{" [ projection ] "}"
+// filter     = and { "||" and }
+// and        = unary { "&&" unary }
+// unary      = "!" unary | "(" filter ")" | condition
+// condition  = "@" key operator value
+// key        = name [ ".$" jsonkey ] | "count(" objtype ")"
+// operator   = "=" | "!=" | ">" | ">=" | "<" | "<=" | "~="
+// value      = string | word
+// pagination = page { "," page }
+// page       = ( "limit" | "offset" ) "=" number | ( "orderasc" | "orderdesc" ) "=" name | "after" "=" cursor
+//            | "asof" "=" timestamp | "includeDeleted" "=" ( "true" | "false" )
+// projection = "*" { "*" } | item { "," item }
+// item       = "@" name [ "as" alias ] | arith "as" alias | "len(" "@" name ")" "as" alias
+//            | "groupby(" "@" name { "," "@" name } ")" | "count()" | aggregate "(" "@" name ")"
+// aggregate  = "sum" | "min" | "max" | "avg"
+// arith      = term { ( "+" | "-" ) term }
+// term       = factor { ( "*" | "/" ) factor }
+// factor     = "@" name | number | "(" arith ")"
+
+type qslTokenKind int
+
+const (
+	qslEOF qslTokenKind = iota
+	qslIllegal
+	qslWord
+	qslString
+	qslAt
+	qslLBracket
+	qslRBracket
+	qslLBrace
+	qslRBrace
+	qslLParen
+	qslRParen
+	qslComma
+	qslDot
+	qslStar
+	qslAnd
+	qslOr
+	qslPage
+	qslOperator
+	qslNot
+	qslArith
+)
+
+type qslToken struct {
+	kind qslTokenKind
+	// text is the token as written, for strings the unescaped content
+	text string
+	// column is the 1-based position of the token in the query
+	column int
+}
+
+// QSLError is returned for malformed queries, it reports where the query stopped making sense
+type QSLError struct {
+	Message string `json:"message"`
+	Column  int    `json:"column"`
+	Token   string `json:"token"`
+	// Expected lists the valid values when the token isn't one of them
+	Expected []string `json:"expected,omitempty"`
+}
+
+func (e *QSLError) Error() string {
+	msg := fmt.Sprintf("%s at column %d near %q", e.Message, e.Column, e.Token)
+	if e.Token == "" {
+		msg = fmt.Sprintf("%s at column %d (end of query)", e.Message, e.Column)
+	}
+	if len(e.Expected) > 0 {
+		msg += ", expected one of " + strings.Join(e.Expected, ", ")
+	}
+	return msg
+}
+
+func newQSLError(tok qslToken, format string, args ...interface{}) *QSLError {
+	return &QSLError{Message: fmt.Sprintf(format, args...), Column: tok.column, Token: tok.raw()}
+}
+
+// raw returns the token as it appears in the query
+func (t qslToken) raw() string {
+	if t.kind == qslString {
+		return strconv.Quote(t.text)
+	}
+	return t.text
+}
+
+func isQSLWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.$^:/\\", r)
+}
+
+// isQSLArith returns true when rs[i] is an arithmetic operator of a projection, - and / are
+// only operators when they aren't followed by a letter so @na-me is still read as one name
+func isQSLArith(rs []rune, i int) bool {
+	switch rs[i] {
+	case '+':
+		return true
+	case '-', '/':
+		return i+1 == len(rs) || !unicode.IsLetter(rs[i+1])
+	}
+	return false
+}
+
+// lexQSL splits the query into tokens, unknown characters become illegal tokens so the parser
+// can report them in context
+func lexQSL(query string) ([]qslToken, error) {
+	tokens := []qslToken{}
+	rs := []rune(query)
+	// arithmetic is only allowed between { and }, filter values keep - and / as part of words
+	projection := false
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		col := i + 1
+		two := ""
+		if i+1 < len(rs) {
+			two = string(rs[i : i+2])
+		}
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, &QSLError{Message: "unterminated string", Column: col, Token: string(rs[i:])}
+			}
+			tokens = append(tokens, qslToken{qslString, sb.String(), col})
+			i = j + 1
+		case two == "&&":
+			tokens = append(tokens, qslToken{qslAnd, two, col})
+			i += 2
+		case two == "||":
+			tokens = append(tokens, qslToken{qslOr, two, col})
+			i += 2
+		case two == "$$":
+			tokens = append(tokens, qslToken{qslPage, two, col})
+			i += 2
+		case two == ">=" || two == "<=" || two == "!=" || two == "~=":
+			tokens = append(tokens, qslToken{qslOperator, two, col})
+			i += 2
+		case r == '!':
+			tokens = append(tokens, qslToken{qslNot, string(r), col})
+			i++
+		case r == '=' || r == '>' || r == '<':
+			tokens = append(tokens, qslToken{qslOperator, string(r), col})
+			i++
+		case projection && isQSLArith(rs, i):
+			tokens = append(tokens, qslToken{qslArith, string(r), col})
+			i++
+		case r != '.' && isQSLWordRune(r):
+			j := i
+			// stop before $$ so unquoted values can be followed by pagination
+			for j < len(rs) && isQSLWordRune(rs[j]) && !(rs[j] == '$' && j+1 < len(rs) && rs[j+1] == '$') && !(projection && isQSLArith(rs, j)) {
+				j++
+			}
+			tokens = append(tokens, qslToken{qslWord, string(rs[i:j]), col})
+			i = j
+		default:
+			kind, ok := map[rune]qslTokenKind{
+				'@': qslAt, '[': qslLBracket, ']': qslRBracket, '{': qslLBrace, '}': qslRBrace,
+				'(': qslLParen, ')': qslRParen, ',': qslComma, '.': qslDot, '*': qslStar,
+			}[r]
+			if !ok {
+				kind = qslIllegal
+			}
+			if kind == qslLBrace || kind == qslRBrace {
+				projection = kind == qslLBrace
+			}
+			tokens = append(tokens, qslToken{kind, string(r), col})
+			i++
+		}
+	}
+	return append(tokens, qslToken{qslEOF, "", len(rs) + 1}), nil
+}
+
+// QSLQuery is the parsed form of a QSL query, each block is related to the one before it
+type QSLQuery struct {
+	Blocks []*QSLBlock `json:"blocks"`
+}
+
+// QSLBlock is a single objtype[filters]{fields} part of a query
+type QSLBlock struct {
+	ObjType string        `json:"objtype"`
+	Filter  QSLExpr       `json:"filter,omitempty"`
+	Page    QSLPage       `json:"page"`
+	Fields  QSLProjection `json:"fields"`
+	Column  int           `json:"column"`
+	// Indirect is set when the block follows .. and may be reached through intermediate object types
+	Indirect bool `json:"indirect,omitempty"`
+}
+
+// QSLPage holds the optional $$limit, $$offset, $$after cursor and ordering of a block
+// AsOf reads the objects of the first block from their history at the given time
+// IncludeDeleted returns the tombstones of soft deleted objects too
+type QSLPage struct {
+	Limit          *int       `json:"limit,omitempty"`
+	Offset         *int       `json:"offset,omitempty"`
+	After          *Cursor    `json:"after,omitempty"`
+	Order          []QSLOrder `json:"order,omitempty"`
+	AsOf           *time.Time `json:"asof,omitempty"`
+	IncludeDeleted bool       `json:"includedeleted,omitempty"`
+}
+
+// paginated returns true if the page selects or orders the objects, includeDeleted alone doesn't
+func (p QSLPage) paginated() bool {
+	return p.Limit != nil || p.Offset != nil || p.After != nil || len(p.Order) > 0 || p.AsOf != nil
+}
+
+// QSLOrder sorts a block by a field, earlier orders take precedence
+type QSLOrder struct {
+	Field  string `json:"field"`
+	Desc   bool   `json:"desc"`
+	Column int    `json:"column"`
+}
+
+// QSLProjection is either a number of * levels, a list of field names and their columns
+// or a list of aggregations optionally grouped by fields
+// Aliases holds the name each field is returned under, empty when it keeps its own name
+type QSLProjection struct {
+	Levels     int            `json:"levels,omitempty"`
+	Names      []string       `json:"names,omitempty"`
+	Aliases    []string       `json:"aliases,omitempty"`
+	Columns    []int          `json:"columns,omitempty"`
+	Computed   []QSLComputed  `json:"computed,omitempty"`
+	GroupBy    []QSLGroupBy   `json:"groupby,omitempty"`
+	Aggregates []QSLAggregate `json:"aggregates,omitempty"`
+}
+
+// IsAggregate returns true when the projection returns groups instead of objects
+func (proj QSLProjection) IsAggregate() bool {
+	return len(proj.Aggregates) > 0
+}
+
+// QSLGroupBy is a field the aggregations of a block are grouped by
+type QSLGroupBy struct {
+	Field  string `json:"field"`
+	Column int    `json:"column"`
+}
+
+// QSLAggregate is count() or sum, min, max, avg of a field
+type QSLAggregate struct {
+	Func   string `json:"func"`
+	Field  string `json:"field,omitempty"`
+	Column int    `json:"column"`
+}
+
+// Key returns the name of the aggregate in each returned group e.g. count, sum_numreplicas
+func (a QSLAggregate) Key() string {
+	if a.Field == "" {
+		return a.Func
+	}
+	return a.Func + "_" + a.Field
+}
+
+// QSLComputed is a value calculated from the fields of an object and returned under Alias
+// it is either arithmetic on numeric fields or the number of items of a json field
+type QSLComputed struct {
+	Alias  string    `json:"alias"`
+	Arith  *QSLArith `json:"arith,omitempty"`
+	Len    string    `json:"len,omitempty"`
+	Column int       `json:"column"`
+}
+
+// QSLArith is a node of an arithmetic expression, leaves hold a field or a number
+type QSLArith struct {
+	Operator string    `json:"operator,omitempty"`
+	Left     *QSLArith `json:"left,omitempty"`
+	Right    *QSLArith `json:"right,omitempty"`
+	Field    string    `json:"field,omitempty"`
+	Number   string    `json:"number,omitempty"`
+	Column   int       `json:"column"`
+}
+
+// Fields returns the fields used in the expression from left to right
+func (e *QSLArith) Fields() []*QSLArith {
+	if e.Operator == "" {
+		if e.Field != "" {
+			return []*QSLArith{e}
+		}
+		return nil
+	}
+	return append(e.Left.Fields(), e.Right.Fields()...)
+}
+
+// aggregateFuncs are the functions allowed in a projection, only count takes no field
+var aggregateFuncs = map[string]bool{
+	util.Count: true,
+	util.Sum:   true,
+	util.Min:   true,
+	util.Max:   true,
+	util.Avg:   true,
+}
+
+// QSLExpr is a node of a filter expression
+type QSLExpr interface {
+	qslExpr()
+}
+
+// QSLCondition compares a field, a json key of a field or a relation count with a value
+type QSLCondition struct {
+	Field    string   `json:"field"`
+	JSONKey  string   `json:"jsonkey,omitempty"`
+	Count    bool     `json:"count,omitempty"`
+	Operator string   `json:"operator"`
+	Value    QSLValue `json:"value"`
+	Column   int      `json:"column"`
+}
+
+// QSLValue is the right hand side of a condition
+type QSLValue struct {
+	Text   string `json:"text"`
+	Quoted bool   `json:"quoted"`
+}
+
+// QSLLogical joins operands with "and" or "or"
+type QSLLogical struct {
+	Operator string    `json:"operator"`
+	Operands []QSLExpr `json:"operands"`
+}
+
+// QSLNot negates its operand
+type QSLNot struct {
+	Operand QSLExpr `json:"not"`
+}
+
+func (*QSLCondition) qslExpr() {}
+func (*QSLLogical) qslExpr()   {}
+func (*QSLNot) qslExpr()       {}
+
+type qslParser struct {
+	tokens []qslToken
+	pos    int
+}
+
+func newQSLParser(query string) (*qslParser, error) {
+	tokens, err := lexQSL(query)
+	if err != nil {
+		return nil, err
+	}
+	return &qslParser{tokens: tokens}, nil
+}
+
+func (p *qslParser) peek() qslToken {
+	return p.tokens[p.pos]
+}
+
+func (p *qslParser) next() qslToken {
+	t := p.tokens[p.pos]
+	if t.kind != qslEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *qslParser) expect(kind qslTokenKind, what string) (qslToken, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, newQSLError(t, "expected %s", what)
+	}
+	return t, nil
+}
+
+// ParseQSL parses a QSL query string into blocks
+func ParseQSL(query string) (*QSLQuery, error) {
+	p, err := newQSLParser(query)
+	if err != nil {
+		return nil, err
+	}
+	q := &QSLQuery{}
+	indirect := false
+	for {
+		b, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		b.Indirect = indirect
+		if b.Page.After != nil && len(q.Blocks) > 0 {
+			return nil, &QSLError{Message: "after is only supported in the first block", Column: b.Column, Token: b.ObjType}
+		}
+		if b.Page.AsOf != nil && len(q.Blocks) > 0 {
+			return nil, &QSLError{Message: "asof is only supported in the first block", Column: b.Column, Token: b.ObjType}
+		}
+		q.Blocks = append(q.Blocks, b)
+		if p.peek().kind != qslDot {
+			break
+		}
+		dot := p.next()
+		if b.Fields.IsAggregate() {
+			return nil, newQSLError(dot, "aggregations are only supported in the last block")
+		}
+		// .. lets the service find the intermediate object types
+		if indirect = p.peek().kind == qslDot; indirect {
+			p.next()
+		}
+	}
+	if t := p.peek(); t.kind != qslEOF {
+		return nil, newQSLError(t, "unexpected token after block")
+	}
+	return q, nil
+}
+
+// ParseQSLFilter parses a filter given without its block, e.g. @phase="Running"&&@name~="^web"
+func ParseQSLFilter(filter string) (QSLExpr, error) {
+	p, err := newQSLParser(filter)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := p.parseFilter()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != qslEOF {
+		return nil, newQSLError(t, "unexpected token after filter")
+	}
+	return expr, nil
+}
+
+func (p *qslParser) parseBlock() (*QSLBlock, error) {
+	t, err := p.expect(qslWord, "object type")
+	if err != nil {
+		return nil, err
+	}
+	if !IsAlphaNum(t.text) {
+		return nil, newQSLError(t, "object type must be alphanumeric")
+	}
+	b := &QSLBlock{ObjType: strings.ToLower(t.text), Column: t.column}
+	var page *qslToken
+	if p.peek().kind == qslLBracket {
+		p.next()
+		if k := p.peek().kind; k != qslPage && k != qslRBracket {
+			if b.Filter, err = p.parseFilter(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek().kind == qslPage {
+			tok := p.next()
+			page = &tok
+			if b.Page, err = p.parsePage(); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.expect(qslRBracket, "]"); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(qslLBrace, "{"); err != nil {
+		return nil, err
+	}
+	if b.Fields, err = p.parseProjection(qslRBrace); err != nil {
+		return nil, err
+	}
+	if b.Page.paginated() && b.Fields.IsAggregate() {
+		return nil, newQSLError(*page, "pagination and ordering can't be used with aggregations")
+	}
+	if b.Page.After != nil && b.Page.Offset != nil {
+		return nil, newQSLError(*page, "after can't be combined with offset")
+	}
+	if b.Page.After != nil && b.Page.AsOf != nil {
+		return nil, newQSLError(*page, "after can't be combined with asof")
+	}
+	p.next()
+	return b, nil
+}
+
+func (p *qslParser) parseFilter() (QSLExpr, error) {
+	return p.parseLogical("or", qslOr, func() (QSLExpr, error) {
+		return p.parseLogical("and", qslAnd, p.parseUnary)
+	})
+}
+
+// parseUnary parses a negation, a parenthesised filter or a single condition
+func (p *qslParser) parseUnary() (QSLExpr, error) {
+	switch p.peek().kind {
+	case qslNot:
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &QSLNot{Operand: operand}, nil
+	case qslLParen:
+		p.next()
+		e, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(qslRParen, ")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return p.parseCondition()
+}
+
+// parseLogical parses operands separated by sep, a single operand is returned as is
+func (p *qslParser) parseLogical(op string, sep qslTokenKind, operand func() (QSLExpr, error)) (QSLExpr, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	operands := []QSLExpr{first}
+	for p.peek().kind == sep {
+		p.next()
+		e, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, e)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &QSLLogical{Operator: op, Operands: operands}, nil
+}
+
+func (p *qslParser) parseCondition() (QSLExpr, error) {
+	at, err := p.expect(qslAt, "@ before filter field")
+	if err != nil {
+		return nil, err
+	}
+	c := &QSLCondition{Column: at.column}
+	key, err := p.expect(qslWord, "filter field")
+	if err != nil {
+		return nil, err
+	}
+	if key.text == util.Count && p.peek().kind == qslLParen {
+		p.next()
+		rel, err := p.expect(qslWord, "object type in count")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(qslRParen, ")"); err != nil {
+			return nil, err
+		}
+		c.Field = strings.ToLower(rel.text)
+		c.Count = true
+	} else if idx := strings.Index(key.text, ".$"); idx >= 0 {
+		c.Field = key.text[:idx]
+		c.JSONKey = key.text[idx+2:]
+		if c.Field == "" || c.JSONKey == "" {
+			return nil, newQSLError(key, "json filter must be of the form @field.$key")
+		}
+	} else {
+		c.Field = key.text
+	}
+	op, err := p.expect(qslOperator, "comparison operator")
+	if err != nil {
+		return nil, err
+	}
+	c.Operator = op.text
+	if c.JSONKey != "" && c.Operator != "=" && c.Operator != "~=" {
+		return nil, newQSLError(op, "filter on json type can only use equal or regexp operator")
+	}
+	val := p.next()
+	switch val.kind {
+	case qslString:
+		c.Value = QSLValue{Text: val.text, Quoted: true}
+	case qslWord:
+		c.Value = QSLValue{Text: val.text}
+	default:
+		return nil, newQSLError(val, "expected filter value")
+	}
+	return c, nil
+}
+
+func (p *qslParser) parsePage() (QSLPage, error) {
+	page := QSLPage{}
+	for {
+		key, err := p.expect(qslWord, "limit, offset, after, orderasc, orderdesc, asof or includeDeleted")
+		if err != nil {
+			return page, err
+		}
+		if op := p.next(); op.kind != qslOperator || op.text != "=" {
+			return page, newQSLError(op, "expected =")
+		}
+		switch key.text {
+		case util.Limit, util.Offset:
+		case util.After:
+			token := p.next()
+			if token.kind != qslWord {
+				return page, newQSLError(token, "expected cursor")
+			}
+			if page.After, err = DecodeCursor(token.text); err != nil {
+				return page, newQSLError(token, "invalid cursor")
+			}
+			if p.peek().kind != qslComma {
+				return page, nil
+			}
+			p.next()
+			continue
+		case util.AsOf:
+			token := p.next()
+			if token.kind != qslWord && token.kind != qslString {
+				return page, newQSLError(token, "expected timestamp")
+			}
+			asof, err := ParseAsOf(token.text)
+			if err != nil {
+				return page, newQSLError(token, "%s", err.Error())
+			}
+			page.AsOf = &asof
+			if p.peek().kind != qslComma {
+				return page, nil
+			}
+			p.next()
+			continue
+		case util.IncludeDeleted:
+			token := p.next()
+			include, err := strconv.ParseBool(token.text)
+			if token.kind != qslWord || err != nil {
+				return page, newQSLError(token, "includeDeleted must be true or false")
+			}
+			page.IncludeDeleted = include
+			if p.peek().kind != qslComma {
+				return page, nil
+			}
+			p.next()
+			continue
+		case util.OrderAsc, util.OrderDesc:
+			field := p.next()
+			if field.kind != qslWord || !IsAlphaNum(field.text) {
+				return page, newQSLError(field, "order field must be an alphanumeric field name")
+			}
+			page.Order = append(page.Order, QSLOrder{Field: strings.ToLower(field.text), Desc: key.text == util.OrderDesc, Column: field.column})
+			if p.peek().kind != qslComma {
+				return page, nil
+			}
+			p.next()
+			continue
+		default:
+			return page, newQSLError(key, "invalid pagination key, expected limit, offset, after, orderasc, orderdesc, asof or includeDeleted")
+		}
+		num := p.next()
+		val, err := strconv.Atoi(num.text)
+		if num.kind != qslWord || err != nil || val < 0 {
+			return page, newQSLError(num, "pagination value must be a number")
+		}
+		if key.text == util.Limit {
+			if val > MaximumLimit {
+				return page, newQSLError(num, "pagination exceeding maxiumum limit %d", MaximumLimit)
+			}
+			page.Limit = &val
+		} else {
+			page.Offset = &val
+		}
+		if p.peek().kind != qslComma {
+			return page, nil
+		}
+		p.next()
+	}
+}
+
+// parseProjection parses fields until the end token, which is left for the caller
+func (p *qslParser) parseProjection(end qslTokenKind) (QSLProjection, error) {
+	proj := QSLProjection{}
+	const notBoth = "Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both"
+	if p.peek().kind == qslStar {
+		for p.peek().kind == qslStar {
+			p.next()
+			proj.Levels++
+		}
+		if t := p.peek(); t.kind != end {
+			return proj, newQSLError(t, notBoth)
+		}
+		return proj, nil
+	}
+	// remember where fields and groupby start to report mixing them with aggregations
+	var field, groupby *qslToken
+	// names of the returned values, aliases must not repeat them
+	names := map[string]bool{}
+	for items := 0; p.peek().kind != end; items++ {
+		if items > 0 {
+			if t := p.next(); t.kind != qslComma {
+				return proj, newQSLError(t, "Fields must be separated by ,")
+			}
+		}
+		t := p.next()
+		if t.kind == qslStar {
+			return proj, newQSLError(t, notBoth)
+		}
+		if t.kind == qslWord && p.peek().kind == qslLParen && strings.ToLower(t.text) == util.Len {
+			c, err := p.parseLen(t)
+			if err != nil {
+				return proj, err
+			}
+			if field == nil {
+				field = &t
+			}
+			if err := p.parseAlias(&c.Alias, names); err != nil {
+				return proj, err
+			}
+			proj.Computed = append(proj.Computed, c)
+			continue
+		}
+		if t.kind == qslWord && p.peek().kind == qslLParen {
+			if t.text == util.GroupBy {
+				if groupby != nil {
+					return proj, newQSLError(t, "groupby may only be used once")
+				}
+				groupby = &t
+				names, err := p.parseGroupBy()
+				if err != nil {
+					return proj, err
+				}
+				proj.GroupBy = names
+				continue
+			}
+			agg, err := p.parseAggregate(t)
+			if err != nil {
+				return proj, err
+			}
+			proj.Aggregates = append(proj.Aggregates, agg)
+			continue
+		}
+		expr, err := p.parseArith(t)
+		if err != nil {
+			return proj, err
+		}
+		if field == nil {
+			field = &t
+		}
+		if expr.Field != "" {
+			// a single field, optionally renamed
+			alias := ""
+			if t := p.peek(); t.kind == qslWord && strings.ToLower(t.text) == "as" {
+				if err := p.parseAlias(&alias, names); err != nil {
+					return proj, err
+				}
+			} else {
+				names[expr.Field] = true
+			}
+			proj.Names = append(proj.Names, expr.Field)
+			proj.Aliases = append(proj.Aliases, alias)
+			proj.Columns = append(proj.Columns, t.column)
+			continue
+		}
+		c := QSLComputed{Arith: expr, Column: t.column}
+		if err := p.parseAlias(&c.Alias, names); err != nil {
+			return proj, err
+		}
+		proj.Computed = append(proj.Computed, c)
+	}
+	if strings.Join(proj.Aliases, "") == "" {
+		// only keep aliases when a field is renamed
+		proj.Aliases = nil
+	}
+	switch {
+	case proj.IsAggregate() && field != nil:
+		return proj, newQSLError(*field, "Fields can't be combined with aggregations, use groupby(@field) instead")
+	case groupby != nil && !proj.IsAggregate():
+		return proj, newQSLError(*groupby, "groupby requires at least one aggregation")
+	}
+	return proj, nil
+}
+
+// parseFieldName parses the name following the @ token t
+func (p *qslParser) parseFieldName(t qslToken) (string, error) {
+	if t.kind != qslAt {
+		return "", newQSLError(t, "Field names must be prefixed with @ sign and followed by an alphanumeric field name")
+	}
+	name := p.next()
+	if name.kind != qslWord || !IsAlphaNum(name.text) {
+		return "", newQSLError(name, "Field names must be composed of only alphanumeric characters")
+	}
+	return strings.ToLower(name.text), nil
+}
+
+// parseGroupBy parses the (@field,...) list following groupby
+func (p *qslParser) parseGroupBy() ([]QSLGroupBy, error) {
+	p.next()
+	names := []QSLGroupBy{}
+	for {
+		at := p.next()
+		name, err := p.parseFieldName(at)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, QSLGroupBy{Field: name, Column: at.column})
+		if p.peek().kind != qslComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(qslRParen, ")"); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// parseAggregate parses the (@field) following the aggregate function fn, count takes no field
+func (p *qslParser) parseAggregate(fn qslToken) (QSLAggregate, error) {
+	agg := QSLAggregate{Func: strings.ToLower(fn.text), Column: fn.column}
+	if !aggregateFuncs[agg.Func] {
+		return agg, newQSLError(fn, "unknown aggregation, expected groupby, count, sum, min, max or avg")
+	}
+	p.next()
+	if agg.Func != util.Count {
+		name, err := p.parseFieldName(p.next())
+		if err != nil {
+			return agg, err
+		}
+		agg.Field = name
+	}
+	if _, err := p.expect(qslRParen, ")"); err != nil {
+		return agg, err
+	}
+	return agg, nil
+}
+
+// parseAlias parses "as" alias and checks the alias isn't already returned by the block
+func (p *qslParser) parseAlias(alias *string, names map[string]bool) error {
+	as := p.next()
+	if as.kind != qslWord || strings.ToLower(as.text) != "as" {
+		return newQSLError(as, "computed fields must be named with as")
+	}
+	name := p.next()
+	if name.kind != qslWord || !IsAlphaNum(name.text) {
+		return newQSLError(name, "alias must be an alphanumeric name")
+	}
+	*alias = strings.ToLower(name.text)
+	if names[*alias] {
+		return newQSLError(name, "%s is returned more than once", *alias)
+	}
+	names[*alias] = true
+	return nil
+}
+
+// parseLen parses the (@field) following len
+func (p *qslParser) parseLen(fn qslToken) (QSLComputed, error) {
+	c := QSLComputed{Column: fn.column}
+	p.next()
+	name, err := p.parseFieldName(p.next())
+	if err != nil {
+		return c, err
+	}
+	c.Len = name
+	if _, err := p.expect(qslRParen, ")"); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// parseArith parses an arithmetic expression starting with the token t, + and - bind looser than * and /
+func (p *qslParser) parseArith(t qslToken) (*QSLArith, error) {
+	left, err := p.parseTerm(t)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op.kind == qslArith && (op.text == "+" || op.text == "-"); op = p.peek() {
+		p.next()
+		right, err := p.parseTerm(p.next())
+		if err != nil {
+			return nil, err
+		}
+		left = &QSLArith{Operator: op.text, Left: left, Right: right, Column: op.column}
+	}
+	return left, nil
+}
+
+func (p *qslParser) parseTerm(t qslToken) (*QSLArith, error) {
+	left, err := p.parseFactor(t)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op.kind == qslStar || (op.kind == qslArith && op.text == "/"); op = p.peek() {
+		p.next()
+		right, err := p.parseFactor(p.next())
+		if err != nil {
+			return nil, err
+		}
+		left = &QSLArith{Operator: op.text, Left: left, Right: right, Column: op.column}
+	}
+	return left, nil
+}
+
+func (p *qslParser) parseFactor(t qslToken) (*QSLArith, error) {
+	switch t.kind {
+	case qslLParen:
+		e, err := p.parseArith(p.next())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(qslRParen, ")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case qslWord:
+		if _, err := strconv.ParseFloat(t.text, 64); err != nil {
+			return nil, newQSLError(t, "Field names must be prefixed with @ sign and followed by an alphanumeric field name")
+		}
+		return &QSLArith{Number: t.text, Column: t.column}, nil
+	}
+	name, err := p.parseFieldName(t)
+	if err != nil {
+		return nil, err
+	}
+	return &QSLArith{Field: name, Column: t.column}, nil
+}
@@ -0,0 +1,187 @@
+package apis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQSL(t *testing.T) {
+	q, err := ParseQSL(`Cluster[@name="a}.b" || @count(Pod)>=2 && @labels.$app~="^web"$$limit=5]{@name, @region}.pod{**}`)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(q.Blocks))
+
+	cluster := q.Blocks[0]
+	assert.Equal(t, "cluster", cluster.ObjType)
+	assert.Equal(t, 1, cluster.Column)
+	assert.Equal(t, 5, *cluster.Page.Limit)
+	assert.Nil(t, cluster.Page.Offset)
+	assert.Equal(t, []string{"name", "region"}, cluster.Fields.Names)
+	or := cluster.Filter.(*QSLLogical)
+	assert.Equal(t, "or", or.Operator)
+	assert.Equal(t, &QSLCondition{Field: "name", Operator: "=", Value: QSLValue{Text: "a}.b", Quoted: true}, Column: 9}, or.Operands[0])
+	and := or.Operands[1].(*QSLLogical)
+	assert.Equal(t, "and", and.Operator)
+	assert.Equal(t, &QSLCondition{Field: "pod", Count: true, Operator: ">=", Value: QSLValue{Text: "2"}, Column: 25}, and.Operands[0])
+	assert.Equal(t, &QSLCondition{Field: "labels", JSONKey: "app", Operator: "~=", Value: QSLValue{Text: "^web", Quoted: true}, Column: 43}, and.Operands[1])
+
+	pod := q.Blocks[1]
+	assert.Equal(t, "pod", pod.ObjType)
+	assert.Equal(t, 2, pod.Fields.Levels)
+	assert.Nil(t, pod.Filter)
+
+	// generated dgraph filter keeps the value intact
+	assert.Equal(t, ` eq(name,"a}.b") or gt(val(cnt_pod),1) `, dgraphFilter(&QSLLogical{Operator: "or", Operands: []QSLExpr{
+		or.Operands[0], &QSLCondition{Field: "pod", Count: true, Operator: ">", Value: QSLValue{Text: "1"}},
+	}}))
+}
+
+func TestParseQSLIndirect(t *testing.T) {
+	q, err := ParseQSL(`deployment[@name="x"]{*}..pod{@name}.node{*}`)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(q.Blocks))
+	assert.False(t, q.Blocks[0].Indirect)
+	assert.True(t, q.Blocks[1].Indirect)
+	assert.Equal(t, "pod", q.Blocks[1].ObjType)
+	assert.False(t, q.Blocks[2].Indirect)
+}
+
+func TestParseQSLIncludeDeleted(t *testing.T) {
+	q, err := ParseQSL(`node{*}.pod[@phase="Failed"$$includeDeleted=true,limit=5]{*}`)
+	assert.Nil(t, err)
+	assert.False(t, q.Blocks[0].Page.IncludeDeleted)
+	assert.True(t, q.Blocks[1].Page.IncludeDeleted)
+	assert.Equal(t, 5, *q.Blocks[1].Page.Limit)
+	// tombstones can be counted
+	q, err = ParseQSL(`pod[$$includeDeleted=true]{groupby(@phase),count()}`)
+	assert.Nil(t, err)
+	assert.True(t, q.Blocks[0].Page.IncludeDeleted)
+}
+
+func TestParseQSLGrouping(t *testing.T) {
+	q, err := ParseQSL(`pod[(@phase="Failed"||@phase="Unknown")&&!(@name~="^debug")&&@phase!="Running"]{*}`)
+	assert.Nil(t, err)
+	and := q.Blocks[0].Filter.(*QSLLogical)
+	assert.Equal(t, "and", and.Operator)
+	assert.Equal(t, 3, len(and.Operands))
+	or := and.Operands[0].(*QSLLogical)
+	assert.Equal(t, "or", or.Operator)
+	not := and.Operands[1].(*QSLNot)
+	assert.Equal(t, "~=", not.Operand.(*QSLCondition).Operator)
+	assert.Equal(t, "!=", and.Operands[2].(*QSLCondition).Operator)
+
+	// double negation and nested groups
+	q, err = ParseQSL(`pod[!!((@a=1))]{*}`)
+	assert.Nil(t, err)
+	inner := q.Blocks[0].Filter.(*QSLNot).Operand.(*QSLNot).Operand
+	assert.Equal(t, "a", inner.(*QSLCondition).Field)
+	assert.Equal(t, " not ( not eq(a,1) ) ", dgraphFilter(q.Blocks[0].Filter))
+}
+
+func TestParseQSLAggregates(t *testing.T) {
+	q, err := ParseQSL(`namespace{@name}.pod[@phase!="Running"]{groupby(@phase, @nodename), count(), Sum(@restarts)}`)
+	assert.Nil(t, err)
+	assert.False(t, q.Blocks[0].Fields.IsAggregate())
+	proj := q.Blocks[1].Fields
+	assert.True(t, proj.IsAggregate())
+	assert.Nil(t, proj.Names)
+	assert.Equal(t, []QSLGroupBy{{Field: "phase", Column: 49}, {Field: "nodename", Column: 57}}, proj.GroupBy)
+	assert.Equal(t, []QSLAggregate{{Func: "count", Column: 69}, {Func: "sum", Field: "restarts", Column: 78}}, proj.Aggregates)
+	assert.Equal(t, "count", proj.Aggregates[0].Key())
+	assert.Equal(t, "sum_restarts", proj.Aggregates[1].Key())
+	assert.Equal(t, " @groupby(phase, nodename)", dgraphGroupBy(proj))
+}
+
+func TestParseQSLComputed(t *testing.T) {
+	q, err := ParseQSL(`deployment{@name, @numreplicas as desired, (@numreplicas - @availablereplicas)/@numreplicas*100 as unavailable}.pod{len(@containers) as ncontainers}`)
+	assert.Nil(t, err)
+	proj := q.Blocks[0].Fields
+	assert.Equal(t, []string{"name", "numreplicas"}, proj.Names)
+	assert.Equal(t, []string{"", "desired"}, proj.Aliases)
+	if assert.Equal(t, 1, len(proj.Computed)) {
+		c := proj.Computed[0]
+		assert.Equal(t, "unavailable", c.Alias)
+		assert.Equal(t, 44, c.Column)
+		// * and / bind tighter than - and are applied from left to right
+		assert.Equal(t, "*", c.Arith.Operator)
+		assert.Equal(t, "/", c.Arith.Left.Operator)
+		assert.Equal(t, "-", c.Arith.Left.Left.Operator)
+		assert.Equal(t, "100", c.Arith.Right.Number)
+		fields := c.Arith.Fields()
+		assert.Equal(t, 3, len(fields))
+		assert.Equal(t, "availablereplicas", fields[1].Field)
+		assert.Equal(t, 60, fields[1].Column)
+		assert.Equal(t, "((val_numreplicas - val_availablereplicas) / val_numreplicas) * 100", dgraphArith(c.Arith))
+	}
+	assert.Equal(t, []QSLComputed{{Alias: "ncontainers", Len: "containers", Column: 117}}, q.Blocks[1].Fields.Computed)
+	assert.Nil(t, q.Blocks[1].Fields.Names)
+
+	// aliases are only kept when a field is renamed
+	q, err = ParseQSL(`pod{@name,@phase}`)
+	assert.Nil(t, err)
+	assert.Nil(t, q.Blocks[0].Fields.Aliases)
+
+	// - and / directly followed by a letter stay part of the name
+	q, err = ParseQSL(`deployment{@numreplicas-@availablereplicas as diff, @numreplicas+1 as next}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "val_numreplicas - val_availablereplicas", dgraphArith(q.Blocks[0].Fields.Computed[0].Arith))
+	assert.Equal(t, "val_numreplicas + 1", dgraphArith(q.Blocks[0].Fields.Computed[1].Arith))
+}
+
+func TestParseQSLErrors(t *testing.T) {
+	tests := map[string]string{
+		``:                                            `expected object type at column 1 (end of query)`,
+		`cluster[@name="x"]`:                          `expected { at column 19 (end of query)`,
+		`cluster[@name="x"}{*}`:                       `expected ] at column 18 near "}"`,
+		`cluster[@name "x"]{*}`:                       `expected comparison operator at column 15 near "\"x\""`,
+		`cluster[@name="x" & @k="y"]{*}`:              `expected ] at column 19 near "&"`,
+		`cluster[name="x"]{*}`:                        `expected @ before filter field at column 9 near "name"`,
+		`cluster[$$first=1]{*}`:                       `invalid pagination key, expected limit, offset, after, orderasc, orderdesc, asof or includeDeleted at column 11 near "first"`,
+		`cluster[$$limit=x]{*}`:                       `pagination value must be a number at column 17 near "x"`,
+		`cluster{*}.pod[@name="x"]{*}}`:               `unexpected token after block at column 29 near "}"`,
+		`cluster{*}...pod{*}`:                         `expected object type at column 13 near "."`,
+		`clus-ter{*}`:                                 `object type must be alphanumeric at column 1 near "clus-ter"`,
+		`cluster[@count(pod=1]{*}`:                    `expected ) at column 19 near "="`,
+		`cluster[@labels.$="x"]{*}`:                   `json filter must be of the form @field.$key at column 10 near "labels.$"`,
+		`cluster[@name=]{*}`:                          `expected filter value at column 15 near "]"`,
+		`cluster{@name,@na-me}`:                       `Field names must be composed of only alphanumeric characters at column 16 near "na-me"`,
+		`cluster[@name="x"&&@name="y]{*}`:             `unterminated string at column 26 near "\"y]{*}"`,
+		`cluster[@name="x"||@name=y?]{*}`:             `expected ] at column 27 near "?"`,
+		`cluster[@name="x"]{*}.pod[]{@name`:           `Fields must be separated by , at column 34 (end of query)`,
+		`pod[()]{*}`:                                  `expected @ before filter field at column 6 near ")"`,
+		`pod[(@a=1]{*}`:                               `expected ) at column 10 near "]"`,
+		`pod[@a=1)]{*}`:                               `expected ] at column 9 near ")"`,
+		`pod[!]{*}`:                                   `expected @ before filter field at column 6 near "]"`,
+		`pod{@name,count()}`:                          `Fields can't be combined with aggregations, use groupby(@field) instead at column 5 near "@"`,
+		`pod{groupby(@phase)}`:                        `groupby requires at least one aggregation at column 5 near "groupby"`,
+		`pod{groupby(@a),groupby(@b)}`:                `groupby may only be used once at column 17 near "groupby"`,
+		`pod{median(@a)}`:                             `unknown aggregation, expected groupby, count, sum, min, max or avg at column 5 near "median"`,
+		`pod{sum()}`:                                  `Field names must be prefixed with @ sign and followed by an alphanumeric field name at column 9 near ")"`,
+		`pod{count(@a)}`:                              `expected ) at column 11 near "@"`,
+		`pod[$$limit=1]{count()}`:                     `pagination and ordering can't be used with aggregations at column 5 near "$$"`,
+		`namespace{count()}.pod{*}`:                   `aggregations are only supported in the last block at column 19 near "."`,
+		`pod[$$after=abc]{*}`:                         `invalid cursor at column 13 near "abc"`,
+		`pod[$$after=eyJ1aWQiOiIweDEifQ,offset=1]{*}`: `after can't be combined with offset at column 5 near "$$"`,
+		`node{*}.pod[$$after=eyJ1aWQiOiIweDEifQ]{*}`:  `after is only supported in the first block at column 9 near "pod"`,
+		`pod[$$asof=yesterday]{*}`:                    `asof must be a RFC3339 timestamp e.g. 2019-01-02T15:04:05Z at column 12 near "yesterday"`,
+		`node{*}.pod[$$asof=2019-01-02T15:04:05Z]{*}`: `asof is only supported in the first block at column 9 near "pod"`,
+		`pod[$$asof=2019-01-02T15:04:05Z,after=eyJ1aWQiOiIweDEifQ]{*}`: `after can't be combined with asof at column 5 near "$$"`,
+		`pod[$$includeDeleted=yes]{*}`:                                 `includeDeleted must be true or false at column 22 near "yes"`,
+		`pod{@a+@b}`:                                                   `computed fields must be named with as at column 10 near "}"`,
+		`pod{@a as b-c}`:                                               `alias must be an alphanumeric name at column 11 near "b-c"`,
+		`pod{@a as x, @b as x}`:                                        `x is returned more than once at column 20 near "x"`,
+		`pod{@a, @b as a}`:                                             `a is returned more than once at column 15 near "a"`,
+		`pod{(@a+1 as x}`:                                              `expected ) at column 11 near "as"`,
+		`pod{@a * x as y}`:                                             `Field names must be prefixed with @ sign and followed by an alphanumeric field name at column 10 near "x"`,
+		`pod{len(@containers)}`:                                        `computed fields must be named with as at column 21 near "}"`,
+		`pod{len(@a) as n, count()}`:                                   `Fields can't be combined with aggregations, use groupby(@field) instead at column 5 near "len"`,
+	}
+	for query, expected := range tests {
+		_, err := ParseQSL(query)
+		if assert.NotNil(t, err, query) {
+			assert.Equal(t, expected, err.Error(), query)
+			_, ok := err.(*QSLError)
+			assert.True(t, ok, "parse error should be a QSLError")
+		}
+	}
+}
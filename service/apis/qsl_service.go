@@ -1,8 +1,9 @@
 package apis
 
 import (
+	"encoding/json"
 	"errors"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 	"unicode"
@@ -13,15 +14,8 @@ import (
 	"github.com/intuit/katlas/service/db"
 	metrics "github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
-	"strconv"
 )
 
-// regex to get objtype[filters]{fields}
-var blockRegex = `([a-zA-Z0-9]+)\[?(?:(\@[\(\)\"\,\@\$\=\>\<\~\!a-zA-Z0-9\/\-\.\|\&\:_\^\*]*|\**|\$\$[a-zA-Z0-9\,\=]+))\]?\{([\*|[\,\@\"\=a-zA-Z0-9\-]*)`
-
-// regex to get KeyOperatorValue from something like numreplicas>=2
-var filterRegex = `\@([a-zA-Z0-9-_\(\)\.\$]*)([\!\<\>\=\~]*)(\"?[a-zA-Z0-9\-\\\/\.\|\&\:_\$\^]*\"?)`
-
 // QSLService service for QSL
 type QSLService struct {
 	DBclient db.IDGClient
@@ -30,6 +24,15 @@ type QSLService struct {
 // MaximumLimit define pagination limit
 const MaximumLimit = 10000
 
+// MaximumHops caps the number of relations followed between two blocks joined with ..
+const MaximumHops = 4
+
+// QSLHop is a relation followed from one object type to the next
+type QSLHop struct {
+	ObjType  string `json:"objtype"`
+	Relation string `json:"relation"`
+}
+
 // IsAlphaNum determine if string is made up of only alphanumeric characters
 func IsAlphaNum(s string) bool {
 	for _, r := range s {
@@ -74,122 +77,40 @@ func NewQSLService(host db.IDGClient) *QSLService {
 // input @name="name",@objtype="objtype"$$limit=2,offset=2
 // filterfunc
 // @name="cluster1" -> eq(name,cluster1)
-// @name="paas-preprod-west2.cluster.k8s.local",@k8sobj="K8sObj",@resourceid="paas-preprod-west2.cluster.k8s.local"
+// @name="paas-preprod-west2.cluster.k8s.local"&&@k8sobj="K8sObj"&&@resourceid="paas-preprod-west2.cluster.k8s.local"
 // -> @filter( eq(name,paas-preprod-west2.cluster.k8s.local) and eq(k8sobj,K8sObj) and eq(resourceid,paas-preprod-west2.cluster.k8s.local) )
-// filterdeclaraction
-// @name="paas-preprod-west2.cluster.k8s.local",@k8sobj="K8sObj",@resourceid="paas-preprod-west2.cluster.k8s.local"
-// -> , $name: string, $k8sobj: string, $resourceid: string
-// pagination
-// $$limit=2,offset=2
-// -> first: 2,offset: 2
+// pagination and ordering
+// $$limit=2,offset=2,orderasc=name
+// -> first: 2,offset: 2,orderasc: name
 func CreateFiltersQuery(filterlist string) (string, string, error) {
 	// default for empty filters is assume no filters
 	if len(filterlist) == 0 {
 		return "", "", nil
 	}
-
-	// for the pagination
-	paginate := ""
-
-	filtersAndPages := strings.Split(filterlist, "$$")
-	if len(filtersAndPages) > 1 {
-		splitlist := strings.Split(filtersAndPages[1], ",")
-		for _, item := range splitlist {
-			splitval := strings.Split(item, "=")
-
-			switch splitval[0] {
-			case util.Limit:
-				paginate += "," + util.First + ": " + splitval[1]
-			case util.Offset:
-				paginate += "," + splitval[0] + ": " + splitval[1]
-			default:
-				return "", "", errors.New("Invalid pagination filters in " + filterlist)
-			}
-			val, err := strconv.Atoi(splitval[1])
-			if err != nil {
-				return "", "", errors.New("Pagination format error " + filterlist)
-			}
-			if splitval[0] == util.Limit && val > MaximumLimit {
-				return "", "", fmt.Errorf("pagination exceeding maxiumum limit %d", MaximumLimit)
-			}
+	p, err := newQSLParser(filterlist)
+	if err != nil {
+		return "", "", err
+	}
+	var filter QSLExpr
+	if p.peek().kind != qslPage {
+		if filter, err = p.parseFilter(); err != nil {
+			return "", "", err
 		}
-		// get rid of the first comma
-		paginate = paginate[0:]
-		if strings.HasPrefix(filterlist, "$$") {
-			return "", paginate, nil
+	}
+	page := QSLPage{}
+	if p.peek().kind == qslPage {
+		p.next()
+		if page, err = p.parsePage(); err != nil {
+			return "", "", err
 		}
 	}
-
-	// split the whole string by the | "or" symbol because of higher priority for ands
-	// e.g. a&b&c|d&e == (a&b&c) | (d&e)
-	splitlist := strings.Split(filtersAndPages[0], "||")
-	// the eq functions eq(name,paas-preprod-west2.cluster.k8s.local)
-	filterfunc := []string{}
-
-	operatorMap := map[string]string{
-		">":  "gt",
-		">=": "ge",
-		"<=": "le",
-		"<":  "lt",
-		"=":  "eq",
-		"!=": "not eq",
-		"~=": "regexp",
+	if t := p.peek(); t.kind != qslEOF {
+		return "", "", newQSLError(t, "unexpected token in filters")
 	}
-
-	for _, item := range splitlist {
-		splitstring := strings.Split(item, "&&")
-
-		interfilterfunc := []string{}
-
-		for _, item2 := range splitstring {
-			// use regex to get the key, operator and value
-			r := regexp.MustCompile(filterRegex)
-			matches := r.FindStringSubmatch(item2)
-			// should be 4 elements in matches
-			// the whole string, key, operator, value
-			if len(matches) < 4 {
-				return "", "", errors.New("Invalid filters in " + filterlist)
-			}
-
-			keyname := matches[1]
-			operator := matches[2]
-			value := matches[3]
-
-			// json field query
-			// use regex search to match json key and value
-			if strings.Contains(keyname, ".$") {
-				tmp := strings.Split(keyname, ".$")
-				keyname = tmp[0]
-				value = "/\"" + tmp[1] + "\" *: *" + value + "/"
-				if operator != "=" && operator != "~=" {
-					return "", "", errors.New("Filter on json type can only use equal or regexp operator " + filterlist)
-				}
-				operator = "~="
-			} else {
-				// if regrex search, add / and remove " for dgraph query
-				if operator == "~=" {
-					value = "/" + strings.Replace(value, `"`, "", -1) + "/"
-				}
-			}
-
-			// if the value is a string make sure it has quotes on both sides
-			if string(value[0]) == "\"" && !(string(value[len(value)-1]) == "\"") {
-				return "", "", errors.New("Invalid filters in " + filterlist)
-			}
-
-			// if keyname is count filter, add prefix cnt_ to the var name
-			if strings.Contains(keyname, "count(") {
-				keyname = "val(cnt_" + keyname[6:]
-			}
-
-			interfilterfunc = append(interfilterfunc, " "+operatorMap[operator]+"("+keyname+","+value+") ")
-		}
-
-		filterfunc = append(filterfunc, strings.Join(interfilterfunc, "and"))
-
+	if filter == nil {
+		return "", dgraphPagination(page) + dgraphOrder(page), nil
 	}
-	return "@filter(" + strings.Join(filterfunc, "or") + ")", paginate, nil
-
+	return "@filter(" + dgraphFilter(filter) + ")", dgraphPagination(page) + dgraphOrder(page), nil
 }
 
 // CreateFieldsQuery translates the fields part of the qsl string to dgraph
@@ -198,113 +119,76 @@ func CreateFiltersQuery(filterlist string) (string, string, error) {
 // will be joined with newlines for the resulting query
 // e.g. @name,@resourceversion -> [name, resourceversion]
 func CreateFieldsQuery(fieldlist string, metafieldslist []MetadataField, tabs int) ([]string, error) {
-	// default case for empty fields is to display nothing
-	if len(fieldlist) == 0 {
-		return []string{}, nil
-	}
-	// if one star, show all fields
-	if fieldlist == "*" {
-		returnlist := []string{}
-		// use list of metadatafields from metadata api to get names of all the fields
-		// for this object type
-		for _, item := range metafieldslist {
-			if item.FieldType != "relationship" {
-				returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+item.FieldName)
-
-			}
-
-		}
-		returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+"uid")
-		return returnlist, nil
-
-		// if n stars show the direct relationships n levels deep
-	} else if string(fieldlist[0]) == "*" && len(fieldlist) > 1 {
-		returnlist := []string{}
-		if IsStar(fieldlist) {
-			for i := 0; i < len(fieldlist); i++ {
-				returnlist = append([]string{strings.Repeat("\t", len(fieldlist)-i+tabs) + "expand(_all_){"}, returnlist...)
-				returnlist = append(returnlist, strings.Repeat("\t", len(fieldlist)-i+tabs)+"}")
-			}
-			return returnlist, nil
-		}
-		return nil, errors.New("Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both [" + fieldlist + "]")
-
-	}
-	splitlist := strings.Split(fieldlist, ",")
-	returnlist := []string{}
-	if !strings.Contains(fieldlist, util.ObjType) {
-		splitlist = append(splitlist, "@"+util.ObjType)
-	}
-	// if we have a list of fields e.g. @name,@resourceversion,@creationtime
-	for _, item := range splitlist {
-		// each item must begin with @ followed by an alphanumeric string
-		if strings.HasPrefix(item, "@") && len(item) > 1 {
-			if IsAlphaNum(item[1:]) {
-				returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+item[1:])
-			} else {
-				return nil, errors.New("Field names must be composed of only alphanumeric characters [" + item[1:] + "]")
-			}
-
-		} else {
-			return nil, errors.New("Field names must be prefixed with @ sign and followed by an alphanumeric field name [" + item + "]")
-		}
-
+	p, err := newQSLParser(fieldlist)
+	if err != nil {
+		return nil, err
 	}
-
-	returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+"uid")
-	return returnlist, nil
-
+	proj, err := p.parseProjection(qslEOF)
+	if err != nil {
+		return nil, err
+	}
+	return dgraphFields(proj, metafieldslist, tabs), nil
 }
 
 // CreateDgraphQuery translates the querystring to a dgraph query
 func (qa *QSLService) CreateDgraphQuery(query string, cntOnly bool) (string, error) {
-	log.Info("Received Query: ", strings.Split(query, "}."))
+	log.Info("Received Query: ", query)
 	metrics.DgraphNumQSL.Inc()
 
-	// remove all whitespace
-	whitespace := regexp.MustCompile("\\s*")
-	querys := whitespace.ReplaceAllString(query, "")
-
 	// e.g. cluster[@name="cluster1.k8s.local"]{@name,@region}.pod[@name="pod1"]{@phase,@image}
-	// split by }. to get each individual block
-	// cannot split by . because . may be present in some object names
-	splitQuery := strings.Split(querys, "}.")
+	qsl, err := ParseQSL(query)
+	if err != nil {
+		return "", err
+	}
+	return qa.createDgraphQuery(qsl, cntOnly)
+}
+
+// createDgraphQuery translates a parsed query to a dgraph query
+func (qa *QSLService) createDgraphQuery(qsl *QSLQuery, cntOnly bool) (string, error) {
+	blocks := qsl.Blocks
 	rootTemplate := "{ A as var(func: eq(objtype, $OBJTYPE)) $FILTERSFUNC @cascade {"
 	edgeTemplate := "\t$RELATION @filter(eq(objtype, $OBJTYPE) $FILTERSFUNC)"
-	pageTemplate := "{ objects(func: uid(A)$PAGINATE) {"
+	pageTemplate := "{ objects(func: uid(A)$PAGINATE)$CURSOR$GROUPBY {"
 	brakets := []string{"}", "}"}
 
-	root, objType, rootCntFilter, err := qa.buildRootQuery(splitQuery[0], rootTemplate, true)
+	root, objType, rootCntFilter, err := qa.buildRootQuery(blocks[0], rootTemplate, true)
 	if err != nil {
 		return "", err
 	}
 	parentType := objType
 	edgeCntFilters := []string{}
-	for i := 1; i < len(splitQuery); i++ {
-		edges, ptype, edgeCntFilter, err := qa.buildEdgeQuery(splitQuery[i], edgeTemplate, parentType, true)
+	// relations followed to reach each block from the one before it
+	paths := make([][]QSLHop, len(blocks))
+	for i := 1; i < len(blocks); i++ {
+		if paths[i], err = qa.getRelationPath(blocks[i], parentType); err != nil {
+			return "", err
+		}
+		root = append(root, dgraphHops(paths[i], true)...)
+		edges, ptype, edgeCntFilter, err := qa.buildEdgeQuery(blocks[i], edgeTemplate, paths[i][len(paths[i])-1].Relation, true)
 		if err != nil {
 			return "", err
 		}
 		parentType = ptype
 		root = append(root, edges...)
-		brakets = append(brakets, "}")
+		for range paths[i] {
+			brakets = append(brakets, "}")
+		}
 		if edgeCntFilter != "" {
 			edgeCntFilters = append(edgeCntFilters, edgeCntFilter)
 		}
 	}
 	root = append(root, brakets...)
-	pages, _, _, err := qa.buildRootQuery(splitQuery[0], pageTemplate, cntOnly)
+	pages, _, _, err := qa.buildRootQuery(blocks[0], pageTemplate, cntOnly)
 	if err != nil {
 		return "", err
 	}
 	root = append(root, pages...)
-	parentType = objType
-	for i := 1; i < len(splitQuery); i++ {
-		edges, ptype, _, err := qa.buildEdgeQuery(splitQuery[i], edgeTemplate, parentType, cntOnly)
+	for i := 1; i < len(blocks); i++ {
+		root = append(root, dgraphHops(paths[i], cntOnly)...)
+		edges, _, _, err := qa.buildEdgeQuery(blocks[i], edgeTemplate, paths[i][len(paths[i])-1].Relation, cntOnly)
 		if err != nil {
 			return "", err
 		}
-		parentType = ptype
 		root = append(root, edges...)
 	}
 	root = append(root, brakets...)
@@ -314,92 +198,120 @@ func (qa *QSLService) CreateDgraphQuery(query string, cntOnly bool) (string, err
 	if len(edgeCntFilters) > 0 {
 		root = append(root, edgeCntFilters...)
 	}
+	// aggregations read the fields of the last block from value vars
+	if aggVars := dgraphAggVars(blocks[len(blocks)-1]); !cntOnly && aggVars != "" {
+		root = append(root, aggVars)
+	}
+	// computed fields read the fields they use from value vars
+	if !cntOnly {
+		root = append(root, dgraphValVars(blocks)...)
+	}
 
 	return strings.Join(root, "\n"), nil
 }
 
-func (qa *QSLService) buildRootQuery(qry string, template string, cntOnly bool) ([]string, string, string, error) {
+func (qa *QSLService) buildRootQuery(block *QSLBlock, template string, cntOnly bool) ([]string, string, string, error) {
 	ret := []string{template}
+	objType := block.ObjType
 
-	objType, filters, fields, err := parseQuery(qry)
-	if err != nil {
-		return nil, "", "", err
-	}
 	// create var for dgraph if filter has count
-	cntFilterQry, err := qa.getCntFilter(filters, objType)
+	cntFilterQry, err := qa.getCntFilter(block.Filter, objType)
 	if err != nil {
 		return nil, "", "", err
 	}
 
-	ff, pag, err := CreateFiltersQuery(filters)
-	if err != nil {
-		return nil, "", "", err
+	ff := ""
+	notDeleted := dgraphNotDeleted(block.Page.IncludeDeleted)
+	if block.Filter != nil && notDeleted != "" {
+		ff = "@filter(" + dgraphGroup(block.Filter) + "and" + notDeleted + ")"
+	} else if block.Filter != nil {
+		ff = "@filter(" + dgraphFilter(block.Filter) + ")"
+	} else if notDeleted != "" {
+		ff = "@filter(" + notDeleted + ")"
 	}
+	pag := dgraphPagination(block.Page)
 	// replace the filters and object type and add the list of fields
 	ret[0] = strings.Replace(ret[0], "$FILTERSFUNC", ff, -1)
 	ret[0] = strings.Replace(ret[0], "$OBJTYPE", objType, -1)
+	var metafieldslist []MetadataField
+	if !cntOnly || block.Filter != nil || len(block.Page.Order) > 0 {
+		// get metadata fields for projection, ordering and validation
+		metafieldslist, err = qa.GetMetadata(objType)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if errs := validateBlock(block, metafieldslist); len(errs) > 0 {
+			return nil, "", "", errs[0]
+		}
+		if err := validateOrder(block, metafieldslist); err != nil {
+			return nil, "", "", err
+		}
+	}
+	if cntOnly || !block.Fields.IsAggregate() {
+		ret[0] = strings.Replace(ret[0], "$GROUPBY", "", -1)
+	}
+	cursorArgs, cursorFilter := dgraphCursor(block.Page)
+	if cntOnly {
+		// the total count isn't affected by the cursor
+		cursorFilter = ""
+	}
+	ret[0] = strings.Replace(ret[0], "$CURSOR", cursorFilter, -1)
 	if cntOnly {
 		ret = append(ret, "\tcount(uid)")
 		if strings.Contains(template, "$PAGINATE") {
 			ret[0] = strings.Replace(ret[0], "$PAGINATE", "", -1)
 		}
-	} else {
-		// get metadata fields for projection
-		metafieldslist, err := qa.GetMetadata(objType)
-		if err != nil {
-			return nil, "", "", err
-		}
-		fl, err := CreateFieldsQuery(fields, metafieldslist, 0)
-		if err != nil {
+	} else if block.Fields.IsAggregate() {
+		if err := validateAggregates(block, metafieldslist); err != nil {
 			return nil, "", "", err
 		}
-		ret = append(ret, fl...)
+		// groups are neither paginated nor ordered
+		ret[0] = strings.Replace(ret[0], "$PAGINATE", "", -1)
+		ret[0] = strings.Replace(ret[0], "$GROUPBY", dgraphGroupBy(block.Fields), -1)
+		ret = append(ret, dgraphAggregates(block.Fields, 0)...)
+	} else {
+		ret = append(ret, dgraphFields(withOrderField(block), metafieldslist, 0)...)
 		if strings.Contains(template, "$PAGINATE") {
-			if pag != "" {
-				ret[0] = strings.Replace(ret[0], "$PAGINATE", pag, -1)
-			} else {
-				ret[0] = strings.Replace(ret[0], "$PAGINATE", ",first:1000,offset:0", -1)
+			if pag == "" && block.Page.After != nil {
+				pag = ",first:1000"
+			} else if pag == "" {
+				pag = ",first:1000,offset:0"
 			}
+			ret[0] = strings.Replace(ret[0], "$PAGINATE", pag+cursorArgs+dgraphOrder(block.Page), -1)
 		}
 	}
 	return ret, objType, cntFilterQry, nil
 }
 
-func (qa *QSLService) buildEdgeQuery(qry string, template string, parent string, cntOnly bool) ([]string, string, string, error) {
+func (qa *QSLService) buildEdgeQuery(block *QSLBlock, template string, relation string, cntOnly bool) ([]string, string, string, error) {
 	ret := []string{template}
-	objType, filters, fields, err := parseQuery(qry)
-	if err != nil {
-		return nil, "", "", err
-	}
+	objType := block.ObjType
 	// get a list of the metadata fields for this object type
 	metafieldslist, err := qa.GetMetadata(objType)
 	if err != nil {
 		return nil, "", "", errors.New("Failed to connect to dgraph to get metadata")
 	}
-
-	// declare relation variable
-	relation, err := qa.getRelationName(objType, parent)
-	if err != nil {
-		return nil, "", "", err
+	if errs := validateBlock(block, metafieldslist); len(errs) > 0 {
+		return nil, "", "", errs[0]
 	}
-
-	// no relation found between the two objects
-	if relation == "" {
-		return nil, "", "", errors.New("no relation found between " + objType + " and " + parent)
+	if err := validateOrder(block, metafieldslist); err != nil {
+		return nil, "", "", err
 	}
 
 	// create var for dgraph if filter has count
-	cntFilterQry, err := qa.getCntFilter(filters, objType)
+	cntFilterQry, err := qa.getCntFilter(block.Filter, objType)
 	if err != nil {
 		return nil, "", "", err
 	}
-	ff, pag, err := CreateFiltersQuery(filters)
-	if err != nil {
-		return nil, "", "", err
+	ff := ""
+	if block.Filter != nil {
+		// the filter is joined with the objtype check, group it so an or can't escape it
+		ff = "and" + dgraphGroup(block.Filter)
 	}
-	if len(ff) > 0 {
-		ff = "and" + ff[8:len(ff)-1]
+	if notDeleted := dgraphNotDeleted(block.Page.IncludeDeleted); notDeleted != "" {
+		ff += "and" + notDeleted
 	}
+	pag := dgraphPagination(block.Page)
 	// replace filters and object type accordingly
 	ret[0] = strings.Replace(ret[0], "$FILTERSFUNC", ff, -1)
 	ret[0] = strings.Replace(ret[0], "$OBJTYPE", objType, -1)
@@ -409,56 +321,104 @@ func (qa *QSLService) buildEdgeQuery(qry string, template string, parent string,
 	if cntOnly {
 		ret[0] += "{"
 		ret = append(ret, "\tcount(uid)")
+	} else if block.Fields.IsAggregate() {
+		if err := validateAggregates(block, metafieldslist); err != nil {
+			return nil, "", "", err
+		}
+		ret[0] += dgraphGroupBy(block.Fields) + "{"
+		ret = append(ret, dgraphAggregates(block.Fields, 1)...)
 	} else {
 		// if pagination values were supplied, add and get rid of the comma at the beginning
 		if len(pag) > 1 {
-			ret[0] += "(" + pag[1:] + ")"
+			ret[0] += "(" + pag[1:] + dgraphOrder(block.Page) + ")"
 		} else {
-			ret[0] += "(first:1000,offset:0)"
+			ret[0] += "(first:1000,offset:0" + dgraphOrder(block.Page) + ")"
 		}
 		ret[0] += "{"
-		fl, err := CreateFieldsQuery(fields, metafieldslist, 1)
-		if err != nil {
-			return nil, "", "", err
-		}
 		// append the fields to be returned
-		ret = append(ret, fl...)
+		ret = append(ret, dgraphFields(block.Fields, metafieldslist, 1)...)
 	}
 	return ret, objType, cntFilterQry, nil
 }
 
-func parseQuery(qry string) (string, string, string, error) {
-	r := regexp.MustCompile(blockRegex)
-	matches := r.FindStringSubmatch(qry)
-	if len(matches) < 2 {
-		log.Error("Malformed Query received: " + qry)
-		return "", "", "", errors.New("Malformed Query: " + qry)
-	}
-	// extract the values of the form objtype[filters]fields and assign to individual variables
-	objType := strings.ToLower(matches[1])
-	filters := matches[2]
-	fields := strings.ToLower(matches[3])
-	return objType, strings.Replace(filters, "/", "\\/", -1), fields, nil
-}
-
-func (qa *QSLService) getCntFilter(query, objType string) (string, error) {
-	ret := ""
-	// create var for dgraph if filter has count
-	if strings.Contains(query, "count(") {
+// getCntFilter creates a var for dgraph for each count() used in the filter
+func (qa *QSLService) getCntFilter(filter QSLExpr, objType string) (string, error) {
+	ret := []string{}
+	for _, relType := range countFilterTargets(filter) {
 		unix32bits := uint32(time.Now().UTC().Unix())
 		buff := make([]byte, 4)
 		rand.Read(buff)
 		seq := fmt.Sprintf("%x%x", unix32bits, buff)
-		tmp := query[strings.Index(query, "count(")+6:]
-		relType := strings.ToLower(tmp[:strings.Index(tmp, ")")])
 		relation, err := qa.getRelationName(relType, objType)
 		if err != nil {
 			return "", err
 		}
-		cntTemplate := `{ var (func: eq(objtype, %s)) { %s @filter (eq (objtype, %s)) { cnt%s as count(name) } cnt_%s as sum(val(cnt%s)) }}`
-		ret = fmt.Sprintf(cntTemplate, objType, relation, relType, seq, relType, seq)
+		if relation == "" {
+			return "", errors.New("no relation found between " + relType + " and " + objType)
+		}
+		ret = append(ret, dgraphCntVar(objType, relation, relType, seq))
+	}
+	return strings.Join(ret, "\n"), nil
+}
+
+// getRelationPath returns the relations followed from parent to the object type of the block
+// blocks joined with . must be directly related, blocks joined with .. may be reached through
+// up to MaximumHops relations and the shortest chain found in the metadata is used
+func (qa *QSLService) getRelationPath(block *QSLBlock, parent string) ([]QSLHop, error) {
+	if !block.Indirect {
+		relation, err := qa.getRelationName(block.ObjType, parent)
+		if err != nil {
+			return nil, err
+		}
+		// no relation found between the two objects
+		if relation == "" {
+			return nil, errors.New("no relation found between " + block.ObjType + " and " + parent)
+		}
+		return []QSLHop{{ObjType: block.ObjType, Relation: relation}}, nil
+	}
+	m := NewMetaService(qa.DBclient)
+	metas, err := m.GetAllMetadata()
+	if err != nil {
+		log.Error(err)
+		return nil, errors.New("Failed to connect to dgraph to get metadata")
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Name < metas[j].Name })
+	// like getRelationName, reverse relations to the parent are preferred
+	reverse := map[string][]QSLHop{}
+	forward := map[string][]QSLHop{}
+	for _, meta := range metas {
+		for _, item := range meta.Fields {
+			if item.FieldType != "relationship" {
+				continue
+			}
+			for _, dtype := range strings.Split(item.RefDataType, ",") {
+				reverse[dtype] = append(reverse[dtype], QSLHop{ObjType: meta.Name, Relation: "~" + strings.ToLower(item.FieldName)})
+				forward[meta.Name] = append(forward[meta.Name], QSLHop{ObjType: dtype, Relation: strings.ToLower(item.FieldName)})
+			}
+		}
+	}
+	// breadth first search so the shortest chain wins
+	paths := map[string][]QSLHop{parent: {}}
+	queue := []string{parent}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if len(paths[current]) == MaximumHops {
+			continue
+		}
+		for _, hop := range append(append([]QSLHop{}, reverse[current]...), forward[current]...) {
+			if _, ok := paths[hop.ObjType]; ok {
+				continue
+			}
+			path := append(append([]QSLHop{}, paths[current]...), hop)
+			if hop.ObjType == block.ObjType {
+				return path, nil
+			}
+			paths[hop.ObjType] = path
+			queue = append(queue, hop.ObjType)
+		}
 	}
-	return ret, nil
+	return nil, fmt.Errorf("no relation found between %s and %s within %d hops", block.ObjType, parent, MaximumHops)
 }
 
 func (qa *QSLService) getRelationName(objType string, parent string) (string, error) {
@@ -510,3 +470,129 @@ func (qa *QSLService) getRelationName(objType string, parent string) (string, er
 	}
 	return relation, nil
 }
+
+// ComputeLengths replaces the json fields returned for len() projections of the query with their number of items
+// dgraph stores json fields as strings so their length can't be computed in the dgraph query
+func ComputeLengths(query string, data map[string]interface{}) {
+	qsl, err := ParseQSL(query)
+	if err != nil {
+		return
+	}
+	computeQSLLengths(qsl, data)
+}
+
+func computeQSLLengths(qsl *QSLQuery, data map[string]interface{}) {
+	aliases := map[string][]string{}
+	for _, block := range qsl.Blocks {
+		for _, c := range block.Fields.Computed {
+			if c.Len != "" {
+				aliases[block.ObjType] = append(aliases[block.ObjType], c.Alias)
+			}
+		}
+	}
+	if len(aliases) > 0 {
+		computeLengths(aliases, data)
+	}
+}
+
+func computeLengths(aliases map[string][]string, obj map[string]interface{}) {
+	objType, _ := obj[util.ObjType].(string)
+	for _, alias := range aliases[strings.ToLower(objType)] {
+		switch v := obj[alias].(type) {
+		case string:
+			var items interface{}
+			if err := json.Unmarshal([]byte(v), &items); err != nil {
+				continue
+			}
+			switch i := items.(type) {
+			case []interface{}:
+				obj[alias] = len(i)
+			case map[string]interface{}:
+				obj[alias] = len(i)
+			}
+		case []interface{}:
+			obj[alias] = len(v)
+		}
+	}
+	for _, v := range obj {
+		if list, ok := v.([]interface{}); ok {
+			for _, item := range list {
+				if child, ok := item.(map[string]interface{}); ok {
+					computeLengths(aliases, child)
+				}
+			}
+		}
+	}
+}
+
+// withOrderField returns the projection of a block with its first order field added when it isn't
+// returned, the next cursor is built from its value in the last object
+func withOrderField(block *QSLBlock) QSLProjection {
+	proj := block.Fields
+	if len(block.Page.Order) == 0 || len(proj.Names) == 0 {
+		return proj
+	}
+	field := block.Page.Order[0].Field
+	for i, name := range proj.Names {
+		if name == field && (len(proj.Aliases) == 0 || proj.Aliases[i] == "") {
+			return proj
+		}
+	}
+	proj.Names = append(append([]string{}, proj.Names...), field)
+	if len(proj.Aliases) > 0 {
+		proj.Aliases = append(append([]string{}, proj.Aliases...), "")
+	}
+	return proj
+}
+
+// NextCursor returns the cursor of the page following the objects returned for a QSL query
+// it is empty when the page isn't full as there are no more objects
+func NextCursor(query string, data map[string]interface{}) string {
+	qsl, err := ParseQSL(query)
+	if err != nil {
+		return ""
+	}
+	if c := nextQSLCursor(qsl.Blocks[0], data); c != nil {
+		return c.Encode()
+	}
+	return ""
+}
+
+func nextQSLCursor(block *QSLBlock, data map[string]interface{}) *Cursor {
+	objects, _ := data[util.Objects].([]interface{})
+	limit := 1000
+	if block.Page.Limit != nil {
+		limit = *block.Page.Limit
+	}
+	if block.Fields.IsAggregate() {
+		// groups are never paginated
+		return nil
+	}
+	if len(block.Page.Order) == 0 {
+		return lastCursor(objects, limit)
+	}
+	if len(objects) == 0 || len(objects) < limit {
+		return nil
+	}
+	field := block.Page.Order[0].Field
+	key := func(o interface{}) string {
+		obj, _ := o.(map[string]interface{})
+		return fmt.Sprint(obj[field])
+	}
+	last, _ := objects[len(objects)-1].(map[string]interface{})
+	if last[field] == nil {
+		// the block doesn't return any field to continue from
+		return nil
+	}
+	c := &Cursor{Key: last[field]}
+	c.UID, _ = last[util.UID].(string)
+	// objects sharing the key of the last one are skipped by the next page, including those
+	// skipped before when the whole page has the same key
+	for i := len(objects) - 1; i >= 0 && key(objects[i]) == key(last); i-- {
+		c.Skip++
+	}
+	if after := block.Page.After; c.Skip == len(objects) && after != nil && fmt.Sprint(after.Key) == key(last) {
+		c.Skip += after.Skip
+	}
+	return c
+}
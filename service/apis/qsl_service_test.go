@@ -6,10 +6,9 @@ import (
 	"io/ioutil"
 	"log"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
-
-	"github.com/intuit/katlas/service/db"
 )
 
 // FResult values is the expected output, err is the expected error
@@ -86,10 +85,80 @@ func TestCreateFiltersQuery(t *testing.T) {
 		},
 		`@name="paas-preprod-west2.cluster.k8s.local?"`: FResult{
 			[]string{
-				`@filter( eq(name,"paas-preprod-west2.cluster.k8s.local") )`,
+				`@filter( eq(name,"paas-preprod-west2.cluster.k8s.local?") )`,
+				"",
+			},
+			nil,
+		},
+		`@name="paas-preprod-west2.cluster.k8s.local`: FResult{
+			nil,
+			errors.New(`unterminated string at column 7 near "\"paas-preprod-west2.cluster.k8s.local"`),
+		},
+		`@name=paas-preprod-west2.cluster.k8s.local?`: FResult{
+			nil,
+			errors.New(`unexpected token in filters at column 43 near "?"`),
+		},
+		`@name="a}.b,c&&d"&&@labels.$app="x.y"`: FResult{
+			[]string{
+				`@filter( eq(name,"a}.b,c&&d") and regexp(labels,/"app" *: *"x\.y"/) )`,
 				"",
 			},
-			errors.New("Invalid filters in @name=\"paas-preprod-west2.cluster.k8s.local?\""),
+			nil,
+		},
+		`@labels.$app>"nginx"`: FResult{
+			nil,
+			errors.New(`filter on json type can only use equal or regexp operator at column 13 near ">"`),
+		},
+		`@numreplicas>=1$$limit=2,offset=4`: FResult{
+			[]string{
+				`@filter( ge(numreplicas,1) )`,
+				",first: 2,offset: 4",
+			},
+			nil,
+		},
+		`(@phase="Failed"||@phase="Unknown")&&!(@name~="^debug")`: FResult{
+			[]string{
+				`@filter( ( eq(phase,"Failed") or eq(phase,"Unknown") ) and not regexp(name,/^debug/) )`,
+				"",
+			},
+			nil,
+		},
+		`!(@a=1&&@b=2)||@c=3`: FResult{
+			[]string{
+				`@filter( not ( eq(a,1) and eq(b,2) ) or eq(c,3) )`,
+				"",
+			},
+			nil,
+		},
+		`@a=1&&(@b=2||(@c=3&&!@d=4))`: FResult{
+			[]string{
+				`@filter( eq(a,1) and ( eq(b,2) or eq(c,3) and not eq(d,4) ) )`,
+				"",
+			},
+			nil,
+		},
+		`(@a=1||@b=2`: FResult{
+			nil,
+			errors.New(`expected ) at column 12 (end of query)`),
+		},
+		`!`: FResult{
+			nil,
+			errors.New(`expected @ before filter field at column 2 (end of query)`),
+		},
+		`@name="x"$$limit=2,orderdesc=name,orderasc=creationtime`: FResult{
+			[]string{
+				`@filter( eq(name,"x") )`,
+				",first: 2,orderdesc: name,orderasc: creationtime",
+			},
+			nil,
+		},
+		`$$orderasc=labels.$app`: FResult{
+			nil,
+			errors.New(`order field must be an alphanumeric field name at column 12 near "labels.$app"`),
+		},
+		`$$limit=20000`: FResult{
+			nil,
+			errors.New(`pagination exceeding maxiumum limit 10000 at column 9 near "20000"`),
 		},
 		`@numreplicas>=1`: FResult{
 			[]string{
@@ -144,14 +213,14 @@ func TestCreateFieldsQuery(t *testing.T) {
 		"*":                                  FResult{[]string{"k8sobj", "objtype", "name", "resourceid", "resourceversion", "uid"}, nil},
 		"**":                                 FResult{[]string{"expand(_all_){", "\texpand(_all_){", "\t}", "}"}, nil},
 		"***":                                FResult{[]string{"expand(_all_){", "\texpand(_all_){", "\t\texpand(_all_){", "\t\t}", "\t}", "}"}, nil},
-		"?":                                  FResult{nil, errors.New("Field names must be prefixed with @ sign and followed by an alphanumeric field name [?]")},
-		"name":                               FResult{nil, errors.New("Field names must be prefixed with @ sign and followed by an alphanumeric field name [name]")},
-		"@n@me":                              FResult{nil, errors.New("Field names must be composed of only alphanumeric characters [n@me]")},
-		"@*":                                 FResult{nil, errors.New("Field names must be composed of only alphanumeric characters [*]")},
-		"*@":                                 FResult{nil, errors.New("Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both [*@]")},
-		"*,@name":                            FResult{nil, errors.New("Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both [*,@name]")},
-		"@name,**":                           FResult{nil, errors.New("Field names must be prefixed with @ sign and followed by an alphanumeric field name [**]")},
-		"**,*":                               FResult{nil, errors.New("Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both [**,*]")},
+		"?":                                  FResult{nil, errors.New(`Field names must be prefixed with @ sign and followed by an alphanumeric field name at column 1 near "?"`)},
+		"name":                               FResult{nil, errors.New(`Field names must be prefixed with @ sign and followed by an alphanumeric field name at column 1 near "name"`)},
+		"@n@me":                              FResult{nil, errors.New(`Fields must be separated by , at column 3 near "@"`)},
+		"@*":                                 FResult{nil, errors.New(`Field names must be composed of only alphanumeric characters at column 2 near "*"`)},
+		"*@":                                 FResult{nil, errors.New(`Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both at column 2 near "@"`)},
+		"*,@name":                            FResult{nil, errors.New(`Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both at column 2 near ","`)},
+		"@name,**":                           FResult{nil, errors.New(`Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both at column 7 near "*"`)},
+		"**,*":                               FResult{nil, errors.New(`Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both at column 3 near ","`)},
 		"@name":                              FResult{[]string{"name", "objtype", "uid"}, nil},
 		"@name,@resourceversion":             FResult{[]string{"name", "resourceversion", "objtype", "uid"}, nil},
 		"@name,@resourceversion,@resourceid": FResult{[]string{"name", "resourceversion", "resourceid", "objtype", "uid"}, nil},
@@ -195,6 +264,7 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tname",
 			"\tresourceid",
 			"\tlabels",
+			"\tasset",
 			"\tuid",
 			"}",
 			"}",
@@ -214,7 +284,7 @@ func TestCreateDgraphQuery(t *testing.T) {
 		`cluster[@name="paas-preprod-west2.cluster.k8s.local"]{*}.namespace[@name="opa"||@name="default"]{*}`: FResult{[]string{
 			"{ A as var(func: eq(objtype, cluster)) @filter( eq(name,\"paas-preprod-west2.cluster.k8s.local\") ) @cascade {",
 			"\tcount(uid)",
-			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"opa\") or eq(name,\"default\") ){",
+			"\t~cluster @filter(eq(objtype, namespace) and ( eq(name,\"opa\") or eq(name,\"default\") ) ){",
 			"\tcount(uid)",
 			"}",
 			"}",
@@ -227,11 +297,12 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tobjtype",
 			"\tname",
 			"\tuid",
-			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"opa\") or eq(name,\"default\") )(first:1000,offset:0){",
+			"\t~cluster @filter(eq(objtype, namespace) and ( eq(name,\"opa\") or eq(name,\"default\") ) )(first:1000,offset:0){",
 			"\t	objtype",
 			"\t	name",
 			"\t	resourceid",
 			"\t	labels",
+			"\t	asset",
 			"\t	resourceversion",
 			"\t	creationtime",
 			"\t	k8sobj",
@@ -261,6 +332,7 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tobjtype",
 			"\tresourceid",
 			"\tlabels",
+			"\tasset",
 			"\tresourceversion",
 			"\tcreationtime",
 			"\tname",
@@ -375,6 +447,7 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tname",
 			"\tresourceid",
 			"\tlabels",
+			"\tasset",
 			"\tresourceversion",
 			"\tcreationtime",
 			"\tuid",
@@ -393,6 +466,7 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"{ objects(func: uid(A),first: 2) {",
 			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"default\") )(first:1000,offset:0){",
 			"\tlabels",
+			"\tasset",
 			"\tresourceversion",
 			"\tcreationtime",
 			"\tk8sobj",
@@ -415,6 +489,7 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"{ objects(func: uid(A),first: 2,offset: 2) {",
 			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"default\") )(first: 2){",
 			"\tlabels",
+			"\tasset",
 			"\tresourceversion",
 			"\tcreationtime",
 			"\tk8sobj",
@@ -437,6 +512,7 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"{ objects(func: uid(A),first: 2,offset: 2) {",
 			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"default\") )(first: 2,offset: 2){",
 			"\tlabels",
+			"\tasset",
 			"\tresourceversion",
 			"\tcreationtime",
 			"\tk8sobj",
@@ -448,10 +524,178 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"}",
 			"}",
 		}, nil},
+		`cluster[$$orderasc=name]{@name}.namespace[$$orderdesc=name,limit=5]{@name}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, cluster))  @cascade {",
+			"\tcount(uid)",
+			"\t~cluster @filter(eq(objtype, namespace) ){",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"}",
+			"{ objects(func: uid(A),first:1000,offset:0,orderasc: name) {",
+			"\tname",
+			"\tobjtype",
+			"\tuid",
+			"\t~cluster @filter(eq(objtype, namespace) )(first: 5,orderdesc: name){",
+			"\t\tname",
+			"\t\tobjtype",
+			"\t\tuid",
+			"}",
+			"}",
+			"}",
+		}, nil},
+		`pod[$$orderasc=labels]{*}`:                   FResult{nil, errors.New(`can't order pod by json field at column 16 near "labels"`)},
+		`pod[$$orderdesc=name,orderasc=namespace]{*}`: FResult{nil, errors.New(`can't order pod by relationship field at column 31 near "namespace"`)},
+		`cluster{*}.namespace[$$orderasc=foo]{*}`:     FResult{nil, errors.New(`can't order namespace by unknown field at column 33 near "foo", expected one of asset, cluster, creationtime, k8sobj, labels, name, objtype, resourceid, resourceversion`)},
+		`pod[(@phase="Failed"||@phase="Unknown")&&!(@name~="^debug")]{@name}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, pod)) @filter( ( eq(phase,\"Failed\") or eq(phase,\"Unknown\") ) and not regexp(name,/^debug/) ) @cascade {",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"{ objects(func: uid(A),first:1000,offset:0) {",
+			"\tname",
+			"\tobjtype",
+			"\tuid",
+			"}",
+			"}",
+		}, nil},
+		`namespace[@name="default"]{@name}.pod[!(@phase="Running")||@phase="Failed"]{@name}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, namespace)) @filter( eq(name,\"default\") ) @cascade {",
+			"\tcount(uid)",
+			"\t~namespace @filter(eq(objtype, pod) and ( not eq(phase,\"Running\") or eq(phase,\"Failed\") ) ){",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"}",
+			"{ objects(func: uid(A),first:1000,offset:0) {",
+			"\tname",
+			"\tobjtype",
+			"\tuid",
+			"\t~namespace @filter(eq(objtype, pod) and ( not eq(phase,\"Running\") or eq(phase,\"Failed\") ) )(first:1000,offset:0){",
+			"\t\tname",
+			"\t\tobjtype",
+			"\t\tuid",
+			"}",
+			"}",
+			"}",
+		}, nil},
+		`pod[@phase="Running"]{groupby(@phase,@namespace),count()}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, pod)) @filter( eq(phase,\"Running\") ) @cascade {",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"{ objects(func: uid(A)) @groupby(phase, namespace) {",
+			"\tcount(uid)",
+			"}",
+			"}",
+		}, nil},
+		`deployment{sum(@numreplicas),avg(@numreplicas)}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, deployment))  @cascade {",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"{ objects(func: uid(A)) @groupby(objtype) {",
+			"\tsum_numreplicas : sum(val(agg_numreplicas))",
+			"\tavg_numreplicas : avg(val(agg_numreplicas))",
+			"}",
+			"}",
+			"{ var(func: eq(objtype, deployment)) { agg_numreplicas as numreplicas } }",
+		}, nil},
+		`namespace[@name="default"]{@name}.pod{groupby(@phase),count(),min(@starttime)}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, namespace)) @filter( eq(name,\"default\") ) @cascade {",
+			"\tcount(uid)",
+			"\t~namespace @filter(eq(objtype, pod) ){",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"}",
+			"{ objects(func: uid(A),first:1000,offset:0) {",
+			"\tname",
+			"\tobjtype",
+			"\tuid",
+			"\t~namespace @filter(eq(objtype, pod) ) @groupby(phase){",
+			"\t\tcount(uid)",
+			"\t\tmin_starttime : min(val(agg_starttime))",
+			"}",
+			"}",
+			"}",
+			"{ var(func: eq(objtype, pod)) { agg_starttime as starttime } }",
+		}, nil},
+		`deployment{@numreplicas as desired, @availablereplicas*100/@numreplicas as ready}..pod{@name, len(@containers) as ncontainers}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, deployment))  @cascade {",
+			"\tcount(uid)",
+			"\t~owner @filter(eq(objtype, replicaset)){",
+			"\tcount(uid)",
+			"\t~owner @filter(eq(objtype, pod) ){",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"}",
+			"{ objects(func: uid(A),first:1000,offset:0) {",
+			"\tdesired : numreplicas",
+			"\tready : math((val_availablereplicas * 100) / val_numreplicas)",
+			"\tobjtype",
+			"\tuid",
+			"\t~owner @filter(eq(objtype, replicaset)){",
+			"\t\tobjtype",
+			"\t\tuid",
+			"\t~owner @filter(eq(objtype, pod) )(first:1000,offset:0){",
+			"\t\tname",
+			"\t\tncontainers : containers",
+			"\t\tobjtype",
+			"\t\tuid",
+			"}",
+			"}",
+			"{ var(func: has(availablereplicas)) { val_availablereplicas as availablereplicas } }",
+			"{ var(func: has(numreplicas)) { val_numreplicas as numreplicas } }",
+		}, nil},
+		`deployment{@name*2 as x}`:                FResult{nil, errors.New(`can't use string field in arithmetic at column 12 near "name"`)},
+		`deployment{@replicas+1 as x}`:            FResult{nil, errors.New(`can't compute unknown field of deployment at column 12 near "replicas", expected one of application, availablereplicas, cluster, creationtime, k8sobj, labels, name, namespace, numreplicas, objtype, resourceid, resourceversion, strategy`)},
+		`pod{len(@name) as n}`:                    FResult{nil, errors.New(`can't use len on string field at column 5 near "name"`)},
+		`cluster[@nmae="x"]{*}`:                   FResult{nil, errors.New(`can't filter cluster by unknown field at column 9 near "nmae", expected one of creationtime, k8sobj, name, objtype, resourceid, resourceversion`)},
+		`cluster{*}.namespace{@name,@region}`:     FResult{nil, errors.New(`can't return unknown field of namespace at column 28 near "region", expected one of asset, cluster, creationtime, k8sobj, labels, name, objtype, resourceid, resourceversion`)},
+		`pod[@name>"a"]{*}`:                       FResult{nil, errors.New(`can't compare string field with > at column 5 near "name"`)},
+		`pod[@labels<="a"]{*}`:                    FResult{nil, errors.New(`can't compare json field with <= at column 5 near "labels"`)},
+		`deployment[@numreplicas~="^1"]{*}`:       FResult{nil, errors.New(`can't use regexp on int field at column 12 near "numreplicas"`)},
+		`deployment[@numreplicas>"one"]{*}`:       FResult{nil, errors.New(`can't compare int field with "one" at column 12 near "numreplicas"`)},
+		`deployment[@name.$app="x"]{*}`:           FResult{nil, errors.New(`can't filter string field by json key at column 12 near "name"`)},
+		`cluster{*}.namespace[@count(node)>1]{*}`: FResult{nil, errors.New(`no relation found between node and namespace`)},
+		`deployment[@name="x"]{@name}..pod{@name}`: FResult{[]string{
+			"{ A as var(func: eq(objtype, deployment)) @filter( eq(name,\"x\") ) @cascade {",
+			"\tcount(uid)",
+			"\t~owner @filter(eq(objtype, replicaset)){",
+			"\tcount(uid)",
+			"\t~owner @filter(eq(objtype, pod) ){",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"}",
+			"}",
+			"{ objects(func: uid(A),first:1000,offset:0) {",
+			"\tname",
+			"\tobjtype",
+			"\tuid",
+			"\t~owner @filter(eq(objtype, replicaset)){",
+			"\t\tobjtype",
+			"\t\tuid",
+			"\t~owner @filter(eq(objtype, pod) )(first:1000,offset:0){",
+			"\t\tname",
+			"\t\tobjtype",
+			"\t\tuid",
+			"}",
+			"}",
+			"}",
+			"}",
+		}, nil},
+		`namespace{@name}..namespace{@name}`: FResult{nil, errors.New(`no relation found between namespace and namespace within 4 hops`)},
+		`pod{sum(@phase)}`:                   FResult{nil, errors.New(`can't sum non numeric field at column 5 near "phase"`)},
+		`pod{groupby(@labels),count()}`:      FResult{nil, errors.New(`can't group pod by json field at column 13 near "labels"`)},
+		`pod{max(@namespace)}`:               FResult{nil, errors.New(`can't max relationship field at column 5 near "namespace"`)},
+		`cluster{*}.namespace{avg(@foo)}`:    FResult{nil, errors.New(`can't avg unknown field of namespace at column 22 near "foo", expected one of asset, cluster, creationtime, k8sobj, labels, name, objtype, resourceid, resourceversion`)},
+		`cluster{groupby(@foo),count()}`:     FResult{nil, errors.New(`can't group cluster by unknown field at column 17 near "foo", expected one of creationtime, k8sobj, name, objtype, resourceid, resourceversion`)},
 	}
 
-	dgraphHost := "127.0.0.1:9080"
-	dc := db.NewDGClient(dgraphHost)
+	dc := newTestClient()
 	defer dc.Close()
 	metaSvc := NewMetaService(dc)
 	qslSvc := NewQSLService(dc)
@@ -498,3 +742,86 @@ func TestCreateDgraphQuery(t *testing.T) {
 	}
 
 }
+
+func TestComputeLengths(t *testing.T) {
+	data := map[string]interface{}{
+		"objects": []interface{}{
+			map[string]interface{}{
+				"objtype": "replicaset",
+				"uid":     "0x1",
+				"~owner": []interface{}{
+					map[string]interface{}{"objtype": "pod", "n": `[{"name":"a"},{"name":"b"}]`},
+					map[string]interface{}{"objtype": "pod", "n": `{"name":"a"}`},
+					map[string]interface{}{"objtype": "pod"},
+				},
+			},
+		},
+	}
+	ComputeLengths(`replicaset{@name}.pod{len(@containers) as n}`, data)
+	pods := data["objects"].([]interface{})[0].(map[string]interface{})["~owner"].([]interface{})
+	expected := []interface{}{2, 1, nil}
+	for i, pod := range pods {
+		if n := pod.(map[string]interface{})["n"]; !reflect.DeepEqual(n, expected[i]) {
+			t.Errorf("length of pod %d incorrect\n expected: %v\n real: %v", i, expected[i], n)
+		}
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	metaSvc := NewMetaService(dc)
+	qslSvc := NewQSLService(dc)
+
+	meta, err := ioutil.ReadFile("../data/meta.json")
+	if err != nil {
+		log.Fatalf("Metadata file error: %v\n", err)
+	}
+	var jsonData []map[string]interface{}
+	json.Unmarshal(meta, &jsonData)
+	for _, data := range jsonData {
+		metaSvc.CreateMetadata(data)
+	}
+	// phases with ties across pages
+	phases := []string{"Failed", "Pending", "Pending", "Pending", "Running"}
+	for i, phase := range phases {
+		name := "cursorpod0" + strconv.Itoa(i)
+		uid, err := dc.CreateEntity("pod", map[string]interface{}{"objtype": "pod", "name": name, "resourceid": name, "phase": phase})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dc.DeleteEntity(uid)
+	}
+
+	// page through the pods ordered by phase two at a time
+	tests := map[string][]string{
+		`pod[@name~="^cursorpod"$$limit=2,orderasc=phase]{@name}`:  {"cursorpod00", "cursorpod01", "cursorpod02", "cursorpod03", "cursorpod04"},
+		`pod[@name~="^cursorpod"$$limit=2,orderdesc=phase]{@name}`: {"cursorpod04", "cursorpod01", "cursorpod02", "cursorpod03", "cursorpod00"},
+		`pod[@name~="^cursorpod"$$limit=2]{@name}`:                 {"cursorpod00", "cursorpod01", "cursorpod02", "cursorpod03", "cursorpod04"},
+	}
+	for query, expected := range tests {
+		names := []string{}
+		q := query
+		for pages := 0; pages < len(phases); pages++ {
+			dq, err := qslSvc.CreateDgraphQuery(q, false)
+			if err != nil {
+				t.Fatalf("query error for %s: %v", q, err)
+			}
+			ret, err := dc.ExecuteDgraphQuery(dq)
+			if err != nil {
+				t.Fatalf("query error for %s: %v", q, err)
+			}
+			for _, o := range ret["objects"].([]interface{}) {
+				names = append(names, o.(map[string]interface{})["name"].(string))
+			}
+			cursor := NextCursor(q, ret)
+			if cursor == "" {
+				break
+			}
+			q = strings.Replace(query, "$$", "$$after="+cursor+",", 1)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("pages incorrect\n input: %s\n expected: %v\n real: %v", query, expected, names)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package apis
+
+import (
+	"github.com/intuit/katlas/service/util"
+)
+
+// StreamPageSize is the number of objects fetched from dgraph for each page of a streamed query
+var StreamPageSize = 1000
+
+// StreamQuery runs a QSL query page by page, following the cursor of each page, and passes the objects
+// of every page to emit so results can be written as they arrive. All objects of the first block are
+// returned, MaximumLimit doesn't apply and the first block can't be paginated
+func (qa *QSLService) StreamQuery(query string, emit func(objects []interface{}) error) error {
+	qsl, err := ParseQSL(query)
+	if err != nil {
+		return err
+	}
+	root := qsl.Blocks[0]
+	if root.Page.Limit != nil || root.Page.Offset != nil || root.Page.After != nil {
+		return &QSLError{Message: "the first block can't be paginated when streaming", Column: root.Column, Token: root.ObjType}
+	}
+	if root.Page.AsOf != nil {
+		ret, err := qa.queryAsOf(qsl, -1)
+		if err != nil {
+			return err
+		}
+		objects, _ := ret[util.Objects].([]interface{})
+		return emit(objects)
+	}
+	if !root.Fields.IsAggregate() {
+		size := StreamPageSize
+		root.Page.Limit = &size
+	}
+	for {
+		q, err := qa.createDgraphQuery(qsl, false)
+		if err != nil {
+			return err
+		}
+		ret, err := qa.DBclient.ExecuteDgraphQuery(q)
+		if err != nil {
+			return err
+		}
+		FlattenGroupBy(ret)
+		computeQSLLengths(qsl, ret)
+		objects, _ := ret[util.Objects].([]interface{})
+		if err := emit(objects); err != nil {
+			return err
+		}
+		if root.Page.After = nextQSLCursor(root, ret); root.Page.After == nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package apis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestStreamQuery(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	metaSvc := NewMetaService(dc)
+	qslSvc := NewQSLService(dc)
+
+	meta, err := ioutil.ReadFile("../data/meta.json")
+	if err != nil {
+		log.Fatalf("Metadata file error: %v\n", err)
+	}
+	var jsonData []map[string]interface{}
+	json.Unmarshal(meta, &jsonData)
+	for _, data := range jsonData {
+		metaSvc.CreateMetadata(data)
+	}
+	phases := []string{"Failed", "Pending", "Pending", "Pending", "Running"}
+	for i, phase := range phases {
+		name := "streampod0" + strconv.Itoa(i)
+		uid, err := dc.CreateEntity("pod", map[string]interface{}{"objtype": "pod", "name": name, "resourceid": name, "phase": phase})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dc.DeleteEntity(uid)
+	}
+
+	// stream two objects per page so the results span several pages
+	defer func(size int) { StreamPageSize = size }(StreamPageSize)
+	StreamPageSize = 2
+
+	tests := map[string][]string{
+		`pod[@name~="^streampod"]{@name}`:                  {"streampod00", "streampod01", "streampod02", "streampod03", "streampod04"},
+		`pod[@name~="^streampod"$$orderdesc=phase]{@name}`: {"streampod04", "streampod01", "streampod02", "streampod03", "streampod00"},
+	}
+	for query, expected := range tests {
+		names := []string{}
+		pages := 0
+		err := qslSvc.StreamQuery(query, func(objects []interface{}) error {
+			pages++
+			for _, o := range objects {
+				names = append(names, o.(map[string]interface{})["name"].(string))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("stream error for %s: %v", query, err)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("streamed objects incorrect\n input: %s\n expected: %v\n real: %v", query, expected, names)
+		}
+		if pages != 3 {
+			t.Errorf("expected 3 pages for %s, got %d", query, pages)
+		}
+	}
+
+	// the first block can't be paginated
+	err = qslSvc.StreamQuery(`pod[@name~="^streampod"$$limit=2]{@name}`, func(objects []interface{}) error { return nil })
+	if err == nil || !strings.HasPrefix(err.Error(), "the first block can't be paginated when streaming") {
+		t.Errorf("expected pagination error, got %v", err)
+	}
+}
@@ -20,6 +20,15 @@ type IQueryService interface {
 	GetQueryResult(queryMap map[string][]string) (map[string]interface{}, error)
 }
 
+// QueryParamError is returned when the params of a key/value query can't be turned into a query
+type QueryParamError struct {
+	Message string
+}
+
+func (e *QueryParamError) Error() string {
+	return e.Message
+}
+
 //QueryService ...
 type QueryService struct {
 	dbclient db.IDGClient
@@ -49,6 +58,28 @@ func (s QueryService) GetQueryResult(queryMap map[string][]string) (map[string]i
 			return nil, err
 		}
 	}
+	// after continues from the cursor returned with the previous page
+	after := ""
+	if val, ok := queryMap[util.After]; ok {
+		if _, ok := queryMap[util.Offset]; ok {
+			return nil, fmt.Errorf("after can't be combined with offset")
+		}
+		c, err := DecodeCursor(val[0])
+		if err != nil {
+			return nil, err
+		}
+		after = c.UID
+	}
+	// the total count is skipped with count=false
+	withCount := true
+	if val, ok := queryMap[util.Count]; ok {
+		withCount = val[0] != "false"
+	}
+	// tombstones of soft deleted objects are returned with includeDeleted=true
+	notDeleted := ""
+	if val, ok := queryMap[util.IncludeDeleted]; !ok || val[0] != "true" {
+		notDeleted = dgraphNotDeleted(false)
+	}
 	// keyword search
 	if val, ok := queryMap[QueryParamKeyword]; ok {
 		if val[0] == "" {
@@ -56,51 +87,69 @@ func (s QueryService) GetQueryResult(queryMap map[string][]string) (map[string]i
 			return nil, err
 		}
 		// generate queries include count query
-		q, cntQry, err := s.getQueryResultByKeyword(val[0], limit, offset)
+		q, cntQry, err := s.getQueryResultByKeyword(val[0], limit, offset, after, notDeleted)
 		metrics.DgraphNumKeywordQueries.Inc()
 		if err != nil {
 			metrics.DgraphNumKeywordQueriesErr.Inc()
 			log.Debug(err)
 			return nil, err
 		}
-		// execute query to get result
-		ret, err := s.dbclient.GetQueryResult(cntQry)
-		if err != nil {
-			log.Debug(err)
-			return nil, err
-		}
-		total := GetTotalCnt(ret)
-		ret, err = s.dbclient.GetQueryResult(q)
-		if err != nil {
-			log.Debug(err)
-			return nil, err
-		}
-		ret[util.Count] = total
-		return ret, nil
+		return s.executeQueries(q, cntQry, limit, withCount)
 	}
 	// key value query
 	if len(queryMap) == 0 {
 		err := fmt.Errorf("Query Params not specified")
 		return nil, err
 	}
-	q, cntQry := getQueryResultByKeyValue(queryMap, limit, offset)
+	q, cntQry, err := getQueryResultByKeyValue(queryMap, limit, offset, after, notDeleted)
+	if err != nil {
+		return nil, err
+	}
 	metrics.DgraphNumKeyValueQueries.Inc()
-	ret, err := s.dbclient.GetQueryResult(cntQry)
+	ret, err := s.executeQueries(q, cntQry, limit, withCount)
 	if err != nil {
 		metrics.DgraphNumKeyValueQueriesErr.Inc()
-		log.Debug(err)
-		return nil, err
 	}
-	total := GetTotalCnt(ret)
-	ret, err = s.dbclient.GetQueryResult(q)
+	return ret, err
+}
+
+// executeQueries runs the count query when withCount is set and the paginated query
+// a cursor to the next page is returned when the page is full
+func (s QueryService) executeQueries(q, cntQry string, limit int, withCount bool) (map[string]interface{}, error) {
+	var total float64
+	if withCount {
+		ret, err := s.dbclient.GetQueryResult(cntQry)
+		if err != nil {
+			log.Debug(err)
+			return nil, err
+		}
+		total = GetTotalCnt(ret)
+	}
+	ret, err := s.dbclient.GetQueryResult(q)
 	if err != nil {
 		log.Debug(err)
 		return nil, err
 	}
-	ret[util.Count] = total
+	if withCount {
+		ret[util.Count] = total
+	}
+	if objects, ok := ret[util.Objects].([]interface{}); ok {
+		if cursor := lastCursor(objects, limit); cursor != nil {
+			ret[util.Cursor] = cursor.Encode()
+		}
+	}
 	return ret, nil
 }
 
+// dgraphPage generates the pagination arguments of the key/value and keyword queries
+// dgraph doesn't allow after with offset so the offset is left out when paging from a cursor
+func dgraphPage(limit, offset int, after string) string {
+	if after != "" {
+		return fmt.Sprintf("first:%d, after:%s", limit, after)
+	}
+	return fmt.Sprintf("first:%d, offset:%d", limit, offset)
+}
+
 // GetTotalCnt find count from returned value
 func GetTotalCnt(data map[string]interface{}) float64 {
 	var total float64
@@ -113,8 +162,32 @@ func GetTotalCnt(data map[string]interface{}) float64 {
 	return total
 }
 
+// FlattenGroupBy replaces the [{"@groupby": [...]}] list dgraph returns for grouped blocks
+// with the list of groups, e.g. {"objects": [{"phase": "Running", "count": 3}]}
+func FlattenGroupBy(data map[string]interface{}) {
+	for k, v := range data {
+		list, ok := v.([]interface{})
+		if !ok {
+			continue
+		}
+		if len(list) == 1 {
+			if obj, ok := list[0].(map[string]interface{}); ok && len(obj) == 1 {
+				if groups, ok := obj["@groupby"].([]interface{}); ok {
+					data[k] = groups
+					continue
+				}
+			}
+		}
+		for _, item := range list {
+			if obj, ok := item.(map[string]interface{}); ok {
+				FlattenGroupBy(obj)
+			}
+		}
+	}
+}
+
 // Keyword query http://<dgraph ip:port>/v1/query?keyword=pod
-func (s QueryService) getQueryResultByKeyword(keyword string, limit, offset int) (string, string, error) {
+func (s QueryService) getQueryResultByKeyword(keyword string, limit, offset int, after string, notDeleted string) (string, string, error) {
 	smds, err := s.dbclient.GetSchemaFromCache(db.LruCache)
 	if err != nil {
 		log.Debug(err)
@@ -153,29 +226,37 @@ func (s QueryService) getQueryResultByKeyword(keyword string, limit, offset int)
 
 	cntOnlyStatements := make([]string, len(statements))
 	copy(cntOnlyStatements, statements)
-	cntTemplate := `objects(func: uid(%s)) { %s }`
-	cntQuery := fmt.Sprintf(cntTemplate, buf.String(), "count(uid)")
+	filter := ""
+	if notDeleted != "" {
+		filter = "@filter(" + notDeleted + ")"
+	}
+	cntTemplate := `objects(func: uid(%s)) %s { %s }`
+	cntQuery := fmt.Sprintf(cntTemplate, buf.String(), filter, "count(uid)")
 	cntOnlyStatements = append(cntOnlyStatements, cntQuery)
 	cntOnlyStatements = append(cntOnlyStatements, "}")
-	template := `objects(func: uid(%s), first:%d,offset:%d) { %s }`
-	query := fmt.Sprintf(template, buf.String(), limit, offset, "uid expand(_all_) { uid expand(_all_) }")
+	template := `objects(func: uid(%s), %s) %s { %s }`
+	query := fmt.Sprintf(template, buf.String(), dgraphPage(limit, offset, after), filter, "uid expand(_all_) { uid expand(_all_) }")
 	statements = append(statements, query)
 	statements = append(statements, "}")
 	return strings.Join(statements, "\n"), strings.Join(cntOnlyStatements, "\n"), nil
 }
 
 // Key-Value query http://<dgraph ip:port>/v1/query?name=pod01&objtype=Pod
-func getQueryResultByKeyValue(queryMap map[string][]string, limit, offset int) (string, string) {
+func getQueryResultByKeyValue(queryMap map[string][]string, limit, offset int, after string, notDeleted string) (string, string, error) {
 	//Only indexed fields can be filtered on
 	//Time must be in correct format "2018-10-18 14:36:32 -0700 PDT"
 	qps := []string{}
 	var funcStr, filterStr string
 	for k, v := range queryMap {
-		if k != util.Limit && k != util.Offset && k != util.Print {
+		if k != util.Limit && k != util.Offset && k != util.Print && k != util.After && k != util.Count && k != util.IncludeDeleted {
 			qp := "eq(" + k + ",\"" + v[0] + "\")"
 			qps = append(qps, qp)
 		}
 	}
+	// reserved params like limit or after alone don't select anything
+	if len(qps) == 0 {
+		return "", "", &QueryParamError{Message: "at least one filter key is required"}
+	}
 	print := "expand(_all_)"
 	if p, ok := queryMap[util.Print]; ok {
 		if "*" != p[0] {
@@ -185,13 +266,16 @@ func getQueryResultByKeyValue(queryMap map[string][]string, limit, offset int) (
 			}
 		}
 	}
-	funcStr = fmt.Sprintf("(func:%s, first:%d, offset:%d) ", qps[0], limit, offset)
+	funcStr = fmt.Sprintf("(func:%s, %s) ", qps[0], dgraphPage(limit, offset, after))
 	cntStr := fmt.Sprintf("(func:%s)", qps[0])
 	filters := qps[1:]
+	if notDeleted != "" {
+		filters = append(filters, strings.TrimSpace(notDeleted))
+	}
 	if len(filters) > 0 {
 		filterStr = "@filter(" + strings.Join(filters, " AND ") + ")"
 	}
 	q := fmt.Sprintf(`{objects %s %s {uid %s { uid %s }}}`, funcStr, filterStr, print, print)
 	cntQry := fmt.Sprintf(`{objects %s %s {count(uid)}}`, cntStr, filterStr)
-	return q, cntQry
+	return q, cntQry, nil
 }
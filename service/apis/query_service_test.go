@@ -8,6 +8,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/intuit/katlas/service/cfg"
 	"github.com/intuit/katlas/service/db"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,7 +27,7 @@ func TestGetQueryResultByKeyValue(t *testing.T) {
 		}
 	}()
 
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 	ms := NewMetaService(dc)
 	//create entity for query later
@@ -72,7 +73,7 @@ func TestGetQueryResultByKeyValue(t *testing.T) {
 }
 
 func TestGetQueryResultByKeywordSearch(t *testing.T) {
-	dc := db.NewDGClient("127.0.0.1:9080")
+	dc := newTestClient()
 	defer dc.Close()
 
 	var err error
@@ -100,7 +101,85 @@ func TestGetQueryResultByKeywordSearch(t *testing.T) {
 	assert.Nil(t, err)
 }
 
-func createPod(dc *db.DGClient, ms *MetaService) (uid string) {
+func TestGetQueryResultWithCursor(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewQueryService(dc)
+	for _, name := range []string{"cursor01", "cursor02", "cursor03"} {
+		uid, err := dc.CreateEntity("CursorPod", map[string]interface{}{"objtype": "CursorPod", "name": name, "resourceid": name})
+		assert.Nil(t, err)
+		defer dc.DeleteEntity(uid)
+	}
+
+	// first page without total count
+	qr, err := s.GetQueryResult(map[string][]string{"objtype": {"CursorPod"}, "limit": {"2"}, "count": {"false"}, "print": {"name"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(qr["objects"].([]interface{})))
+	assert.Nil(t, qr["count"])
+	cursor, ok := qr["cursor"].(string)
+	assert.True(t, ok, "full page should return a cursor")
+
+	// the last page has no cursor
+	qr, err = s.GetQueryResult(map[string][]string{"objtype": {"CursorPod"}, "limit": {"2"}, "after": {cursor}, "print": {"name"}})
+	assert.Nil(t, err)
+	objs := qr["objects"].([]interface{})
+	if assert.Equal(t, 1, len(objs)) {
+		assert.Equal(t, "cursor03", objs[0].(map[string]interface{})["name"])
+	}
+	assert.Equal(t, float64(3), qr["count"])
+	assert.Nil(t, qr["cursor"])
+
+	_, err = s.GetQueryResult(map[string][]string{"objtype": {"CursorPod"}, "after": {cursor}, "offset": {"1"}})
+	assert.Equal(t, "after can't be combined with offset", err.Error())
+	_, err = s.GetQueryResult(map[string][]string{"objtype": {"CursorPod"}, "after": {"0x1"}})
+	assert.Equal(t, "invalid cursor 0x1", err.Error())
+}
+
+func TestGetQueryResultReservedParamsOnly(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewQueryService(dc)
+	for _, m := range []map[string][]string{
+		{"after": {Cursor{UID: "0x1"}.Encode()}},
+		{"count": {"true"}},
+		{"limit": {"10"}, "print": {"name"}},
+		{"includeDeleted": {"true"}},
+		{"includeDeleted": {"false"}, "count": {"false"}},
+	} {
+		_, err := s.GetQueryResult(m)
+		if assert.Error(t, err, "%v", m) {
+			assert.IsType(t, &QueryParamError{}, err)
+			assert.Equal(t, "at least one filter key is required", err.Error())
+		}
+	}
+}
+
+func TestFlattenGroupBy(t *testing.T) {
+	data := map[string]interface{}{
+		"objects": []interface{}{map[string]interface{}{"@groupby": []interface{}{
+			map[string]interface{}{"phase": "Running", "count": float64(2)},
+		}}},
+	}
+	FlattenGroupBy(data)
+	assert.Equal(t, []interface{}{map[string]interface{}{"phase": "Running", "count": float64(2)}}, data["objects"])
+
+	// groups of an edge block are flattened in place
+	data = map[string]interface{}{
+		"objects": []interface{}{map[string]interface{}{"name": "default", "~namespace": []interface{}{
+			map[string]interface{}{"@groupby": []interface{}{map[string]interface{}{"objtype": "pod", "count": float64(3)}}},
+		}}},
+	}
+	FlattenGroupBy(data)
+	ns := data["objects"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"objtype": "pod", "count": float64(3)}}, ns["~namespace"])
+}
+
+// newTestClient returns the storage client selected by -storage, tests can run without dgraph using -args -storage=memory
+func newTestClient() db.IDGClient {
+	return db.NewClient(cfg.ServerCfg.StorageType, "127.0.0.1:9080")
+}
+
+func createPod(dc db.IDGClient, ms *MetaService) (uid string) {
 	s := NewEntityService(dc)
 	// create pod
 	pod := map[string]interface{}{
@@ -129,7 +208,7 @@ func createPod(dc *db.DGClient, ms *MetaService) (uid string) {
 	return pid
 }
 
-func deletePod(dc *db.DGClient, ms *MetaService, uid string) {
+func deletePod(dc db.IDGClient, ms *MetaService, uid string) {
 	s := NewEntityService(dc)
 	s.DeleteEntity(uid)
 }
@@ -0,0 +1,207 @@
+package apis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
+)
+
+var (
+	// placeholders of a saved query, e.g. {{namespace}}
+	paramRegex = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+	// names of saved queries are used in paths and resource ids
+	savedQueryNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	// parameter values that can be used unquoted in a query
+	plainValueRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// ISavedQueryService define interfaces to manage and run named QSL templates
+type ISavedQueryService interface {
+	// save a named query, replacing the query with the same name
+	CreateSavedQuery(q SavedQuery) (string, error)
+	// get the saved query with the given name, nil if not found
+	GetSavedQuery(name string) (*SavedQuery, error)
+	// list all saved queries
+	ListSavedQueries() ([]SavedQuery, error)
+	// remove the saved query with the given name
+	DeleteSavedQuery(name string) error
+}
+
+// SavedQuery is a named QSL template, {{param}} placeholders are replaced by parameters when it runs
+type SavedQuery struct {
+	UID         string   `json:"uid,omitempty"`
+	Name        string   `json:"name"`
+	Query       string   `json:"query"`
+	Description string   `json:"description,omitempty"`
+	Params      []string `json:"params"`
+}
+
+// SavedQueryService implements ISavedQueryService, saved queries are stored as savedquery entities
+type SavedQueryService struct {
+	dbclient db.IDGClient
+}
+
+// NewSavedQueryService creates a new SavedQueryService with the given dgraph client.
+func NewSavedQueryService(dc db.IDGClient) *SavedQueryService {
+	return &SavedQueryService{dc}
+}
+
+// CreateSavedQuery validates and stores a saved query
+func (s SavedQueryService) CreateSavedQuery(q SavedQuery) (string, error) {
+	if err := ValidateSavedQuery(q); err != nil {
+		return "", err
+	}
+	data := map[string]interface{}{
+		util.ObjType:     util.SavedQuery,
+		util.Name:        q.Name,
+		util.Query:       q.Query,
+		util.Description: q.Description,
+	}
+	return NewEntityService(s.dbclient).CreateEntity(util.SavedQuery, data)
+}
+
+// GetSavedQuery returns the saved query with the given name, nil if not found
+func (s SavedQueryService) GetSavedQuery(name string) (*SavedQuery, error) {
+	if !savedQueryNameRegex.MatchString(name) {
+		return nil, nil
+	}
+	queries, err := s.getSavedQueries(map[string][]string{util.ObjType: {util.SavedQuery}, util.Name: {name}})
+	if err != nil || len(queries) == 0 {
+		return nil, err
+	}
+	return &queries[0], nil
+}
+
+// ListSavedQueries returns all saved queries sorted by name
+func (s SavedQueryService) ListSavedQueries() ([]SavedQuery, error) {
+	queries, err := s.getSavedQueries(map[string][]string{util.ObjType: {util.SavedQuery}, util.Limit: {fmt.Sprint(MaximumLimit)}})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries, nil
+}
+
+// DeleteSavedQuery removes the saved query with the given name
+func (s SavedQueryService) DeleteSavedQuery(name string) error {
+	q, err := s.GetSavedQuery(name)
+	if err != nil {
+		return err
+	}
+	if q == nil {
+		return fmt.Errorf("saved query %s not found", name)
+	}
+	return NewEntityService(s.dbclient).DeleteEntity(q.UID)
+}
+
+func (s SavedQueryService) getSavedQueries(queryMap map[string][]string) ([]SavedQuery, error) {
+	ret, err := NewQueryService(s.dbclient).GetQueryResult(queryMap)
+	if err != nil {
+		return nil, err
+	}
+	queries := []SavedQuery{}
+	objs, _ := ret[util.Objects].([]interface{})
+	for _, o := range objs {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		q := SavedQuery{}
+		q.UID, _ = obj[util.UID].(string)
+		q.Name, _ = obj[util.Name].(string)
+		q.Query, _ = obj[util.Query].(string)
+		q.Description, _ = obj[util.Description].(string)
+		q.Params = TemplateParams(q.Query)
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
+
+// ValidateSavedQuery checks the name of a saved query and that its template is valid QSL
+func ValidateSavedQuery(q SavedQuery) error {
+	if !savedQueryNameRegex.MatchString(q.Name) {
+		return fmt.Errorf("name of saved query must only contain letters, digits, _ or -")
+	}
+	if strings.TrimSpace(q.Query) == "" {
+		return fmt.Errorf("query of saved query %s is empty", q.Name)
+	}
+	// any value must give a valid query, 0 can be used in filters as well as pagination
+	params := map[string]string{}
+	for _, p := range TemplateParams(q.Query) {
+		params[p] = "0"
+	}
+	query, err := RenderQuery(q.Query, params)
+	if err != nil {
+		return err
+	}
+	_, err = ParseQSL(query)
+	return err
+}
+
+// TemplateParams returns the names of the placeholders of a query template in order of first use
+func TemplateParams(template string) []string {
+	params := []string{}
+	seen := map[string]bool{}
+	for _, m := range paramRegex.FindAllStringSubmatch(template, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			params = append(params, m[1])
+		}
+	}
+	return params
+}
+
+// RenderQuery replaces the placeholders of a query template with the given parameters
+// values inside a quoted string are escaped, elsewhere values other than plain words are quoted
+// so a parameter can never change the structure of the query
+func RenderQuery(template string, params map[string]string) (string, error) {
+	missing := []string{}
+	for _, p := range TemplateParams(template) {
+		if _, ok := params[p]; !ok {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing parameters %s", strings.Join(missing, ", "))
+	}
+	var sb strings.Builder
+	quoted := false
+	last := 0
+	for _, loc := range paramRegex.FindAllStringSubmatchIndex(template, -1) {
+		quoted = inQuotes(template[last:loc[0]], quoted)
+		sb.WriteString(template[last:loc[0]])
+		value := params[template[loc[2]:loc[3]]]
+		switch {
+		case quoted:
+			sb.WriteString(escapeQSLString(value))
+		case plainValueRegex.MatchString(value):
+			sb.WriteString(value)
+		default:
+			sb.WriteString(`"` + escapeQSLString(value) + `"`)
+		}
+		last = loc[1]
+	}
+	sb.WriteString(template[last:])
+	return sb.String(), nil
+}
+
+// inQuotes returns whether a quoted string is still open at the end of s, quoted tells if it was at the start
+func inQuotes(s string, quoted bool) bool {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		}
+	}
+	return quoted
+}
+
+func escapeQSLString(s string) string {
+	return strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1)
+}
@@ -0,0 +1,70 @@
+package apis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderQuery(t *testing.T) {
+	template := `pod[@namespace="{{ns}}"&&@name={{ name }}$$limit={{limit}}]{@name}`
+	assert.Equal(t, []string{"ns", "name", "limit"}, TemplateParams(template))
+
+	tests := []struct {
+		params   map[string]string
+		expected string
+	}{
+		{map[string]string{"ns": "default", "name": "web-01", "limit": "10"}, `pod[@namespace="default"&&@name=web-01$$limit=10]{@name}`},
+		// values can't end the string or break out of the filter
+		{map[string]string{"ns": `a"]{*}`, "name": `b"]{*}`, "limit": "1"}, `pod[@namespace="a\"]{*}"&&@name="b\"]{*}"$$limit=1]{@name}`},
+		{map[string]string{"ns": `x\`, "name": "web 01", "limit": "1"}, `pod[@namespace="x\\"&&@name="web 01"$$limit=1]{@name}`},
+	}
+	for _, test := range tests {
+		query, err := RenderQuery(template, test.params)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, query)
+		qsl, err := ParseQSL(query)
+		if assert.Nil(t, err) {
+			ns := qsl.Blocks[0].Filter.(*QSLLogical).Operands[0].(*QSLCondition)
+			assert.Equal(t, test.params["ns"], ns.Value.Text)
+		}
+	}
+
+	_, err := RenderQuery(template, map[string]string{"ns": "default"})
+	assert.Equal(t, "missing parameters name, limit", err.Error())
+}
+
+func TestSavedQuery(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewSavedQueryService(dc)
+
+	_, err := s.CreateSavedQuery(SavedQuery{Name: "bad name", Query: "pod{*}"})
+	assert.NotNil(t, err)
+	_, err = s.CreateSavedQuery(SavedQuery{Name: "broken", Query: "pod[@name={{name}}"})
+	assert.NotNil(t, err)
+
+	uid, err := s.CreateSavedQuery(SavedQuery{Name: "pods-in-ns", Query: `pod[@namespace="{{ns}}"]{*}`, Description: "pods of a namespace"})
+	assert.Nil(t, err)
+	defer dc.DeleteEntity(uid)
+	// saving again replaces the query
+	uid2, err := s.CreateSavedQuery(SavedQuery{Name: "pods-in-ns", Query: `pod[@namespace="{{ns}}"$$limit={{limit}}]{*}`})
+	assert.Nil(t, err)
+	assert.Equal(t, uid, uid2)
+
+	q, err := s.GetSavedQuery("pods-in-ns")
+	assert.Nil(t, err)
+	if assert.NotNil(t, q) {
+		assert.Equal(t, `pod[@namespace="{{ns}}"$$limit={{limit}}]{*}`, q.Query)
+		assert.Equal(t, []string{"ns", "limit"}, q.Params)
+	}
+	queries, err := s.ListSavedQueries()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(queries))
+
+	assert.Nil(t, s.DeleteSavedQuery("pods-in-ns"))
+	q, err = s.GetSavedQuery("pods-in-ns")
+	assert.Nil(t, err)
+	assert.Nil(t, q)
+	assert.Equal(t, "saved query pods-in-ns not found", s.DeleteSavedQuery("pods-in-ns").Error())
+}
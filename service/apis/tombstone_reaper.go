@@ -0,0 +1,75 @@
+package apis
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/metrics"
+	"github.com/intuit/katlas/service/util"
+)
+
+// ReapInterval is how often the reaper looks for expired tombstones
+const ReapInterval = 10 * time.Minute
+
+// reapBatchSize is the number of tombstones read per query
+const reapBatchSize = 1000
+
+// TombstoneReaper permanently removes soft deleted entities once their retention expired
+type TombstoneReaper struct {
+	dbclient  db.IDGClient
+	retention time.Duration
+}
+
+// NewTombstoneReaper creates a reaper removing the tombstones older than retention
+func NewTombstoneReaper(dc db.IDGClient, retention time.Duration) *TombstoneReaper {
+	return &TombstoneReaper{dc, retention}
+}
+
+// Run removes the expired tombstones every interval until stop is closed
+func (r *TombstoneReaper) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := r.Reap(time.Now()); err != nil {
+			log.Errorf("failed to reap tombstones: %v", err)
+		} else if n > 0 {
+			log.Infof("%d tombstones older than %s removed", n, r.retention)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reap removes the entities deleted before now minus the retention and returns how many were removed
+func (r *TombstoneReaper) Reap(now time.Time) (int, error) {
+	cutoff := now.Add(-r.retention).UTC().Format(time.RFC3339)
+	q := fmt.Sprintf(`{
+		objects(func: lt(%s, %s), first: %d) {
+			uid
+		}
+	}`, util.DeletedAt, dgraphString(cutoff), reapBatchSize)
+	n := 0
+	for {
+		ret, err := r.dbclient.ExecuteDgraphQuery(q)
+		if err != nil {
+			return n, err
+		}
+		objs, _ := ret[util.Objects].([]interface{})
+		for _, o := range objs {
+			uid, _ := o.(map[string]interface{})[util.UID].(string)
+			if err := r.dbclient.DeleteEntity(uid); err != nil {
+				return n, err
+			}
+			metrics.DgraphNumReapedEntity.Inc()
+			n++
+		}
+		if len(objs) < reapBatchSize {
+			return n, nil
+		}
+	}
+}
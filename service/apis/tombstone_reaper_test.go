@@ -0,0 +1,145 @@
+package apis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/service/cfg"
+	"github.com/intuit/katlas/service/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftDelete(t *testing.T) {
+	cfg.ServerCfg.SoftDelete = true
+	defer func() { cfg.ServerCfg.SoftDelete = false }()
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	qa := NewQSLService(dc)
+	q := NewQueryService(dc)
+	count := func(query string) int {
+		dq, err := qa.CreateDgraphQuery(query, false)
+		if !assert.Nil(t, err, query) {
+			return -1
+		}
+		ret, err := dc.ExecuteDgraphQuery(dq)
+		assert.Nil(t, err)
+		objs, _ := ret[util.Objects].([]interface{})
+		return len(objs)
+	}
+
+	tomb := map[string]interface{}{"objtype": "tombpod", "name": "tombpod01", "resourceversion": "1"}
+	uid, err := s.CreateEntity("tombpod", tomb)
+	assert.Nil(t, err)
+	other, _ := s.CreateEntity("tombpod", map[string]interface{}{"objtype": "tombpod", "name": "tombpod02", "resourceversion": "1"})
+	defer dc.DeleteEntity(other)
+	assert.Nil(t, s.DeleteEntity(uid))
+
+	// the tombstone is kept and can still be read by uid
+	obj := s.getObject(uid)
+	if assert.NotNil(t, obj) {
+		assert.NotNil(t, obj[util.DeletedAt])
+	}
+	// deleting it again does nothing
+	assert.Nil(t, s.DeleteEntity(uid))
+	entries, _ := NewHistoryService(dc).GetHistory(uid)
+	assert.Equal(t, 2, len(entries))
+
+	// queries leave it out unless asked for
+	assert.Equal(t, 1, count(`tombpod{@name}`))
+	assert.Equal(t, 2, count(`tombpod[$$includeDeleted=true]{@name}`))
+	assert.Equal(t, 0, count(`tombpod[@name="tombpod01"]{@name}`))
+	ret, err := q.GetQueryResult(map[string][]string{"objtype": {"tombpod"}})
+	assert.Nil(t, err)
+	assert.Equal(t, float64(1), ret[util.Count])
+	ret, _ = q.GetQueryResult(map[string][]string{"objtype": {"tombpod"}, util.IncludeDeleted: {"true"}})
+	assert.Equal(t, float64(2), ret[util.Count])
+
+	// creating the object again brings it back with the same uid
+	tomb = map[string]interface{}{"objtype": "tombpod", "name": "tombpod01", "resourceversion": "5"}
+	again, _ := s.CreateEntity("tombpod", tomb)
+	assert.Equal(t, uid, again)
+	assert.Nil(t, s.getObject(uid)[util.DeletedAt])
+	assert.Equal(t, 2, count(`tombpod{@name}`))
+
+	// only tombstones older than the retention are removed
+	s.DeleteEntity(uid)
+	r := NewTombstoneReaper(dc, time.Hour)
+	n, err := r.Reap(time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = r.Reap(time.Now().Add(2 * time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Nil(t, s.getObject(uid))
+	assert.NotNil(t, s.getObject(other))
+}
+
+func TestSyncSoftDelete(t *testing.T) {
+	cfg.ServerCfg.SoftDelete = true
+	defer func() { cfg.ServerCfg.SoftDelete = false }()
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	cluster := map[string]interface{}{"objtype": "cluster", "name": "tombcluster", "resourceversion": "1"}
+	cid, _ := s.CreateEntity("cluster", cluster)
+	defer dc.DeleteEntity(cid)
+	pod := func(name string) map[string]interface{} {
+		return map[string]interface{}{"objtype": "tombsync", "name": name, "cluster": map[string]interface{}{"uid": cid}, "resourceversion": "1"}
+	}
+	uid, _ := s.CreateEntity("tombsync", pod("tombsync01"))
+	kept, _ := s.CreateEntity("tombsync", pod("tombsync02"))
+	defer dc.DeleteEntity(kept)
+	defer dc.DeleteEntity(uid)
+
+	s.SyncEntities("tombsync", []map[string]interface{}{{"objtype": "tombsync", "name": "tombsync02", "cluster": "tombcluster", "resourceversion": "2"}})
+	assert.NotNil(t, s.getObject(uid)[util.DeletedAt])
+	assert.Nil(t, s.getObject(kept)[util.DeletedAt])
+	objs, err := dc.GetAllByClusterAndType("tombsync", "tombcluster")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(objs[util.Objects].([]interface{})))
+}
+
+func TestSoftDeleteGetAndRelationships(t *testing.T) {
+	cfg.ServerCfg.SoftDelete = true
+	defer func() { cfg.ServerCfg.SoftDelete = false }()
+	dc := newTestClient()
+	defer dc.Close()
+	loadTestMetadata(t, dc)
+	s := NewEntityService(dc)
+	ns := func(name string, cluster interface{}) map[string]interface{} {
+		return map[string]interface{}{"objtype": "namespace", "name": name, "cluster": cluster, "resourceversion": "1"}
+	}
+	nid, err := s.CreateEntity("namespace", ns("tombns01", "tombcluster03"))
+	assert.Nil(t, err)
+	defer dc.DeleteEntity(nid)
+	clusterUID := func(uid string) string {
+		cluster, _ := s.getObject(uid)[util.Cluster].([]interface{})[0].(map[string]interface{})[util.UID].(string)
+		return cluster
+	}
+	cid := clusterUID(nid)
+	defer dc.DeleteEntity(cid)
+	assert.Nil(t, s.DeleteEntity(cid))
+
+	// a tombstone isn't found unless it is asked for
+	ret, err := s.GetEntity(cid)
+	assert.Nil(t, err)
+	assert.Empty(t, ret)
+	ret, err = s.GetEntity(cid, util.OptionContext{IncludeDeleted: true})
+	assert.Nil(t, err)
+	if assert.NotEmpty(t, ret) {
+		assert.NotNil(t, ret[util.Objects].([]interface{})[0].(map[string]interface{})[util.DeletedAt])
+	}
+
+	// a relationship can't point to it by uid
+	_, err = s.CreateEntity("namespace", ns("tombns02", map[string]interface{}{util.UID: cid}))
+	assert.IsType(t, &EntityError{}, err)
+	// by name it is brought back with the same uid
+	nid2, err := s.CreateEntity("namespace", ns("tombns03", "tombcluster03"))
+	assert.Nil(t, err)
+	defer dc.DeleteEntity(nid2)
+	assert.Equal(t, cid, clusterUID(nid2))
+	assert.Nil(t, s.getObject(cid)[util.DeletedAt])
+	ret, _ = s.GetEntity(cid)
+	assert.NotEmpty(t, ret)
+}
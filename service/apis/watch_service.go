@@ -0,0 +1,336 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intuit/katlas/service/util"
+)
+
+// Types of watch events
+const (
+	WatchAdded    = "ADDED"
+	WatchModified = "MODIFIED"
+	WatchDeleted  = "DELETED"
+)
+
+const (
+	// number of recent events kept to resume watches
+	watchHistorySize = 1000
+	// events buffered per watcher, a watcher falling further behind is closed and has to resume
+	watchBufferSize = 256
+)
+
+// watchHub dispatches the entity changes made through this instance to its watchers
+var watchHub = NewWatchHub(watchHistorySize)
+
+// IWatchService define interfaces to be notified of entity changes
+type IWatchService interface {
+	// watch the events matching a filter, replaying the events after the given event id if not 0
+	Watch(filter *WatchFilter, since uint64) (*Watcher, error)
+}
+
+// WatchEvent is a change of an entity
+type WatchEvent struct {
+	ID              uint64                 `json:"id"`
+	Type            string                 `json:"type"`
+	UID             string                 `json:"uid"`
+	ObjType         string                 `json:"objtype"`
+	ResourceVersion string                 `json:"resourceversion,omitempty"`
+	Cluster         string                 `json:"cluster,omitempty"`
+	Object          map[string]interface{} `json:"object"`
+}
+
+// WatchExpiredError is returned when the events after the requested event id are no longer available
+type WatchExpiredError struct {
+	ID uint64
+}
+
+func (e *WatchExpiredError) Error() string {
+	return fmt.Sprintf("events after %d are no longer available, list the entities again and watch from now", e.ID)
+}
+
+// WatchFilter selects the events sent to a watcher, empty fields match any event
+type WatchFilter struct {
+	ObjType string
+	Cluster string
+	Filter  QSLExpr
+}
+
+// NewWatchFilter creates a filter of events, filter is a QSL filter e.g. @phase="Running"
+func NewWatchFilter(objtype, cluster, filter string) (*WatchFilter, error) {
+	f := &WatchFilter{ObjType: objtype, Cluster: cluster}
+	if strings.TrimSpace(filter) != "" {
+		expr, err := ParseQSLFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		f.Filter = expr
+	}
+	return f, nil
+}
+
+// Match returns whether an event passes the filter
+func (f *WatchFilter) Match(e *WatchEvent) bool {
+	if f == nil {
+		return true
+	}
+	if f.ObjType != "" && !strings.EqualFold(f.ObjType, e.ObjType) {
+		return false
+	}
+	if f.Cluster != "" && f.Cluster != e.Cluster {
+		return false
+	}
+	return f.Filter == nil || matchQSLFilter(f.Filter, e.Object)
+}
+
+// matchQSLFilter evaluates a QSL filter against an object
+func matchQSLFilter(expr QSLExpr, obj map[string]interface{}) bool {
+	switch e := expr.(type) {
+	case *QSLNot:
+		return !matchQSLFilter(e.Operand, obj)
+	case *QSLLogical:
+		// stop at the first operand deciding the result, false for and, true for or
+		and := e.Operator == "and"
+		for _, operand := range e.Operands {
+			if matchQSLFilter(operand, obj) != and {
+				return !and
+			}
+		}
+		return and
+	case *QSLCondition:
+		return matchQSLCondition(e, obj)
+	}
+	return false
+}
+
+func matchQSLCondition(c *QSLCondition, obj map[string]interface{}) bool {
+	v, ok := obj[c.Field]
+	switch {
+	case c.Count:
+		n := 0
+		switch rel := v.(type) {
+		case []interface{}:
+			n = len(rel)
+		case map[string]interface{}:
+			n = 1
+		}
+		return compareWatchValue(strconv.Itoa(n), c.Operator, c.Value.Text)
+	case !ok || v == nil:
+		// a missing field is only different from any value
+		return c.Operator == "!="
+	case c.JSONKey != "":
+		var m map[string]interface{}
+		if s, ok := v.(string); ok {
+			json.Unmarshal([]byte(s), &m)
+		} else {
+			m, _ = v.(map[string]interface{})
+		}
+		val, ok := m[c.JSONKey]
+		return ok && compareWatchValue(fmt.Sprint(val), c.Operator, c.Value.Text)
+	}
+	// relationships are compared by the name of the objects they point to
+	switch rel := v.(type) {
+	case map[string]interface{}:
+		v = rel[util.Name]
+	case []interface{}:
+		for _, item := range rel {
+			if m, ok := item.(map[string]interface{}); ok {
+				item = m[util.Name]
+			}
+			if compareWatchValue(fmt.Sprint(item), c.Operator, c.Value.Text) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareWatchValue(fmt.Sprint(v), c.Operator, c.Value.Text)
+}
+
+// compareWatchValue compares values as numbers when both are numbers, as strings otherwise
+func compareWatchValue(v string, op string, expected string) bool {
+	if op == "~=" {
+		re, err := regexp.Compile(expected)
+		return err == nil && re.MatchString(v)
+	}
+	cmp := strings.Compare(v, expected)
+	if a, err := strconv.ParseFloat(v, 64); err == nil {
+		if b, err := strconv.ParseFloat(expected, 64); err == nil {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+	}
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Watcher receives the events matching its filter until it is closed
+type Watcher struct {
+	// Events is closed when the watcher is closed or falls too far behind
+	Events <-chan *WatchEvent
+	events chan *WatchEvent
+	filter *WatchFilter
+	hub    *WatchHub
+}
+
+// Close stops the watcher
+func (w *Watcher) Close() {
+	w.hub.remove(w)
+}
+
+// WatchHub keeps the recent events and dispatches new events to watchers
+type WatchHub struct {
+	mu       sync.Mutex
+	nextID   uint64
+	history  []*WatchEvent
+	size     int
+	watchers map[*Watcher]bool
+}
+
+// NewWatchHub creates a hub keeping the given number of events to resume watches
+// event ids start from the time the hub is created so ids from before a restart are detected
+func NewWatchHub(size int) *WatchHub {
+	return &WatchHub{
+		nextID:   uint64(time.Now().UnixNano() / int64(time.Microsecond)),
+		size:     size,
+		watchers: map[*Watcher]bool{},
+	}
+}
+
+// Publish assigns the next id to an event and sends it to the matching watchers
+func (h *WatchHub) Publish(e *WatchEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e.ID = h.nextID
+	h.nextID++
+	h.history = append(h.history, e)
+	if len(h.history) > h.size {
+		h.history = h.history[len(h.history)-h.size:]
+	}
+	for w := range h.watchers {
+		if !w.filter.Match(e) {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			delete(h.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+// Watch registers a watcher, the events after since are sent first when since is not 0
+func (h *WatchHub) Watch(filter *WatchFilter, since uint64) (*Watcher, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	replay := []*WatchEvent{}
+	if since != 0 {
+		// since must be the last event or one still in the history
+		oldest := h.nextID
+		if len(h.history) > 0 {
+			oldest = h.history[0].ID
+		}
+		if since+1 < oldest || since >= h.nextID {
+			return nil, &WatchExpiredError{ID: since}
+		}
+		for _, e := range h.history {
+			if e.ID > since && filter.Match(e) {
+				replay = append(replay, e)
+			}
+		}
+	}
+	events := make(chan *WatchEvent, len(replay)+watchBufferSize)
+	for _, e := range replay {
+		events <- e
+	}
+	w := &Watcher{Events: events, events: events, filter: filter, hub: h}
+	h.watchers[w] = true
+	return w, nil
+}
+
+func (h *WatchHub) remove(w *Watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.watchers[w] {
+		delete(h.watchers, w)
+		close(w.events)
+	}
+}
+
+// WatchService implements IWatchService for the entity changes made through this instance
+type WatchService struct {
+	hub *WatchHub
+}
+
+// NewWatchService creates a new WatchService
+func NewWatchService() *WatchService {
+	return &WatchService{watchHub}
+}
+
+// Watch returns a watcher of the entity changes matching the filter
+// the events after since are replayed first, a *WatchExpiredError is returned if they are no longer available
+func (s WatchService) Watch(filter *WatchFilter, since uint64) (*Watcher, error) {
+	return s.hub.Watch(filter, since)
+}
+
+// publishEntityEvent sends the change of an entity to the watchers
+func publishEntityEvent(typ string, uid string, meta string, obj map[string]interface{}, cluster interface{}) *WatchEvent {
+	e := &WatchEvent{Type: typ, UID: uid, ObjType: meta, Object: map[string]interface{}{}}
+	for k, v := range obj {
+		e.Object[k] = v
+	}
+	e.Object[util.UID] = uid
+	if objtype, ok := obj[util.ObjType].(string); ok {
+		e.ObjType = objtype
+	}
+	if v, ok := obj[util.ResourceVersion]; ok && v != nil {
+		e.ResourceVersion = fmt.Sprint(v)
+	}
+	if cluster == nil {
+		cluster = obj[util.Cluster]
+	}
+	e.Cluster = relationName(cluster)
+	watchHub.Publish(e)
+	return e
+}
+
+// relationName returns the name of a relationship given by name or as the object it points to
+func relationName(v interface{}) string {
+	switch rel := v.(type) {
+	case string:
+		return rel
+	case map[string]interface{}:
+		name, _ := rel[util.Name].(string)
+		return name
+	case []interface{}:
+		if len(rel) > 0 {
+			return relationName(rel[0])
+		}
+	}
+	return ""
+}
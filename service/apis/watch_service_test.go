@@ -0,0 +1,126 @@
+package apis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchFilter(t *testing.T) {
+	obj := map[string]interface{}{
+		"objtype":     "pod",
+		"name":        "web-01",
+		"phase":       "Running",
+		"numreplicas": "3",
+		"labels":      `{"app":"web"}`,
+		"nodename":    []interface{}{map[string]interface{}{"uid": "0x2", "name": "node01"}},
+	}
+	tests := map[string]bool{
+		`@phase="Running"`:                   true,
+		`@phase!="Running"`:                  false,
+		`@name~="^web"&&@numreplicas>2`:      true,
+		`@numreplicas>=10`:                   false,
+		`@phase="Pending"||@labels.$app=web`: true,
+		`!(@phase="Running")`:                false,
+		`@nodename="node01"`:                 true,
+		`@count(nodename)=1`:                 true,
+		`@ip="10.0.0.1"`:                     false,
+		`@ip!="10.0.0.1"`:                    true,
+	}
+	for filter, expected := range tests {
+		f, err := NewWatchFilter("", "", filter)
+		if assert.Nil(t, err, filter) {
+			assert.Equal(t, expected, f.Match(&WatchEvent{ObjType: "pod", Object: obj}), filter)
+		}
+	}
+
+	f, _ := NewWatchFilter("Pod", "c1", "")
+	assert.True(t, f.Match(&WatchEvent{ObjType: "pod", Cluster: "c1"}))
+	assert.False(t, f.Match(&WatchEvent{ObjType: "pod", Cluster: "c2"}))
+	assert.False(t, f.Match(&WatchEvent{ObjType: "node", Cluster: "c1"}))
+
+	_, err := NewWatchFilter("pod", "", `@phase=`)
+	assert.NotNil(t, err)
+}
+
+func TestWatchHub(t *testing.T) {
+	h := NewWatchHub(3)
+	pods, _ := NewWatchFilter("pod", "", "")
+	w, err := h.Watch(pods, 0)
+	assert.Nil(t, err)
+	for _, objtype := range []string{"pod", "node", "pod", "pod"} {
+		h.Publish(&WatchEvent{Type: WatchAdded, ObjType: objtype})
+	}
+	ids := []uint64{}
+	for i := 0; i < 3; i++ {
+		e := <-w.Events
+		assert.Equal(t, "pod", e.ObjType)
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, ids[0]+2, ids[1])
+	assert.Equal(t, ids[1]+1, ids[2])
+	w.Close()
+	_, ok := <-w.Events
+	assert.False(t, ok)
+
+	// resume after the second pod, the node event is still in the history
+	w, err = h.Watch(pods, ids[1])
+	if assert.Nil(t, err) {
+		assert.Equal(t, ids[2], (<-w.Events).ID)
+		w.Close()
+	}
+	// the first pod event is no longer in the history
+	_, err = h.Watch(pods, ids[0]-1)
+	assert.Equal(t, &WatchExpiredError{ID: ids[0] - 1}, err)
+	// ids of a previous run of the service are unknown
+	_, err = h.Watch(pods, ids[2]+1)
+	assert.NotNil(t, err)
+
+	// a watcher too far behind is closed
+	w, _ = h.Watch(nil, 0)
+	for i := 0; i <= watchBufferSize; i++ {
+		h.Publish(&WatchEvent{Type: WatchModified, ObjType: "pod"})
+	}
+	n := 0
+	for range w.Events {
+		n++
+	}
+	assert.Equal(t, watchBufferSize, n)
+}
+
+func TestWatchEntityEvents(t *testing.T) {
+	dc := newTestClient()
+	defer dc.Close()
+	s := NewEntityService(dc)
+	f, _ := NewWatchFilter("watchpod", "", `@name="watchpod01"`)
+	w, err := NewWatchService().Watch(f, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer w.Close()
+
+	uid, err := s.CreateEntity("watchpod", map[string]interface{}{"objtype": "watchpod", "name": "watchpod01", "resourceversion": "1"})
+	assert.Nil(t, err)
+	// an older version leaves the object unchanged
+	s.CreateEntity("watchpod", map[string]interface{}{"objtype": "watchpod", "name": "watchpod01", "resourceversion": "1"})
+	s.CreateEntity("watchpod", map[string]interface{}{"objtype": "watchpod", "name": "watchpod01", "resourceversion": "2"})
+	// updates increase the version
+	s.UpdateEntity(uid, map[string]interface{}{"phase": "Running"})
+	s.DeleteEntity(uid)
+
+	expected := []struct {
+		typ     string
+		version string
+	}{{WatchAdded, "1"}, {WatchModified, "2"}, {WatchModified, "3"}, {WatchDeleted, "3"}}
+	for _, ex := range expected {
+		e := <-w.Events
+		assert.Equal(t, ex.typ, e.Type)
+		assert.Equal(t, uid, e.UID)
+		assert.Equal(t, ex.version, e.ResourceVersion)
+	}
+	select {
+	case e := <-w.Events:
+		t.Errorf("unexpected event %v", e)
+	default:
+	}
+}
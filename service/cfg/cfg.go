@@ -1,12 +1,19 @@
 //Package cfg - contains all global configuration that should only be set once at the startup
 package cfg
 
-import "flag"
+import (
+	"flag"
+	"time"
+)
 
 type (
 	serverCfg struct {
-		ServerType string
-		DgraphHost string
+		ServerType         string
+		DgraphHost         string
+		StorageType        string
+		SoftDelete         bool
+		TombstoneRetention time.Duration
+		WebSocketOrigins   string
 	}
 )
 
@@ -19,4 +26,8 @@ func init() {
 
 	flag.StringVar(&ServerCfg.ServerType, "serverType", "http", "Mode the Rest Service runs in - Secure/Insecure")
 	flag.StringVar(&ServerCfg.DgraphHost, "dgraphHost", "127.0.0.1:9080", "Mode the Rest Service runs in - Secure/Insecure")
+	flag.StringVar(&ServerCfg.StorageType, "storage", "dgraph", "Storage backend of the Rest Service - dgraph/memory")
+	flag.BoolVar(&ServerCfg.SoftDelete, "softDelete", false, "Mark deleted entities with a deletedat timestamp and keep them for tombstoneRetention")
+	flag.DurationVar(&ServerCfg.TombstoneRetention, "tombstoneRetention", 7*24*time.Hour, "How long soft deleted entities are kept before they are removed")
+	flag.StringVar(&ServerCfg.WebSocketOrigins, "wsOrigins", "", "Comma separated origins of other sites allowed to watch over a WebSocket, * for any")
 }
@@ -17,15 +17,17 @@ import (
 	"google.golang.org/grpc"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 // Action as oper
 type Action int
 
+// actions of edge changes and bulk mutations
 const (
-	create Action = iota
-	update
-	delete
+	Create Action = iota
+	Update
+	Delete
 )
 
 //CacheKey - Define key name for LruCache
@@ -72,6 +74,7 @@ type IDGClient interface {
 	GetQueryResult(query string) (map[string]interface{}, error)
 	Close() error
 	ExecuteDgraphQuery(query string) (map[string]interface{}, error)
+	BulkMutate(mutations []Mutation) []MutationResult
 }
 
 // NewDGClient create client instance
@@ -167,6 +170,7 @@ func (s DGClient) CreateEntity(meta string, data map[string]interface{}) (string
 				name
 				objtype
 				resourceversion
+				deletedat
 			}
 		}
 	`, data[util.ResourceID])
@@ -195,6 +199,16 @@ func (s DGClient) CreateEntity(meta string, data map[string]interface{}) (string
 			log.Error(err, data)
 			return "", err
 		}
+		// upserting a soft deleted object brings it back
+		_, deleted := current[util.Objects].([]interface{})[0].(map[string]interface{})[util.DeletedAt]
+		if _, ok := data[util.DeletedAt]; deleted && !ok {
+			err = removePredicate(ctx, uid, util.DeletedAt, mu, txn)
+			if err != nil {
+				metrics.DgraphNumCreateEntityErr.Inc()
+				log.Error(err, data)
+				return "", err
+			}
+		}
 		data[util.UID] = uid
 	}
 	if _, ok := data[util.ResourceVersion]; !ok {
@@ -252,6 +266,43 @@ func cleanListOrEdgesFields(ctx context.Context, uuid string, data map[string]in
 	return nil
 }
 
+// removeNullFields - remove the predicates and edges set to null in data from the node
+func removeNullFields(ctx context.Context, uuid string, data map[string]interface{}, mu *api.Mutation, txn *dgo.Txn) error {
+	delMap := make(map[string]interface{})
+	for k, v := range data {
+		if v == nil {
+			delMap[k] = nil
+			delete(data, k)
+		}
+	}
+	if len(delMap) == 0 {
+		return nil
+	}
+	delMap[util.UID] = uuid
+	delJSON, _ := json.Marshal(delMap)
+	mu.DeleteJson = delJSON
+	_, err := txn.Mutate(ctx, mu)
+	mu.DeleteJson = nil
+	if err != nil {
+		metrics.DgraphNumMutationsErr.Inc()
+		return err
+	}
+	return nil
+}
+
+// removePredicate - remove a scalar predicate from a node
+func removePredicate(ctx context.Context, uuid string, pred string, mu *api.Mutation, txn *dgo.Txn) error {
+	delJSON, _ := json.Marshal(map[string]interface{}{util.UID: uuid, pred: nil})
+	mu.DeleteJson = delJSON
+	_, err := txn.Mutate(ctx, mu)
+	mu.DeleteJson = nil
+	if err != nil {
+		metrics.DgraphNumMutationsErr.Inc()
+		return err
+	}
+	return nil
+}
+
 // CreateOrDeleteEdge - create or remove edge
 func (s DGClient) CreateOrDeleteEdge(fromType string, fromUID string, toType string, toUID string, rel string, op Action) error {
 	ctx := context.Background()
@@ -270,9 +321,9 @@ func (s DGClient) CreateOrDeleteEdge(fromType string, fromUID string, toType str
 		CommitNow: true,
 	}
 	switch op {
-	case create:
+	case Create:
 		mu.SetJson = []byte(buffer.String())
-	case delete:
+	case Delete:
 		mu.DeleteJson = []byte(buffer.String())
 	default:
 		log.Debug("No operation found, skip")
@@ -288,7 +339,7 @@ func (s DGClient) CreateOrDeleteEdge(fromType string, fromUID string, toType str
 	return nil
 }
 
-// UpdateEntity - update entity
+// UpdateEntity - update entity, fields set to null are removed
 func (s DGClient) UpdateEntity(uuid string, data map[string]interface{}, option ...util.OptionContext) error {
 	data[util.UID] = uuid
 	mu := &api.Mutation{
@@ -315,12 +366,17 @@ func (s DGClient) UpdateEntity(uuid string, data map[string]interface{}, option
 		return ex
 	}
 	// check if object exist
-	if len(current[util.Objects].([]interface{})) > 0 {
+	if nodeExists(current) {
 		// new version has to larger than old
 		valid := validateResourceVersion(current, data)
 		if !valid {
 			return backoff.Permanent(fmt.Errorf("resource %s updated by others with higher version, ignore this change", uuid))
 		}
+		if err := removeNullFields(ctx, uuid, data, mu, txn); err != nil {
+			metrics.DgraphNumUpdateEntityErr.Inc()
+			log.Error(err, data)
+			return err
+		}
 		if len(option) == 0 || option[0].ReplaceListOrEdge {
 			err := cleanListOrEdgesFields(ctx, uuid, data, mu, txn)
 			if err != nil {
@@ -350,7 +406,7 @@ func (s DGClient) UpdateEntity(uuid string, data map[string]interface{}, option
 		log.Debugf("%s %s updated to version %s successfully", data[util.Name], uuid, data[util.ResourceVersion])
 		return nil
 	}
-	return backoff.Permanent(fmt.Errorf("update failed, resource %s not found", uuid))
+	return backoff.Permanent(&NotFoundError{UID: uuid})
 }
 
 // GetQueryResult - get Query Results
@@ -377,7 +433,7 @@ func (s DGClient) GetAllByClusterAndType(meta string, cluster string) (map[strin
 	q := `
 	query qry($type: string, $cluster: string) 
 	{
-  		objects (func: eq (objtype, $type)) @cascade {
+  		objects (func: eq (objtype, $type)) @filter(not has(deletedat)) @cascade {
 			uid
 			name
 			resourceid
@@ -405,9 +461,19 @@ func (s DGClient) GetAllByClusterAndType(meta string, cluster string) (map[strin
 
 //GetCacheContainsDBSchema - Get cache which contains db schema
 func (s DGClient) GetCacheContainsDBSchema() (*lru.Cache, error) {
+	return cacheDBSchema(s.GetSchemaFromDB)
+}
+
+//GetSchemaFromCache - Get db schema from cache
+func (s DGClient) GetSchemaFromCache(cache *lru.Cache) ([]*api.SchemaNode, error) {
+	return schemaFromCache(s.GetSchemaFromDB)
+}
+
+// cacheDBSchema - add db schema to the cache with given loader if not present
+func cacheDBSchema(load func() ([]*api.SchemaNode, error)) (*lru.Cache, error) {
 	//Add db schema to the cache
 	if !InitLruCacheDBSchema {
-		dbSchemaNodes, err := s.GetSchemaFromDB()
+		dbSchemaNodes, err := load()
 		if err != nil {
 			log.Errorf("err: %v", err)
 			return nil, err
@@ -418,7 +484,7 @@ func (s DGClient) GetCacheContainsDBSchema() (*lru.Cache, error) {
 		//Looks up a key's value from the cache
 		_, ok := LruCache.Get(CacheKey)
 		if !ok {
-			dbSchemaNodes, err := s.GetSchemaFromDB()
+			dbSchemaNodes, err := load()
 			if err != nil {
 				log.Errorf("err: %v", err)
 				return nil, err
@@ -429,9 +495,9 @@ func (s DGClient) GetCacheContainsDBSchema() (*lru.Cache, error) {
 	return LruCache, nil
 }
 
-//GetSchemaFromCache - Get db schema from cache
-func (s DGClient) GetSchemaFromCache(cache *lru.Cache) ([]*api.SchemaNode, error) {
-	cache, err := s.GetCacheContainsDBSchema()
+// schemaFromCache - get db schema from cache, load it with given loader when missing
+func schemaFromCache(load func() ([]*api.SchemaNode, error)) ([]*api.SchemaNode, error) {
+	cache, err := cacheDBSchema(load)
 	if err != nil {
 		log.Errorf("err: %v", err)
 		return nil, err
@@ -581,3 +647,258 @@ func validateResourceVersion(node, data map[string]interface{}) bool {
 	}
 	return true
 }
+
+// bulkBatchSize is the number of mutations committed in a single transaction
+const bulkBatchSize = 100
+
+// Mutation is a single create, update or delete of a bulk request
+// creates are upserted by resourceid, updates and deletes address the node by uid
+type Mutation struct {
+	Action Action
+	Meta   string
+	UID    string
+	Data   map[string]interface{}
+}
+
+// MutationResult is the outcome of a mutation, UID is the node created or changed
+// errors which won't go away when the mutation is retried are wrapped with backoff.Permanent
+type MutationResult struct {
+	UID string
+	Err error
+}
+
+// NotFoundError is returned when the node an update addresses doesn't exist
+type NotFoundError struct {
+	UID string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("update failed, resource %s not found", e.UID)
+}
+
+// nodeExists returns whether the result of a uid query has an entity, dgraph returns the uid even for nodes
+// which don't exist so the objtype every entity has is checked
+func nodeExists(current map[string]interface{}) bool {
+	objs, _ := current[util.Objects].([]interface{})
+	if len(objs) == 0 {
+		return false
+	}
+	obj, _ := objs[0].(map[string]interface{})
+	_, ok := obj[util.ObjType]
+	return ok
+}
+
+// bulkBatch collects the mutations of one transaction
+type bulkBatch struct {
+	txn *dgo.Txn
+	// indexes of the mutations in the batch and the uid or blank node each one changes
+	items []int
+	uids  []string
+	del   []interface{}
+	set   []interface{}
+	// nodes changed in the batch, new nodes by resourceid
+	nodes map[string]bool
+}
+
+// BulkMutate applies the mutations in order, batched in transactions of up to bulkBatchSize mutations
+// a batch is committed early when a mutation changes a node already changed in it, so the order is kept
+// a batch failing to commit is retried from its first mutation, when it keeps failing every mutation of it fails
+func (s DGClient) BulkMutate(mutations []Mutation) []MutationResult {
+	ctx := context.Background()
+	results := make([]MutationResult, len(mutations))
+	for start := 0; start < len(mutations); {
+		var next int
+		operation := func() error {
+			var err error
+			next, err = s.mutateBatch(ctx, mutations, start, results)
+			return err
+		}
+		backoff.Retry(operation, backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount))
+		start = next
+	}
+	return results
+}
+
+// mutateBatch writes the mutations from start in one transaction until the batch is full or a node would be changed twice
+// it returns the index of the first mutation left for the next batch, the data of the mutations is left unchanged for retries
+func (s DGClient) mutateBatch(ctx context.Context, mutations []Mutation, start int, results []MutationResult) (int, error) {
+	b := s.newBulkBatch()
+	i := start
+	for ; i < len(mutations); i++ {
+		m := mutations[i]
+		results[i] = MutationResult{}
+		if m.Data != nil {
+			data := make(map[string]interface{}, len(m.Data))
+			for k, v := range m.Data {
+				data[k] = v
+			}
+			m.Data = data
+		}
+		uid, current, err := b.current(ctx, m)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		key := uid
+		if m.Action == Create && current == nil {
+			key = util.ResourceID + ":" + fmt.Sprint(m.Data[util.ResourceID])
+		}
+		if b.nodes[key] || len(b.items) == bulkBatchSize {
+			break
+		}
+		switch m.Action {
+		case Create:
+			if current != nil {
+				// new version has to larger than old
+				if !validateResourceVersion(current, m.Data) {
+					results[i].UID = uid
+					continue
+				}
+				b.clean(uid, m.Data, current)
+				m.Data[util.UID] = uid
+			} else {
+				uid = "_:b" + strconv.Itoa(i)
+				m.Data[util.UID] = uid
+			}
+			if _, ok := m.Data[util.ResourceVersion]; !ok {
+				m.Data[util.ResourceVersion] = "0"
+			}
+			b.set = append(b.set, m.Data)
+		case Update:
+			if current == nil {
+				results[i].Err = backoff.Permanent(&NotFoundError{UID: m.UID})
+				continue
+			}
+			if !validateResourceVersion(current, m.Data) {
+				results[i].Err = backoff.Permanent(fmt.Errorf("resource %s updated by others with higher version, ignore this change", m.UID))
+				continue
+			}
+			b.clean(uid, m.Data, nil)
+			m.Data[util.UID] = uid
+			b.set = append(b.set, m.Data)
+		case Delete:
+			b.del = append(b.del, map[string]interface{}{util.UID: uid})
+		}
+		b.items = append(b.items, i)
+		b.uids = append(b.uids, uid)
+		b.nodes[key] = true
+	}
+	return i, s.commitBatch(ctx, b, results)
+}
+
+func (s DGClient) newBulkBatch() *bulkBatch {
+	return &bulkBatch{txn: s.dc.NewTxn(), nodes: map[string]bool{}}
+}
+
+// current reads the node a mutation changes within the transaction, nil if there is none
+func (b *bulkBatch) current(ctx context.Context, m Mutation) (string, map[string]interface{}, error) {
+	var q string
+	vars := map[string]string{}
+	switch m.Action {
+	case Create:
+		q = `query qry($rid: string) {
+			objects(func: eq(resourceid, $rid)) {
+				uid
+				resourceversion
+				deletedat
+			}
+		}`
+		vars["$rid"] = fmt.Sprint(m.Data[util.ResourceID])
+	case Update:
+		q = `query qry($uid: string) {
+			objects(func: uid($uid)) {
+				uid
+				objtype
+				resourceversion
+			}
+		}`
+		vars["$uid"] = m.UID
+	default:
+		return m.UID, nil, nil
+	}
+	resp, err := b.txn.QueryWithVars(ctx, q, vars)
+	if err != nil {
+		metrics.DgraphNumQueriesErr.Inc()
+		return "", nil, err
+	}
+	metrics.DgraphNumQueries.Inc()
+	current := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Json, &current); err != nil {
+		return "", nil, err
+	}
+	objs, _ := current[util.Objects].([]interface{})
+	if len(objs) == 0 || (m.Action == Update && !nodeExists(current)) {
+		return m.UID, nil, nil
+	}
+	uid, _ := objs[0].(map[string]interface{})[util.UID].(string)
+	return uid, current, nil
+}
+
+// clean removes the lists and edges replaced by the data and the fields set to null, and brings back a soft deleted node
+func (b *bulkBatch) clean(uid string, data map[string]interface{}, current map[string]interface{}) {
+	delMap := map[string]interface{}{}
+	for k, v := range data {
+		if v == nil {
+			// fields set to null are removed
+			delMap[k] = nil
+			delete(data, k)
+			continue
+		}
+		if kind := reflect.TypeOf(v).Kind(); kind == reflect.Map || kind == reflect.Slice {
+			delMap[k] = nil
+		}
+	}
+	if current != nil {
+		_, deleted := current[util.Objects].([]interface{})[0].(map[string]interface{})[util.DeletedAt]
+		if _, ok := data[util.DeletedAt]; deleted && !ok {
+			delMap[util.DeletedAt] = nil
+		}
+	}
+	if len(delMap) > 0 {
+		delMap[util.UID] = uid
+		b.del = append(b.del, delMap)
+	}
+}
+
+// commitBatch writes the deletes then the sets of a batch and records the uid or error of its mutations
+func (s DGClient) commitBatch(ctx context.Context, b *bulkBatch, results []MutationResult) error {
+	defer b.txn.Discard(ctx)
+	if len(b.items) == 0 {
+		return nil
+	}
+	fail := func(err error) error {
+		metrics.DgraphNumMutationsErr.Inc()
+		log.Error(err)
+		for _, i := range b.items {
+			results[i].Err = err
+		}
+		return err
+	}
+	if len(b.del) > 0 {
+		delJSON, _ := json.Marshal(b.del)
+		if _, err := b.txn.Mutate(ctx, &api.Mutation{DeleteJson: delJSON}); err != nil {
+			return fail(err)
+		}
+	}
+	var uids map[string]string
+	if len(b.set) > 0 {
+		setJSON, _ := json.Marshal(b.set)
+		resp, err := b.txn.Mutate(ctx, &api.Mutation{SetJson: setJSON})
+		if err != nil {
+			return fail(err)
+		}
+		uids = resp.Uids
+	}
+	if err := b.txn.Commit(ctx); err != nil {
+		return fail(err)
+	}
+	metrics.DgraphNumMutations.Inc()
+	for n, i := range b.items {
+		uid := b.uids[n]
+		if strings.HasPrefix(uid, "_:") {
+			uid = uids[strings.TrimPrefix(uid, "_:")]
+		}
+		results[i].UID = uid
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/cenkalti/backoff"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/stretchr/testify/assert"
 )
@@ -47,7 +48,7 @@ func TestDGClient(t *testing.T) {
 	// assert resourceid is the same as input
 	assert.Equal(t, o2["resourceid"], "unique_id_of_pod", "pod01 resourceid not the same as input")
 	// create relationship
-	client.CreateOrDeleteEdge("K8sPod", v, "K8sNode", nid, "runsOn", create)
+	client.CreateOrDeleteEdge("K8sPod", v, "K8sNode", nid, "runsOn", Create)
 	// get pod again to check rel
 	pod01, _ = client.GetEntity(v)
 	o3 := pod01["objects"].([]interface{})[0].(map[string]interface{})
@@ -64,7 +65,7 @@ func TestDGClient(t *testing.T) {
 	o4 := pod01["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, o4["status"], "Failed", "pod01 status not update to Failed")
 	// remove edges from pod01 to node01
-	client.CreateOrDeleteEdge("K8sPod", v, "K8sNode", nid, "runsOn", delete)
+	client.CreateOrDeleteEdge("K8sPod", v, "K8sNode", nid, "runsOn", Delete)
 	pod01, _ = client.GetEntity(v)
 	o5 := pod01["objects"].([]interface{})[0].(map[string]interface{})
 	val := o5["runsOn"]
@@ -73,6 +74,19 @@ func TestDGClient(t *testing.T) {
 	}
 }
 
+func TestBulkMutateUpdateMissing(t *testing.T) {
+	client := NewDGClient("127.0.0.1:9080")
+	defer client.Close()
+	// dgraph returns the uid of a node which doesn't exist, the update must not create it
+	ret := client.BulkMutate([]Mutation{{Action: Update, UID: "0xfffffff", Data: map[string]interface{}{"status": "Running"}}})
+	assert.Equal(t, 1, len(ret))
+	if assert.IsType(t, &backoff.PermanentError{}, ret[0].Err) {
+		assert.IsType(t, &NotFoundError{}, ret[0].Err.(*backoff.PermanentError).Err)
+	}
+	obj, _ := client.GetEntity("0xfffffff")
+	assert.Equal(t, 0, len(obj))
+}
+
 func TestCreateIndex(t *testing.T) {
 	client := NewDGClient("127.0.0.1:9080")
 	s := Schema{Predicate: "testindex", Type: "string", Count: true, List: true, Index: true,
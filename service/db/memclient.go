@@ -0,0 +1,598 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cenkalti/backoff"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/hashicorp/golang-lru"
+	"github.com/intuit/katlas/service/metrics"
+	"github.com/intuit/katlas/service/util"
+)
+
+// storage types supported by NewClient
+const (
+	// DgraphStorage keeps entities in a remote dgraph cluster
+	DgraphStorage = "dgraph"
+	// MemoryStorage keeps entities in process, nothing survives a restart
+	MemoryStorage = "memory"
+)
+
+// NewClient create client instance for the given storage type
+func NewClient(storage string, dgraphHost string) IDGClient {
+	if strings.EqualFold(storage, MemoryStorage) {
+		log.Info("Using in-memory storage, data will not be persisted")
+		return NewMemClient()
+	}
+	return NewDGClient(dgraphHost)
+}
+
+// memNode is a single node of the in-memory graph
+type memNode struct {
+	uid uint64
+	// scalar predicates, value is either a single value or a []interface{} list
+	preds map[string]interface{}
+	// uid predicates, targets are kept sorted like dgraph does
+	edges map[string][]uint64
+}
+
+// MemClient implements IDGClient with an in-process graph store,
+// it understands the subset of dgraph queries generated by the services
+type MemClient struct {
+	mu    *sync.RWMutex
+	next  uint64
+	nodes map[uint64]*memNode
+	// reverse index: predicate -> target uid -> source uids
+	reverse map[string]map[uint64][]uint64
+	// resourceid index: resourceid -> uids of the nodes with it, kept sorted
+	rids   map[string][]uint64
+	schema map[string]Schema
+}
+
+// NewMemClient create in-memory client instance
+func NewMemClient() *MemClient {
+	return &MemClient{
+		mu:      &sync.RWMutex{},
+		nodes:   make(map[uint64]*memNode),
+		reverse: make(map[string]map[uint64][]uint64),
+		rids:    make(map[string][]uint64),
+		schema:  make(map[string]Schema),
+	}
+}
+
+// GetEntity - get entity by uid
+func (s *MemClient) GetEntity(uuid string) (map[string]interface{}, error) {
+	q := fmt.Sprintf(`
+		{
+			objects(func: uid(%s)) {
+				uid
+				expand(_all_) {
+					uid
+					expand(_all_)
+				}
+			}
+		}
+	`, uuid)
+	m, err := s.ExecuteDgraphQuery(q)
+	if err != nil {
+		metrics.DgraphNumGetEntityErr.Inc()
+		return nil, err
+	}
+	if len(m[util.Objects].([]interface{})) > 0 {
+		// only uid return, means no record found
+		data := m[util.Objects].([]interface{})[0].(map[string]interface{})
+		if _, ok := data[util.UID]; ok && len(data) == 1 {
+			return map[string]interface{}{}, nil
+		}
+	}
+	return m, nil
+}
+
+// DeleteEntity - delete entity by uuid
+func (s *MemClient) DeleteEntity(uuid string) error {
+	id, err := parseUID(uuid)
+	if err != nil {
+		metrics.DgraphNumDeleteEntityErr.Inc()
+		metrics.DgraphNumMutationsErr.Inc()
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeNode(id)
+	metrics.DgraphNumMutations.Inc()
+	return nil
+}
+
+// CreateEntity - create entity
+func (s *MemClient) CreateEntity(meta string, data map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// check existing resource by resourceid
+	var current *memNode
+	if ids := s.rids[fmt.Sprint(data[util.ResourceID])]; len(ids) > 0 {
+		current = s.nodes[ids[0]]
+	}
+	if current != nil {
+		// new version has to larger than old
+		if !validateResourceVersion(nodeVersion(current), data) {
+			return formatUID(current.uid), nil
+		}
+		s.cleanListOrEdgesFields(current, data)
+		// upserting a soft deleted object brings it back
+		if _, ok := data[util.DeletedAt]; !ok {
+			s.removePred(current, util.DeletedAt)
+		}
+		data[util.UID] = formatUID(current.uid)
+	}
+	if _, ok := data[util.ResourceVersion]; !ok {
+		data[util.ResourceVersion] = "0"
+	}
+	uids, err := s.setJSON(data)
+	if err != nil {
+		metrics.DgraphNumCreateEntityErr.Inc()
+		metrics.DgraphNumMutationsErr.Inc()
+		log.Error(err, data)
+		return "", err
+	}
+	metrics.DgraphNumMutations.Inc()
+	log.Debugf("%s %s upsert with version %s successfully", meta, data[util.Name], data[util.ResourceVersion])
+	// return created blank node uid
+	if uid, ok := uids["A"]; ok {
+		return uid, nil
+	}
+	if uid, ok := uids["blank-0"]; ok {
+		return uid, nil
+	}
+	return data[util.UID].(string), nil
+}
+
+// CreateOrDeleteEdge - create or remove edge
+func (s *MemClient) CreateOrDeleteEdge(fromType string, fromUID string, toType string, toUID string, rel string, op Action) error {
+	from, err := parseUID(fromUID)
+	if err != nil {
+		metrics.DgraphNumMutationsErr.Inc()
+		return err
+	}
+	to, err := parseUID(toUID)
+	if err != nil {
+		metrics.DgraphNumMutationsErr.Inc()
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch op {
+	case Create:
+		s.addEdge(s.getOrCreateNode(from), rel, s.getOrCreateNode(to).uid)
+	case Delete:
+		if n, ok := s.nodes[from]; ok {
+			s.removeEdge(n, rel, to)
+		}
+	default:
+		log.Debug("No operation found, skip")
+		return nil
+	}
+	metrics.DgraphNumMutations.Inc()
+	return nil
+}
+
+// UpdateEntity - update entity, fields set to null are removed
+func (s *MemClient) UpdateEntity(uuid string, data map[string]interface{}, option ...util.OptionContext) error {
+	id, err := parseUID(uuid)
+	if err != nil {
+		metrics.DgraphNumUpdateEntityErr.Inc()
+		metrics.DgraphNumMutationsErr.Inc()
+		return backoff.Permanent(err)
+	}
+	data[util.UID] = uuid
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.nodes[id]
+	if ok {
+		// nodes only known as the target of an edge aren't entities, same as nodeExists
+		_, ok = current.preds[util.ObjType]
+	}
+	if !ok {
+		return backoff.Permanent(&NotFoundError{UID: uuid})
+	}
+	// new version has to larger than old
+	if !validateResourceVersion(nodeVersion(current), data) {
+		return backoff.Permanent(fmt.Errorf("resource %s updated by others with higher version, ignore this change", uuid))
+	}
+	s.removeNullFields(current, data)
+	if len(option) == 0 || option[0].ReplaceListOrEdge {
+		s.cleanListOrEdgesFields(current, data)
+	}
+	if _, err := s.setJSON(data); err != nil {
+		metrics.DgraphNumUpdateEntityErr.Inc()
+		metrics.DgraphNumMutationsErr.Inc()
+		log.Error(err, data)
+		return err
+	}
+	metrics.DgraphNumMutations.Inc()
+	log.Debugf("%s %s updated to version %s successfully", data[util.Name], uuid, data[util.ResourceVersion])
+	return nil
+}
+
+// BulkMutate - apply mutations in order, each one is written on its own as nothing is shared with other clients
+func (s *MemClient) BulkMutate(mutations []Mutation) []MutationResult {
+	results := make([]MutationResult, len(mutations))
+	for i, m := range mutations {
+		switch m.Action {
+		case Create:
+			if _, ok := m.Data[util.UID]; !ok {
+				m.Data[util.UID] = "_:A"
+			}
+			results[i].UID, results[i].Err = s.CreateEntity(m.Meta, m.Data)
+		case Update:
+			results[i].UID, results[i].Err = m.UID, s.UpdateEntity(m.UID, m.Data)
+		case Delete:
+			results[i].UID, results[i].Err = m.UID, s.DeleteEntity(m.UID)
+		}
+	}
+	return results
+}
+
+// GetQueryResult - get Query Results
+func (s *MemClient) GetQueryResult(query string) (map[string]interface{}, error) {
+	m, err := s.runQuery(query)
+	if err != nil {
+		log.Errorf("Query[%v] Error [%v]\n", query, err)
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetAllByClusterAndType - query to get result by filter edge
+func (s *MemClient) GetAllByClusterAndType(meta string, cluster string) (map[string]interface{}, error) {
+	q := fmt.Sprintf(`
+	{
+  		objects (func: eq (objtype, %s)) @filter(not has(deletedat)) @cascade {
+			uid
+			name
+			resourceid
+			cluster @filter (eq(name, %s)) {
+				name
+			}
+		}
+	}`, strconv.Quote(meta), strconv.Quote(cluster))
+	return s.GetQueryResult(q)
+}
+
+// GetCacheContainsDBSchema - Get cache which contains db schema
+func (s *MemClient) GetCacheContainsDBSchema() (*lru.Cache, error) {
+	return cacheDBSchema(s.GetSchemaFromDB)
+}
+
+// GetSchemaFromCache - Get db schema from cache
+func (s *MemClient) GetSchemaFromCache(cache *lru.Cache) ([]*api.SchemaNode, error) {
+	return schemaFromCache(s.GetSchemaFromDB)
+}
+
+// GetSchemaFromDB - get all predicates
+func (s *MemClient) GetSchemaFromDB() ([]*api.SchemaNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nodes := make([]*api.SchemaNode, 0, len(s.schema))
+	for _, sm := range s.schema {
+		nodes = append(nodes, &api.SchemaNode{
+			Predicate: sm.Predicate,
+			Type:      sm.Type,
+			Index:     sm.Index,
+			Tokenizer: sm.Tokenizer,
+			Reverse:   sm.Reverse,
+			Count:     sm.Count,
+			List:      sm.List,
+			Upsert:    sm.Upsert,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Predicate < nodes[j].Predicate })
+	metrics.DgraphNumQueries.Inc()
+	return nodes, nil
+}
+
+// RemoveDBSchemaFromCache - remove DBSchema key from the Cache
+func (s *MemClient) RemoveDBSchemaFromCache(cache *lru.Cache) {
+	cache.Remove(CacheKey)
+}
+
+// CreateSchema - create index
+func (s *MemClient) CreateSchema(sm Schema) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema[sm.Predicate] = sm
+	return nil
+}
+
+// DropSchema remove db schema by name, the predicate is dropped from all nodes
+func (s *MemClient) DropSchema(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.schema, name)
+	for _, n := range s.nodes {
+		s.removePred(n, name)
+		for _, to := range append([]uint64{}, n.edges[name]...) {
+			s.removeEdge(n, name, to)
+		}
+	}
+	return nil
+}
+
+// Close - nothing to release for the in-memory store
+func (s *MemClient) Close() error {
+	return nil
+}
+
+// ExecuteDgraphQuery - Takes a dgraph query as a string and executes on the in-memory store
+func (s *MemClient) ExecuteDgraphQuery(query string) (map[string]interface{}, error) {
+	m, err := s.runQuery(query)
+	if err != nil {
+		log.Errorf("query err: %#v\n", err)
+		return nil, errors.New("could not successfully execute query. Please try again later\n" + err.Error())
+	}
+	return m, nil
+}
+
+func (s *MemClient) runQuery(query string) (map[string]interface{}, error) {
+	blocks, err := parseDQL(query)
+	if err != nil {
+		metrics.DgraphNumQueriesErr.Inc()
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, err := newMemQuery(s).run(blocks)
+	if err != nil {
+		metrics.DgraphNumQueriesErr.Inc()
+		return nil, err
+	}
+	metrics.DgraphNumQueries.Inc()
+	return m, nil
+}
+
+// setJSON applies a dgraph style json set mutation and returns the uids assigned to blank nodes
+func (s *MemClient) setJSON(data map[string]interface{}) (map[string]string, error) {
+	// round trip through json so typed values (k8s structs, map[string]string...)
+	// are stored the same way dgraph would return them
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, err
+	}
+	uids := make(map[string]string)
+	blanks := 0
+	_, err = s.setObject(obj, uids, &blanks)
+	return uids, err
+}
+
+func (s *MemClient) setObject(obj map[string]interface{}, uids map[string]string, blanks *int) (uint64, error) {
+	var n *memNode
+	if v, ok := obj[util.UID]; ok {
+		ref := fmt.Sprint(v)
+		if strings.HasPrefix(ref, "_:") {
+			if uid, ok := uids[ref[2:]]; ok {
+				id, _ := parseUID(uid)
+				n = s.getOrCreateNode(id)
+			} else {
+				n = s.newNode()
+				uids[ref[2:]] = formatUID(n.uid)
+			}
+		} else {
+			id, err := parseUID(ref)
+			if err != nil {
+				return 0, err
+			}
+			n = s.getOrCreateNode(id)
+		}
+	} else {
+		n = s.newNode()
+		uids["blank-"+strconv.Itoa(*blanks)] = formatUID(n.uid)
+		*blanks++
+	}
+	for k, v := range obj {
+		if k == util.UID || v == nil {
+			continue
+		}
+		switch val := v.(type) {
+		case map[string]interface{}:
+			id, err := s.setObject(val, uids, blanks)
+			if err != nil {
+				return 0, err
+			}
+			s.addEdge(n, k, id)
+		case []interface{}:
+			for _, item := range val {
+				if child, ok := item.(map[string]interface{}); ok {
+					id, err := s.setObject(child, uids, blanks)
+					if err != nil {
+						return 0, err
+					}
+					s.addEdge(n, k, id)
+				} else if item != nil {
+					list, _ := n.preds[k].([]interface{})
+					if !containsValue(list, item) {
+						n.preds[k] = append(list, item)
+					}
+				}
+			}
+		default:
+			s.setPred(n, k, val)
+		}
+	}
+	return n.uid, nil
+}
+
+// cleanListOrEdgesFields - array and edges not able to replace, have to set them to nil and create it again
+func (s *MemClient) cleanListOrEdgesFields(n *memNode, data map[string]interface{}) {
+	for k, v := range data {
+		if v == nil {
+			continue
+		}
+		if kind := reflect.TypeOf(v).Kind(); kind == reflect.Map || kind == reflect.Slice {
+			s.removePred(n, k)
+			for _, to := range append([]uint64{}, n.edges[k]...) {
+				s.removeEdge(n, k, to)
+			}
+		}
+	}
+}
+
+// removeNullFields - remove the predicates and edges set to null in data from the node
+func (s *MemClient) removeNullFields(n *memNode, data map[string]interface{}) {
+	for k, v := range data {
+		if v != nil {
+			continue
+		}
+		s.removePred(n, k)
+		for _, to := range append([]uint64{}, n.edges[k]...) {
+			s.removeEdge(n, k, to)
+		}
+		delete(data, k)
+	}
+}
+
+func (s *MemClient) newNode() *memNode {
+	s.next++
+	n := &memNode{uid: s.next, preds: make(map[string]interface{}), edges: make(map[string][]uint64)}
+	s.nodes[n.uid] = n
+	return n
+}
+
+func (s *MemClient) getOrCreateNode(id uint64) *memNode {
+	if n, ok := s.nodes[id]; ok {
+		return n
+	}
+	n := &memNode{uid: id, preds: make(map[string]interface{}), edges: make(map[string][]uint64)}
+	s.nodes[id] = n
+	if id > s.next {
+		s.next = id
+	}
+	return n
+}
+
+// removeNode drops all predicates and outgoing edges of the node, same as a dgraph "uid * *" delete
+// edges pointing to it are kept and render with the uid only
+func (s *MemClient) removeNode(id uint64) {
+	n, ok := s.nodes[id]
+	if !ok {
+		return
+	}
+	for pred, targets := range n.edges {
+		for _, to := range append([]uint64{}, targets...) {
+			s.removeEdge(n, pred, to)
+		}
+	}
+	s.removePred(n, util.ResourceID)
+	delete(s.nodes, id)
+}
+
+func (s *MemClient) addEdge(n *memNode, pred string, to uint64) {
+	n.edges[pred] = insertUID(n.edges[pred], to)
+	if _, ok := s.reverse[pred]; !ok {
+		s.reverse[pred] = make(map[uint64][]uint64)
+	}
+	s.reverse[pred][to] = insertUID(s.reverse[pred][to], n.uid)
+}
+
+func (s *MemClient) removeEdge(n *memNode, pred string, to uint64) {
+	// empty edge lists are kept, they are treated the same as a missing predicate
+	n.edges[pred] = removeUID(n.edges[pred], to)
+	if idx, ok := s.reverse[pred]; ok {
+		idx[to] = removeUID(idx[to], n.uid)
+	}
+}
+
+// setPred sets a scalar predicate of the node and keeps the resourceid index up to date
+func (s *MemClient) setPred(n *memNode, pred string, value interface{}) {
+	if pred == util.ResourceID {
+		s.removePred(n, pred)
+		rid := fmt.Sprint(value)
+		s.rids[rid] = insertUID(s.rids[rid], n.uid)
+	}
+	n.preds[pred] = value
+}
+
+// removePred removes a scalar predicate of the node and keeps the resourceid index up to date
+func (s *MemClient) removePred(n *memNode, pred string) {
+	v, ok := n.preds[pred]
+	if !ok {
+		return
+	}
+	if pred == util.ResourceID {
+		rid := fmt.Sprint(v)
+		if ids := removeUID(s.rids[rid], n.uid); len(ids) > 0 {
+			s.rids[rid] = ids
+		} else {
+			delete(s.rids, rid)
+		}
+	}
+	delete(n.preds, pred)
+}
+
+func (s *MemClient) sortedUIDs() []uint64 {
+	ids := make([]uint64, 0, len(s.nodes))
+	for id := range s.nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// nodeVersion wraps the node's resourceversion in the shape validateResourceVersion expects
+func nodeVersion(n *memNode) map[string]interface{} {
+	obj := map[string]interface{}{}
+	if v, ok := n.preds[util.ResourceVersion]; ok {
+		obj[util.ResourceVersion] = fmt.Sprint(v)
+	}
+	return map[string]interface{}{util.Objects: []interface{}{obj}}
+}
+
+func insertUID(list []uint64, id uint64) []uint64 {
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+	if i < len(list) && list[i] == id {
+		return list
+	}
+	list = append(list, 0)
+	copy(list[i+1:], list[i:])
+	list[i] = id
+	return list
+}
+
+func removeUID(list []uint64, id uint64) []uint64 {
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+	if i < len(list) && list[i] == id {
+		return append(list[:i], list[i+1:]...)
+	}
+	return list
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseUID(uid string) (uint64, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(uid), "0x"), 16, 64)
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(uid), "0x") {
+		return 0, fmt.Errorf("invalid uid %q", uid)
+	}
+	return id, nil
+}
+
+func formatUID(id uint64) string {
+	return "0x" + strconv.FormatUint(id, 16)
+}
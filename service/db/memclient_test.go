@@ -0,0 +1,138 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemClient(t *testing.T) {
+	client := NewMemClient()
+	defer client.Close()
+	// create node and pod
+	nid, err := client.CreateEntity("K8sNode", map[string]interface{}{
+		"objtype":    "K8sNode",
+		"name":       "node01",
+		"resourceid": "node01",
+	})
+	assert.Nil(t, err)
+	pid, err := client.CreateEntity("K8sPod", map[string]interface{}{
+		"objtype":         "K8sPod",
+		"name":            "pod01",
+		"resourceid":      "unique_id_of_pod",
+		"resourceversion": "6365014",
+		"status":          "Running",
+	})
+	assert.Nil(t, err)
+	// create again with same resourceid should update existing entity
+	pid2, _ := client.CreateEntity("K8sPod", map[string]interface{}{
+		"objtype":         "K8sPod",
+		"name":            "pod01",
+		"resourceid":      "unique_id_of_pod",
+		"resourceversion": "6365015",
+		"status":          "Running",
+	})
+	assert.Equal(t, pid, pid2, "entity with same resourceid should not be created twice")
+
+	// create relationship and query both directions
+	client.CreateOrDeleteEdge("K8sPod", pid, "K8sNode", nid, "runsOn", Create)
+	pod01, _ := client.GetEntity(pid)
+	o := pod01["objects"].([]interface{})[0].(map[string]interface{})
+	rel := o["runsOn"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "node01", rel["name"], "pod01 doesn't runsOn expected node01")
+	assert.Equal(t, "6365015", o["resourceversion"], "pod01 not updated")
+
+	q := `{
+		A as var(func: eq(objtype, K8sNode)) @filter(eq(name, "node01") and not regexp(name, /node02/i)) @cascade {
+			~runsOn @filter(eq(objtype, K8sPod)) {
+				cnt as count(uid)
+			}
+		}
+		objects(func: uid(A), first: 10, offset: 0) {
+			name
+			~runsOn @filter(eq(status, "Running")) {
+				name
+			}
+		}
+	}`
+	ret, err := client.GetQueryResult(q)
+	assert.Nil(t, err)
+	objs := ret["objects"].([]interface{})
+	assert.Equal(t, 1, len(objs))
+	pods := objs[0].(map[string]interface{})["~runsOn"].([]interface{})
+	assert.Equal(t, "pod01", pods[0].(map[string]interface{})["name"])
+
+	// count query
+	ret, _ = client.GetQueryResult(`{objects(func: eq(objtype, "K8sPod")) { count(uid) }}`)
+	assert.Equal(t, float64(1), ret["objects"].([]interface{})[0].(map[string]interface{})["count"])
+
+	// order and paginate
+	client.CreateEntity("K8sPod", map[string]interface{}{"objtype": "K8sPod", "name": "pod00", "resourceid": "pod00"})
+	ret, _ = client.GetQueryResult(`{objects(func: eq(objtype, "K8sPod"), orderdesc: name, first: 1) { name }}`)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "pod01"}}, ret["objects"])
+	ret, _ = client.GetQueryResult(`{objects(func: eq(objtype, "K8sPod"), orderasc: name, first: 1) { name }}`)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "pod00"}}, ret["objects"])
+
+	// group by a predicate, nodes without it are left out
+	ret, err = client.GetQueryResult(`{
+		var(func: eq(objtype, "K8sPod")) { rv as resourceversion }
+		objects(func: eq(objtype, "K8sPod")) @groupby(status) {
+			count(uid)
+			maxrv : max(val(rv))
+		}
+	}`)
+	assert.Nil(t, err)
+	groups := ret["objects"].([]interface{})[0].(map[string]interface{})["@groupby"]
+	assert.Equal(t, []interface{}{map[string]interface{}{"status": "Running", "count": float64(1), "maxrv": "6365015"}}, groups)
+
+	// math over value variables, nodes without a value are left out
+	ret, err = client.GetQueryResult(`{
+		var(func: eq(name, "pod01")) { rv as resourceversion }
+		objects(func: eq(objtype, "K8sPod"), orderasc: name) { name next : math((rv + 1) / 2) }
+	}`)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "pod00"},
+		map[string]interface{}{"name": "pod01", "next": float64(3182508)},
+	}, ret["objects"])
+
+	// shortest path follows forward and reverse edges
+	ret, err = client.ExecuteDgraphQuery(`{
+		path as shortest(from: ` + nid + `, to: ` + pid + `, numpaths: 1, depth: 3) {
+			runsOn
+			~runsOn
+		}
+		objects(func: uid(path)) { uid name }
+	}`)
+	assert.Nil(t, err)
+	paths := ret["_path_"].([]interface{})
+	assert.Equal(t, 1, len(paths))
+	hop := paths[0].(map[string]interface{})["~runsOn"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, pid, hop["uid"])
+	assert.Equal(t, 2, len(ret["objects"].([]interface{})))
+
+	// update and remove edge
+	client.UpdateEntity(pid, map[string]interface{}{"status": "Failed"})
+	client.CreateOrDeleteEdge("K8sPod", pid, "K8sNode", nid, "runsOn", Delete)
+	pod01, _ = client.GetEntity(pid)
+	o = pod01["objects"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Failed", o["status"], "pod01 status not update to Failed")
+	assert.Nil(t, o["runsOn"], "relationship still exist after call delete edge API")
+
+	// delete entities
+	client.DeleteEntity(pid)
+	client.DeleteEntity(nid)
+	pod01, _ = client.GetEntity(pid)
+	assert.Equal(t, 0, len(pod01), "pod01 still exist after delete")
+
+	// the resourceid of a deleted entity is free again, lookups by resourceid use the index
+	pid3, err := client.CreateEntity("K8sPod", map[string]interface{}{"objtype": "K8sPod", "name": "pod01", "resourceid": "unique_id_of_pod"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, pid, pid3)
+	ret, _ = client.GetQueryResult(`{objects(func: eq(resourceid, "unique_id_of_pod")) { uid name }}`)
+	assert.Equal(t, []interface{}{map[string]interface{}{"uid": pid3, "name": "pod01"}}, ret["objects"])
+
+	// invalid query returns error
+	_, err = client.GetQueryResult(`{objects(func: eq(objtype, "K8sPod")) { name `)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,1490 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/intuit/katlas/service/util"
+)
+
+// This file contains a small interpreter for the subset of the dgraph query
+// language produced by QueryService, QSLService and EntityService, used by MemClient
+
+// dqlToken kinds
+const (
+	dqlEOF = iota
+	dqlIdent
+	dqlString
+	dqlRegex
+	dqlPunct
+)
+
+type dqlToken struct {
+	kind  int
+	value string
+	// regex flags such as i
+	flags string
+	pos   int
+}
+
+func lexDQL(q string) ([]dqlToken, error) {
+	tokens := []dqlToken{}
+	rs := []rune(q)
+	isIdent := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-~$", r)
+	}
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#':
+			// comment till end of line
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case r == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+					switch rs[j] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(rs[j])
+					}
+					continue
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, dqlToken{kind: dqlString, value: sb.String(), pos: i})
+			i = j + 1
+		case r == '/' && !afterOperand(tokens):
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '/'; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					sb.WriteRune(rs[j])
+					j++
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated regex at %d", i)
+			}
+			j++
+			k := j
+			for k < len(rs) && unicode.IsLetter(rs[k]) {
+				k++
+			}
+			tokens = append(tokens, dqlToken{kind: dqlRegex, value: sb.String(), flags: string(rs[j:k]), pos: i})
+			i = k
+		case isIdent(r):
+			j := i
+			for j < len(rs) && isIdent(rs[j]) {
+				j++
+			}
+			tokens = append(tokens, dqlToken{kind: dqlIdent, value: string(rs[i:j]), pos: i})
+			i = j
+		default:
+			tokens = append(tokens, dqlToken{kind: dqlPunct, value: string(r), pos: i})
+			i++
+		}
+	}
+	return append(tokens, dqlToken{kind: dqlEOF, pos: len(rs)}), nil
+}
+
+// afterOperand returns true when the last token ends an operand, a / following it is a division
+func afterOperand(tokens []dqlToken) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == dqlIdent || (last.kind == dqlPunct && last.value == ")")
+}
+
+// dqlArg is a function argument, either a literal or a nested function like val(x)
+type dqlArg struct {
+	kind  int
+	value string
+	flags string
+	fn    *dqlFunc
+}
+
+type dqlFunc struct {
+	name string
+	args []dqlArg
+}
+
+// dqlFilter is a boolean expression tree, op is one of and, or, not or fn
+type dqlFilter struct {
+	op       string
+	children []*dqlFilter
+	fn       *dqlFunc
+}
+
+// dqlSelection is a single entry of a selection set
+type dqlSelection struct {
+	// alias for the output key
+	alias string
+	// name of the value or uid variable defined by this selection
+	varName string
+	// pred is the predicate name, or the function name for count, val, expand and aggregations
+	pred string
+	fn   *dqlFunc
+	// child block when selection is an edge
+	block *dqlBlock
+	// math expression of the selection
+	math *dqlMath
+}
+
+// dqlMath is a node of a math() expression, leaves are value variables or numbers
+type dqlMath struct {
+	op          string
+	left, right *dqlMath
+	value       string
+}
+
+// dqlBlock is either a root query block or the child block of an edge
+type dqlBlock struct {
+	name     string
+	varName  string
+	root     *dqlFunc
+	args     map[string]string
+	order    []dqlOrder
+	filter   *dqlFilter
+	cascade  bool
+	groupBy  []string
+	children []*dqlSelection
+}
+
+// dqlOrder is an orderasc or orderdesc argument, in the order they were given
+type dqlOrder struct {
+	pred string
+	desc bool
+}
+
+// setArg records a block argument such as first, offset or orderasc
+func (b *dqlBlock) setArg(key, value string) {
+	switch key {
+	case util.OrderAsc, util.OrderDesc:
+		b.order = append(b.order, dqlOrder{pred: value, desc: key == util.OrderDesc})
+	default:
+		b.args[key] = value
+	}
+}
+
+type dqlParser struct {
+	tokens []dqlToken
+	pos    int
+}
+
+func (p *dqlParser) peek() dqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *dqlParser) next() dqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != dqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *dqlParser) isPunct(v string) bool {
+	t := p.peek()
+	return t.kind == dqlPunct && t.value == v
+}
+
+func (p *dqlParser) expect(v string) error {
+	t := p.next()
+	if t.kind != dqlPunct || t.value != v {
+		return fmt.Errorf("expected %q at %d but got %q", v, t.pos, t.value)
+	}
+	return nil
+}
+
+func (p *dqlParser) ident() (string, error) {
+	t := p.next()
+	if t.kind != dqlIdent {
+		return "", fmt.Errorf("expected name at %d but got %q", t.pos, t.value)
+	}
+	return t.value, nil
+}
+
+// parseDQL parses one or more query groups into a flat list of root blocks
+func parseDQL(q string) ([]*dqlBlock, error) {
+	tokens, err := lexDQL(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &dqlParser{tokens: tokens}
+	blocks := []*dqlBlock{}
+	for p.peek().kind != dqlEOF {
+		// skip optional query header e.g. query qry($uuid: string)
+		for !p.isPunct("{") {
+			if p.next().kind == dqlEOF {
+				return nil, fmt.Errorf("expected query block")
+			}
+		}
+		p.next()
+		for !p.isPunct("}") {
+			if p.peek().kind == dqlEOF {
+				return nil, fmt.Errorf("unexpected end of query")
+			}
+			b, err := p.parseRootBlock()
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, b)
+		}
+		p.next()
+	}
+	return blocks, nil
+}
+
+func (p *dqlParser) parseRootBlock() (*dqlBlock, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	b := &dqlBlock{args: map[string]string{}}
+	if t := p.peek(); t.kind == dqlIdent && t.value == "as" {
+		p.next()
+		b.varName = name
+		if name, err = p.ident(); err != nil {
+			return nil, err
+		}
+	}
+	b.name = name
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.isPunct(")") {
+		key, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if key == "func" {
+			if b.root, err = p.parseFunc(); err != nil {
+				return nil, err
+			}
+		} else {
+			b.setArg(key, p.next().value)
+		}
+		if p.isPunct(",") {
+			p.next()
+		}
+	}
+	p.next()
+	if b.root == nil && b.name != "shortest" {
+		return nil, fmt.Errorf("root block %s has no func", b.name)
+	}
+	if err := p.parseDirectives(b); err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		if b.children, err = p.parseSelections(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// parseDirectives reads @filter, @cascade and pagination args in any order
+func (p *dqlParser) parseDirectives(b *dqlBlock) error {
+	for {
+		switch {
+		case p.isPunct("@"):
+			p.next()
+			d, err := p.ident()
+			if err != nil {
+				return err
+			}
+			switch d {
+			case "filter":
+				if err := p.expect("("); err != nil {
+					return err
+				}
+				if b.filter, err = p.parseFilter(); err != nil {
+					return err
+				}
+				if err := p.expect(")"); err != nil {
+					return err
+				}
+			case "cascade":
+				b.cascade = true
+			case "groupby":
+				if err := p.expect("("); err != nil {
+					return err
+				}
+				for !p.isPunct(")") {
+					pred, err := p.ident()
+					if err != nil {
+						return err
+					}
+					b.groupBy = append(b.groupBy, pred)
+					if p.isPunct(",") {
+						p.next()
+					}
+				}
+				p.next()
+			case "normalize":
+			default:
+				return fmt.Errorf("unsupported directive @%s", d)
+			}
+		case p.isPunct("("):
+			p.next()
+			for !p.isPunct(")") {
+				key, err := p.ident()
+				if err != nil {
+					return err
+				}
+				if err := p.expect(":"); err != nil {
+					return err
+				}
+				b.setArg(key, p.next().value)
+				if p.isPunct(",") {
+					p.next()
+				}
+			}
+			p.next()
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *dqlParser) parseSelections() ([]*dqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	sels := []*dqlSelection{}
+	for !p.isPunct("}") {
+		if p.isPunct(",") {
+			p.next()
+			continue
+		}
+		if p.peek().kind == dqlEOF {
+			return nil, fmt.Errorf("unexpected end of selection")
+		}
+		sel := &dqlSelection{}
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if p.isPunct(":") {
+			p.next()
+			sel.alias = name
+			if name, err = p.ident(); err != nil {
+				return nil, err
+			}
+		}
+		if t := p.peek(); t.kind == dqlIdent && t.value == "as" {
+			p.next()
+			sel.varName = name
+			if name, err = p.ident(); err != nil {
+				return nil, err
+			}
+		}
+		sel.pred = name
+		if name == "math" && p.isPunct("(") {
+			p.next()
+			if sel.math, err = p.parseMath(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			sels = append(sels, sel)
+			continue
+		}
+		switch name {
+		case "count", "val", "sum", "min", "max", "avg", "expand":
+			if p.isPunct("(") {
+				p.pos--
+				if sel.fn, err = p.parseFunc(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if sel.fn == nil || name == "expand" {
+			b := &dqlBlock{name: name, args: map[string]string{}}
+			if err := p.parseDirectives(b); err != nil {
+				return nil, err
+			}
+			if p.isPunct("{") {
+				if b.children, err = p.parseSelections(); err != nil {
+					return nil, err
+				}
+				sel.block = b
+			} else if b.filter != nil || len(b.args) > 0 {
+				sel.block = b
+			}
+		}
+		sels = append(sels, sel)
+	}
+	p.next()
+	return sels, nil
+}
+
+func (p *dqlParser) parseFunc() (*dqlFunc, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	f := &dqlFunc{name: strings.ToLower(name)}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.isPunct(")") {
+		t := p.next()
+		switch t.kind {
+		case dqlIdent:
+			if p.isPunct("(") {
+				p.pos--
+				nested, err := p.parseFunc()
+				if err != nil {
+					return nil, err
+				}
+				f.args = append(f.args, dqlArg{fn: nested})
+			} else {
+				f.args = append(f.args, dqlArg{kind: dqlIdent, value: t.value})
+			}
+		case dqlString, dqlRegex:
+			f.args = append(f.args, dqlArg{kind: t.kind, value: t.value, flags: t.flags})
+		case dqlPunct:
+			if t.value != "," {
+				return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected end of function %s", name)
+		}
+	}
+	p.next()
+	return f, nil
+}
+
+// parseMath parses + and - of terms, - is lexed as an identifier
+func (p *dqlParser) parseMath() (*dqlMath, error) {
+	left, err := p.parseMathTerm()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); (t.kind == dqlPunct && t.value == "+") || (t.kind == dqlIdent && t.value == "-"); t = p.peek() {
+		p.next()
+		right, err := p.parseMathTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &dqlMath{op: t.value, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *dqlParser) parseMathTerm() (*dqlMath, error) {
+	left, err := p.parseMathFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("*") || p.isPunct("/") {
+		op := p.next().value
+		right, err := p.parseMathFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &dqlMath{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *dqlParser) parseMathFactor() (*dqlMath, error) {
+	if p.isPunct("(") {
+		p.next()
+		e, err := p.parseMath()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	t := p.next()
+	if t.kind != dqlIdent {
+		return nil, fmt.Errorf("unexpected %q in math at %d", t.value, t.pos)
+	}
+	return &dqlMath{value: t.value}, nil
+}
+
+// parseFilter parses or-expressions, and binds tighter than or
+func (p *dqlParser) parseFilter() (*dqlFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != dqlIdent || !strings.EqualFold(t.value, "or") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &dqlFilter{op: "or", children: []*dqlFilter{left, right}}
+	}
+}
+
+func (p *dqlParser) parseAnd() (*dqlFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != dqlIdent || !strings.EqualFold(t.value, "and") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &dqlFilter{op: "and", children: []*dqlFilter{left, right}}
+	}
+}
+
+func (p *dqlParser) parseUnary() (*dqlFilter, error) {
+	t := p.peek()
+	if t.kind == dqlIdent && strings.EqualFold(t.value, "not") {
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &dqlFilter{op: "not", children: []*dqlFilter{child}}, nil
+	}
+	if p.isPunct("(") {
+		p.next()
+		f, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+	fn, err := p.parseFunc()
+	if err != nil {
+		return nil, err
+	}
+	return &dqlFilter{op: "fn", fn: fn}, nil
+}
+
+// memQuery evaluates parsed blocks against the store, caller must hold the read lock
+type memQuery struct {
+	store   *MemClient
+	uidVars map[string][]uint64
+	valVars map[string]map[uint64]interface{}
+}
+
+func newMemQuery(s *MemClient) *memQuery {
+	return &memQuery{store: s, uidVars: map[string][]uint64{}, valVars: map[string]map[uint64]interface{}{}}
+}
+
+func (q *memQuery) run(blocks []*dqlBlock) (map[string]interface{}, error) {
+	// evaluate blocks once the variables they use are defined
+	defined := map[string]bool{}
+	for _, b := range blocks {
+		for v := range blockDefines(b) {
+			defined[v] = true
+		}
+	}
+	done := make([]bool, len(blocks))
+	results := make([][]interface{}, len(blocks))
+	for remaining := len(blocks); remaining > 0; {
+		progress := false
+		for i, b := range blocks {
+			if done[i] {
+				continue
+			}
+			ready := true
+			own := blockDefines(b)
+			for v := range blockUses(b) {
+				if defined[v] && !own[v] && !q.isDefined(v) {
+					ready = false
+				}
+			}
+			if !ready {
+				continue
+			}
+			res, err := q.evalRoot(b)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = res
+			done[i] = true
+			remaining--
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("cyclic dependency between query variables")
+		}
+	}
+	out := map[string]interface{}{}
+	for i, b := range blocks {
+		switch b.name {
+		case "var":
+		case "shortest":
+			if len(results[i]) > 0 {
+				out["_path_"] = results[i]
+			}
+		default:
+			out[b.name] = results[i]
+		}
+	}
+	return out, nil
+}
+
+func (q *memQuery) isDefined(v string) bool {
+	if _, ok := q.uidVars[v]; ok {
+		return true
+	}
+	_, ok := q.valVars[v]
+	return ok
+}
+
+func blockDefines(b *dqlBlock) map[string]bool {
+	vars := map[string]bool{}
+	if b.varName != "" {
+		vars[b.varName] = true
+	}
+	for _, sel := range b.children {
+		if sel.varName != "" {
+			vars[sel.varName] = true
+		}
+		if sel.block != nil {
+			for v := range blockDefines(sel.block) {
+				vars[v] = true
+			}
+		}
+	}
+	return vars
+}
+
+func blockUses(b *dqlBlock) map[string]bool {
+	vars := map[string]bool{}
+	var fromFunc func(f *dqlFunc)
+	fromFunc = func(f *dqlFunc) {
+		if f == nil {
+			return
+		}
+		for _, a := range f.args {
+			if a.fn != nil {
+				fromFunc(a.fn)
+			} else if (f.name == "uid" || f.name == "val") && a.kind == dqlIdent && !strings.HasPrefix(a.value, "0x") {
+				vars[a.value] = true
+			}
+		}
+	}
+	var fromFilter func(f *dqlFilter)
+	fromFilter = func(f *dqlFilter) {
+		if f == nil {
+			return
+		}
+		fromFunc(f.fn)
+		for _, c := range f.children {
+			fromFilter(c)
+		}
+	}
+	var fromMath func(m *dqlMath)
+	fromMath = func(m *dqlMath) {
+		if m == nil {
+			return
+		}
+		if _, err := strconv.ParseFloat(m.value, 64); m.op == "" && err != nil {
+			vars[m.value] = true
+		}
+		fromMath(m.left)
+		fromMath(m.right)
+	}
+	fromFunc(b.root)
+	fromFilter(b.filter)
+	for _, sel := range b.children {
+		fromFunc(sel.fn)
+		fromMath(sel.math)
+		if sel.block != nil {
+			for v := range blockUses(sel.block) {
+				vars[v] = true
+			}
+		}
+	}
+	return vars
+}
+
+func (q *memQuery) evalRoot(b *dqlBlock) ([]interface{}, error) {
+	if b.name == "shortest" {
+		return q.shortest(b)
+	}
+	var candidates []uint64
+	if b.root.name == "uid" {
+		ids, err := q.uidArgs(b.root)
+		if err != nil {
+			return nil, err
+		}
+		candidates = ids
+	} else if rid, ok := resourceIDArg(b.root); ok {
+		// resourceids are looked up in the index instead of matching every node
+		candidates = append(candidates, q.store.rids[rid]...)
+	} else {
+		for _, id := range q.store.sortedUIDs() {
+			ok, err := q.match(b.root, q.store.nodes[id])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+	nodes, list, err := q.evalBlock(b, candidates, b.cascade)
+	if err != nil {
+		return nil, err
+	}
+	if b.varName != "" {
+		q.uidVars[b.varName] = append(q.uidVars[b.varName], nodes...)
+	}
+	return list, nil
+}
+
+// resourceIDArg returns the resourceid of an eq(resourceid, "...") function
+func resourceIDArg(f *dqlFunc) (string, bool) {
+	if f.name != "eq" || len(f.args) != 2 || f.args[0].fn != nil || f.args[0].value != util.ResourceID || f.args[1].kind != dqlString {
+		return "", false
+	}
+	return f.args[1].value, true
+}
+
+// shortest finds up to numpaths paths of at most depth edges between the from and to uids
+// following only the predicates selected in the block, shorter paths come first
+func (q *memQuery) shortest(b *dqlBlock) ([]interface{}, error) {
+	from, err := parseUID(b.args["from"])
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseUID(b.args["to"])
+	if err != nil {
+		return nil, err
+	}
+	numPaths, depth := 1, math.MaxInt32
+	if v, ok := b.args["numpaths"]; ok {
+		if numPaths, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := b.args["depth"]; ok {
+		if depth, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	type path struct {
+		uids  []uint64
+		preds []string
+	}
+	found := []path{}
+	// breadth first over simple paths so they are found by increasing length
+	queue := []path{{uids: []uint64{from}}}
+	for len(queue) > 0 && len(found) < numPaths {
+		p := queue[0]
+		queue = queue[1:]
+		last := p.uids[len(p.uids)-1]
+		if last == to && len(p.uids) > 1 {
+			found = append(found, p)
+			continue
+		}
+		if len(p.preds) == depth {
+			continue
+		}
+		for _, sel := range b.children {
+			for _, t := range q.edgeTargets(q.node(last), sel.pred) {
+				visited := false
+				for _, id := range p.uids {
+					visited = visited || id == t
+				}
+				if visited {
+					continue
+				}
+				queue = append(queue, path{
+					uids:  append(append([]uint64{}, p.uids...), t),
+					preds: append(append([]string{}, p.preds...), sel.pred),
+				})
+			}
+		}
+	}
+	list := []interface{}{}
+	if b.varName != "" {
+		// the variable is defined even when no path is found
+		q.uidVars[b.varName] = []uint64{}
+	}
+	for _, p := range found {
+		// nest the path like dgraph, each node holds the edge to the next one
+		obj := map[string]interface{}{util.UID: formatUID(p.uids[len(p.uids)-1])}
+		for i := len(p.preds) - 1; i >= 0; i-- {
+			obj = map[string]interface{}{util.UID: formatUID(p.uids[i]), p.preds[i]: []interface{}{obj}}
+		}
+		list = append(list, obj)
+		if b.varName != "" {
+			q.uidVars[b.varName] = append(q.uidVars[b.varName], p.uids...)
+		}
+	}
+	return list, nil
+}
+
+// evalBlock filters, paginates and renders the given uids with the block selections
+func (q *memQuery) evalBlock(b *dqlBlock, ids []uint64, cascade bool) ([]uint64, []interface{}, error) {
+	filtered := []uint64{}
+	for _, id := range ids {
+		n := q.node(id)
+		if b.filter != nil {
+			ok, err := q.eval(b.filter, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		filtered = append(filtered, id)
+	}
+	q.sort(filtered, b.order)
+	filtered = paginate(filtered, b.args)
+	if len(b.groupBy) > 0 {
+		return q.group(b, filtered)
+	}
+	kept := []uint64{}
+	objs := []interface{}{}
+	hasCount := false
+	for _, sel := range b.children {
+		if sel.pred == "count" && sel.fn != nil && len(sel.fn.args) == 1 && sel.fn.args[0].value == util.UID {
+			hasCount = true
+		}
+	}
+	for _, id := range filtered {
+		obj, ok, err := q.render(q.node(id), b.children, cascade)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		kept = append(kept, id)
+		if len(obj) > 0 {
+			objs = append(objs, obj)
+		}
+	}
+	if hasCount {
+		objs = append([]interface{}{map[string]interface{}{util.Count: float64(len(kept))}}, objs...)
+	}
+	return kept, objs, nil
+}
+
+// group renders the aggregations of the block for each distinct value of its @groupby predicates
+// dgraph returns the groups as [{"@groupby": [...]}] and leaves out nodes missing a predicate
+func (q *memQuery) group(b *dqlBlock, ids []uint64) ([]uint64, []interface{}, error) {
+	keys := []string{}
+	groups := map[string][]uint64{}
+	values := map[string][]interface{}{}
+	kept := []uint64{}
+	for _, id := range ids {
+		n := q.node(id)
+		vals := make([]interface{}, len(b.groupBy))
+		parts := make([]string, len(b.groupBy))
+		missing := false
+		for i, pred := range b.groupBy {
+			v := q.values(n, pred)
+			if len(v) == 0 {
+				missing = true
+				break
+			}
+			vals[i] = v[0]
+			parts[i] = fmt.Sprintf("%v", v[0])
+		}
+		if missing {
+			continue
+		}
+		key := strings.Join(parts, "\x00")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+			values[key] = vals
+		}
+		groups[key] = append(groups[key], id)
+		kept = append(kept, id)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		for k := range b.groupBy {
+			if c, _ := compareValues(values[keys[i]][k], values[keys[j]][k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	list := []interface{}{}
+	for _, key := range keys {
+		obj := map[string]interface{}{}
+		for i, pred := range b.groupBy {
+			obj[pred] = values[key][i]
+		}
+		for _, sel := range b.children {
+			name := sel.alias
+			switch {
+			case sel.pred == "count" && sel.fn != nil && len(sel.fn.args) == 1 && sel.fn.args[0].value == util.UID:
+				if name == "" {
+					name = util.Count
+				}
+				obj[name] = float64(len(groups[key]))
+			case sel.fn != nil && sel.pred != "count" && sel.pred != "val" && sel.pred != "expand":
+				v, err := q.aggregate(sel.fn, groups[key])
+				if err != nil {
+					return nil, nil, err
+				}
+				if v == nil {
+					continue
+				}
+				if name == "" {
+					name = sel.pred + "(val(" + sel.fn.args[0].fn.args[0].value + "))"
+				}
+				obj[name] = v
+			default:
+				return nil, nil, fmt.Errorf("only aggregator/count functions allowed inside @groupby")
+			}
+		}
+		list = append(list, obj)
+	}
+	if len(list) == 0 {
+		return kept, list, nil
+	}
+	return kept, []interface{}{map[string]interface{}{"@groupby": list}}, nil
+}
+
+// render builds the output object of a node, the bool is false when cascade removes it
+func (q *memQuery) render(n *memNode, sels []*dqlSelection, cascade bool) (map[string]interface{}, bool, error) {
+	obj := map[string]interface{}{}
+	// uids visited below this node, used by aggregations over value variables
+	descendants := []uint64{}
+	aggregations := []*dqlSelection{}
+	for _, sel := range sels {
+		key := sel.alias
+		switch {
+		case sel.pred == util.UID:
+			if key == "" {
+				key = util.UID
+			}
+			obj[key] = formatUID(n.uid)
+		case sel.pred == "expand" && sel.fn != nil:
+			for k, v := range n.preds {
+				obj[k] = copyValue(v)
+			}
+			if sel.block != nil {
+				for pred, targets := range n.edges {
+					_, list, err := q.evalBlock(sel.block, targets, false)
+					if err != nil {
+						return nil, false, err
+					}
+					if len(list) > 0 {
+						obj[pred] = list
+					}
+					descendants = append(descendants, targets...)
+				}
+			}
+		case sel.pred == "count" && sel.fn != nil:
+			if len(sel.fn.args) != 1 || sel.fn.args[0].value == util.UID {
+				continue
+			}
+			pred := sel.fn.args[0].value
+			cnt := float64(len(q.values(n, pred)))
+			if key == "" {
+				key = "count(" + pred + ")"
+			}
+			obj[key] = cnt
+			q.setVal(sel.varName, n.uid, cnt)
+		case sel.pred == "val" && sel.fn != nil:
+			if len(sel.fn.args) != 1 {
+				return nil, false, fmt.Errorf("val expects one variable")
+			}
+			v, ok := q.valVars[sel.fn.args[0].value][n.uid]
+			if !ok {
+				if cascade {
+					return nil, false, nil
+				}
+				continue
+			}
+			if key == "" {
+				key = "val(" + sel.fn.args[0].value + ")"
+			}
+			obj[key] = v
+			q.setVal(sel.varName, n.uid, v)
+		case sel.math != nil:
+			v, ok := q.evalMath(sel.math, n.uid)
+			if !ok {
+				continue
+			}
+			if key == "" {
+				key = "math"
+			}
+			obj[key] = v
+			q.setVal(sel.varName, n.uid, v)
+		case sel.fn != nil:
+			aggregations = append(aggregations, sel)
+		case sel.block != nil || q.isEdge(n, sel.pred):
+			targets := q.edgeTargets(n, sel.pred)
+			if len(targets) == 0 && sel.block == nil {
+				if cascade {
+					return nil, false, nil
+				}
+				continue
+			}
+			if len(targets) == 0 {
+				if v, ok := n.preds[sel.pred]; ok {
+					// scalar predicate requested with a child block, dgraph returns the value
+					obj[sel.pred] = copyValue(v)
+					continue
+				}
+			}
+			block := sel.block
+			if block == nil {
+				block = &dqlBlock{args: map[string]string{}}
+			}
+			kept, list, err := q.evalBlock(block, targets, cascade)
+			if err != nil {
+				return nil, false, err
+			}
+			if len(kept) == 0 {
+				if cascade {
+					return nil, false, nil
+				}
+				continue
+			}
+			if sel.varName != "" {
+				q.uidVars[sel.varName] = append(q.uidVars[sel.varName], kept...)
+			}
+			descendants = append(descendants, kept...)
+			if key == "" {
+				key = sel.pred
+			}
+			if len(list) > 0 {
+				obj[key] = list
+			}
+		default:
+			v, ok := n.preds[sel.pred]
+			if !ok {
+				if cascade {
+					return nil, false, nil
+				}
+				continue
+			}
+			if key == "" {
+				key = sel.pred
+			}
+			obj[key] = copyValue(v)
+			q.setVal(sel.varName, n.uid, v)
+		}
+	}
+	for _, sel := range aggregations {
+		v, err := q.aggregate(sel.fn, descendants)
+		if err != nil {
+			return nil, false, err
+		}
+		if v == nil {
+			continue
+		}
+		key := sel.alias
+		if key == "" {
+			key = sel.pred + "(val(" + sel.fn.args[0].fn.args[0].value + "))"
+		}
+		obj[key] = v
+		q.setVal(sel.varName, n.uid, v)
+	}
+	return obj, true, nil
+}
+
+// aggregate computes sum/min/max/avg of a value variable over the given uids
+func (q *memQuery) aggregate(fn *dqlFunc, ids []uint64) (interface{}, error) {
+	if len(fn.args) != 1 || fn.args[0].fn == nil || fn.args[0].fn.name != "val" || len(fn.args[0].fn.args) != 1 {
+		return nil, fmt.Errorf("unsupported aggregation %s", fn.name)
+	}
+	vals := q.valVars[fn.args[0].fn.args[0].value]
+	var result interface{}
+	var sum float64
+	cnt := 0
+	for _, id := range ids {
+		v, ok := vals[id]
+		if !ok {
+			continue
+		}
+		cnt++
+		switch fn.name {
+		case "sum", "avg":
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("%s on non numeric value %v", fn.name, v)
+			}
+			sum += f
+		case "min":
+			if c, _ := compareValues(v, result); result == nil || c < 0 {
+				result = v
+			}
+		case "max":
+			if c, _ := compareValues(v, result); result == nil || c > 0 {
+				result = v
+			}
+		}
+	}
+	switch fn.name {
+	case "sum":
+		return sum, nil
+	case "avg":
+		if cnt == 0 {
+			return nil, nil
+		}
+		return sum / float64(cnt), nil
+	}
+	return result, nil
+}
+
+// evalMath computes a math() expression for a node, false when a variable has no value for it
+func (q *memQuery) evalMath(m *dqlMath, uid uint64) (float64, bool) {
+	if m.op == "" {
+		if f, err := strconv.ParseFloat(m.value, 64); err == nil {
+			return f, true
+		}
+		return toFloat(q.valVars[m.value][uid])
+	}
+	l, ok := q.evalMath(m.left, uid)
+	if !ok {
+		return 0, false
+	}
+	r, ok := q.evalMath(m.right, uid)
+	if !ok {
+		return 0, false
+	}
+	switch m.op {
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	}
+	if r == 0 {
+		return 0, false
+	}
+	return l / r, true
+}
+
+func (q *memQuery) setVal(name string, uid uint64, v interface{}) {
+	if name == "" {
+		return
+	}
+	if _, ok := q.valVars[name]; !ok {
+		q.valVars[name] = map[uint64]interface{}{}
+	}
+	q.valVars[name][uid] = v
+}
+
+// node returns the node for uid, or an empty node when only referenced
+func (q *memQuery) node(id uint64) *memNode {
+	if n, ok := q.store.nodes[id]; ok {
+		return n
+	}
+	return &memNode{uid: id, preds: map[string]interface{}{}, edges: map[string][]uint64{}}
+}
+
+func (q *memQuery) isEdge(n *memNode, pred string) bool {
+	if strings.HasPrefix(pred, "~") {
+		return true
+	}
+	return len(n.edges[pred]) > 0
+}
+
+func (q *memQuery) edgeTargets(n *memNode, pred string) []uint64 {
+	if strings.HasPrefix(pred, "~") {
+		return q.store.reverse[pred[1:]][n.uid]
+	}
+	return n.edges[pred]
+}
+
+// values returns all values of a scalar or edge predicate of the node
+func (q *memQuery) values(n *memNode, pred string) []interface{} {
+	if strings.HasPrefix(pred, "~") || len(n.edges[pred]) > 0 {
+		targets := q.edgeTargets(n, pred)
+		vals := make([]interface{}, len(targets))
+		for i, t := range targets {
+			vals[i] = formatUID(t)
+		}
+		return vals
+	}
+	v, ok := n.preds[pred]
+	if !ok {
+		return nil
+	}
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{v}
+}
+
+func (q *memQuery) uidArgs(f *dqlFunc) ([]uint64, error) {
+	set := map[uint64]bool{}
+	for _, a := range f.args {
+		if strings.HasPrefix(a.value, "0x") {
+			id, err := parseUID(a.value)
+			if err != nil {
+				return nil, err
+			}
+			set[id] = true
+			continue
+		}
+		for _, id := range q.uidVars[a.value] {
+			set[id] = true
+		}
+	}
+	ids := make([]uint64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (q *memQuery) eval(f *dqlFilter, n *memNode) (bool, error) {
+	switch f.op {
+	case "and":
+		for _, c := range f.children {
+			ok, err := q.eval(c, n)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case "or":
+		for _, c := range f.children {
+			ok, err := q.eval(c, n)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "not":
+		ok, err := q.eval(f.children[0], n)
+		return !ok, err
+	}
+	return q.match(f.fn, n)
+}
+
+// match evaluates a single function against a node
+func (q *memQuery) match(f *dqlFunc, n *memNode) (bool, error) {
+	switch f.name {
+	case "uid":
+		ids, err := q.uidArgs(f)
+		if err != nil {
+			return false, err
+		}
+		for _, id := range ids {
+			if id == n.uid {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "has":
+		if len(f.args) != 1 {
+			return false, fmt.Errorf("has expects one argument")
+		}
+		return len(q.values(n, f.args[0].value)) > 0, nil
+	}
+	if len(f.args) != 2 {
+		return false, fmt.Errorf("%s expects two arguments", f.name)
+	}
+	left := q.argValues(f.args[0], n)
+	if f.args[0].fn == nil {
+		left = q.values(n, f.args[0].value)
+	}
+	right := f.args[1]
+	switch f.name {
+	case "regexp":
+		if right.kind != dqlRegex {
+			return false, fmt.Errorf("regexp expects a regular expression")
+		}
+		pattern := right.value
+		if strings.Contains(right.flags, "i") {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range left {
+			if s, ok := v.(string); ok && re.MatchString(s) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "anyofterms", "allofterms":
+		terms := strings.Fields(strings.ToLower(fmt.Sprint(right.value)))
+		for _, v := range left {
+			words := map[string]bool{}
+			for _, w := range strings.Fields(strings.ToLower(fmt.Sprint(v))) {
+				words[w] = true
+			}
+			found := 0
+			for _, t := range terms {
+				if words[t] {
+					found++
+				}
+			}
+			if (f.name == "anyofterms" && found > 0) || (f.name == "allofterms" && found == len(terms) && found > 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "eq", "ge", "gt", "le", "lt":
+		rv := q.argValues(right, n)
+		if len(rv) != 1 {
+			return false, nil
+		}
+		for _, v := range left {
+			c, ok := compareValues(v, rv[0])
+			if !ok {
+				continue
+			}
+			if (f.name == "eq" && c == 0) || (f.name == "ge" && c >= 0) || (f.name == "gt" && c > 0) ||
+				(f.name == "le" && c <= 0) || (f.name == "lt" && c < 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported function %s", f.name)
+}
+
+// argValues resolves a function argument, predicates on the left side are looked up on the node
+func (q *memQuery) argValues(a dqlArg, n *memNode) []interface{} {
+	if a.fn != nil {
+		switch a.fn.name {
+		case "val":
+			if len(a.fn.args) == 1 {
+				if v, ok := q.valVars[a.fn.args[0].value][n.uid]; ok {
+					return []interface{}{v}
+				}
+			}
+		case "count":
+			if len(a.fn.args) == 1 {
+				return []interface{}{float64(len(q.values(n, a.fn.args[0].value)))}
+			}
+		}
+		return nil
+	}
+	return []interface{}{a.value}
+}
+
+// compareValues compares numbers numerically and everything else as strings
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// sort orders uids by the given predicates, nodes without the predicate come last
+func (q *memQuery) sort(ids []uint64, order []dqlOrder) {
+	if len(order) == 0 {
+		return
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		for _, o := range order {
+			a, okA := q.node(ids[i]).preds[o.pred]
+			b, okB := q.node(ids[j]).preds[o.pred]
+			if !okA || !okB {
+				if okA != okB {
+					return okA
+				}
+				continue
+			}
+			c, _ := compareValues(a, b)
+			if c != 0 {
+				return (c < 0) != o.desc
+			}
+		}
+		return false
+	})
+}
+
+func paginate(ids []uint64, args map[string]string) []uint64 {
+	if v, ok := args[util.After]; ok {
+		// ids are in uid order when paging with after
+		after, _ := parseUID(v)
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] > after })
+		ids = ids[i:]
+	}
+	if v, ok := args[util.Offset]; ok {
+		offset, _ := strconv.Atoi(v)
+		if offset >= len(ids) {
+			return []uint64{}
+		}
+		ids = ids[offset:]
+	}
+	if v, ok := args[util.First]; ok {
+		first, _ := strconv.Atoi(v)
+		if first >= 0 && first < len(ids) {
+			ids = ids[:first]
+		}
+	}
+	return ids
+}
+
+func copyValue(v interface{}) interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return append([]interface{}{}, list...)
+	}
+	return v
+}
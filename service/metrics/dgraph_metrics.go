@@ -88,6 +88,11 @@ var (
 		Name: "katlas_dgraph_num_delete_entity_err",
 		Help: "The total number of Delete Entity Requests errored in Katlas Entity Service",
 	})
+	//DgraphNumReapedEntity ...The total number of soft deleted entities removed once their retention expired
+	DgraphNumReapedEntity = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "katlas_dgraph_num_reaped_entity",
+		Help: "The total number of soft deleted entities removed once their retention expired",
+	})
 	//DgraphNumGetEntity ...The total number of Get Entity Requests processed by Katlas Entity Service
 	DgraphNumGetEntity = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "katlas_dgraph_num_get_entity",
@@ -127,4 +132,10 @@ var (
 		Help:    "Time take to handle get entity queries by the Katlas Entity Service",
 		Buckets: prometheus.ExponentialBuckets(0.0010, 2, 15),
 	}, []string{"code"})
+	//DgraphBulkEntityLatencyHistogram ...latency metric for Bulk Entity requests
+	DgraphBulkEntityLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "katlas_dgraph_bulk_entity_latency",
+		Help:    "Time take to handle bulk entity requests by the Katlas Entity Service",
+		Buckets: prometheus.ExponentialBuckets(0.0010, 2, 15),
+	}, []string{"code"})
 )
@@ -14,20 +14,22 @@ import (
 	metrics "github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
 	"github.com/mitchellh/mapstructure"
-	appsv1 "k8s.io/api/apps/v1"
-	"k8s.io/api/apps/v1beta2"
-	core_v1 "k8s.io/api/core/v1"
-	ext_v1beta1 "k8s.io/api/extensions/v1beta1"
 	"reflect"
 	"strings"
 )
 
 // ServerResource handle http request
 type ServerResource struct {
-	EntitySvc *apis.EntityService
-	QuerySvc  *apis.QueryService
-	MetaSvc   *apis.MetaService
-	QSLSvc    *apis.QSLService
+	EntitySvc     *apis.EntityService
+	QuerySvc      *apis.QueryService
+	MetaSvc       *apis.MetaService
+	QSLSvc        *apis.QSLService
+	PathSvc       *apis.PathService
+	GraphSvc      *apis.GraphService
+	SavedQuerySvc *apis.SavedQueryService
+	GraphQLSvc    *apis.GraphQLService
+	WatchSvc      *apis.WatchService
+	HistorySvc    *apis.HistoryService
 	// TODO:
 	// add metadata service, audit service and spec service after API ready
 }
@@ -47,7 +49,7 @@ func (s ServerResource) EntityGetHandler(w http.ResponseWriter, r *http.Request)
 	defer func() {
 		metrics.DgraphGetEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
-	obj, err := s.EntitySvc.GetEntity(uid)
+	obj, err := s.EntitySvc.GetEntity(uid, util.OptionContext{IncludeDeleted: r.URL.Query().Get(util.IncludeDeleted) == "true"})
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
 		metrics.KatlasNumReqErr5xx.Inc()
@@ -119,6 +121,7 @@ func (s ServerResource) MetaDeleteHandler(w http.ResponseWriter, r *http.Request
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusConflict, trim(err.Error()))))
 		return
 	}
+	s.refreshGraphQLSchema()
 	msg := map[string]interface{}{
 		"status": http.StatusOK,
 		"objects": []map[string]interface{}{
@@ -194,7 +197,7 @@ func (s ServerResource) EntityCreateHandler(w http.ResponseWriter, r *http.Reque
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
 		return
 	}
-	payload, err := buildEntityData(clusterName, meta, body, false)
+	payload, err := s.buildEntityData(clusterName, meta, body, false)
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
 		metrics.KatlasNumReqErr4xx.Inc()
@@ -212,9 +215,14 @@ func (s ServerResource) EntityCreateHandler(w http.ResponseWriter, r *http.Reque
 	uid, err := s.EntitySvc.CreateEntity(meta, payload.(map[string]interface{}))
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
 		log.Error(err)
-		code = http.StatusInternalServerError
+		if _, ok := err.(*apis.EntityError); ok {
+			metrics.KatlasNumReqErr4xx.Inc()
+			code = http.StatusBadRequest
+		} else {
+			metrics.KatlasNumReqErr5xx.Inc()
+			code = http.StatusInternalServerError
+		}
 		w.WriteHeader(code)
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
 		return
@@ -312,7 +320,7 @@ func (s ServerResource) EntitySyncHandler(w http.ResponseWriter, r *http.Request
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
 		return
 	}
-	payload, err := buildEntityData(clusterName, meta, body, true)
+	payload, err := s.buildEntityData(clusterName, meta, body, true)
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
 		metrics.KatlasNumReqErr4xx.Inc()
@@ -357,9 +365,14 @@ func (s ServerResource) QueryHandler(w http.ResponseWriter, r *http.Request) {
 
 	obj, err := s.QuerySvc.GetQueryResult(queryMap)
 	if err != nil {
-		metrics.KatlasNumReqErr5xx.Inc()
 		metrics.KatlasNumReqErr.Inc()
-		code = http.StatusInternalServerError
+		if _, ok := err.(*apis.QueryParamError); ok {
+			metrics.KatlasNumReqErr4xx.Inc()
+			code = http.StatusBadRequest
+		} else {
+			metrics.KatlasNumReqErr5xx.Inc()
+			code = http.StatusInternalServerError
+		}
 		w.WriteHeader(code)
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
 		return
@@ -435,6 +448,7 @@ func (s ServerResource) MetaCreateHandler(w http.ResponseWriter, r *http.Request
 		}
 		metrics.KatlasNumReq2xx.Inc()
 	}
+	s.refreshGraphQLSchema()
 	ret, _ := json.Marshal(msg)
 	w.Write(ret)
 }
@@ -472,6 +486,7 @@ func (s ServerResource) MetaUpdateHandler(w http.ResponseWriter, r *http.Request
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
 		return
 	}
+	s.refreshGraphQLSchema()
 	msg := map[string]interface{}{
 		"status": http.StatusOK,
 		"objects": []map[string]interface{}{
@@ -598,418 +613,65 @@ func (s ServerResource) SchemaDropHandler(w http.ResponseWriter, r *http.Request
 	metrics.KatlasNumReq2xx.Inc()
 }
 
-func buildEntityData(clusterName string, meta string, body []byte, isArray bool) (interface{}, error) {
-	switch meta {
-	case util.Namespace:
-		if isArray {
-			list := make([]map[string]interface{}, 0)
-			data := []core_v1.Namespace{}
-			err := json.Unmarshal(body, &data)
-			if err != nil {
-				return nil, err
-			}
-			for _, d := range data {
-				namespace := map[string]interface{}{
-					util.ObjType:         util.Namespace,
-					util.Name:            d.ObjectMeta.Name,
-					util.CreationTime:    d.ObjectMeta.CreationTimestamp,
-					util.Cluster:         clusterName,
-					util.ResourceVersion: d.ResourceVersion,
-					util.K8sObj:          util.K8sObj,
-					util.Labels:          d.ObjectMeta.GetLabels(),
-					util.Asset:           getValues(&data, util.AssetID, "GetAnnotations"),
-				}
-				list = append(list, namespace)
-			}
-			return list, nil
-		}
-		data := core_v1.Namespace{}
-		err := json.Unmarshal(body, &data)
-		if err != nil {
-			return nil, err
-		}
-		return map[string]interface{}{
-			util.ObjType:         util.Namespace,
-			util.Name:            data.ObjectMeta.Name,
-			util.CreationTime:    data.ObjectMeta.CreationTimestamp,
-			util.Cluster:         clusterName,
-			util.ResourceVersion: data.ResourceVersion,
-			util.K8sObj:          util.K8sObj,
-			util.Labels:          data.ObjectMeta.GetLabels(),
-			util.Asset:           getValues(&data, util.AssetID, "GetAnnotations"),
-		}, nil
-	case util.Deployment:
-		if isArray {
-			list := make([]map[string]interface{}, 0)
-			data := []v1beta2.Deployment{}
-			err := json.Unmarshal(body, &data)
-			if err != nil {
-				return nil, err
-			}
-			for _, d := range data {
-				deployment := map[string]interface{}{
-					util.ObjType:           util.Deployment,
-					util.Cluster:           clusterName,
-					util.Name:              d.ObjectMeta.Name,
-					util.CreationTime:      d.ObjectMeta.CreationTimestamp,
-					util.Namespace:         d.ObjectMeta.Namespace,
-					util.NumReplicas:       d.Spec.Replicas,
-					util.AvailableReplicas: d.Status.AvailableReplicas,
-					util.Strategy:          d.Spec.Strategy.Type,
-					util.ResourceVersion:   d.ResourceVersion,
-					util.Labels:            d.ObjectMeta.GetLabels(),
-					util.K8sObj:            util.K8sObj,
-				}
-				// creata application from labels
-				appList := createAppNameList(&d)
-				if len(appList) > 0 {
-					deployment[util.Application] = appList
-				}
-				list = append(list, deployment)
-			}
-			return list, nil
-		}
-		data := v1beta2.Deployment{}
-		err := json.Unmarshal(body, &data)
-		if err != nil {
-			return nil, err
-		}
-		deployment := map[string]interface{}{
-			util.ObjType:           util.Deployment,
-			util.Cluster:           clusterName,
-			util.Name:              data.ObjectMeta.Name,
-			util.CreationTime:      data.ObjectMeta.CreationTimestamp,
-			util.Namespace:         data.ObjectMeta.Namespace,
-			util.NumReplicas:       data.Spec.Replicas,
-			util.AvailableReplicas: data.Status.AvailableReplicas,
-			util.Strategy:          data.Spec.Strategy.Type,
-			util.ResourceVersion:   data.ResourceVersion,
-			util.Labels:            data.ObjectMeta.GetLabels(),
-			util.K8sObj:            util.K8sObj,
-		}
-		// creata application from labels
-		appList := createAppNameList(&data)
-		if len(appList) > 0 {
-			deployment[util.Application] = appList
-		}
-		return deployment, nil
-	case util.Ingress:
-		if isArray {
-			list := make([]map[string]interface{}, 0)
-			data := []ext_v1beta1.Ingress{}
-			err := json.Unmarshal(body, &data)
-			if err != nil {
-				return nil, err
-			}
-			for _, d := range data {
-				ingress := map[string]interface{}{
-					util.ObjType:         util.Ingress,
-					util.Cluster:         clusterName,
-					util.Name:            d.ObjectMeta.Name,
-					util.Namespace:       d.ObjectMeta.Namespace,
-					util.CreationTime:    d.ObjectMeta.CreationTimestamp,
-					util.DefaultBackend:  d.Spec.Backend,
-					util.TSL:             d.Spec.TLS,
-					util.Rules:           d.Spec.Rules,
-					util.ResourceVersion: d.ObjectMeta.ResourceVersion,
-					util.Labels:          d.ObjectMeta.GetLabels(),
-					util.K8sObj:          util.K8sObj,
-				}
-				// creata application from labels
-				appList := createAppNameList(&d)
-				if len(appList) > 0 {
-					ingress[util.Application] = appList
-				}
-				list = append(list, ingress)
-			}
-			return list, nil
-		}
-		data := ext_v1beta1.Ingress{}
-		err := json.Unmarshal(body, &data)
-		if err != nil {
-			return nil, err
-		}
-		ingress := map[string]interface{}{
-			util.ObjType:         util.Ingress,
-			util.Cluster:         clusterName,
-			util.Name:            data.ObjectMeta.Name,
-			util.Namespace:       data.ObjectMeta.Namespace,
-			util.CreationTime:    data.ObjectMeta.CreationTimestamp,
-			util.DefaultBackend:  data.Spec.Backend,
-			util.TSL:             data.Spec.TLS,
-			util.Rules:           data.Spec.Rules,
-			util.ResourceVersion: data.ObjectMeta.ResourceVersion,
-			util.Labels:          data.ObjectMeta.GetLabels(),
-			util.K8sObj:          util.K8sObj,
-		}
-		appList := createAppNameList(&data)
-		if len(appList) > 0 {
-			ingress[util.Application] = appList
-		}
-		return ingress, nil
-	case util.Pod:
-		if isArray {
-			list := make([]map[string]interface{}, 0)
-			data := []core_v1.Pod{}
-			err := json.Unmarshal(body, &data)
-			if err != nil {
-				return nil, err
-			}
-			for _, d := range data {
-				pod := map[string]interface{}{
-					util.ObjType:         util.Pod,
-					util.Name:            d.ObjectMeta.Name,
-					util.Namespace:       d.ObjectMeta.Namespace,
-					util.CreationTime:    d.ObjectMeta.CreationTimestamp,
-					util.Phase:           d.Status.Phase,
-					util.NodeName:        d.Spec.NodeName,
-					util.IP:              d.Status.PodIP,
-					util.Containers:      d.Spec.Containers,
-					util.Volumes:         d.Spec.Volumes,
-					util.Labels:          d.ObjectMeta.GetLabels(),
-					util.Cluster:         clusterName,
-					util.ResourceVersion: d.ObjectMeta.ResourceVersion,
-					util.K8sObj:          util.K8sObj,
-					util.StartTime:       d.Status.StartTime,
-				}
-				if len(d.ObjectMeta.OwnerReferences) > 0 {
-					pod[util.Owner] = d.ObjectMeta.OwnerReferences[0].Name
-					pod[util.OwnerType] = strings.ToLower(d.ObjectMeta.OwnerReferences[0].Kind)
-				}
-				list = append(list, pod)
-			}
-			return list, nil
-		}
-		data := core_v1.Pod{}
-		err := json.Unmarshal(body, &data)
-		if err != nil {
-			return nil, err
-		}
-		pod := map[string]interface{}{
-			util.ObjType:         util.Pod,
-			util.Name:            data.ObjectMeta.Name,
-			util.Namespace:       data.ObjectMeta.Namespace,
-			util.CreationTime:    data.ObjectMeta.CreationTimestamp,
-			util.Phase:           data.Status.Phase,
-			util.NodeName:        data.Spec.NodeName,
-			util.IP:              data.Status.PodIP,
-			util.Containers:      data.Spec.Containers,
-			util.Volumes:         data.Spec.Volumes,
-			util.Labels:          data.ObjectMeta.GetLabels(),
-			util.Cluster:         clusterName,
-			util.ResourceVersion: data.ObjectMeta.ResourceVersion,
-			util.K8sObj:          util.K8sObj,
-			util.StartTime:       data.Status.StartTime,
-		}
-		if len(data.ObjectMeta.OwnerReferences) > 0 {
-			pod[util.Owner] = data.ObjectMeta.OwnerReferences[0].Name
-			pod[util.OwnerType] = strings.ToLower(data.ObjectMeta.OwnerReferences[0].Kind)
-		}
-		return pod, nil
-	case util.ReplicaSet:
-		if isArray {
-			list := make([]map[string]interface{}, 0)
-			data := []v1beta2.ReplicaSet{}
-			err := json.Unmarshal(body, &data)
-			if err != nil {
-				return nil, err
-			}
-			for _, d := range data {
-				replicaset := map[string]interface{}{
-					util.ObjType:         util.ReplicaSet,
-					util.Name:            d.ObjectMeta.Name,
-					util.CreationTime:    d.ObjectMeta.CreationTimestamp,
-					util.Namespace:       d.ObjectMeta.Namespace,
-					util.NumReplicas:     d.Spec.Replicas,
-					util.PodSpec:         d.Spec.Template.Spec,
-					util.Owner:           d.ObjectMeta.OwnerReferences[0].Name,
-					util.Cluster:         clusterName,
-					util.ResourceVersion: d.ObjectMeta.ResourceVersion,
-					util.Labels:          d.ObjectMeta.GetLabels(),
-					util.K8sObj:          util.K8sObj,
-				}
-				list = append(list, replicaset)
-			}
-			return list, nil
-		}
-		data := v1beta2.ReplicaSet{}
-		err := json.Unmarshal(body, &data)
-		if err != nil {
+// buildEntityData converts the raw kubernetes objects of a request to entities with the jsonpath of the metadata fields
+// of their type, objects which aren't raw kubernetes objects are returned as they are
+func (s ServerResource) buildEntityData(clusterName string, meta string, body []byte, isArray bool) (interface{}, error) {
+	list := []map[string]interface{}{}
+	if isArray {
+		if err := json.Unmarshal(body, &list); err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{
-			util.ObjType:         util.ReplicaSet,
-			util.Name:            data.ObjectMeta.Name,
-			util.CreationTime:    data.ObjectMeta.CreationTimestamp,
-			util.Namespace:       data.ObjectMeta.Namespace,
-			util.NumReplicas:     data.Spec.Replicas,
-			util.PodSpec:         data.Spec.Template.Spec,
-			util.Owner:           data.ObjectMeta.OwnerReferences[0].Name,
-			util.Cluster:         clusterName,
-			util.ResourceVersion: data.ObjectMeta.ResourceVersion,
-			util.Labels:          data.ObjectMeta.GetLabels(),
-			util.K8sObj:          util.K8sObj,
-		}, nil
-	case util.Service:
-		if isArray {
-			list := make([]map[string]interface{}, 0)
-			data := []core_v1.Service{}
-			err := json.Unmarshal(body, &data)
-			if err != nil {
-				return nil, err
-			}
-			for _, d := range data {
-				service := map[string]interface{}{
-					util.ObjType:         util.Service,
-					util.Name:            d.ObjectMeta.Name,
-					util.Namespace:       d.ObjectMeta.Namespace,
-					util.CreationTime:    d.ObjectMeta.CreationTimestamp,
-					util.Selector:        d.Spec.Selector,
-					util.Labels:          d.ObjectMeta.GetLabels(),
-					util.ClusterIP:       d.Spec.ClusterIP,
-					util.ServiceType:     d.Spec.Type,
-					util.Ports:           d.Spec.Ports,
-					util.Cluster:         clusterName,
-					util.ResourceVersion: d.ObjectMeta.ResourceVersion,
-					util.K8sObj:          util.K8sObj,
-				}
-				// creata application from labels
-				appList := createAppNameList(&d)
-				if len(appList) > 0 {
-					service[util.Application] = appList
-				}
-				list = append(list, service)
-			}
-			return list, nil
-		}
-		data := core_v1.Service{}
-		err := json.Unmarshal(body, &data)
-		if err != nil {
+	} else {
+		data := map[string]interface{}{}
+		if err := json.Unmarshal(body, &data); err != nil {
 			return nil, err
 		}
-		service := map[string]interface{}{
-			util.ObjType:         util.Service,
-			util.Name:            data.ObjectMeta.Name,
-			util.Namespace:       data.ObjectMeta.Namespace,
-			util.CreationTime:    data.ObjectMeta.CreationTimestamp,
-			util.Selector:        data.Spec.Selector,
-			util.Labels:          data.ObjectMeta.GetLabels(),
-			util.ClusterIP:       data.Spec.ClusterIP,
-			util.ServiceType:     data.Spec.Type,
-			util.Ports:           data.Spec.Ports,
-			util.Cluster:         clusterName,
-			util.ResourceVersion: data.ObjectMeta.ResourceVersion,
-			util.K8sObj:          util.K8sObj,
-		}
-		// creata application from labels
-		appList := createAppNameList(&data)
-		if len(appList) > 0 {
-			service[util.Application] = appList
+		list = append(list, data)
+	}
+	var fields []apis.MetadataField
+	for i, obj := range list {
+		if !apis.IsK8sObject(meta, obj) {
+			continue
 		}
-		return service, nil
-	case util.StatefulSet:
-		if isArray {
-			list := make([]map[string]interface{}, 0)
-			data := []appsv1.StatefulSet{}
-			err := json.Unmarshal(body, &data)
-			if err != nil {
+		// the metadata is read once for all objects of the request
+		if fields == nil {
+			var err error
+			if fields, err = s.MetaSvc.GetMetadataFields(meta); err != nil {
 				return nil, err
 			}
-			for _, d := range data {
-				statefulset := map[string]interface{}{
-					util.ObjType:         util.StatefulSet,
-					util.Name:            d.ObjectMeta.Name,
-					util.CreationTime:    d.ObjectMeta.CreationTimestamp,
-					util.Namespace:       d.ObjectMeta.Namespace,
-					util.NumReplicas:     d.Spec.Replicas,
-					util.Cluster:         clusterName,
-					util.ResourceVersion: d.ObjectMeta.ResourceVersion,
-					util.Labels:          d.ObjectMeta.GetLabels(),
-					util.K8sObj:          util.K8sObj,
-				}
-				list = append(list, statefulset)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("metadata %s not found, can't map kubernetes object", meta)
 			}
-			return list, nil
-		}
-		data := appsv1.StatefulSet{}
-		err := json.Unmarshal(body, &data)
-		if err != nil {
-			return nil, err
-		}
-		return map[string]interface{}{
-			util.ObjType:         util.StatefulSet,
-			util.Name:            data.ObjectMeta.Name,
-			util.CreationTime:    data.ObjectMeta.CreationTimestamp,
-			util.Namespace:       data.ObjectMeta.Namespace,
-			util.NumReplicas:     data.Spec.Replicas,
-			util.Cluster:         clusterName,
-			util.ResourceVersion: data.ObjectMeta.ResourceVersion,
-			util.Labels:          data.ObjectMeta.GetLabels(),
-			util.K8sObj:          util.K8sObj,
-		}, nil
-	default:
-		var data interface{}
-		if isArray {
-			data = []map[string]interface{}{}
-		} else {
-			data = map[string]interface{}{}
 		}
-		err := json.Unmarshal(body, &data)
+		data, err := apis.MapK8sObject(clusterName, meta, obj, fields)
 		if err != nil {
 			return nil, err
 		}
-		return data, nil
+		list[i] = data
 	}
-}
-
-func getValues(data interface{}, key, method string) string {
-	vals := []reflect.Value{}
-	switch data.(type) {
-	case *core_v1.Service:
-		vals = reflect.ValueOf(&data.(*core_v1.Service).ObjectMeta).MethodByName(method).Call(nil)
-	case *core_v1.Namespace:
-		vals = reflect.ValueOf(&data.(*core_v1.Namespace).ObjectMeta).MethodByName(method).Call(nil)
-	case *v1beta2.Deployment:
-		vals = reflect.ValueOf(&data.(*v1beta2.Deployment).ObjectMeta).MethodByName(method).Call(nil)
-	case *ext_v1beta1.Ingress:
-		vals = reflect.ValueOf(&data.(*ext_v1beta1.Ingress).ObjectMeta).MethodByName(method).Call(nil)
-	case *core_v1.Pod:
-		vals = reflect.ValueOf(&data.(*core_v1.Pod).ObjectMeta).MethodByName(method).Call(nil)
-	case *v1beta2.ReplicaSet:
-		vals = reflect.ValueOf(&data.(*v1beta2.ReplicaSet).ObjectMeta).MethodByName(method).Call(nil)
-	case *appsv1.StatefulSet:
-		vals = reflect.ValueOf(&data.(*appsv1.StatefulSet).ObjectMeta).MethodByName(method).Call(nil)
+	if isArray {
+		return list, nil
 	}
-	if len(vals) > 0 {
-		if val, ok := vals[0].Interface().(map[string]string)[key]; ok {
-			return val
-		}
-	}
-	return ""
-}
-
-func createAppNameList(obj interface{}) []interface{} {
-	appList := make([]interface{}, 0)
-	for _, key := range []string{util.App, util.K8sApp} {
-		val := getValues(obj, key, "GetLabels")
-		if val != "" {
-			appList = append(appList, val)
-		}
-	}
-	return appList
+	return list[0], nil
 }
 
 // QSLHandler handles requests for QSL
 func (s *ServerResource) QSLHandler(w http.ResponseWriter, r *http.Request) {
+	s.qslHandler(w, r, mux.Vars(r)[util.Query])
+}
+
+// qslHandler runs the given QSL query
+func (s *ServerResource) qslHandler(w http.ResponseWriter, r *http.Request, qsl string) {
 
 	metrics.KatlasNumReqCount.Inc()
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
-	vars := mux.Vars(r)
+	// clients only paging forward with the cursor can skip the total count with count=false
+	withCount := r.URL.Query().Get(util.Count) != "false"
 
 	// get query for count only
-	query, err := s.QSLSvc.CreateDgraphQuery(vars[util.Query], true)
+	query, err := s.QSLSvc.CreateDgraphQuery(qsl, true)
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
 		if err.Error() == "Failed to connect to dgraph to get metadata" {
@@ -1023,20 +685,28 @@ func (s *ServerResource) QSLHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := s.QSLSvc.DBclient.ExecuteDgraphQuery(query)
-	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		fmt.Println(err.Error())
-		fmt.Println(trim(err.Error()))
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+	if apis.IsAsOfQuery(qsl) {
+		s.qslAsOfHandler(w, qsl)
 		return
 	}
-	total := apis.GetTotalCnt(response)
+
+	var total float64
+	if withCount {
+		response, err := s.QSLSvc.DBclient.ExecuteDgraphQuery(query)
+		if err != nil {
+			metrics.KatlasNumReqErr.Inc()
+			metrics.KatlasNumReqErr5xx.Inc()
+			fmt.Println(err.Error())
+			fmt.Println(trim(err.Error()))
+			w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+			return
+		}
+		total = apis.GetTotalCnt(response)
+	}
 
 	// get query with pagination
-	query, err = s.QSLSvc.CreateDgraphQuery(vars[util.Query], false)
-	log.Infof("dgraph query for %#v:\n %s", vars[util.Query], query)
+	query, err = s.QSLSvc.CreateDgraphQuery(qsl, false)
+	log.Infof("dgraph query for %#v:\n %s", qsl, query)
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
 		metrics.KatlasNumReqErr4xx.Inc()
@@ -1050,7 +720,7 @@ func (s *ServerResource) QSLHandler(w http.ResponseWriter, r *http.Request) {
 		metrics.KatlasQueryLatencyHistogram.WithLabelValues("katlas", "*", "None", "dev", "containers", "GET", fmt.Sprintf("%d", code), "/**").Observe(time.Since(start).Seconds())
 	}()
 
-	response, err = s.QSLSvc.DBclient.ExecuteDgraphQuery(query)
+	response, err := s.QSLSvc.DBclient.ExecuteDgraphQuery(query)
 	if err != nil {
 		metrics.DgraphNumQSLErr.Inc()
 		code = http.StatusInternalServerError
@@ -1059,8 +729,15 @@ func (s *ServerResource) QSLHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
 		return
 	}
-	log.Infof("[elapsedtime: %s]response for query %#v", time.Since(start), vars[util.Query])
-	response[util.Count] = total
+	log.Infof("[elapsedtime: %s]response for query %#v", time.Since(start), qsl)
+	apis.FlattenGroupBy(response)
+	apis.ComputeLengths(qsl, response)
+	if withCount {
+		response[util.Count] = total
+	}
+	if cursor := apis.NextCursor(qsl, response); cursor != "" {
+		response[util.Cursor] = cursor
+	}
 	response["status"] = http.StatusOK
 	ret, err := json.Marshal(response)
 	if err != nil {
@@ -0,0 +1,97 @@
+package resources
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestResource returns a resource backed by the in-memory storage with the metadata of data/meta.json
+func newTestResource(t *testing.T) ServerResource {
+	dc := db.NewMemClient()
+	metaSvc := apis.NewMetaService(dc)
+	meta, err := ioutil.ReadFile("../data/meta.json")
+	assert.Nil(t, err)
+	var metas []map[string]interface{}
+	json.Unmarshal(meta, &metas)
+	for _, m := range metas {
+		metaSvc.CreateMetadata(m)
+	}
+	return ServerResource{EntitySvc: apis.NewEntityService(dc), MetaSvc: metaSvc, QuerySvc: apis.NewQueryService(dc), WatchSvc: apis.NewWatchService()}
+}
+
+func TestEntityCreateHandlerWithoutKind(t *testing.T) {
+	res := newTestResource(t)
+	post := func(objtype string, body string) (int, map[string]interface{}) {
+		r := httptest.NewRequest("POST", "/v1.1/entity?objtype="+objtype, strings.NewReader(body))
+		r.Header.Set("clusterName", "cluster01")
+		w := httptest.NewRecorder()
+		res.EntityCreateHandlerV1_1(w, r)
+		ret := map[string]interface{}{}
+		json.Unmarshal(w.Body.Bytes(), &ret)
+		return w.Code, ret
+	}
+
+	// typed objects of the informers of existing collectors have no kind
+	code, ret := post("pod", `{"metadata": {"name": "pod01", "namespace": "default", "resourceVersion": "7"},
+		"spec": {"nodeName": "node01"}, "status": {"phase": "Running"}}`)
+	if assert.Equal(t, http.StatusOK, code, "%v", ret) {
+		uid := ret["objects"].([]interface{})[0].(map[string]interface{})["uid"].(string)
+		obj, err := res.EntitySvc.GetEntity(uid)
+		assert.Nil(t, err)
+		pod := obj["objects"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "pod01", pod["name"])
+		assert.Equal(t, "Running", pod["phase"])
+		assert.Equal(t, "pod:cluster01:default:pod01", pod["resourceid"])
+	}
+
+	// objects of other types without kind are stored as they are and need a name
+	code, ret = post("application", `{"metadata": {"name": "app01"}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "application has no name to build its resourceid", ret["error"])
+}
+
+func TestWatchWebSocket(t *testing.T) {
+	res := newTestResource(t)
+	srv := httptest.NewServer(http.HandlerFunc(res.WatchHandlerV1_1))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?objtype=pod"
+
+	// pages of other sites can't watch
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"http://example.com"}})
+	assert.NotNil(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {srv.URL}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ws.Close()
+	uid, err := res.EntitySvc.CreateEntity("pod", map[string]interface{}{"objtype": "pod", "name": "pod02", "resourceid": "pod:cluster01:default:pod02", "resourceversion": "1"})
+	assert.Nil(t, err)
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typ, data, err := ws.ReadMessage()
+	if assert.Nil(t, err) {
+		assert.Equal(t, websocket.TextMessage, typ)
+		e := apis.WatchEvent{}
+		assert.Nil(t, json.Unmarshal(data, &e))
+		assert.Equal(t, apis.WatchAdded, e.Type)
+		assert.Equal(t, uid, e.UID)
+	}
+
+	// clients have to mask their frames, the server closes the connection on an unmasked one
+	ws.UnderlyingConn().Write([]byte{0x81, 0x01, 'a'})
+	_, _, err = ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseProtocolError), "%v", err)
+}
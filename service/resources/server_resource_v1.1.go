@@ -1,19 +1,34 @@
 package resources
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/db"
 	metrics "github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // EntityGetHandlerV1_1 REST API for get Entity
+// the entity and its relationships are exported as a graph with ?export=dot, graphml or cytoscape
 func (s ServerResource) EntityGetHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	if s.writeExported(w, r, s.entityGetHandler) {
+		return
+	}
+	s.entityGetHandler(w, r)
+}
+
+// entityGetHandler returns the entity with the uid of the request and its relationships
+func (s ServerResource) entityGetHandler(w http.ResponseWriter, r *http.Request) {
 	metrics.KatlasNumReqCount.Inc()
 	//Set Access-Control-Allow-Origin header now so that it will be present
 	//even if an error is returned (otherwise the error also causes a CORS
@@ -29,7 +44,11 @@ func (s ServerResource) EntityGetHandlerV1_1(w http.ResponseWriter, r *http.Requ
 		metrics.DgraphGetEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	obj, err := s.EntitySvc.GetEntity(uid)
+	if asof := r.URL.Query().Get(util.AsOf); asof != "" {
+		s.entityAsOfHandler(w, uid, asof)
+		return
+	}
+	obj, err := s.EntitySvc.GetEntity(uid, util.OptionContext{IncludeDeleted: r.URL.Query().Get(util.IncludeDeleted) == "true"})
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
 		metrics.KatlasNumReqErr5xx.Inc()
@@ -134,7 +153,7 @@ func (s ServerResource) EntityCreateHandlerV1_1(w http.ResponseWriter, r *http.R
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
 		return
 	}
-	payload, err := buildEntityData(clusterName, meta, body, false)
+	payload, err := s.buildEntityData(clusterName, meta, body, false)
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
 		metrics.KatlasNumReqErr4xx.Inc()
@@ -153,9 +172,14 @@ func (s ServerResource) EntityCreateHandlerV1_1(w http.ResponseWriter, r *http.R
 	uid, err := s.EntitySvc.CreateEntity(meta, payload.(map[string]interface{}))
 	if err != nil {
 		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
 		log.Error(err)
-		code = http.StatusInternalServerError
+		if _, ok := err.(*apis.EntityError); ok {
+			metrics.KatlasNumReqErr4xx.Inc()
+			code = http.StatusBadRequest
+		} else {
+			metrics.KatlasNumReqErr5xx.Inc()
+			code = http.StatusInternalServerError
+		}
 		w.WriteHeader(code)
 		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
 		return
@@ -238,14 +262,73 @@ func (s ServerResource) EntityUpdateHandlerV1_1(w http.ResponseWriter, r *http.R
 	metrics.KatlasNumReq2xx.Inc()
 }
 
+// EntityPatchHandlerV1_1 REST API to update some fields of an Entity found by the resourceid of the given object
+// the object can be a partial raw kubernetes object, only the fields found in it are changed
+func (s ServerResource) EntityPatchHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	meta := r.URL.Query().Get(util.ObjType)
+	if meta == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("metadata not found from parameters"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, err := s.buildEntityData(r.Header.Get(util.ClusterName), meta, body, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	code := http.StatusOK
+	start := time.Now()
+	defer func() {
+		metrics.DgraphUpdateEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
+	}()
+
+	data := payload.(map[string]interface{})
+	uid, err := s.EntitySvc.PatchEntity(meta, data)
+	if err != nil {
+		code = http.StatusInternalServerError
+		if _, ok := err.(*apis.EntityError); ok {
+			code = http.StatusBadRequest
+		}
+		writeError(w, code, err)
+		return
+	}
+	if uid == "" {
+		code = http.StatusNotFound
+		writeError(w, code, fmt.Errorf("%s %v not found", meta, data[util.ResourceID]))
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status": code,
+		"objects": []map[string]interface{}{
+			{
+				"uid":     uid,
+				"objtype": meta,
+			},
+		},
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
 // EntitySyncHandlerV1_1 REST API to sync entities
 func (s ServerResource) EntitySyncHandlerV1_1(w http.ResponseWriter, r *http.Request) {
 	s.EntitySyncHandler(w, r)
 }
 
 // QueryHandlerV1_1 REST API for get Query Response
+// results are returned as csv, yaml or a table when asked for in the Accept header
 func (s ServerResource) QueryHandlerV1_1(w http.ResponseWriter, r *http.Request) {
-	s.QueryHandler(w, r)
+	writeFormatted(w, r, s.QueryHandler)
 }
 
 // MetaCreateHandlerV1_1 REST API for create Metadata
@@ -270,5 +353,843 @@ func (s ServerResource) SchemaDropHandlerV1_1(w http.ResponseWriter, r *http.Req
 
 // QSLHandlerV1_1 handles requests for QSL
 func (s *ServerResource) QSLHandlerV1_1(w http.ResponseWriter, r *http.Request) {
-	s.QSLHandler(w, r)
+	s.runQSL(w, r, mux.Vars(r)[util.Query])
+}
+
+// runQSL writes the result of a QSL query
+// objects are exported as a graph with ?export=dot, graphml or cytoscape, returned as csv, yaml or a table
+// when asked for in the Accept header and streamed one object per line with Accept: application/x-ndjson or ?stream=true
+func (s *ServerResource) runQSL(w http.ResponseWriter, r *http.Request, query string) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		s.qslHandler(w, r, query)
+	}
+	if s.writeExported(w, r, handler) {
+		return
+	}
+	if r.URL.Query().Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), ndjson) {
+		s.qslStreamHandler(w, r, query)
+		return
+	}
+	writeFormatted(w, r, handler)
+}
+
+// ndjson is the content type of streamed QSL results
+const ndjson = "application/x-ndjson"
+
+// qslStreamHandler writes the objects of the first block as newline delimited json, flushing every page
+// errors after the first page are written as a last line with the status and error
+func (s *ServerResource) qslStreamHandler(w http.ResponseWriter, r *http.Request, query string) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	// errors are written as a single line so the content type is the same for all responses
+	w.Header().Set("Content-Type", ndjson)
+
+	code := http.StatusOK
+	start := time.Now()
+	defer func() {
+		metrics.KatlasQueryLatencyHistogram.WithLabelValues("katlas", "*", "None", "dev", "containers", "GET", fmt.Sprintf("%d", code), "/**").Observe(time.Since(start).Seconds())
+	}()
+
+	// check the query before anything is written so errors keep their status code
+	if _, err := s.QSLSvc.CreateDgraphQuery(query, true); err != nil {
+		metrics.KatlasNumReqErr.Inc()
+		code = http.StatusBadRequest
+		if err.Error() == "Failed to connect to dgraph to get metadata" {
+			metrics.KatlasNumReqErr5xx.Inc()
+			code = http.StatusInternalServerError
+		} else {
+			metrics.KatlasNumReqErr4xx.Inc()
+		}
+		w.WriteHeader(code)
+		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}\n", code, trim(err.Error()))))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	started := false
+	err := s.QSLSvc.StreamQuery(query, func(objects []interface{}) error {
+		started = true
+		for _, obj := range objects {
+			if err := enc.Encode(obj); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DgraphNumQSLErr.Inc()
+		metrics.KatlasNumReqErr.Inc()
+		code = http.StatusInternalServerError
+		if _, ok := err.(*apis.QSLError); ok {
+			code = http.StatusBadRequest
+		}
+		if code == http.StatusBadRequest {
+			metrics.KatlasNumReqErr4xx.Inc()
+		} else {
+			metrics.KatlasNumReqErr5xx.Inc()
+		}
+		if !started {
+			w.WriteHeader(code)
+		}
+		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}\n", code, trim(err.Error()))))
+		return
+	}
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// QSLExplainHandlerV1_1 returns the dgraph queries generated for a QSL query without running them
+func (s *ServerResource) QSLExplainHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+
+	explain, err := s.QSLSvc.ExplainQuery(vars[util.Query])
+	if err != nil {
+		metrics.KatlasNumReqErr.Inc()
+		code := http.StatusBadRequest
+		if err.Error() == "Failed to connect to dgraph to get metadata" {
+			metrics.KatlasNumReqErr5xx.Inc()
+			code = http.StatusInternalServerError
+		} else {
+			metrics.KatlasNumReqErr4xx.Inc()
+		}
+		w.WriteHeader(code)
+		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status":  http.StatusOK,
+		"explain": explain,
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// PathHandlerV1_1 returns the shortest paths between two entities
+// e.g. /v1.1/path?from=0x1&to=0x2&maxdepth=5&numpaths=1
+func (s *ServerResource) PathHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	queryMap := r.URL.Query()
+
+	code := http.StatusOK
+	start := time.Now()
+	defer func() {
+		metrics.KatlasQueryLatencyHistogram.WithLabelValues("katlas", "*", "None", "dev", "containers", "GET", fmt.Sprintf("%d", code), "/**").Observe(time.Since(start).Seconds())
+	}()
+
+	from, to := queryMap.Get("from"), queryMap.Get("to")
+	maxDepth, numPaths := apis.DefaultPathDepth, 1
+	var err error
+	if v := queryMap.Get("maxdepth"); v != "" {
+		if maxDepth, err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf("maxdepth must be a number")
+		}
+	}
+	if v := queryMap.Get("numpaths"); v != "" && err == nil {
+		if numPaths, err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf("numpaths must be a number")
+		}
+	}
+	if err == nil {
+		err = apis.ValidatePathQuery(from, to, maxDepth, numPaths)
+	}
+	if err != nil {
+		metrics.KatlasNumReqErr.Inc()
+		metrics.KatlasNumReqErr4xx.Inc()
+		code = http.StatusBadRequest
+		w.WriteHeader(code)
+		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		return
+	}
+
+	paths, err := s.PathSvc.GetPaths(from, to, maxDepth, numPaths)
+	if err != nil {
+		metrics.KatlasNumReqErr.Inc()
+		metrics.KatlasNumReqErr5xx.Inc()
+		code = http.StatusInternalServerError
+		w.WriteHeader(code)
+		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status":   code,
+		util.Count: len(paths),
+		"paths":    paths,
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// SavedQueryCreateHandlerV1_1 saves a named QSL template, a query with the same name is replaced
+// e.g. {"name": "pods-in-ns", "query": "pod[@namespace=\"{{ns}}\"]{*}", "description": "pods of a namespace"}
+func (s *ServerResource) SavedQueryCreateHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	var q apis.SavedQuery
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &q)
+	}
+	if err == nil {
+		err = apis.ValidateSavedQuery(q)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	uid, err := s.SavedQuerySvc.CreateSavedQuery(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status": http.StatusOK,
+		"objects": []map[string]interface{}{
+			{
+				"uid":     uid,
+				"objtype": util.SavedQuery,
+				"name":    q.Name,
+			},
+		},
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// SavedQueryListHandlerV1_1 returns all saved queries
+func (s *ServerResource) SavedQueryListHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	queries, err := s.SavedQuerySvc.ListSavedQueries()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status":     http.StatusOK,
+		util.Count:   len(queries),
+		util.Objects: queries,
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// SavedQueryGetHandlerV1_1 returns the saved query with the given name
+func (s *ServerResource) SavedQueryGetHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+
+	q, err := s.SavedQuerySvc.GetSavedQuery(name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if q == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("saved query %s not found", name))
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status":     http.StatusOK,
+		util.Objects: []apis.SavedQuery{*q},
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// SavedQueryDeleteHandlerV1_1 removes the saved query with the given name
+func (s *ServerResource) SavedQueryDeleteHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+
+	q, err := s.SavedQuerySvc.GetSavedQuery(name)
+	if err == nil && q == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("saved query %s not found", name))
+		return
+	}
+	if err == nil {
+		err = s.SavedQuerySvc.DeleteSavedQuery(name)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("{\"status\": %v}", http.StatusOK)))
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// SavedQueryRunHandlerV1_1 fills in the placeholders of a saved query with the request parameters and runs it
+// like /v1.1/qsl, e.g. /v1.1/savedqueries/pods-in-ns/run?ns=default
+func (s *ServerResource) SavedQueryRunHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)[util.Name]
+	q, err := s.SavedQuerySvc.GetSavedQuery(name)
+	if err == nil && q == nil {
+		metrics.KatlasNumReqCount.Inc()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusNotFound, fmt.Errorf("saved query %s not found", name))
+		return
+	}
+	code := http.StatusInternalServerError
+	query := ""
+	if err == nil {
+		code = http.StatusBadRequest
+		params := map[string]string{}
+		for k, v := range r.URL.Query() {
+			params[k] = v[0]
+		}
+		query, err = apis.RenderQuery(q.Query, params)
+	}
+	if err != nil {
+		metrics.KatlasNumReqCount.Inc()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, code, err)
+		return
+	}
+	s.runQSL(w, r, query)
+}
+
+// GraphQLHandlerV1_1 REST API to query entities with GraphQL
+// the query is sent as a JSON body {"query", "operationName", "variables"}, an application/graphql body
+// or with GET parameters of the same names
+func (s *ServerResource) GraphQLHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	req, err := graphQLRequest(r)
+	if err != nil {
+		writeGraphQLErrors(w, &apis.GraphQLError{Message: err.Error()})
+		return
+	}
+	data, err := s.GraphQLSvc.Execute(req)
+	if err != nil {
+		if gqlErr, ok := err.(*apis.GraphQLError); ok {
+			writeGraphQLErrors(w, gqlErr)
+			return
+		}
+		log.Error(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ret, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(ret)
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// GraphQLSchemaHandlerV1_1 REST API to get the GraphQL schema generated from metadata
+func (s *ServerResource) GraphQLSchemaHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	schema, err := s.GraphQLSvc.Schema()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(schema.SDL()))
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// graphQLRequest reads a GraphQL request from the parameters or the body of a request
+func graphQLRequest(r *http.Request) (apis.GraphQLRequest, error) {
+	req := apis.GraphQLRequest{}
+	if r.Method == http.MethodGet {
+		params := r.URL.Query()
+		req.Query = params.Get(util.Query)
+		req.OperationName = params.Get("operationName")
+		if v := params.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, fmt.Errorf("variables must be a JSON object")
+			}
+		}
+	} else {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return req, err
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, &req); err != nil {
+			return req, fmt.Errorf("request body must be a JSON object with a query")
+		}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return req, fmt.Errorf("query is missing")
+	}
+	return req, nil
+}
+
+// writeGraphQLErrors writes the errors of an invalid GraphQL request
+func writeGraphQLErrors(w http.ResponseWriter, errs ...*apis.GraphQLError) {
+	metrics.KatlasNumReqErr.Inc()
+	metrics.KatlasNumReqErr4xx.Inc()
+	w.WriteHeader(http.StatusBadRequest)
+	ret, _ := json.Marshal(map[string]interface{}{"errors": errs})
+	w.Write(ret)
+}
+
+// refreshGraphQLSchema regenerates the GraphQL schema after metadata changed
+func (s ServerResource) refreshGraphQLSchema() {
+	if s.GraphQLSvc == nil {
+		return
+	}
+	if err := s.GraphQLSvc.Refresh(); err != nil {
+		log.Warnf("failed to refresh GraphQL schema: %v", err)
+	}
+}
+
+// EntityHistoryHandlerV1_1 REST API for the changes of an entity, oldest first
+func (s *ServerResource) EntityHistoryHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	uid := mux.Vars(r)[util.UID]
+
+	entries, err := s.HistorySvc.GetHistory(uid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status":     http.StatusOK,
+		util.Objects: entries,
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// entityAsOfHandler returns an entity as it was at the time given by asof
+func (s ServerResource) entityAsOfHandler(w http.ResponseWriter, uid string, asof string) {
+	t, err := apis.ParseAsOf(asof)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	obj, err := s.HistorySvc.GetEntityAsOf(uid, t)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if obj == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("entity with id %s didn't exist at %s", uid, asof))
+		return
+	}
+	ret, _ := json.Marshal(map[string]interface{}{
+		"status":     http.StatusOK,
+		util.Objects: []interface{}{obj},
+	})
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// qslAsOfHandler returns the result of a query read from the history of entities with $$asof
+func (s *ServerResource) qslAsOfHandler(w http.ResponseWriter, qsl string) {
+	response, err := s.QSLSvc.QueryAsOf(qsl)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if _, ok := err.(*apis.QSLError); ok {
+			code = http.StatusBadRequest
+		}
+		writeError(w, code, err)
+		return
+	}
+	response["status"] = http.StatusOK
+	ret, _ := json.Marshal(response)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// watchHeartbeat is the interval of the messages keeping idle watch connections open
+var watchHeartbeat = 30 * time.Second
+
+// WatchHandlerV1_1 REST API streaming entity changes as server-sent events, or over a WebSocket when the request upgrades
+// events can be filtered by objtype, cluster and a QSL filter, and resumed after the event id given by since or Last-Event-ID
+func (s *ServerResource) WatchHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.URL.Query()
+	filter, err := apis.NewWatchFilter(params.Get(util.ObjType), params.Get(util.Cluster), params.Get("filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	since := params.Get("since")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		since = id
+	}
+	var from uint64
+	if since != "" {
+		if from, err = strconv.ParseUint(since, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("since must be the id of an event"))
+			return
+		}
+	}
+	watcher, err := s.WatchSvc.Watch(filter, from)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if _, ok := err.(*apis.WatchExpiredError); ok {
+			code = http.StatusGone
+		}
+		writeError(w, code, err)
+		return
+	}
+	defer watcher.Close()
+	if websocket.IsWebSocketUpgrade(r) {
+		s.watchWebSocket(w, r, watcher)
+	} else {
+		s.watchEventStream(w, r, watcher)
+	}
+}
+
+// watchEventStream sends the events of a watcher as server-sent events until the client goes away
+// the stream ends if the client falls too far behind, browsers then reconnect with the Last-Event-ID header
+func (s *ServerResource) watchEventStream(w http.ResponseWriter, r *http.Request, watcher *apis.Watcher) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported by the server"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	metrics.KatlasNumReq2xx.Inc()
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			// comments keep proxies from closing idle streams
+			w.Write([]byte(": heartbeat\n\n"))
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// watchWebSocket sends the events of a watcher as WebSocket text messages until the client closes the connection
+func (s *ServerResource) watchWebSocket(w http.ResponseWriter, r *http.Request, watcher *apis.Watcher) {
+	ws, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied with the error
+		metrics.KatlasNumReqErr.Inc()
+		metrics.KatlasNumReqErr4xx.Inc()
+		log.Debug(err)
+		return
+	}
+	defer ws.Close()
+	metrics.KatlasNumReq2xx.Inc()
+
+	closed := make(chan struct{})
+	go func() {
+		// messages of the client are discarded, reading answers its pings and close frames
+		ws.SetReadLimit(wsMaxMessage)
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Debug(err)
+				}
+				break
+			}
+		}
+		close(closed)
+	}()
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			err = ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		case e, ok := <-watcher.Events:
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many pending events, watch again with since")
+				ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+				return
+			}
+			data, _ := json.Marshal(e)
+			ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = ws.WriteMessage(websocket.TextMessage, data)
+		}
+		if err != nil {
+			log.Debug(err)
+			return
+		}
+	}
+}
+
+// writeError writes an error response with the given status code
+func writeError(w http.ResponseWriter, code int, err error) {
+	metrics.KatlasNumReqErr.Inc()
+	if code >= http.StatusInternalServerError {
+		metrics.KatlasNumReqErr5xx.Inc()
+	} else {
+		metrics.KatlasNumReqErr4xx.Inc()
+	}
+	w.WriteHeader(code)
+	w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+}
+
+// responseBuffer keeps the response of a handler so it can be converted before being written
+type responseBuffer struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *responseBuffer) WriteHeader(code int) {
+	b.code = code
+}
+
+// writeFormatted runs a query handler and converts a successful json response to the format
+// negotiated from the Accept header, errors are always returned as json
+func writeFormatted(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	format := apis.NegotiateFormat(r.Header.Get("Accept"))
+	if format == "" {
+		handler(w, r)
+		return
+	}
+	writeConverted(w, r, handler, format+"; charset=utf-8", func(response map[string]interface{}) ([]byte, error) {
+		return apis.EncodeResponse(format, response)
+	})
+}
+
+// writeExported runs a handler and exports its objects as a graph when asked for with ?export= or the Accept header
+func (s ServerResource) writeExported(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) bool {
+	export, err := apis.NegotiateExport(r.URL.Query().Get("export"), r.Header.Get("Accept"))
+	if err != nil {
+		metrics.KatlasNumReqCount.Inc()
+		metrics.KatlasNumReqErr.Inc()
+		metrics.KatlasNumReqErr4xx.Inc()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		return true
+	}
+	if export == "" {
+		return false
+	}
+	writeConverted(w, r, handler, apis.ExportContentType(export), func(response map[string]interface{}) ([]byte, error) {
+		return s.GraphSvc.Export(export, response)
+	})
+	return true
+}
+
+// writeConverted runs a handler and writes its successful json response converted with convert,
+// anything else is written unchanged
+func writeConverted(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc, contentType string, convert func(map[string]interface{}) ([]byte, error)) {
+	buf := &responseBuffer{header: w.Header(), code: http.StatusOK}
+	handler(buf, r)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(buf.body.Bytes(), &response); err != nil || response["status"] != float64(http.StatusOK) {
+		w.WriteHeader(buf.code)
+		w.Write(buf.body.Bytes())
+		return
+	}
+	ret, err := convert(response)
+	if err != nil {
+		log.Errorf("failed to convert response to %s: %v", contentType, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(buf.code)
+	w.Write(ret)
+}
+
+// bulkOperation is an item of a bulk request, the object is a raw kubernetes object or a normalized entity
+type bulkOperation struct {
+	Op         string          `json:"op"`
+	ObjType    string          `json:"objtype"`
+	UID        string          `json:"uid"`
+	ResourceID string          `json:"resourceid"`
+	Object     json.RawMessage `json:"object"`
+}
+
+// EntityBulkHandlerV1_1 REST API to create, update and delete a list of entities in one request
+// e.g. [{"op": "create", "objtype": "pod", "object": {...}}, {"op": "update", "uid": "0x1", "object": {...}},
+// {"op": "delete", "objtype": "pod", "resourceid": "pod:cluster:ns:name"}]
+// every operation gets its own status with the uid or the error, in the order of the request
+func (s ServerResource) EntityBulkHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := r.Header.Get(util.ClusterName)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var items []bulkOperation
+	if err := json.Unmarshal(body, &items); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(items) == 0 || len(items) > apis.MaximumBulkOperations {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected 1 to %d operations, got %d", apis.MaximumBulkOperations, len(items)))
+		return
+	}
+
+	start := time.Now()
+	code := http.StatusOK
+	defer func() {
+		metrics.DgraphBulkEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
+	}()
+
+	objects := make([]map[string]interface{}, len(items))
+	ops := []apis.BulkOperation{}
+	indexes := []int{}
+	for i, item := range items {
+		objects[i] = map[string]interface{}{"index": i, "op": item.Op}
+		op, err := s.buildBulkOperation(clusterName, item)
+		if err != nil {
+			objects[i]["status"] = http.StatusBadRequest
+			objects[i]["error"] = trim(err.Error())
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+	for n, res := range s.EntitySvc.BulkEntities(ops) {
+		obj := objects[indexes[n]]
+		if res.Err != nil {
+			log.Error(res.Err)
+			obj["status"] = http.StatusInternalServerError
+			switch res.Err.(type) {
+			case *apis.EntityError:
+				obj["status"] = http.StatusBadRequest
+			case *db.NotFoundError:
+				obj["status"] = http.StatusNotFound
+			}
+			obj["error"] = trim(res.Err.Error())
+			continue
+		}
+		obj["status"] = http.StatusOK
+		if res.UID != "" {
+			obj[util.UID] = res.UID
+		}
+		if res.ObjType != "" {
+			obj[util.ObjType] = res.ObjType
+		}
+	}
+	msg := map[string]interface{}{
+		"status":  code,
+		"objects": objects,
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// buildBulkOperation checks an item of a bulk request and converts its object to entity data
+func (s ServerResource) buildBulkOperation(clusterName string, item bulkOperation) (apis.BulkOperation, error) {
+	op := apis.BulkOperation{Op: item.Op, ObjType: item.ObjType, UID: item.UID, ResourceID: item.ResourceID}
+	switch item.Op {
+	case apis.BulkCreate:
+		if item.ObjType == "" || len(item.Object) == 0 {
+			return op, fmt.Errorf("create needs objtype and object")
+		}
+		raw := map[string]json.RawMessage{}
+		if err := json.Unmarshal(item.Object, &raw); err != nil {
+			return op, err
+		}
+		if _, ok := raw[util.Metadata]; ok {
+			// raw kubernetes object, converted like the objects of the create api
+			payload, err := s.buildEntityData(clusterName, item.ObjType, item.Object, false)
+			if err != nil {
+				return op, err
+			}
+			op.Object = payload.(map[string]interface{})
+			return op, nil
+		}
+		op.Object = map[string]interface{}{}
+		if err := json.Unmarshal(item.Object, &op.Object); err != nil {
+			return op, err
+		}
+		if _, ok := op.Object[util.ObjType]; !ok {
+			op.Object[util.ObjType] = item.ObjType
+		}
+		if _, ok := op.Object[util.Cluster]; !ok && clusterName != "" {
+			op.Object[util.Cluster] = clusterName
+		}
+		if op.Object[util.Name] == nil && op.Object[util.ResourceID] == nil {
+			return op, fmt.Errorf("create needs an object with name or resourceid")
+		}
+	case apis.BulkUpdate:
+		if item.UID == "" || len(item.Object) == 0 {
+			return op, fmt.Errorf("update needs uid and object")
+		}
+		op.Object = map[string]interface{}{}
+		if err := json.Unmarshal(item.Object, &op.Object); err != nil {
+			return op, err
+		}
+	case apis.BulkDelete:
+		if item.UID == "" && (item.ObjType == "" || item.ResourceID == "") {
+			return op, fmt.Errorf("delete needs uid or objtype and resourceid")
+		}
+	default:
+		return op, fmt.Errorf("unknown operation %s, expected create, update or delete", item.Op)
+	}
+	return op, nil
 }
@@ -0,0 +1,42 @@
+package resources
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/intuit/katlas/service/cfg"
+)
+
+const (
+	// largest message accepted from clients, they are only expected to send control frames
+	wsMaxMessage   = 1 << 16
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsUpgrader upgrades watch requests to WebSockets
+var wsUpgrader = websocket.Upgrader{CheckOrigin: checkWebSocketOrigin}
+
+// checkWebSocketOrigin accepts clients which aren't browsers, pages served by the same host and the origins
+// given with the wsOrigins flag, so other sites can't open a watch with the credentials of the user
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range strings.Split(cfg.ServerCfg.WebSocketOrigins, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
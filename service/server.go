@@ -37,13 +37,27 @@ func Up(w http.ResponseWriter, r *http.Request) {
 func serve() {
 	router := mux.NewRouter()
 
-	dc := db.NewDGClient(cfg.ServerCfg.DgraphHost)
+	dc := db.NewClient(cfg.ServerCfg.StorageType, cfg.ServerCfg.DgraphHost)
 	defer dc.Close()
 	metaSvc := apis.NewMetaService(dc)
 	entitySvc := apis.NewEntityService(dc)
 	querySvc := apis.NewQueryService(dc)
 	qslSvc := apis.NewQSLService(dc)
-	res := resources.ServerResource{EntitySvc: entitySvc, QuerySvc: querySvc, MetaSvc: metaSvc, QSLSvc: qslSvc}
+	pathSvc := apis.NewPathService(dc)
+	graphSvc := apis.NewGraphService(dc)
+	savedQuerySvc := apis.NewSavedQueryService(dc)
+	graphQLSvc := apis.NewGraphQLService(dc)
+	watchSvc := apis.NewWatchService()
+	historySvc := apis.NewHistoryService(dc)
+	if cfg.ServerCfg.SoftDelete {
+		log.Infof("Soft delete enabled, tombstones are kept for %s", cfg.ServerCfg.TombstoneRetention)
+		go apis.NewTombstoneReaper(dc, cfg.ServerCfg.TombstoneRetention).Run(apis.ReapInterval, nil)
+	}
+	if err := graphQLSvc.Refresh(); err != nil {
+		log.Warnf("GraphQL schema will be generated on first use: %v", err)
+	}
+	res := resources.ServerResource{EntitySvc: entitySvc, QuerySvc: querySvc, MetaSvc: metaSvc, QSLSvc: qslSvc, PathSvc: pathSvc,
+		GraphSvc: graphSvc, SavedQuerySvc: savedQuerySvc, GraphQLSvc: graphQLSvc, WatchSvc: watchSvc, HistorySvc: historySvc}
 	// Entity APIs v1
 
 	router.HandleFunc("/v1/entity/{metadata}/{uid}", res.EntityGetHandler).Methods("GET")
@@ -64,12 +78,26 @@ func serve() {
 
 	// Entity APIs v1.1
 	router.HandleFunc("/v1.1/entity/{uid}", res.EntityGetHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/entity/{uid}/history", res.EntityHistoryHandlerV1_1).Methods("GET")
 	router.HandleFunc("/v1.1/entity", res.EntityCreateHandlerV1_1).Methods("POST")
 	router.HandleFunc("/v1.1/entity/{uid}", res.EntityUpdateHandlerV1_1).Methods("POST")
+	router.HandleFunc("/v1.1/entity", res.EntityPatchHandlerV1_1).Methods("PATCH")
 	router.HandleFunc("/v1.1/entity/{uid}", res.EntityDeleteHandlerV1_1).Methods("DELETE")
+	router.HandleFunc("/v1.1/entities/bulk", res.EntityBulkHandlerV1_1).Methods("POST")
 	router.HandleFunc("/v1.1/sync/{metadata}", res.EntitySyncHandlerV1_1).Methods("POST")
 	// Query APIs v1.1
 	router.HandleFunc("/v1.1/query", res.QueryHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/path", res.PathHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/watch", res.WatchHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/graphql/schema", res.GraphQLSchemaHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/graphql", res.GraphQLHandlerV1_1).Methods("GET", "POST")
+	router.HandleFunc("/v1.1/savedqueries", res.SavedQueryListHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/savedqueries", res.SavedQueryCreateHandlerV1_1).Methods("POST")
+	router.HandleFunc("/v1.1/savedqueries/{name}", res.SavedQueryGetHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/savedqueries/{name}", res.SavedQueryDeleteHandlerV1_1).Methods("DELETE")
+	router.HandleFunc("/v1.1/savedqueries/{name}/run", res.SavedQueryRunHandlerV1_1).Methods("GET")
+	// explain is registered first as the qsl route matches any path
+	router.HandleFunc("/v1.1/qsl/explain/{query:.*}", res.QSLExplainHandlerV1_1).Methods("GET")
 	// add .* to support url that contains special characters like pod[@name="abc/bcd"]{}
 	router.HandleFunc("/v1.1/qsl/{query:.*}", res.QSLHandlerV1_1).Methods("GET")
 	//Metadata v1.1
@@ -51,13 +51,37 @@ const (
 	FieldType         = "fieldtype"
 	Mandatory         = "mandatory"
 	Cardinality       = "cardinality"
+	JSONPath          = "jsonpath"
 	One               = "one"
 	Query             = "query"
 	StartTime         = "starttime"
 	Count             = "count"
+	Sum               = "sum"
+	Min               = "min"
+	Max               = "max"
+	Avg               = "avg"
+	GroupBy           = "groupby"
+	Len               = "len"
 	First             = "first"
 	Limit             = "limit"
 	Offset            = "offset"
+	After             = "after"
+	Cursor            = "cursor"
+	SavedQuery        = "savedquery"
+	Description       = "description"
+	ChangeLog         = "changelog"
+	EntityUID         = "entityuid"
+	EntityType        = "entitytype"
+	Change            = "change"
+	OldValue          = "oldvalue"
+	NewValue          = "newvalue"
+	Timestamp         = "timestamp"
+	SourceCluster     = "sourcecluster"
+	AsOf              = "asof"
+	DeletedAt         = "deletedat"
+	IncludeDeleted    = "includeDeleted"
+	OrderAsc          = "orderasc"
+	OrderDesc         = "orderdesc"
 	Print             = "print"
 	Asset             = "asset"
 	AssetID           = "iks.intuit.com/service-asset-id"
@@ -12,6 +12,8 @@ import (
 type OptionContext struct {
 	// is replace field when update
 	ReplaceListOrEdge bool
+	// is return the tombstone of a soft deleted entity when get
+	IncludeDeleted bool
 }
 
 // NewBackOff creates an instance of ExponentialBackOff using default values.
@@ -35,6 +37,7 @@ func RegisterHistogramMetrics() {
 	prometheus.MustRegister(metrics.DgraphUpdateEntityLatencyHistogram)
 	prometheus.MustRegister(metrics.DgraphDeleteEntityLatencyHistogram)
 	prometheus.MustRegister(metrics.DgraphGetEntityLatencyHistogram)
+	prometheus.MustRegister(metrics.DgraphBulkEntityLatencyHistogram)
 }
 
 //ReadCounter ...Extract float64 Value from the prometheus Counter metric